@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// cacheInfo is the output of cache-info
+type cacheInfo struct {
+	Dir     string `json:"dir"`
+	Entries int    `json:"entries"`
+	Bytes   int64  `json:"bytes"`
+	// IndexBytes is the size of the Packages indexes kept for package lookups and --pdiff
+	IndexBytes int64   `json:"index_bytes"`
+	Hits       int64   `json:"hits"`
+	Misses     int64   `json:"misses"`
+	HitRatio   float64 `json:"hit_ratio"`
+}
+
+func runCacheInfo(format string) error {
+	info, err := transports.CacheInfo()
+	if err != nil {
+		return fmt.Errorf("failed to inspect cache: %w", err)
+	}
+	result := cacheInfo{
+		Dir:      info.Dir,
+		Entries:  info.Entries,
+		Bytes:    info.Bytes,
+		Hits:     info.Hits,
+		Misses:   info.Misses,
+		HitRatio: info.HitRatio(),
+	}
+	for _, dir := range []string{indexCacheDir(), pdiffDir()} {
+		size, err := dirSize(dir)
+		if err != nil {
+			return fmt.Errorf("failed to inspect cache: %w", err)
+		}
+		result.IndexBytes += size
+	}
+
+	return outputCacheInfo(stdout, &result, format)
+}
+
+// dirSize adds up the sizes of the files below dir, which is empty if it doesn't exist
+func dirSize(dir string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return nil // removed since the directory was read
+			}
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+func outputCacheInfo(w io.Writer, info *cacheInfo, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(info)
+
+	case "jsonl":
+		return json.NewEncoder(w).Encode(info)
+
+	case "text":
+		fallthrough
+	default:
+		fmt.Fprintf(w, "Cache directory: %s\n", info.Dir)
+		fmt.Fprintf(w, "Entries: %d\n", info.Entries)
+		fmt.Fprintf(w, "Size: %d bytes (%.1f MB)\n", info.Bytes, megabytes(info.Bytes))
+		fmt.Fprintf(w, "Package indexes: %d bytes (%.1f MB)\n", info.IndexBytes, megabytes(info.IndexBytes))
+		if info.Hits+info.Misses == 0 {
+			fmt.Fprintf(w, "Hit ratio: no requests recorded yet\n")
+		} else {
+			fmt.Fprintf(w, "Hit ratio: %.1f%% (%d hits, %d misses)\n", info.HitRatio*100, info.Hits, info.Misses)
+		}
+		return nil
+	}
+}
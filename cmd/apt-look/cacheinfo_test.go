@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheInfo(t *testing.T) {
+	repo := t.TempDir()
+	writeMirrorRepo(t, repo)
+	source := "deb file://" + repo + " stable main"
+	cacheDir := t.TempDir()
+
+	cacheInfoJSON := func() cacheInfo {
+		var info cacheInfo
+		require.NoError(t, json.Unmarshal([]byte(runCommand(t, "cache-info", "--cache-dir", cacheDir, "--format", "json")), &info))
+		return info
+	}
+	assert.Equal(t, cacheInfo{Dir: cacheDir}, cacheInfoJSON())
+	assert.Contains(t, runCommand(t, "cache-info", "--cache-dir", cacheDir), "Hit ratio: no requests recorded yet\n")
+
+	// the counts are saved when the transports are closed at the end of each run
+	for range 2 {
+		runCommand(t, "list", source, "--cache-dir", cacheDir, "--arch", "amd64", "--index-cache")
+		require.NoError(t, transports.Close())
+	}
+	info := cacheInfoJSON()
+	// the index and the copy of the Release file kept for offline use
+	assert.Equal(t, 2, info.Entries)
+	assert.Positive(t, info.Bytes)
+	assert.Positive(t, info.IndexBytes)
+	assert.Equal(t, int64(1), info.Hits)
+	assert.Equal(t, int64(1), info.Misses)
+	assert.Equal(t, 0.5, info.HitRatio)
+	assert.Contains(t, runCommand(t, "cache-info", "--cache-dir", cacheDir), "Hit ratio: 50.0% (1 hits, 1 misses)\n")
+
+	runCommand(t, "purge-cache", "--cache-dir", cacheDir)
+	assert.Equal(t, cacheInfo{Dir: cacheDir}, cacheInfoJSON())
+}
+
+func TestPurgeCacheSource(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	writeMirrorRepo(t, first)
+	writeMirrorRepo(t, second)
+	cacheDir := t.TempDir()
+	entries := func() int {
+		var info cacheInfo
+		require.NoError(t, json.Unmarshal([]byte(runCommand(t, "cache-info", "--cache-dir", cacheDir, "--format", "json")), &info))
+		return info.Entries
+	}
+
+	copies := func() int {
+		files, err := os.ReadDir(filepath.Join(cacheDir, "index"))
+		require.NoError(t, err)
+		return len(files)
+	}
+
+	for _, repo := range []string{first, second} {
+		runCommand(t, "list", "deb file://"+repo+" stable main", "--cache-dir", cacheDir, "--arch", "amd64", "--arch", "arm64", "--index-cache")
+	}
+	// two indexes and a Release file for each, and the copies of the indexes with their names
+	require.Equal(t, 6, entries())
+	require.Equal(t, 8, copies())
+
+	// only the files of the given repository are removed, whatever architectures were fetched
+	output := runCommand(t, "purge-cache", "deb file://"+first+" stable main", "--cache-dir", cacheDir, "--arch", "amd64")
+	assert.Equal(t, "Removed 2 cache entries\nRemoved 2 kept Packages indexes\n", output)
+	assert.Equal(t, 3, entries())
+	assert.Equal(t, 4, copies())
+
+	output = runCommand(t, "purge-cache", "deb file://"+first+" stable main", "--cache-dir", cacheDir)
+	assert.Equal(t, "Removed 0 cache entries\n", output)
+	assert.Equal(t, 3, entries())
+	assert.Equal(t, 4, copies())
+}
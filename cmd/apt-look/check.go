@@ -3,10 +3,11 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
-	"os"
 	"strings"
 	"time"
 
@@ -36,11 +37,13 @@ type CheckResult struct {
 		MissingFiles    int `json:"missing_files"`
 		NetworkErrors   int `json:"network_errors"`
 		IntegrityIssues int `json:"integrity_issues"`
+		HashMismatches  int `json:"hash_mismatches"`
 	} `json:"summary"`
 
 	MissingFiles    []FileCheckResult `json:"missing_files,omitempty"`
 	NetworkErrors   []FileCheckResult `json:"network_errors,omitempty"`
 	IntegrityIssues []FileCheckResult `json:"integrity_issues,omitempty"`
+	HashMismatches  []FileCheckResult `json:"hash_mismatches,omitempty"`
 }
 
 // FileCheckResult represents the result of checking a single file
@@ -51,34 +54,32 @@ type FileCheckResult struct {
 	Error       string `json:"error,omitempty"`
 	ActualSize  int64  `json:"actual_size,omitempty"`
 	SizeMatches bool   `json:"size_matches,omitempty"`
+	// HashMismatch is only ever set when the content was hashed, with --verify-hashes
+	HashMismatch bool `json:"hash_mismatch,omitempty"`
 }
 
-func runCheck(sourceStr, format string) error {
+func runCheck(ctx context.Context, sourceStr, format string, verifyHashes bool) error {
 	// Parse source
-	sources, err := parseSourceInput(sourceStr)
+	sources, err := parseSourceInput(ctx, sourceStr)
 	if err != nil {
 		return fmt.Errorf("failed to parse sources: %w", err)
 	}
 
-	if len(sources) == 0 {
-		return fmt.Errorf("no sources provided")
-	}
 	// Use the first source when multiple are discovered
-	source := sources[0]
-	if len(sources) > 1 {
-		log.Info().Msgf("Multiple sources discovered, using: %s %s %v",
-			source.Type, source.ArchiveRoot.String(), source.Components)
+	repo, source, err := mountFirstSource(ctx, sources)
+	if err != nil {
+		return err
 	}
 	//log.Info().Msgf("Checking repository integrity: %v", source)
 
 	// Perform the integrity check
-	result, err := performIntegrityCheck(source)
+	result, err := performIntegrityCheck(ctx, repo, source, verifyHashes)
 	if err != nil {
 		return fmt.Errorf("failed to perform integrity check: %w", err)
 	}
 
 	// Format and output results
-	err = outputCheckResults(result, format)
+	err = outputCheckResults(stdout, result, format)
 	if err != nil {
 		return err
 	}
@@ -97,14 +98,9 @@ func runCheck(sourceStr, format string) error {
 	return nil
 }
 
-func performIntegrityCheck(source sources.Entry) (*CheckResult, error) {
+func performIntegrityCheck(ctx context.Context, repo *apt.Repository, source sources.Entry, verifyHashes bool) (*CheckResult, error) {
 	result := &CheckResult{}
 
-	repo, err := apt.Mount(source, buildMountOptions()...)
-	if err != nil {
-		return nil, fmt.Errorf("failed to mount repository: %w", err)
-	}
-
 	// Release file is already fetched during mount
 	release := repo.Release()
 
@@ -125,12 +121,15 @@ func performIntegrityCheck(source sources.Entry) (*CheckResult, error) {
 
 	// Check each file
 	for _, fileInfo := range allFiles {
-		checkResult := checkFile(repo.Transport(), result.Repository.BaseURL, fileInfo)
+		checkResult := checkFile(ctx, repo.Transport(), result.Repository.BaseURL, fileInfo, verifyHashes)
 
 		switch {
 		case checkResult.StatusCode == http.StatusNotFound:
 			result.MissingFiles = append(result.MissingFiles, checkResult)
 			result.Summary.MissingFiles++
+		case checkResult.HashMismatch:
+			result.HashMismatches = append(result.HashMismatches, checkResult)
+			result.Summary.HashMismatches++
 		case checkResult.Error != "":
 			result.NetworkErrors = append(result.NetworkErrors, checkResult)
 			result.Summary.NetworkErrors++
@@ -145,7 +144,9 @@ func performIntegrityCheck(source sources.Entry) (*CheckResult, error) {
 	return result, nil
 }
 
-func checkFile(tpt apttransport2.Transport, baseURL string, fileInfo deb822.FileInfo) FileCheckResult {
+// checkFile fetches a file listed in the Release file and compares it with the recorded size.
+// With verifyHashes the whole body is also hashed and compared with the strongest recorded hash.
+func checkFile(ctx context.Context, tpt apttransport2.Transport, baseURL string, fileInfo deb822.FileInfo, verifyHashes bool) FileCheckResult {
 	checkResult := FileCheckResult{
 		FileInfo: fileInfo,
 		URL:      baseURL + "/" + fileInfo.Path,
@@ -157,24 +158,43 @@ func checkFile(tpt apttransport2.Transport, baseURL string, fileInfo deb822.File
 		return checkResult
 	}
 
+	// Without hash verification the content isn't needed, so ask for the size alone
+	if headTransport, ok := tpt.(apttransport2.HeadTransport); ok && !verifyHashes {
+		resp, err := headTransport.Head(ctx, parsedURL)
+		if !errors.Is(err, apttransport2.ErrHeadNotSupported) {
+			if err != nil {
+				recordAcquireError(&checkResult, err)
+				return checkResult
+			}
+			checkResult.StatusCode = http.StatusOK
+			checkResult.ActualSize = resp.Size
+			checkResult.SizeMatches = checkResult.ActualSize == fileInfo.Size
+			return checkResult
+		}
+	}
+
 	// Use GET request to check existence and get size
-	ctx := context.Background()
-	req := &apttransport2.AcquireRequest{
-		URI:     parsedURL,
-		Timeout: 10 * time.Second,
+	req := &apttransport2.AcquireRequest{URI: parsedURL}
+	if verifyHashes {
+		req.ExpectedHashes = strongestHash(fileInfo)
 	}
 
 	resp, err := tpt.Acquire(ctx, req)
+	if err == nil {
+		// the transport verifies the hash when the content has been read to the end
+		_, err = io.Copy(io.Discard, resp.Content)
+		resp.Content.Close()
+	}
+	if errors.Is(err, apttransport2.ErrHashMismatch) {
+		checkResult.StatusCode = http.StatusOK
+		checkResult.HashMismatch = true
+		checkResult.Error = err.Error()
+		return checkResult
+	}
 	if err != nil {
-		// Try to extract status code from HTTP errors
-		if strings.Contains(err.Error(), "HTTP 404") {
-			checkResult.StatusCode = http.StatusNotFound
-		} else {
-			checkResult.Error = err.Error()
-		}
+		recordAcquireError(&checkResult, err)
 		return checkResult
 	}
-	defer resp.Content.Close()
 
 	checkResult.StatusCode = http.StatusOK
 	checkResult.ActualSize = resp.Size
@@ -183,96 +203,128 @@ func checkFile(tpt apttransport2.Transport, baseURL string, fileInfo deb822.File
 	return checkResult
 }
 
-func outputCheckResults(result *CheckResult, format string) error {
+// recordAcquireError classifies a failed fetch as missing or as an error
+func recordAcquireError(checkResult *FileCheckResult, err error) {
+	// a missing file is reported as a 404 whatever the transport
+	if apttransport2.IsNotFound(err) {
+		checkResult.StatusCode = http.StatusNotFound
+	} else {
+		checkResult.Error = err.Error()
+	}
+}
+
+// strongestHash picks the strongest hash the Release file records for a file, for use as ExpectedHashes
+func strongestHash(fileInfo deb822.FileInfo) map[string]string {
+	algo, hash := fileInfo.BestHash()
+	if algo == "" {
+		return nil
+	}
+	return map[string]string{algo: hash}
+}
+
+func outputCheckResults(w io.Writer, result *CheckResult, format string) error {
 	switch format {
 	case "json":
-		encoder := json.NewEncoder(os.Stdout)
+		encoder := json.NewEncoder(w)
 		encoder.SetIndent("", "  ")
 		return encoder.Encode(result)
 
+	case "jsonl":
+		return json.NewEncoder(w).Encode(result)
+
 	case "tsv":
-		return outputCheckResultsTSV(result)
+		return outputCheckResultsTSV(w, result)
 
 	case "text":
 		fallthrough
 	default:
-		return outputCheckResultsText(result)
+		return outputCheckResultsText(w, result)
 	}
 }
 
-func outputCheckResultsText(result *CheckResult) error {
-	fmt.Printf("Repository Integrity Check\n")
-	fmt.Printf("=========================\n\n")
+func outputCheckResultsText(w io.Writer, result *CheckResult) error {
+	fmt.Fprintf(w, "Repository Integrity Check\n")
+	fmt.Fprintf(w, "=========================\n\n")
 
 	// Repository information
-	fmt.Printf("Repository Information:\n")
+	fmt.Fprintf(w, "Repository Information:\n")
 	if result.Repository.Origin != "" {
-		fmt.Printf("  Origin: %s\n", result.Repository.Origin)
+		fmt.Fprintf(w, "  Origin: %s\n", result.Repository.Origin)
 	}
 	if result.Repository.Label != "" {
-		fmt.Printf("  Label: %s\n", result.Repository.Label)
+		fmt.Fprintf(w, "  Label: %s\n", result.Repository.Label)
 	}
 	if result.Repository.Suite != "" {
-		fmt.Printf("  Suite: %s\n", result.Repository.Suite)
+		fmt.Fprintf(w, "  Suite: %s\n", result.Repository.Suite)
 	}
 	if result.Repository.Codename != "" {
-		fmt.Printf("  Codename: %s\n", result.Repository.Codename)
+		fmt.Fprintf(w, "  Codename: %s\n", result.Repository.Codename)
 	}
-	fmt.Printf("  Date: %s\n", result.Repository.Date.Format("2006-01-02 15:04:05 MST"))
-	fmt.Printf("  Base URL: %s\n", result.Repository.BaseURL)
-	fmt.Printf("  Components: %s\n", strings.Join(result.Repository.Components, ", "))
+	fmt.Fprintf(w, "  Date: %s\n", result.Repository.Date.Format("2006-01-02 15:04:05 MST"))
+	fmt.Fprintf(w, "  Base URL: %s\n", result.Repository.BaseURL)
+	fmt.Fprintf(w, "  Components: %s\n", strings.Join(result.Repository.Components, ", "))
 
 	// Summary
-	fmt.Printf("\nIntegrity Summary:\n")
-	fmt.Printf("  Total indexes: %d\n", result.Summary.TotalFiles)
-	fmt.Printf("  Existing indexes: %d\n", result.Summary.ExistingFiles)
-	fmt.Printf("  Missing indexes: %d\n", result.Summary.MissingFiles)
-	fmt.Printf("  Network Errors: %d\n", result.Summary.NetworkErrors)
-	fmt.Printf("  Integrity Issues: %d\n", result.Summary.IntegrityIssues)
+	fmt.Fprintf(w, "\nIntegrity Summary:\n")
+	fmt.Fprintf(w, "  Total indexes: %d\n", result.Summary.TotalFiles)
+	fmt.Fprintf(w, "  Existing indexes: %d\n", result.Summary.ExistingFiles)
+	fmt.Fprintf(w, "  Missing indexes: %d\n", result.Summary.MissingFiles)
+	fmt.Fprintf(w, "  Network Errors: %d\n", result.Summary.NetworkErrors)
+	fmt.Fprintf(w, "  Integrity Issues: %d\n", result.Summary.IntegrityIssues)
+	fmt.Fprintf(w, "  Hash Mismatches: %d\n", result.Summary.HashMismatches)
 
 	// Missing files
 	if len(result.MissingFiles) > 0 {
-		fmt.Printf("\nMissing indexes:\n")
+		fmt.Fprintf(w, "\nMissing indexes:\n")
 		for _, file := range result.MissingFiles {
-			fmt.Printf("  - %s (type: %s, component: %s, arch: %s)\n",
+			fmt.Fprintf(w, "  - %s (type: %s, component: %s, arch: %s)\n",
 				file.Path, file.Type, file.Component, file.Architecture)
 		}
 	}
 
 	// Network errors
 	if len(result.NetworkErrors) > 0 {
-		fmt.Printf("\nNetwork Errors:\n")
+		fmt.Fprintf(w, "\nNetwork Errors:\n")
 		for _, file := range result.NetworkErrors {
-			fmt.Printf("  - %s: %s\n", file.Path, file.Error)
+			fmt.Fprintf(w, "  - %s: %s\n", file.Path, file.Error)
 		}
 	}
 
 	// Integrity issues
 	if len(result.IntegrityIssues) > 0 {
-		fmt.Printf("\nIntegrity Issues:\n")
+		fmt.Fprintf(w, "\nIntegrity Issues:\n")
 		for _, file := range result.IntegrityIssues {
-			fmt.Printf("  - %s: size mismatch (expected: %d, actual: %d)\n",
+			fmt.Fprintf(w, "  - %s: size mismatch (expected: %d, actual: %d)\n",
 				file.Path, file.Size, file.ActualSize)
 		}
 	}
 
+	// Hash mismatches
+	if len(result.HashMismatches) > 0 {
+		fmt.Fprintf(w, "\nHash Mismatches:\n")
+		for _, file := range result.HashMismatches {
+			fmt.Fprintf(w, "  - %s: %s\n", file.Path, file.Error)
+		}
+	}
+
 	return nil
 }
 
-func outputCheckResultsTSV(result *CheckResult) error {
-	fmt.Printf("field\tvalue\n")
-	fmt.Printf("origin\t%s\n", result.Repository.Origin)
-	fmt.Printf("label\t%s\n", result.Repository.Label)
-	fmt.Printf("suite\t%s\n", result.Repository.Suite)
-	fmt.Printf("codename\t%s\n", result.Repository.Codename)
-	fmt.Printf("date\t%s\n", result.Repository.Date.Format("2006-01-02T15:04:05Z07:00"))
-	fmt.Printf("base_url\t%s\n", result.Repository.BaseURL)
-	fmt.Printf("components\t%s\n", strings.Join(result.Repository.Components, ","))
-	fmt.Printf("total_files\t%d\n", result.Summary.TotalFiles)
-	fmt.Printf("existing_files\t%d\n", result.Summary.ExistingFiles)
-	fmt.Printf("missing_files\t%d\n", result.Summary.MissingFiles)
-	fmt.Printf("network_errors\t%d\n", result.Summary.NetworkErrors)
-	fmt.Printf("integrity_issues\t%d\n", result.Summary.IntegrityIssues)
+func outputCheckResultsTSV(w io.Writer, result *CheckResult) error {
+	fmt.Fprintf(w, "field\tvalue\n")
+	fmt.Fprintf(w, "origin\t%s\n", result.Repository.Origin)
+	fmt.Fprintf(w, "label\t%s\n", result.Repository.Label)
+	fmt.Fprintf(w, "suite\t%s\n", result.Repository.Suite)
+	fmt.Fprintf(w, "codename\t%s\n", result.Repository.Codename)
+	fmt.Fprintf(w, "date\t%s\n", result.Repository.Date.Format("2006-01-02T15:04:05Z07:00"))
+	fmt.Fprintf(w, "base_url\t%s\n", result.Repository.BaseURL)
+	fmt.Fprintf(w, "components\t%s\n", strings.Join(result.Repository.Components, ","))
+	fmt.Fprintf(w, "total_files\t%d\n", result.Summary.TotalFiles)
+	fmt.Fprintf(w, "existing_files\t%d\n", result.Summary.ExistingFiles)
+	fmt.Fprintf(w, "missing_files\t%d\n", result.Summary.MissingFiles)
+	fmt.Fprintf(w, "network_errors\t%d\n", result.Summary.NetworkErrors)
+	fmt.Fprintf(w, "integrity_issues\t%d\n", result.Summary.IntegrityIssues)
+	fmt.Fprintf(w, "hash_mismatches\t%d\n", result.Summary.HashMismatches)
 
 	return nil
 }
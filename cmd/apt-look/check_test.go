@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	apttransport2 "github.com/nicwaller/apt-look/pkg/apt/apttransport"
+	"github.com/nicwaller/apt-look/pkg/deb822"
+)
+
+// acquireCounter records Acquire calls and hides the wrapped transport's Head method
+type acquireCounter struct {
+	apttransport2.Transport
+	acquired int
+}
+
+func (c *acquireCounter) Acquire(ctx context.Context, req *apttransport2.AcquireRequest) (*apttransport2.AcquireResponse, error) {
+	c.acquired++
+	return c.Transport.Acquire(ctx, req)
+}
+
+func TestCheckFile_HeadWithGetFallback(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Packages"), []byte("Package: alpha\n"), 0644))
+	baseURL := "file://" + dir
+	fileInfo := deb822.FileInfo{Path: "Packages", Size: 15}
+
+	registry := apttransport2.NewRegistryWithCache(apttransport2.CacheConfig{Disabled: true})
+	counter := &acquireCounter{Transport: apttransport2.NewFileTransport()}
+	registry.Register(counter)
+
+	// the registry finds no Head on the wrapper, so check falls back to GET
+	result := checkFile(context.Background(), registry, baseURL, fileInfo, false)
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.True(t, result.SizeMatches)
+	assert.Equal(t, 1, counter.acquired)
+
+	registry = apttransport2.NewRegistryWithCache(apttransport2.CacheConfig{Disabled: true})
+	registry.Register(apttransport2.NewFileTransport())
+	result = checkFile(context.Background(), registry, baseURL, fileInfo, false)
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Equal(t, int64(15), result.ActualSize)
+	assert.True(t, result.SizeMatches)
+
+	// a missing local file counts as missing, like a 404 from a server, rather than as an error
+	result = checkFile(context.Background(), registry, baseURL, deb822.FileInfo{Path: "missing"}, false)
+	assert.Equal(t, http.StatusNotFound, result.StatusCode)
+	assert.Empty(t, result.Error)
+	result = checkFile(context.Background(), registry, baseURL, deb822.FileInfo{Path: "missing"}, true)
+	assert.Equal(t, http.StatusNotFound, result.StatusCode)
+	assert.Empty(t, result.Error)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/nicwaller/apt-look/pkg/apt"
+)
+
+// maxPackageCompletions bounds how many package names are offered, so completing an empty
+// prefix against a large archive stays quick
+const maxPackageCompletions = 1000
+
+// registerCompletions adds completion of flag values and arguments to the commands.
+// Cobra's completion command generates the bash, zsh, fish and powershell scripts that use them.
+func registerCompletions() {
+	_ = rootCmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions(validFormats, cobra.ShellCompDirectiveNoFileComp))
+	for _, cmd := range []*cobra.Command{listCmd, latestCmd} {
+		_ = cmd.RegisterFlagCompletionFunc("priority", cobra.FixedCompletions(validPriorities, cobra.ShellCompDirectiveNoFileComp))
+	}
+
+	for _, cmd := range []*cobra.Command{listCmd, statsCmd, latestCmd, checkCmd, purgeCacheCmd} {
+		cmd.ValidArgsFunction = completeArgs(completeSource)
+	}
+	for _, cmd := range []*cobra.Command{infoCmd, downloadCmd, verifyCmd, graphCmd, rdependsCmd} {
+		cmd.ValidArgsFunction = completeArgs(completeSource, completePackageName)
+	}
+	searchCmd.ValidArgsFunction = completeArgs(completeSource, cobra.NoFileCompletions)
+	findFileCmd.ValidArgsFunction = completeArgs(completeSource, cobra.NoFileCompletions)
+	diffCmd.ValidArgsFunction = completeArgs(completeSource, completeSource)
+	mirrorCmd.ValidArgsFunction = completeArgs(completeSource, completeDirectory)
+}
+
+// completeArgs completes each argument with the function for its position, and nothing past them
+func completeArgs(fns ...cobra.CompletionFunc) cobra.CompletionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+		if len(args) >= len(fns) {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return fns[len(args)](cmd, args, toComplete)
+	}
+}
+
+// completeSource completes a source argument with file paths, for sources.list files and directories
+func completeSource(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	return nil, cobra.ShellCompDirectiveDefault
+}
+
+func completeDirectory(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	return nil, cobra.ShellCompDirectiveFilterDirs
+}
+
+// completePackageName completes a package name argument from the Packages indexes of the source in
+// the first argument that are in the cache. Nothing is fetched: sources that need discovery, like a
+// bare URL, and repositories that haven't been cached offer no names.
+func completePackageName(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	// the root's pre-run is skipped when completing, so the environment's defaults are applied here
+	if err := applyEnvFlags(cmd.Flags()); err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	if len(args) == 0 || options.noCache || args[0] == "-" {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	if isRepositoryURL(args[0]) {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	entries, err := parseSourceInput(cmd.Context(), args[0])
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	// for the same reason, the registry is made for the flags here
+	registry := loadTransports()
+	defer registry.Close()
+
+	seen := make(map[string]bool)
+	var names []cobra.Completion
+	for _, entry := range entries {
+		for pkg := range apt.UnverifiedPackages(cmd.Context(), registry.Offline(), entry, options.arch) {
+			if seen[pkg.Package] || !strings.HasPrefix(pkg.Package, toComplete) {
+				continue
+			}
+			seen[pkg.Package] = true
+			names = append(names, pkg.Package)
+			if len(names) >= maxPackageCompletions {
+				return names, cobra.ShellCompDirectiveNoFileComp
+			}
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// completions returns the suggestions of a __complete request, without the directive line
+func completions(t *testing.T, args ...string) []string {
+	t.Helper()
+	output := runCommand(t, append([]string{"__complete"}, args...)...)
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if !strings.HasPrefix(line, ":") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func TestCompletion_Format(t *testing.T) {
+	assert.Equal(t, validFormats, completions(t, "list", "--format", ""))
+	assert.Equal(t, validPriorities, completions(t, "latest", "--priority", ""))
+}
+
+func TestCompletion_PackageNames(t *testing.T) {
+	repo := t.TempDir()
+	writeMirrorRepo(t, repo)
+	source := "deb file://" + repo + " stable main"
+	cacheDir := t.TempDir()
+
+	// nothing is fetched, so there are no names until the indexes are cached
+	assert.Empty(t, completions(t, "info", "--arch", "amd64,arm64", "--cache-dir", cacheDir, source, ""))
+
+	runCommand(t, "list", source, "--arch", "amd64,arm64", "--cache-dir", cacheDir)
+	assert.Equal(t, []string{"alpha", "beta"}, completions(t, "info", "--arch", "amd64,arm64", "--cache-dir", cacheDir, source, ""))
+	assert.Equal(t, []string{"beta"}, completions(t, "download", "--arch", "amd64,arm64", "--cache-dir", cacheDir, source, "b"))
+	assert.Equal(t, []string{"alpha"}, completions(t, "info", "--arch", "amd64", "--cache-dir", cacheDir, source, ""))
+
+	// only the package argument is completed from the indexes
+	assert.Empty(t, completions(t, "info", "--cache-dir", cacheDir, source, "alpha", ""))
+	assert.Empty(t, completions(t, "info", "--no-cache", source, ""))
+}
+
+func TestCompletion_PackageNamesFromEnvironment(t *testing.T) {
+	repo := t.TempDir()
+	writeMirrorRepo(t, repo)
+	source := "deb file://" + repo + " stable main"
+	cacheDir := t.TempDir()
+	runCommand(t, "list", source, "--arch", "amd64,arm64", "--cache-dir", cacheDir)
+
+	// the cache directory comes from APT_LOOK_CACHE_DIR, as it would for the command itself
+	t.Setenv("APT_LOOK_CACHE_DIR", cacheDir)
+	assert.Equal(t, []string{"alpha", "beta"}, completions(t, "info", "--arch", "amd64,arm64", source, ""))
+	t.Setenv("APT_LOOK_NO_CACHE", "true")
+	assert.Empty(t, completions(t, "info", "--arch", "amd64,arm64", source, ""))
+
+	// a bad value only matters to the completions that read it
+	t.Setenv("APT_LOOK_TIMEOUT", "soon")
+	assert.Equal(t, validFormats, completions(t, "list", "--format", ""))
+}
+
+func TestCompletion_PackageNamesByHash(t *testing.T) {
+	// the indexes are only published by hash, which is found in the cached Release file
+	repo := t.TempDir()
+	writeRepoLayout(t, repo, "dists/stable", []string{"main/binary-amd64", "main/binary-arm64"}, true)
+	source := "deb file://" + repo + " stable main"
+	cacheDir := t.TempDir()
+
+	runCommand(t, "list", source, "--arch", "amd64,arm64", "--cache-dir", cacheDir)
+	assert.Equal(t, []string{"alpha", "beta"}, completions(t, "info", "--arch", "amd64,arm64", "--cache-dir", cacheDir, source, ""))
+}
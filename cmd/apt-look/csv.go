@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// csvOutput writes CSV rows, repeating the header row only when the columns change
+var csvOutput struct {
+	out    io.Writer
+	w      *csv.Writer
+	header []string
+}
+
+// packageCSVHeader lists the columns written for binary packages
+var packageCSVHeader = []string{"package", "version", "architecture", "section", "description"}
+
+// writeCSVRow writes one record to w, preceded by the header row the first time these columns are used.
+// Each row is flushed immediately so CSV output interleaves correctly with other output.
+func writeCSVRow(w io.Writer, header, record []string) error {
+	if csvOutput.out != w {
+		csvOutput.out, csvOutput.w, csvOutput.header = w, csv.NewWriter(w), nil
+	}
+	if !slices.Equal(csvOutput.header, header) {
+		if err := csvOutput.w.Write(header); err != nil {
+			return fmt.Errorf("failed to write CSV header: %w", err)
+		}
+		csvOutput.header = header
+	}
+	if err := csvOutput.w.Write(record); err != nil {
+		return fmt.Errorf("failed to write CSV row: %w", err)
+	}
+	csvOutput.w.Flush()
+	return csvOutput.w.Error()
+}
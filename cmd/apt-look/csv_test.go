@@ -0,0 +1,19 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteCSVRow_Quoting(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeCSVRow(&buf, packageCSVHeader, []string{"alpha", "1.0", "amd64", "utils", `say "hi", then	leave`}))
+	require.NoError(t, writeCSVRow(&buf, packageCSVHeader, []string{"bravo", "2.0", "all", "doc", "plain"}))
+
+	assert.Equal(t, "package,version,architecture,section,description\n"+
+		"alpha,1.0,amd64,utils,\"say \"\"hi\"\", then\tleave\"\n"+
+		"bravo,2.0,all,doc,plain\n", buf.String())
+}
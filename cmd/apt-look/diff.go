@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/nicwaller/apt-look/pkg/apt"
+	"github.com/nicwaller/apt-look/pkg/deb822"
+)
+
+// PackageDiff describes how one (name, architecture) pair differs between two repositories
+type PackageDiff struct {
+	Package      string `json:"package"`
+	Architecture string `json:"architecture"`
+	// Change is one of "added", "removed", "upgraded" or "downgraded"
+	Change     string `json:"change"`
+	OldVersion string `json:"old_version,omitempty"`
+	NewVersion string `json:"new_version,omitempty"`
+}
+
+// runDiff reports the packages added, removed and changed in version going from sourceA to sourceB
+func runDiff(ctx context.Context, sourceA, sourceB, format string) error {
+	log.Info().Msgf("Comparing %s with %s", sourceA, sourceB)
+
+	oldVersions, err := collectLatestVersions(ctx, sourceA)
+	if err != nil {
+		return err
+	}
+	newVersions, err := collectLatestVersions(ctx, sourceB)
+	if err != nil {
+		return err
+	}
+
+	diffs := diffVersions(oldVersions, newVersions)
+	log.Info().Msgf("Found %d differences between %d and %d packages", len(diffs), len(oldVersions), len(newVersions))
+	return outputPackageDiffs(stdout, diffs, format)
+}
+
+// collectLatestVersions maps each (name, architecture) pair in a source to its highest version
+func collectLatestVersions(ctx context.Context, source string) (map[PackageKey]string, error) {
+	sourceList, err := parseSourceInput(ctx, source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse source input: %w", err)
+	}
+
+	versions := make(map[PackageKey]string)
+	failures := newSourceFailures(sourceList)
+	for _, src := range sourceList {
+		repo, err := apt.MountContext(ctx, src, buildMountOptions()...)
+		if err != nil {
+			if err := failures.skip(src, fmt.Errorf("failed to mount repository: %w", err)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		for pkg, err := range repo.Packages(ctx) {
+			if err != nil {
+				return nil, fmt.Errorf("failed to list packages: %w", err)
+			}
+			if !matchesArchFilter(pkg) {
+				continue
+			}
+			key := PackageKey{Name: pkg.Package, Architecture: pkg.Architecture}
+			if existing, ok := versions[key]; !ok || isNewerVersion(pkg.Version, existing) {
+				versions[key] = pkg.Version
+			}
+		}
+	}
+	if err := failures.done(); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// diffVersions compares two version maps, ordered by package name and then architecture
+func diffVersions(oldVersions, newVersions map[PackageKey]string) []PackageDiff {
+	keys := slices.Collect(maps.Keys(oldVersions))
+	for key := range newVersions {
+		if _, ok := oldVersions[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.SortFunc(keys, func(a, b PackageKey) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Architecture, b.Architecture)
+	})
+
+	var diffs []PackageDiff
+	for _, key := range keys {
+		oldVersion, inOld := oldVersions[key]
+		newVersion, inNew := newVersions[key]
+		diff := PackageDiff{
+			Package:      key.Name,
+			Architecture: key.Architecture,
+			OldVersion:   oldVersion,
+			NewVersion:   newVersion,
+		}
+		switch {
+		case !inOld:
+			diff.Change = "added"
+		case !inNew:
+			diff.Change = "removed"
+		default:
+			c := deb822.CompareVersions(newVersion, oldVersion)
+			if c == 0 {
+				continue
+			}
+			diff.Change = "upgraded"
+			if c < 0 {
+				diff.Change = "downgraded"
+			}
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs
+}
+
+// outputPackageDiffs outputs package differences in the specified format
+func outputPackageDiffs(w io.Writer, diffs []PackageDiff, format string) error {
+	switch format {
+	case "text":
+		for _, diff := range diffs {
+			switch diff.Change {
+			case "added":
+				fmt.Fprintf(w, "+ %s:%s %s\n", diff.Package, diff.Architecture, diff.NewVersion)
+			case "removed":
+				fmt.Fprintf(w, "- %s:%s %s\n", diff.Package, diff.Architecture, diff.OldVersion)
+			default:
+				fmt.Fprintf(w, "~ %s:%s %s -> %s (%s)\n", diff.Package, diff.Architecture, diff.OldVersion, diff.NewVersion, diff.Change)
+			}
+		}
+	case "json", "jsonl":
+		for _, diff := range diffs {
+			data, err := json.Marshal(diff)
+			if err != nil {
+				return fmt.Errorf("failed to marshal package difference to JSON: %w", err)
+			}
+			fmt.Fprintf(w, "%s\n", string(data))
+		}
+	case "tsv":
+		// TSV format: Package\tArchitecture\tChange\tOldVersion\tNewVersion
+		for _, diff := range diffs {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", diff.Package, diff.Architecture, diff.Change, diff.OldVersion, diff.NewVersion)
+		}
+	case "csv":
+		for _, diff := range diffs {
+			if err := writeCSVRow(w, []string{"package", "architecture", "change", "old_version", "new_version"},
+				[]string{diff.Package, diff.Architecture, diff.Change, diff.OldVersion, diff.NewVersion}); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffVersions(t *testing.T) {
+	oldVersions := map[PackageKey]string{
+		{Name: "curl", Architecture: "amd64"}:   "7.81.0-1",
+		{Name: "curl", Architecture: "arm64"}:   "7.81.0-1",
+		{Name: "nginx", Architecture: "amd64"}:  "1.24.0-2",
+		{Name: "python2", Architecture: "all"}:  "2.7.18-3",
+		{Name: "zlib1g", Architecture: "amd64"}: "1:1.2.13-1",
+	}
+	newVersions := map[PackageKey]string{
+		{Name: "curl", Architecture: "amd64"}:   "8.5.0-2",
+		{Name: "curl", Architecture: "arm64"}:   "7.81.0-1",
+		{Name: "nginx", Architecture: "amd64"}:  "1.22.1-9",
+		{Name: "python3", Architecture: "all"}:  "3.12.3-0",
+		{Name: "zlib1g", Architecture: "amd64"}: "1:1.2.13-1",
+	}
+
+	assert.Equal(t, []PackageDiff{
+		{Package: "curl", Architecture: "amd64", Change: "upgraded", OldVersion: "7.81.0-1", NewVersion: "8.5.0-2"},
+		{Package: "nginx", Architecture: "amd64", Change: "downgraded", OldVersion: "1.24.0-2", NewVersion: "1.22.1-9"},
+		{Package: "python2", Architecture: "all", Change: "removed", OldVersion: "2.7.18-3"},
+		{Package: "python3", Architecture: "all", Change: "added", NewVersion: "3.12.3-0"},
+	}, diffVersions(oldVersions, newVersions))
+
+	assert.Empty(t, diffVersions(newVersions, newVersions))
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/nicwaller/apt-look/pkg/apt"
+	apttransport2 "github.com/nicwaller/apt-look/pkg/apt/apttransport"
+	"github.com/nicwaller/apt-look/pkg/deb822"
+)
+
+// runDownload fetches the highest available version of a package into outputPath
+func runDownload(ctx context.Context, source, packageName, outputPath string) error {
+	log.Info().Msgf("Downloading package '%s' from: %s", packageName, source)
+
+	sourceList, err := parseSourceInput(ctx, source)
+	if err != nil {
+		return fmt.Errorf("failed to parse source input: %w", err)
+	}
+
+	pkg, repo, err := findPackage(ctx, sourceList, packageName)
+	if err != nil {
+		return err
+	}
+
+	// Package filenames are relative to the archive root, e.g. pool/main/a/apache2/apache2_2.4.52_amd64.deb
+	debURL := repo.ArchiveRoot().JoinPath(pkg.Filename)
+	destination := resolveDownloadPath(outputPath, pkg.Filename)
+
+	req := &apttransport2.AcquireRequest{
+		URI:          debURL,
+		Filename:     destination,
+		ExpectedSize: pkg.Size,
+		Timeout:      30 * time.Minute, // packages can be much larger than index files
+	}
+	if !options.quiet && !options.events {
+		req.ProgressCallback = newProgressBar(os.Stderr, path.Base(pkg.Filename))
+	}
+	if pkg.SHA256 != "" {
+		req.ExpectedHashes = map[string]string{"sha256": pkg.SHA256}
+	} else {
+		log.Warn().Msgf("No SHA256 hash available for %s; downloading without verification", pkg.Package)
+	}
+
+	resp, err := repo.Transport().Acquire(ctx, req)
+	if req.ProgressCallback != nil {
+		fmt.Fprintln(os.Stderr) // finish the progress bar line
+	}
+	if err != nil {
+		// the transport removes the partial file when hash verification fails
+		return fmt.Errorf("failed to download %s: %w", debURL.String(), err)
+	}
+
+	log.Info().Msgf("Saved %s %s (%d bytes) to %s", pkg.Package, pkg.Version, resp.Size, destination)
+	return nil
+}
+
+// runDownloadSource fetches the files of the highest available version of a source package into
+// outputDir, as apt source does, verifying each against the hashes in the Sources index
+func runDownloadSource(ctx context.Context, source, sourceName, outputDir string) error {
+	log.Info().Msgf("Downloading source package '%s' from: %s", sourceName, source)
+
+	sourceList, err := parseSourceInput(ctx, source)
+	if err != nil {
+		return fmt.Errorf("failed to parse source input: %w", err)
+	}
+
+	var src *deb822.Source
+	var srcRepo *apt.Repository
+	failures := newSourceFailures(sourceList)
+	for _, entry := range sourceList {
+		repo, err := apt.MountContext(ctx, entry, buildMountOptions()...)
+		if err != nil {
+			if err := failures.skip(entry, fmt.Errorf("failed to mount repository: %w", err)); err != nil {
+				return err
+			}
+			continue
+		}
+		matches, err := repo.FindSource(ctx, sourceName)
+		if err != nil {
+			return fmt.Errorf("failed to list source packages: %w", err)
+		}
+		for _, match := range matches {
+			if src == nil || isNewerVersion(match.Version, src.Version) {
+				src, srcRepo = match, repo
+			}
+		}
+	}
+	if err := failures.done(); err != nil {
+		return err
+	}
+	if src == nil {
+		return fmt.Errorf("source package %q not found in repository", sourceName)
+	}
+
+	files := src.SourceFiles()
+	if len(files) == 0 {
+		return fmt.Errorf("source package %s %s doesn't list any files", src.Package, src.Version)
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	var dsc string
+	for _, f := range files {
+		// file names come from the repository, so they mustn't reach outside the output directory
+		if !filepath.IsLocal(f.Name) || strings.ContainsAny(f.Name, `/\`) {
+			return fmt.Errorf("source package %s lists an invalid file name %q", src.Package, f.Name)
+		}
+
+		// Sources files name a Directory relative to the archive root, e.g. pool/main/a/apache2
+		fileURL := srcRepo.ArchiveRoot().JoinPath(src.Directory, f.Name)
+		destination := filepath.Join(outputDir, f.Name)
+		req := &apttransport2.AcquireRequest{
+			URI:            fileURL,
+			Filename:       destination,
+			ExpectedSize:   f.Size,
+			ExpectedHashes: sourceFileHashes(f),
+			Timeout:        30 * time.Minute, // upstream tarballs can be much larger than index files
+		}
+		if len(req.ExpectedHashes) == 0 {
+			log.Warn().Msgf("No hash available for %s; downloading without verification", f.Name)
+		}
+		if !options.quiet && !options.events {
+			req.ProgressCallback = newProgressBar(os.Stderr, f.Name)
+		}
+
+		resp, err := srcRepo.Transport().Acquire(ctx, req)
+		if req.ProgressCallback != nil {
+			fmt.Fprintln(os.Stderr) // finish the progress bar line
+		}
+		if err != nil {
+			return fmt.Errorf("failed to download %s: %w", fileURL.String(), err)
+		}
+		log.Info().Msgf("Saved %s (%d bytes) to %s", f.Name, resp.Size, destination)
+		if strings.HasSuffix(f.Name, ".dsc") {
+			dsc = destination
+		}
+	}
+
+	if dsc != "" {
+		log.Info().Msgf("Unpack %s %s with: dpkg-source -x %s", src.Package, src.Version, dsc)
+	}
+	return nil
+}
+
+// sourceFileHashes returns the hashes a source file is verified against, keyed as AcquireRequest expects
+func sourceFileHashes(f deb822.SourceFile) map[string]string {
+	hashes := make(map[string]string)
+	if f.SHA256 != "" {
+		hashes["sha256"] = f.SHA256
+	}
+	if f.SHA1 != "" {
+		hashes["sha1"] = f.SHA1
+	}
+	if f.MD5 != "" {
+		hashes["md5"] = f.MD5
+	}
+	return hashes
+}
+
+// resolveDownloadPath returns the destination for a download.
+// If outputPath is an existing directory the original filename is kept, otherwise outputPath is used verbatim.
+func resolveDownloadPath(outputPath, packageFilename string) string {
+	if info, err := os.Stat(outputPath); err == nil && info.IsDir() {
+		return filepath.Join(outputPath, path.Base(packageFilename))
+	}
+	return outputPath
+}
+
+// newProgressBar returns a ProgressCallback that draws a progress bar on w, usually stderr
+func newProgressBar(w io.Writer, label string) func(downloaded, total int64) {
+	const width = 40
+	lastPercent := -1
+	return func(downloaded, total int64) {
+		if total <= 0 {
+			fmt.Fprintf(w, "\r%s %.1f MB", label, float64(downloaded)/(1024*1024))
+			return
+		}
+		// servers can send more than they announced, and nothing stops the transfer until it ends
+		percent := min(max(int(downloaded*100/total), 0), 100)
+		if percent == lastPercent {
+			return // avoid redrawing on every small read
+		}
+		lastPercent = percent
+		filled := width * percent / 100
+		fmt.Fprintf(w, "\r%s [%s%s] %3d%% %.1f/%.1f MB", label,
+			strings.Repeat("=", filled), strings.Repeat(" ", width-filled), percent,
+			float64(downloaded)/(1024*1024), float64(total)/(1024*1024))
+	}
+}
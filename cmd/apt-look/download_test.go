@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeSourceRepo creates a repository with one source package, hello, whose files are in the pool
+func writeSourceRepo(t *testing.T, dir string) {
+	t.Helper()
+	files := map[string]string{
+		"hello_2.10-3.dsc":           "Format: 3.0 (quilt)\nSource: hello\n",
+		"hello_2.10.orig.tar.gz":     "upstream tarball",
+		"hello_2.10-3.debian.tar.xz": "debian tarball",
+	}
+	var md5s, sha256s strings.Builder
+	for _, name := range []string{"hello_2.10-3.dsc", "hello_2.10.orig.tar.gz", "hello_2.10-3.debian.tar.xz"} {
+		content := files[name]
+		writeFile(t, dir, "pool/main/h/hello/"+name, content)
+		fmt.Fprintf(&md5s, " %x %d %s\n", md5.Sum([]byte(content)), len(content), name)
+		fmt.Fprintf(&sha256s, " %x %d %s\n", sha256.Sum256([]byte(content)), len(content), name)
+	}
+
+	index := "Package: hello\nVersion: 2.10-3\nDirectory: pool/main/h/hello\nFiles:\n" + md5s.String() +
+		"Checksums-Sha256:\n" + sha256s.String()
+	writeFile(t, dir, "dists/stable/main/source/Sources", index)
+	release := fmt.Sprintf("Suite: stable\nArchitectures: amd64\nComponents: main\nDate: Sat, 27 Apr 2024 15:24:47 UTC\nSHA256:\n %x %d main/source/Sources\n",
+		sha256.Sum256([]byte(index)), len(index))
+	writeFile(t, dir, "dists/stable/Release", release)
+}
+
+func TestDownloadSource(t *testing.T) {
+	repo := t.TempDir()
+	writeSourceRepo(t, repo)
+	source := "deb-src file://" + repo + " stable main"
+	dest := filepath.Join(t.TempDir(), "hello")
+
+	runCommand(t, "download", source, "hello", "--source", "--no-cache", "--quiet", "--output", dest)
+	for _, name := range []string{"hello_2.10-3.dsc", "hello_2.10.orig.tar.gz", "hello_2.10-3.debian.tar.xz"} {
+		assert.FileExists(t, filepath.Join(dest, name))
+	}
+	content, err := os.ReadFile(filepath.Join(dest, "hello_2.10.orig.tar.gz"))
+	require.NoError(t, err)
+	assert.Equal(t, "upstream tarball", string(content))
+
+	// a file that doesn't match the Sources index isn't kept
+	writeFile(t, repo, "pool/main/h/hello/hello_2.10.orig.tar.gz", "UPSTREAM TARBALL")
+	dest = t.TempDir()
+	rootCmd.SetArgs([]string{"download", source, "hello", "--source", "--no-cache", "--quiet", "--output", dest})
+	assert.ErrorContains(t, rootCmd.Execute(), "hash verification failed")
+	assert.NoFileExists(t, filepath.Join(dest, "hello_2.10.orig.tar.gz"))
+
+	rootCmd.SetArgs([]string{"download", source, "missing", "--source", "--no-cache", "--quiet", "--output", dest})
+	assert.ErrorContains(t, rootCmd.Execute(), `source package "missing" not found`)
+}
+
+func TestDownloadSkipsFailedSources(t *testing.T) {
+	binaryRepo, sourceRepo := t.TempDir(), t.TempDir()
+	writeMirrorRepo(t, binaryRepo)
+	writeSourceRepo(t, sourceRepo)
+	dead := "file://" + filepath.Join(t.TempDir(), "gone") + " stable main"
+	sourcesList := filepath.Join(t.TempDir(), "sources.list")
+	writeFile(t, filepath.Dir(sourcesList), "sources.list",
+		"deb "+dead+"\ndeb-src "+dead+"\ndeb file://"+binaryRepo+" stable main\ndeb-src file://"+sourceRepo+" stable main\n")
+
+	dest := t.TempDir()
+	runCommand(t, "download", sourcesList, "alpha", "--no-cache", "--quiet", "--arch", "amd64", "--output", dest)
+	assert.FileExists(t, filepath.Join(dest, "alpha_1.0_amd64.deb"))
+	runCommand(t, "download", sourcesList, "hello", "--source", "--no-cache", "--quiet", "--output", dest)
+	assert.FileExists(t, filepath.Join(dest, "hello_2.10-3.dsc"))
+
+	for _, args := range [][]string{{"alpha"}, {"hello", "--source"}} {
+		resetFlags(t)
+		rootCmd.SetArgs(append([]string{"download", sourcesList, args[0], "--no-cache", "--quiet", "--output", t.TempDir(), "--fail-fast"}, args[1:]...))
+		assert.ErrorContains(t, rootCmd.Execute(), "failed to mount repository")
+	}
+
+	writeFile(t, filepath.Dir(sourcesList), "sources.list", "deb-src "+dead+"\ndeb-src "+dead+"\n")
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"download", sourcesList, "hello", "--source", "--no-cache", "--quiet", "--output", t.TempDir()})
+	assert.ErrorContains(t, rootCmd.Execute(), "all 2 sources failed")
+}
+
+func TestProgressBar(t *testing.T) {
+	var buf bytes.Buffer
+	callback := newProgressBar(&buf, "alpha.deb")
+
+	callback(512*1024, 1024*1024)
+	assert.Contains(t, buf.String(), " 50% 0.5/1.0 MB")
+
+	// more bytes than announced are drawn as a full bar rather than overflowing it
+	buf.Reset()
+	require.NotPanics(t, func() { callback(3*1024*1024, 1024*1024) })
+	assert.Equal(t, "\ralpha.deb ["+strings.Repeat("=", 40)+"] 100% 3.0/1.0 MB", buf.String())
+}
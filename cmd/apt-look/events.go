@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	apttransport2 "github.com/nicwaller/apt-look/pkg/apt/apttransport"
+	"github.com/nicwaller/apt-look/pkg/deb822"
+)
+
+// events receives what the command is doing, for --events; by default it's discarded
+var events eventSink = noEvents{}
+
+// eventSink receives machine-readable events describing the progress of a command
+type eventSink interface {
+	emit(e event)
+}
+
+// event is one line of --events output; fields that don't apply to the event are left out
+type event struct {
+	Event        string `json:"event"`
+	URI          string `json:"uri,omitempty"`
+	Size         int64  `json:"size,omitempty"`
+	Package      string `json:"package,omitempty"`
+	Version      string `json:"version,omitempty"`
+	Architecture string `json:"architecture,omitempty"`
+	Count        *int   `json:"count,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+type noEvents struct{}
+
+func (noEvents) emit(event) {}
+
+// jsonEvents writes each event as a line of JSON, and counts the packages for the done event
+type jsonEvents struct {
+	mu       sync.Mutex
+	enc      *json.Encoder
+	packages int
+}
+
+func newJSONEvents(w io.Writer) *jsonEvents {
+	return &jsonEvents{enc: json.NewEncoder(w)}
+}
+
+func (e *jsonEvents) emit(ev event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if ev.Event == "package" {
+		e.packages++
+	}
+	_ = e.enc.Encode(ev)
+}
+
+// done emits the final event of a successful command, with the number of packages it output
+func (e *jsonEvents) done() {
+	e.mu.Lock()
+	count := e.packages
+	e.mu.Unlock()
+	e.emit(event{Event: "done", Count: &count})
+}
+
+// emitPackage reports a package the command has output
+func emitPackage(pkg *deb822.Package) {
+	events.emit(event{Event: "package", Package: pkg.Package, Version: pkg.Version, Architecture: pkg.Architecture})
+}
+
+// eventTransport reports each fetch made through the registry, and whether the cache answered it
+type eventTransport struct {
+	*apttransport2.Registry
+}
+
+func (t eventTransport) Acquire(ctx context.Context, req *apttransport2.AcquireRequest) (*apttransport2.AcquireResponse, error) {
+	events.emit(event{Event: "fetch", URI: req.URI.String()})
+	resp, err := t.Registry.Acquire(ctx, req)
+	if err != nil {
+		events.emit(event{Event: "fetch_failed", URI: req.URI.String(), Error: err.Error()})
+		return nil, err
+	}
+	if resp.Cached {
+		events.emit(event{Event: "cache_hit", URI: req.URI.String(), Size: resp.Size})
+	}
+	return resp, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runWithEvents runs a command with --events the way main does and returns the events written to stderr
+func runWithEvents(t *testing.T, args ...string) ([]event, error) {
+	t.Helper()
+	resetFlags(t)
+	stderr, err := os.Create(filepath.Join(t.TempDir(), "stderr"))
+	require.NoError(t, err)
+	realStderr, resultWriter := os.Stderr, stdout
+	os.Stderr, stdout = stderr, &bytes.Buffer{}
+	t.Cleanup(func() {
+		os.Stderr, stdout = realStderr, resultWriter
+		configureLogging()
+	})
+
+	rootCmd.SetArgs(append(args, "--events"))
+	runErr := execute(context.Background())
+	os.Stderr, stdout = realStderr, resultWriter
+	require.NoError(t, stderr.Close())
+
+	data, err := os.ReadFile(stderr.Name())
+	require.NoError(t, err)
+	var result []event
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var e event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e), "not an event: %s", scanner.Text())
+		result = append(result, e)
+	}
+	return result, runErr
+}
+
+// eventsNamed returns the events with the given name
+func eventsNamed(all []event, name string) []event {
+	var named []event
+	for _, e := range all {
+		if e.Event == name {
+			named = append(named, e)
+		}
+	}
+	return named
+}
+
+func TestEvents(t *testing.T) {
+	repo, err := filepath.Abs("../../pkg/apt/testdata/compressedrepo")
+	require.NoError(t, err)
+	source := "deb file://" + repo + " stable main"
+	cacheDir := t.TempDir()
+
+	all, err := runWithEvents(t, "list", source, "--arch", "amd64", "--cache-dir", cacheDir)
+	require.NoError(t, err)
+	assert.NotEmpty(t, eventsNamed(all, "fetch"))
+	assert.Empty(t, eventsNamed(all, "cache_hit"))
+	assert.NotEmpty(t, eventsNamed(all, "log"), "log messages are events too")
+
+	packages := eventsNamed(all, "package")
+	require.NotEmpty(t, packages)
+	assert.Equal(t, "alpha", packages[0].Package)
+	assert.Equal(t, "amd64", packages[0].Architecture)
+	done := all[len(all)-1]
+	assert.Equal(t, "done", done.Event)
+	require.NotNil(t, done.Count)
+	assert.Equal(t, len(packages), *done.Count)
+
+	// the indexes are served from the cache the second time
+	all, err = runWithEvents(t, "list", source, "--arch", "amd64", "--cache-dir", cacheDir)
+	require.NoError(t, err)
+	assert.NotEmpty(t, eventsNamed(all, "cache_hit"))
+
+	all, err = runWithEvents(t, "info", source, "missing", "--no-cache", "--arch", "amd64")
+	assert.Error(t, err)
+	assert.Equal(t, "error", all[len(all)-1].Event)
+	assert.Contains(t, all[len(all)-1].Error, "not found")
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/nicwaller/apt-look/pkg/apt"
+	"github.com/nicwaller/apt-look/pkg/apt/sources"
+)
+
+// sourceFailures keeps track of the sources a command had to skip. A real sources.list often has a stale
+// third-party repository in it, which shouldn't stop the others from being read unless --fail-fast is set.
+type sourceFailures struct {
+	total   int
+	failed  int
+	lastErr error
+}
+
+func newSourceFailures(sourceList []sources.Entry) *sourceFailures {
+	return &sourceFailures{total: len(sourceList)}
+}
+
+// skip logs err and returns nil so the command can carry on with the next source, or returns err
+// itself with --fail-fast or when there is only the one source
+func (f *sourceFailures) skip(src sources.Entry, err error) error {
+	if options.failFast || f.total == 1 {
+		return err
+	}
+	log.Error().Err(err).Str("source", src.String()).Msg("Skipping source")
+	f.failed++
+	f.lastErr = err
+	return nil
+}
+
+// done reports how many sources were skipped, which is an error if it was all of them
+func (f *sourceFailures) done() error {
+	if f.failed == 0 {
+		return nil
+	}
+	if f.failed == f.total {
+		return fmt.Errorf("all %d sources failed: %w", f.total, f.lastErr)
+	}
+	log.Warn().Msgf("%d of %d sources failed and were skipped", f.failed, f.total)
+	return nil
+}
+
+// mountFirstSource mounts the first of the sources that can be mounted, for the commands that read a
+// single repository. The sources before it are skipped like in the other commands.
+func mountFirstSource(ctx context.Context, sourceList []sources.Entry) (*apt.Repository, sources.Entry, error) {
+	if len(sourceList) == 0 {
+		return nil, sources.Entry{}, fmt.Errorf("no sources provided")
+	}
+	failures := newSourceFailures(sourceList)
+	for _, src := range sourceList {
+		repo, err := apt.MountContext(ctx, src, buildMountOptions()...)
+		if err != nil {
+			if err := failures.skip(src, fmt.Errorf("failed to mount repository: %w", err)); err != nil {
+				return nil, sources.Entry{}, err
+			}
+			continue
+		}
+		if len(sourceList) > 1 {
+			log.Info().Msgf("Multiple sources discovered, using: %s %s %v",
+				src.Type, src.ArchiveRoot.String(), src.Components)
+		}
+		return repo, src, nil
+	}
+	return nil, sources.Entry{}, failures.done()
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandsSkipFailedSources(t *testing.T) {
+	repo := t.TempDir()
+	writeMirrorRepo(t, repo)
+	dead := "deb file://" + filepath.Join(t.TempDir(), "gone") + " stable main"
+	sourcesList := filepath.Join(t.TempDir(), "sources.list")
+	writeFile(t, filepath.Dir(sourcesList), "sources.list", dead+"\ndeb file://"+repo+" stable main\n")
+
+	tests := map[string][]string{
+		"verify": {"verify", sourcesList},
+		"mirror": {"mirror", sourcesList, t.TempDir()},
+		"diff":   {"diff", sourcesList, "deb file://" + repo + " stable main"},
+		"stats":  {"stats", sourcesList},
+		"check":  {"check", sourcesList},
+		"graph":  {"graph", sourcesList},
+	}
+	for name, args := range tests {
+		t.Run(name, func(t *testing.T) {
+			runCommand(t, append(args, "--no-cache", "--arch", "amd64")...)
+
+			rootCmd.SetArgs(append(args, "--no-cache", "--arch", "amd64", "--fail-fast"))
+			assert.ErrorContains(t, rootCmd.Execute(), "failed to mount repository")
+		})
+	}
+}
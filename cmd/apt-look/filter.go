@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/nicwaller/apt-look/pkg/deb822"
+)
+
+// validPriorities lists the values accepted by --priority, from most to least important
+var validPriorities = []string{"required", "important", "standard", "optional", "extra"}
+
+// validatePriorities returns an error if any --priority value isn't a Debian priority
+func validatePriorities(priorities []string) error {
+	for _, priority := range priorities {
+		if !slices.Contains(validPriorities, priority) {
+			return fmt.Errorf("invalid priority '%s'. Valid priorities: %s",
+				priority, strings.Join(validPriorities, ", "))
+		}
+	}
+	return nil
+}
+
+// validateExcludes returns an error if any glob: pattern of --exclude is malformed
+func validateExcludes(patterns []string) error {
+	for _, pattern := range patterns {
+		if glob, ok := strings.CutPrefix(pattern, "glob:"); ok {
+			if _, err := path.Match(glob, ""); err != nil {
+				return fmt.Errorf("invalid exclude pattern '%s': %w", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// excluded reports whether a package name matches an --exclude pattern, which is a substring of the
+// name or, with a glob: prefix, a path.Match pattern for the whole name, e.g. glob:lib*
+func excluded(name string) bool {
+	for _, pattern := range options.exclude {
+		if glob, ok := strings.CutPrefix(pattern, "glob:"); ok {
+			if matched, _ := path.Match(glob, name); matched {
+				return true
+			}
+		} else if strings.Contains(name, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesPackageFilters reports whether a package is acceptable under the --essential-only, --priority
+// and --exclude flags
+func matchesPackageFilters(pkg *deb822.Package) bool {
+	if options.essentialOnly && !pkg.Essential {
+		return false
+	}
+	if len(options.priority) > 0 && !slices.Contains(options.priority, pkg.Priority) {
+		return false
+	}
+	return !excluded(pkg.Package)
+}
+
+// packageFiltersActive reports whether --essential-only, --priority or --exclude may have hidden packages
+func packageFiltersActive() bool {
+	return options.essentialOnly || len(options.priority) > 0 || len(options.exclude) > 0
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nicwaller/apt-look/pkg/deb822"
+)
+
+func TestMatchesPackageFilters(t *testing.T) {
+	base := &deb822.Package{Package: "base-files", Essential: true, Priority: "required"}
+	libc := &deb822.Package{Package: "libc6", Priority: "required"}
+	vim := &deb822.Package{Package: "vim", Priority: "optional"}
+
+	// an exclusion left by another test would hide the packages
+	options.exclude = nil
+	t.Cleanup(func() {
+		options.essentialOnly = false
+		options.priority = nil
+	})
+
+	assert.True(t, matchesPackageFilters(vim))
+	assert.False(t, packageFiltersActive())
+
+	options.essentialOnly = true
+	assert.True(t, matchesPackageFilters(base))
+	assert.False(t, matchesPackageFilters(libc))
+
+	options.essentialOnly = false
+	options.priority = []string{"required", "important"}
+	assert.True(t, matchesPackageFilters(base))
+	assert.True(t, matchesPackageFilters(libc))
+	assert.False(t, matchesPackageFilters(vim))
+	assert.True(t, packageFiltersActive())
+}
+
+func TestExcluded(t *testing.T) {
+	t.Cleanup(func() { options.exclude = nil })
+
+	options.exclude = []string{"-dbg", "glob:lib*"}
+	assert.True(t, excluded("vim-dbg"))
+	assert.True(t, excluded("dbg-tools-dbgsym"))
+	assert.True(t, excluded("libc6"))
+	assert.False(t, excluded("glibc-source"), "a glob matches the whole name")
+	assert.False(t, excluded("vim"))
+	assert.False(t, matchesPackageFilters(&deb822.Package{Package: "libssl3"}))
+	assert.True(t, packageFiltersActive())
+}
+
+func TestValidateExcludes(t *testing.T) {
+	assert.NoError(t, validateExcludes([]string{"-dev", "glob:lib*-dev", "[not a glob"}))
+	assert.ErrorContains(t, validateExcludes([]string{"glob:lib[abc"}), "invalid exclude pattern 'glob:lib[abc'")
+}
+
+func TestValidatePriorities(t *testing.T) {
+	assert.NoError(t, validatePriorities(nil))
+	assert.NoError(t, validatePriorities([]string{"standard", "extra"}))
+	assert.ErrorContains(t, validatePriorities([]string{"urgent"}), "invalid priority 'urgent'")
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/nicwaller/apt-look/pkg/apt"
+)
+
+// runFindFile reports which packages ship the file at filePath, using the repository Contents indexes
+func runFindFile(ctx context.Context, source, filePath, format string) error {
+	log.Info().Msgf("Finding packages that contain '%s' in: %s", filePath, source)
+
+	sourceList, err := parseSourceInput(ctx, source)
+	if err != nil {
+		return fmt.Errorf("failed to parse source input: %w", err)
+	}
+
+	// Contents paths are relative to the filesystem root
+	target := strings.TrimPrefix(filePath, "/")
+
+	var packages []string
+	failures := newSourceFailures(sourceList)
+	for _, src := range sourceList {
+		repo, err := apt.MountContext(ctx, src, buildMountOptions()...)
+		if err != nil {
+			if err := failures.skip(src, fmt.Errorf("failed to mount repository: %w", err)); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(repo.ContentsIndexes()) == 0 {
+			log.Warn().Msgf("No Contents index found in %s", repo.DistributionRoot().String())
+			continue
+		}
+
+		for entry, err := range repo.Contents(ctx) {
+			if err != nil {
+				return fmt.Errorf("failed to read contents: %w", err)
+			}
+			if entry.Path != target {
+				continue
+			}
+			for _, name := range entry.Packages {
+				if !slices.Contains(packages, name) {
+					packages = append(packages, name)
+				}
+			}
+		}
+	}
+
+	if err := failures.done(); err != nil {
+		return err
+	}
+
+	if len(packages) == 0 {
+		return fmt.Errorf("no package contains %q", filePath)
+	}
+	slices.Sort(packages)
+
+	return outputFileMatches(stdout, "/"+target, packages, format)
+}
+
+// outputFileMatches outputs the packages providing a file in the specified format
+func outputFileMatches(w io.Writer, filePath string, packages []string, format string) error {
+	switch format {
+	case "text":
+		// same layout as apt-file search
+		for _, name := range packages {
+			fmt.Fprintf(w, "%s: %s\n", name, filePath)
+		}
+	case "json", "jsonl":
+		data, err := json.Marshal(struct {
+			Path     string   `json:"path"`
+			Packages []string `json:"packages"`
+		}{filePath, packages})
+		if err != nil {
+			return fmt.Errorf("failed to marshal matches to JSON: %w", err)
+		}
+		fmt.Fprintf(w, "%s\n", string(data))
+	case "tsv":
+		// TSV format: Package\tPath
+		for _, name := range packages {
+			fmt.Fprintf(w, "%s\t%s\n", name, filePath)
+		}
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindFile(t *testing.T) {
+	repo, err := filepath.Abs("../../pkg/apt/testdata/compressedrepo")
+	require.NoError(t, err)
+	source := "deb file://" + repo + " stable main"
+
+	output := runCommand(t, "find-file", source, "/usr/share/doc/alpha/copyright", "--no-cache", "--arch", "amd64")
+	assert.Equal(t, "alpha: /usr/share/doc/alpha/copyright\nalpha-doc: /usr/share/doc/alpha/copyright\n", output)
+
+	// the leading slash is optional, as the Contents indexes leave it out
+	output = runCommand(t, "find-file", source, "usr/bin/alpha", "--no-cache", "--arch", "amd64", "--format", "json")
+	assert.JSONEq(t, `{"path": "/usr/bin/alpha", "packages": ["alpha"]}`, output)
+	output = runCommand(t, "find-file", source, "/usr/bin/alpha", "--no-cache", "--arch", "amd64", "--format", "tsv")
+	assert.Equal(t, "alpha\t/usr/bin/alpha\n", output)
+
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"find-file", source, "/usr/bin/missing", "--no-cache", "--arch", "amd64"})
+	assert.ErrorContains(t, rootCmd.Execute(), `no package contains "/usr/bin/missing"`)
+}
+
+func TestFindFile_NoContents(t *testing.T) {
+	repo, err := filepath.Abs("../../pkg/apt/testdata/flatrepo")
+	require.NoError(t, err)
+
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"find-file", "deb file://" + repo + "/ /", "/usr/bin/kubeadm", "--no-cache", "--arch", "amd64"})
+	assert.ErrorContains(t, rootCmd.Execute(), `no package contains "/usr/bin/kubeadm"`)
+}
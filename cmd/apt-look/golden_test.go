@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nicwaller/apt-look/pkg/apt"
+	"github.com/nicwaller/apt-look/pkg/apt/sources"
+	"github.com/nicwaller/apt-look/pkg/deb822"
+)
+
+var update = flag.Bool("update", false, "rewrite the .golden files in testdata with the current output")
+
+// assertGolden compares output with testdata/name.golden, or rewrites the file with -update
+func assertGolden(t *testing.T, name string, output []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		require.NoError(t, os.MkdirAll("testdata", 0755))
+		require.NoError(t, os.WriteFile(path, output, 0644))
+		return
+	}
+	expected, err := os.ReadFile(path)
+	require.NoError(t, err, "run go test with -update to create %s", path)
+	assert.Equal(t, string(expected), string(output))
+}
+
+var goldenDate = time.Date(2024, 4, 25, 14, 30, 0, 0, time.UTC)
+
+func goldenStats() map[string]*apt.RepositoryStats {
+	sample := &apt.RepositoryStats{}
+	sample.Repository.Origin = "Ubuntu"
+	sample.Repository.Label = "Ubuntu"
+	sample.Repository.Suite = "noble"
+	sample.Repository.Codename = "noble"
+	sample.Repository.Date = goldenDate
+	sample.Repository.Architectures = []string{"amd64", "arm64"}
+	sample.Repository.Components = []string{"main", "universe"}
+	sample.Packages.Total = 5
+	sample.Packages.TotalSize = 3 * 1024 * 1024
+	sample.Packages.TotalSizeMB = 3
+	sample.Packages.ByArchitecture = map[string]int{"amd64": 3, "arm64": 2}
+	sample.Packages.ByComponent = map[string]int{"universe": 1, "main": 4}
+	sample.Packages.BySection = map[string]int{"utils": 3, "doc": 2}
+	sample.Packages.ByPriority = map[string]int{"optional": 4, "important": 1}
+	sample.Packages.TotalInstalledSize = 12 * 1024 * 1024
+	sample.Packages.SizeByArchitecture = map[string]int64{"amd64": 2 * 1024 * 1024, "arm64": 1024 * 1024}
+	sample.Packages.SizeByComponent = map[string]int64{"universe": 512 * 1024, "main": 2560 * 1024}
+	sample.Packages.SizeBySection = map[string]int64{"utils": 1024 * 1024, "doc": 2 * 1024 * 1024}
+
+	empty := &apt.RepositoryStats{}
+	empty.Repository.Date = goldenDate
+	empty.Repository.Architectures = []string{"amd64"}
+	empty.Repository.Components = []string{"main"}
+	empty.Packages.ByArchitecture = map[string]int{}
+	empty.Packages.ByComponent = map[string]int{}
+	empty.Packages.BySection = map[string]int{}
+	empty.Packages.ByPriority = map[string]int{}
+	empty.Packages.SizeByArchitecture = map[string]int64{}
+	empty.Packages.SizeByComponent = map[string]int64{}
+	empty.Packages.SizeBySection = map[string]int64{}
+
+	return map[string]*apt.RepositoryStats{"sample": sample, "empty": empty}
+}
+
+func TestOutputStats_Golden(t *testing.T) {
+	archiveRoot, err := url.Parse("http://archive.ubuntu.com/ubuntu")
+	require.NoError(t, err)
+	source := sources.Entry{Type: sources.SourceTypeDeb, ArchiveRoot: archiveRoot, Distribution: "noble"}
+
+	for name, stats := range goldenStats() {
+		for _, format := range []string{"text", "json", "jsonl", "tsv", "prom", "raw"} {
+			t.Run(name+"/"+format, func(t *testing.T) {
+				var buf bytes.Buffer
+				require.NoError(t, outputStats(&buf, source, stats, format))
+				assertGolden(t, "stats-"+name+"."+format, buf.Bytes())
+			})
+		}
+	}
+
+	options.bySectionSize = true
+	t.Cleanup(func() { options.bySectionSize = false })
+	for _, format := range []string{"text", "tsv"} {
+		t.Run("by-section-size/"+format, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, outputStats(&buf, source, goldenStats()["sample"], format))
+			assertGolden(t, "stats-by-section-size."+format, buf.Bytes())
+		})
+	}
+}
+
+func goldenCheckResults() map[string]*CheckResult {
+	sample := &CheckResult{}
+	sample.Repository.Origin = "Ubuntu"
+	sample.Repository.Suite = "noble"
+	sample.Repository.Date = goldenDate
+	sample.Repository.BaseURL = "http://archive.ubuntu.com/ubuntu/dists/noble"
+	sample.Repository.Components = []string{"main"}
+	sample.Summary.TotalFiles = 4
+	sample.Summary.ExistingFiles = 3
+	sample.Summary.MissingFiles = 1
+	sample.Summary.IntegrityIssues = 1
+	sample.Summary.HashMismatches = 1
+	sample.MissingFiles = []FileCheckResult{{
+		FileInfo: deb822.FileInfo{Path: "main/binary-arm64/Packages.gz", Type: "Packages", Component: "main", Architecture: "arm64"},
+		Error:    "HTTP 404",
+	}}
+	sample.IntegrityIssues = []FileCheckResult{{
+		FileInfo:   deb822.FileInfo{Path: "main/binary-amd64/Packages.gz", Size: 1024},
+		ActualSize: 1000,
+	}}
+	sample.HashMismatches = []FileCheckResult{{
+		FileInfo: deb822.FileInfo{Path: "main/i18n/Translation-en"},
+		Error:    "sha256 mismatch",
+	}}
+
+	empty := &CheckResult{}
+	empty.Repository.Date = goldenDate
+	empty.Repository.BaseURL = "http://archive.ubuntu.com/ubuntu/dists/noble"
+
+	return map[string]*CheckResult{"sample": sample, "empty": empty}
+}
+
+func TestOutputCheckResults_Golden(t *testing.T) {
+	for name, result := range goldenCheckResults() {
+		for _, format := range []string{"text", "json", "tsv"} {
+			t.Run(name+"/"+format, func(t *testing.T) {
+				var buf bytes.Buffer
+				require.NoError(t, outputCheckResults(&buf, result, format))
+				assertGolden(t, "check-"+name+"."+format, buf.Bytes())
+			})
+		}
+	}
+}
+
+func TestOutputPackage_Golden(t *testing.T) {
+	control := `Package: alpha
+Version: 1.0-1
+Architecture: amd64
+Maintainer: Alpha Maintainers <alpha@example.com>
+Installed-Size: 120
+Depends: libc6 (>= 2.34)
+Priority: optional
+Section: utils
+Filename: pool/main/a/alpha/alpha_1.0-1_amd64.deb
+Size: 40960
+SHA256: 5d41402abc4b2a76b9719d911017c592ae1c0a3d2a4f2b3f6e1f1a2b3c4d5e6f
+Description: first letter, "quoted"
+ A longer description
+ over two lines.
+`
+	var packages []*deb822.Package
+	for pkg, err := range deb822.ParsePackages(strings.NewReader(control)) {
+		require.NoError(t, err)
+		packages = append(packages, pkg)
+	}
+	require.Len(t, packages, 1)
+
+	tests := map[string][]*deb822.Package{"single": packages, "empty": nil}
+	for name, pkgs := range tests {
+		for _, format := range []string{"text", "json", "tsv", "csv", "raw"} {
+			t.Run(name+"/"+format, func(t *testing.T) {
+				var buf bytes.Buffer
+				for _, pkg := range pkgs {
+					require.NoError(t, outputPackage(&buf, pkg, format))
+				}
+				assertGolden(t, "packages-"+name+"."+format, buf.Bytes())
+			})
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/nicwaller/apt-look/pkg/apt"
+)
+
+// runGraph outputs the dependency graph of a repository, or of the packages reachable from packageName
+func runGraph(ctx context.Context, source, packageName, format string, depth int) error {
+	log.Info().Msgf("Building dependency graph from: %s", source)
+
+	sourceList, err := parseSourceInput(ctx, source)
+	if err != nil {
+		return fmt.Errorf("failed to parse source input: %w", err)
+	}
+	// Use the first source when multiple are discovered
+	repo, _, err := mountFirstSource(ctx, sourceList)
+	if err != nil {
+		return err
+	}
+
+	graph, err := repo.DependencyGraph(ctx, packageName, depth)
+	if err != nil {
+		return fmt.Errorf("failed to build dependency graph: %w", err)
+	}
+
+	log.Info().Msgf("Graph has %d packages, %d virtual packages and %d edges",
+		len(graph.Packages), len(graph.Virtual), len(graph.Edges))
+	return outputGraph(stdout, graph, format)
+}
+
+// outputGraph outputs a dependency graph as Graphviz DOT, JSON, or TSV edges
+func outputGraph(w io.Writer, graph *apt.DependencyGraph, format string) error {
+	switch format {
+	case "text":
+		outputGraphDOT(w, graph)
+	case "json", "jsonl":
+		data, err := json.Marshal(graph)
+		if err != nil {
+			return fmt.Errorf("failed to marshal graph to JSON: %w", err)
+		}
+		fmt.Fprintf(w, "%s\n", string(data))
+	case "tsv":
+		// TSV format: From\tTo\tField
+		for _, edge := range graph.Edges {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", edge.From, edge.To, edge.Field)
+		}
+	case "csv":
+		for _, edge := range graph.Edges {
+			if err := writeCSVRow(w, []string{"from", "to", "field"}, []string{edge.From, edge.To, edge.Field}); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+	return nil
+}
+
+// outputGraphDOT draws packages as boxes and virtual packages as dashed ellipses.
+// Depends edges are solid, Pre-Depends bold, Recommends dashed and Provides dotted.
+func outputGraphDOT(w io.Writer, graph *apt.DependencyGraph) {
+	fmt.Fprintf(w, "digraph dependencies {\n")
+	fmt.Fprintf(w, "  node [shape=box];\n")
+	for _, name := range graph.Packages {
+		fmt.Fprintf(w, "  %q;\n", name)
+	}
+	for _, name := range graph.Virtual {
+		fmt.Fprintf(w, "  %q [shape=ellipse, style=dashed];\n", name)
+	}
+	for _, edge := range graph.Edges {
+		switch edge.Field {
+		case "Pre-Depends":
+			fmt.Fprintf(w, "  %q -> %q [style=bold];\n", edge.From, edge.To)
+		case "Recommends":
+			fmt.Fprintf(w, "  %q -> %q [style=dashed];\n", edge.From, edge.To)
+		case "Provides":
+			fmt.Fprintf(w, "  %q -> %q [style=dotted, arrowhead=empty];\n", edge.From, edge.To)
+		default:
+			fmt.Fprintf(w, "  %q -> %q;\n", edge.From, edge.To)
+		}
+	}
+	fmt.Fprintf(w, "}\n")
+}
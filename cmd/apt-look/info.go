@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/nicwaller/apt-look/pkg/apt"
+	"github.com/nicwaller/apt-look/pkg/apt/sources"
+	"github.com/nicwaller/apt-look/pkg/deb822"
+)
+
+// runInfo shows the metadata for the highest available version of a package
+func runInfo(ctx context.Context, source, packageName, format string) error {
+	log.Info().Msgf("Getting info for package '%s' from: %s", packageName, source)
+
+	sourceList, err := parseSourceInput(ctx, source)
+	if err != nil {
+		return fmt.Errorf("failed to parse source input: %w", err)
+	}
+
+	// --show-files can't be combined with formats that hold one record per package
+	if options.showFiles && !slices.Contains([]string{"text", "json", "jsonl"}, format) {
+		return fmt.Errorf("--show-files doesn't support the %s format", format)
+	}
+
+	pkg, repo, err := findPackage(ctx, sourceList, packageName)
+	if err != nil {
+		return err
+	}
+
+	// Packages files may carry only the synopsis, with the long description in a Translation file
+	if pkg.DescriptionMd5 != "" {
+		descriptions, err := repo.Descriptions(ctx, options.lang)
+		if err != nil {
+			log.Warn().Msgf("Failed to load %s descriptions: %v", options.lang, err)
+		} else if description, ok := descriptions[pkg.DescriptionMd5]; ok {
+			pkg.Description = description
+		}
+	}
+
+	// the Contents indexes list what a package installs without downloading the .deb
+	var files []string
+	if options.showFiles {
+		paths, err := repo.PackageFiles(ctx, pkg.Package, pkg.Architecture)
+		if errors.Is(err, apt.ErrNoContentsIndex) {
+			return fmt.Errorf("can't show files: no Contents index found in %s", repo.DistributionRoot().String())
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read contents: %w", err)
+		}
+		files = make([]string, len(paths))
+		for i, path := range paths {
+			files[i] = "/" + path
+		}
+	}
+
+	return outputPackageInfo(stdout, pkg, files, format)
+}
+
+// findPackage searches all sources for the named package and returns the highest version,
+// along with the repository that provides it.
+// When --arch is given, only packages built for one of those architectures (or "all") are considered.
+func findPackage(ctx context.Context, sourceList []sources.Entry, packageName string) (*deb822.Package, *apt.Repository, error) {
+	var best *deb822.Package
+	var bestRepo *apt.Repository
+	failures := newSourceFailures(sourceList)
+	for _, src := range sourceList {
+		repo, err := apt.MountContext(ctx, src, buildMountOptions()...)
+		if err != nil {
+			if err := failures.skip(src, fmt.Errorf("failed to mount repository: %w", err)); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		matches, err := repo.FindPackage(ctx, packageName)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list packages: %w", err)
+		}
+		for _, pkg := range matches {
+			if !matchesArchFilter(pkg) {
+				continue
+			}
+			if best == nil || isNewerVersion(pkg.Version, best.Version) {
+				best = pkg
+				bestRepo = repo
+			}
+		}
+	}
+
+	if err := failures.done(); err != nil {
+		return nil, nil, err
+	}
+
+	if best == nil {
+		return nil, nil, fmt.Errorf("package %q not found in repository", packageName)
+	}
+	return best, bestRepo, nil
+}
+
+// matchesArchFilter reports whether a package is acceptable under the --arch flag
+func matchesArchFilter(pkg *deb822.Package) bool {
+	if len(options.arch) == 0 {
+		return true
+	}
+	return pkg.Architecture == "all" || slices.Contains(options.arch, pkg.Architecture)
+}
+
+// outputPackageInfo outputs every field of a single package in the specified format,
+// followed by the files it installs when files isn't nil
+func outputPackageInfo(w io.Writer, pkg *deb822.Package, files []string, format string) error {
+	switch format {
+	case "text":
+		emitPackage(pkg)
+		// Show fields in the order they appear in the Packages file
+		for _, field := range pkg.Fields() {
+			if field == "Description" {
+				writeDescription(w, pkg)
+				continue
+			}
+			fmt.Fprintf(w, "%-16s %s\n", field+":", pkg.GetField(field))
+		}
+		if files != nil {
+			fmt.Fprintf(w, "%-16s %d\n", "Files:", len(files))
+			for _, file := range files {
+				fmt.Fprintf(w, " %s\n", file)
+			}
+		}
+	case "json", "jsonl":
+		emitPackage(pkg)
+		var value any = pkg
+		if files != nil {
+			value = packageWithFiles{pkg, files}
+		}
+		encoder := json.NewEncoder(w)
+		if format == "json" {
+			encoder.SetIndent("", "  ")
+		}
+		return encoder.Encode(value)
+	default:
+		return outputPackage(w, pkg, format)
+	}
+	return nil
+}
+
+// writeDescription writes the synopsis on the Description line with the long description beneath it, like apt show.
+// A translated long description replaces the Description unfolded into one line, so it is written as it is.
+func writeDescription(w io.Writer, pkg *deb822.Package) {
+	if pkg.Description != pkg.GetField("Description") {
+		fmt.Fprintf(w, "%-16s %s\n", "Description:", pkg.Description)
+		return
+	}
+	fmt.Fprintf(w, "%-16s %s\n", "Description:", pkg.Synopsis())
+	if long := pkg.LongDescription(); long != "" {
+		for _, line := range strings.Split(long, "\n") {
+			if line == "" {
+				line = "."
+			}
+			fmt.Fprintf(w, " %s\n", line)
+		}
+	}
+}
+
+// packageWithFiles adds the files a package installs to its JSON object
+type packageWithFiles struct {
+	*deb822.Package
+	Files []string `json:"files"`
+}
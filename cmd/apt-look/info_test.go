@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nicwaller/apt-look/pkg/deb822"
+)
+
+func TestInfo(t *testing.T) {
+	// alpha is at 1.0 for amd64 and 2.0 for arm64
+	repo := t.TempDir()
+	var release strings.Builder
+	release.WriteString("Suite: stable\nArchitectures: amd64 arm64\nComponents: main\nDate: Sat, 27 Apr 2024 15:24:47 UTC\nSHA256:\n")
+	for arch, version := range map[string]string{"amd64": "1.0", "arm64": "2.0"} {
+		index := fmt.Sprintf("Package: alpha\nVersion: %s\nArchitecture: %s\nSection: utils\nFilename: pool/alpha_%s_%s.deb\nSize: 1\nDescription: first letter\n",
+			version, arch, version, arch)
+		writeFile(t, repo, "dists/stable/main/binary-"+arch+"/Packages", index)
+		fmt.Fprintf(&release, " %x %d main/binary-%s/Packages\n", sha256.Sum256([]byte(index)), len(index), arch)
+	}
+	writeFile(t, repo, "dists/stable/Release", release.String())
+	source := "deb file://" + repo + " stable main"
+
+	// the highest version wins, among the architectures --arch allows
+	output := runCommand(t, "info", source, "alpha", "--no-cache", "--arch", "amd64,arm64")
+	assert.Contains(t, output, "Version:         2.0\n")
+	assert.Contains(t, output, "Architecture:    arm64\n")
+	output = runCommand(t, "info", source, "alpha", "--no-cache", "--arch", "amd64")
+	assert.Contains(t, output, "Version:         1.0\n")
+
+	var pkg deb822.Package
+	require.NoError(t, json.Unmarshal([]byte(runCommand(t, "info", source, "alpha", "--no-cache", "--arch", "amd64,arm64", "--format", "json")), &pkg))
+	assert.Equal(t, "2.0", pkg.Version)
+	assert.Equal(t, "alpha\t2.0\tarm64\tutils\tfirst letter\n", runCommand(t, "info", source, "alpha", "--no-cache", "--arch", "amd64,arm64", "--format", "tsv"))
+	assert.Equal(t, "Package: alpha\nVersion: 2.0\nArchitecture: arm64\nSection: utils\nFilename: pool/alpha_2.0_arm64.deb\nSize: 1\nDescription: first letter\n\n",
+		runCommand(t, "info", source, "alpha", "--no-cache", "--arch", "amd64,arm64", "--format", "raw"))
+
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"info", source, "missing", "--no-cache"})
+	assert.ErrorContains(t, rootCmd.Execute(), `package "missing" not found in repository`)
+}
+
+func TestInfoShowFiles(t *testing.T) {
+	repo, err := filepath.Abs("../../pkg/apt/testdata/compressedrepo")
+	require.NoError(t, err)
+	source := "deb file://" + repo + " stable main"
+
+	output := runCommand(t, "info", source, "alpha", "--no-cache", "--arch", "amd64", "--show-files")
+	assert.Contains(t, output, "Package:         alpha\n")
+	assert.Contains(t, output, "Files:           2\n /usr/bin/alpha\n /usr/share/doc/alpha/copyright\n")
+
+	var info struct {
+		Package string   `json:"package"`
+		Files   []string `json:"files"`
+	}
+	output = runCommand(t, "info", source, "alpha", "--no-cache", "--arch", "amd64", "--show-files", "--format", "json")
+	require.NoError(t, json.Unmarshal([]byte(output), &info))
+	assert.Equal(t, "alpha", info.Package)
+	assert.Equal(t, []string{"/usr/bin/alpha", "/usr/share/doc/alpha/copyright"}, info.Files)
+
+	// without the flag, the JSON is the package alone
+	output = runCommand(t, "info", source, "alpha", "--no-cache", "--arch", "amd64", "--format", "json")
+	assert.NotContains(t, output, `"files"`)
+}
+
+func TestInfoShowFiles_NoContents(t *testing.T) {
+	repo, err := filepath.Abs("../../pkg/apt/testdata/flatrepo")
+	require.NoError(t, err)
+
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"info", "deb file://" + repo + "/ /", "kubeadm", "--no-cache", "--arch", "amd64", "--show-files"})
+	assert.ErrorContains(t, rootCmd.Execute(), "no Contents index found")
+
+	rootCmd.SetArgs([]string{"info", "deb file://" + repo + "/ /", "kubeadm", "--no-cache", "--show-files", "--format", "tsv"})
+	assert.ErrorContains(t, rootCmd.Execute(), "--show-files doesn't support the tsv format")
+}
+
+func TestInfoLongDescription(t *testing.T) {
+	control := "Package: alpha\nFilename: pool/alpha.deb\nSize: 1\nDescription: first letter\n A longer description\n .\n over two paragraphs.\n"
+	var pkg *deb822.Package
+	for p, err := range deb822.ParsePackages(strings.NewReader(control)) {
+		require.NoError(t, err)
+		pkg = p
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, outputPackageInfo(&buf, pkg, nil, "text"))
+	assert.Contains(t, buf.String(), "Description:     first letter\n A longer description\n .\n over two paragraphs.\n")
+
+	// a translated description is kept on one line
+	pkg.Description = "premiere lettre"
+	buf.Reset()
+	require.NoError(t, outputPackageInfo(&buf, pkg, nil, "text"))
+	assert.Contains(t, buf.String(), "Description:     premiere lettre\n")
+	assert.NotContains(t, buf.String(), "A longer description")
+
+	// and it replaces the one in the raw record
+	buf.Reset()
+	require.NoError(t, outputPackageInfo(&buf, pkg, nil, "raw"))
+	assert.Contains(t, buf.String(), "Description: premiere lettre\n")
+	assert.NotContains(t, buf.String(), "A longer description")
+}
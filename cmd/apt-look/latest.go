@@ -1,12 +1,12 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"fmt"
-	"sort"
+	"slices"
 
 	"github.com/rs/zerolog/log"
-	"pault.ag/go/debian/version"
 
 	"github.com/nicwaller/apt-look/pkg/apt"
 	"github.com/nicwaller/apt-look/pkg/deb822"
@@ -19,11 +19,17 @@ type PackageKey struct {
 }
 
 // runLatest shows the latest version of each package grouped by (name, architecture)
-func runLatest(source, format string) error {
+func runLatest(ctx context.Context, source, format string) error {
 	log.Info().Msgf("Finding latest packages from: %s", source)
 	log.Info().Msgf("Format: %s", format)
 
-	sourceList, err := parseSourceInput(source)
+	// packages are grouped by name and architecture, so sort on those unless asked otherwise
+	compare, err := packageComparator(cmp.Or(options.sort, "name"))
+	if err != nil {
+		return err
+	}
+
+	sourceList, err := parseSourceInput(ctx, source)
 	if err != nil {
 		return fmt.Errorf("failed to parse source input: %w", err)
 	}
@@ -31,18 +37,23 @@ func runLatest(source, format string) error {
 	// Map to store the latest version for each (name, architecture) pair
 	latestPackages := make(map[PackageKey]*deb822.Package)
 
+	failures := newSourceFailures(sourceList)
 	for _, src := range sourceList {
-		repo, err := apt.Mount(src, buildMountOptions()...)
+		repo, err := apt.MountContext(ctx, src, buildMountOptions()...)
 		if err != nil {
-			return fmt.Errorf("failed to mount repository: %w", err)
+			if err := failures.skip(src, fmt.Errorf("failed to mount repository: %w", err)); err != nil {
+				return err
+			}
+			continue
 		}
-		ctx := context.TODO()
-
 		count := 0
 		for pkg, err := range repo.Packages(ctx) {
 			if err != nil {
 				return fmt.Errorf("failed to list packages: %w", err)
 			}
+			if !matchesPackageFilters(pkg) {
+				continue
+			}
 
 			key := PackageKey{
 				Name:         pkg.Package,
@@ -60,38 +71,31 @@ func runLatest(source, format string) error {
 		log.Info().Msgf("%d unique packages found in %s", count, repo.DistributionRoot().String())
 	}
 
-	// Check if no packages were found and warn about architecture mismatch
-	if len(latestPackages) == 0 {
-		for _, src := range sourceList {
-			repo, err := apt.Mount(src, buildMountOptions()...)
-			if err != nil {
-				continue
-			}
+	if err := failures.done(); err != nil {
+		return err
+	}
 
-			availableArchs := repo.GetAvailableArchitectures(src.Components)
-			if len(availableArchs) > 0 {
-				log.Warn().Msgf("No packages found for current architecture. Available architectures: %v", availableArchs)
-				break
-			}
-		}
+	// Check if no packages were found and warn about architecture mismatch
+	if len(latestPackages) == 0 && !packageFiltersActive() {
+		warnArchitectureMismatch(ctx, sourceList)
 	}
 
-	// Convert to slice and sort by package name, then architecture
+	// Convert to slice and sort, by package name then architecture by default
 	packages := make([]*deb822.Package, 0, len(latestPackages))
 	for _, pkg := range latestPackages {
 		packages = append(packages, pkg)
 	}
 
-	sort.Slice(packages, func(i, j int) bool {
-		if packages[i].Package != packages[j].Package {
-			return packages[i].Package < packages[j].Package
-		}
-		return packages[i].Architecture < packages[j].Architecture
-	})
+	slices.SortFunc(packages, compare)
+
+	// Any index may hold a newer version, so the limit only applies once every index is read
+	if limitReached(len(packages)) {
+		packages = packages[:options.limit]
+	}
 
 	// Output all packages in the requested format
 	for _, pkg := range packages {
-		if err := outputPackage(pkg, format); err != nil {
+		if err := outputPackage(stdout, pkg, format); err != nil {
 			return fmt.Errorf("failed to output package: %w", err)
 		}
 	}
@@ -100,7 +104,6 @@ func runLatest(source, format string) error {
 }
 
 // isNewerVersion compares two Debian version strings and returns true if v1 is newer than v2
-// Uses the proper Debian version comparison from pault.ag/go/debian/version
 func isNewerVersion(v1, v2 string) bool {
 	if v1 == v2 {
 		return false
@@ -112,17 +115,5 @@ func isNewerVersion(v1, v2 string) bool {
 		return true
 	}
 
-	ver1, err1 := version.Parse(v1)
-	if err1 != nil {
-		// Fall back to string comparison if parsing fails
-		return v1 > v2
-	}
-
-	ver2, err2 := version.Parse(v2)
-	if err2 != nil {
-		// Fall back to string comparison if parsing fails
-		return v1 > v2
-	}
-
-	return version.Compare(ver1, ver2) > 0
+	return deb822.CompareVersions(v1, v2) > 0
 }
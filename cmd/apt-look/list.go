@@ -4,16 +4,19 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"slices"
 	"strings"
 
 	"github.com/rs/zerolog/log"
 
 	"github.com/nicwaller/apt-look/pkg/apt"
+	"github.com/nicwaller/apt-look/pkg/apt/sources"
 	"github.com/nicwaller/apt-look/pkg/deb822"
 )
 
 // Implementation functions (stubs for demonstration)
-func runList(source, format string) error {
+func runList(ctx context.Context, source, format string) error {
 	log.Info().Msgf("Listing packages from: %s", source)
 	log.Info().Msgf("Format: %s", format)
 
@@ -24,133 +27,228 @@ func runList(source, format string) error {
 	// 3. Parsing package metadata
 	// 4. Formatting output according to --format flag
 
-	sourceList, err := parseSourceInput(source)
+	sourceList, err := parseSourceInput(ctx, source)
 	if err != nil {
 		return fmt.Errorf("failed to parse source input: %w", err)
 	}
 
+	// --sort has to see every package before any is output, and only then applies --limit
+	var compare func(a, b *deb822.Package) int
+	var sorted []*deb822.Package
+	if options.sort != "" {
+		if compare, err = packageComparator(options.sort); err != nil {
+			return err
+		}
+	}
+
 	packageNames := make(map[string]bool) // for deduplication
 
+	// packages are written as they are found, so the progress is only drawn when they aren't on the terminal too
+	progress, stopProgress := startProgress(!isTerminal(stdout))
+	defer stopProgress()
+
+	failures := newSourceFailures(sourceList)
 	for _, src := range sourceList {
-		repo, err := apt.Mount(src, buildMountOptions()...)
+		if compare == nil && limitReached(len(packageNames)) {
+			break
+		}
+		repo, err := apt.MountContext(ctx, src, append(buildMountOptions(), apt.WithProgress(progress))...)
 		if err != nil {
-			return fmt.Errorf("failed to mount repository: %w", err)
+			if err := failures.skip(src, fmt.Errorf("failed to mount repository: %w", err)); err != nil {
+				return err
+			}
+			continue
+		}
+		// deb-src entries list source packages from the Sources indexes
+		if src.Type == sources.SourceTypeSrc {
+			count, err := listSourcePackages(ctx, repo, format, packageNames)
+			if err != nil {
+				return err
+			}
+			log.Info().Msgf("%d source packages found in %s", count, repo.DistributionRoot().String())
+			continue
 		}
-		ctx := context.TODO()
 
 		count := 0
 		for pkg, err := range repo.Packages(ctx) {
 			if err != nil {
 				return fmt.Errorf("failed to list packages: %w", err)
 			}
+			if !matchesPackageFilters(pkg) {
+				continue
+			}
 			if !packageNames[pkg.Package] {
-				if err := outputPackage(pkg, format); err != nil {
+				if compare != nil {
+					sorted = append(sorted, pkg)
+				} else if err := outputPackage(stdout, pkg, format); err != nil {
 					return fmt.Errorf("failed to output package: %w", err)
 				}
 				packageNames[pkg.Package] = true
 				count++
 			}
+			// stopping the iteration early also skips fetching the remaining indexes
+			if compare == nil && limitReached(len(packageNames)) {
+				break
+			}
 		}
 		log.Info().Msgf("%d packages found in %s", count, repo.DistributionRoot().String())
 	}
 
+	if err := failures.done(); err != nil {
+		return err
+	}
+
+	if compare != nil {
+		slices.SortFunc(sorted, compare)
+		if limitReached(len(sorted)) {
+			sorted = sorted[:options.limit]
+		}
+		for _, pkg := range sorted {
+			if err := outputPackage(stdout, pkg, format); err != nil {
+				return fmt.Errorf("failed to output package: %w", err)
+			}
+		}
+	}
+
 	// Check if no packages were found and warn about architecture mismatch
-	if len(packageNames) == 0 {
-		for _, src := range sourceList {
-			repo, err := apt.Mount(src, buildMountOptions()...)
-			if err != nil {
+	if len(packageNames) == 0 && !packageFiltersActive() {
+		warnArchitectureMismatch(ctx, sourceList)
+	}
+
+	return nil
+}
+
+// warnArchitectureMismatch warns about the first source that offers none of the requested architectures,
+// which is the usual reason for finding no packages
+func warnArchitectureMismatch(ctx context.Context, sourceList []sources.Entry) {
+	for _, src := range sourceList {
+		repo, err := apt.MountContext(ctx, src, buildMountOptions()...)
+		if err != nil || len(repo.Architectures()) > 0 {
+			continue
+		}
+		available := repo.GetAvailableArchitectures(repo.Components())
+		if len(available) == 0 {
+			continue
+		}
+
+		requested := options.arch
+		if len(requested) == 0 {
+			requested = src.Architectures()
+		}
+		if len(requested) == 0 {
+			requested = sources.DefaultArchitectures()
+		}
+		log.Warn().Msgf("No packages found: asked for %s but %s only has %s",
+			strings.Join(requested, ", "), repo.DistributionRoot(), strings.Join(available, ", "))
+		return
+	}
+}
+
+// listSourcePackages outputs each source package not already in seen and returns how many were output
+func listSourcePackages(ctx context.Context, repo *apt.Repository, format string, seen map[string]bool) (int, error) {
+	count := 0
+	for src, err := range repo.SourcePackages(ctx) {
+		if err != nil {
+			return count, fmt.Errorf("failed to list source packages: %w", err)
+		}
+		if seen[src.Package] {
+			continue
+		}
+		if err := outputSource(stdout, src, format); err != nil {
+			return count, fmt.Errorf("failed to output source package: %w", err)
+		}
+		seen[src.Package] = true
+		count++
+		if limitReached(len(seen)) {
+			break
+		}
+	}
+	return count, nil
+}
+
+// outputSource outputs a single source package in the specified format
+func outputSource(w io.Writer, src *deb822.Source, format string) error {
+	events.emit(event{Event: "package", Package: src.Package, Version: src.Version, Architecture: "source"})
+	switch format {
+	case "text":
+		fmt.Fprintf(w, "%s\n", src.Package)
+	case "json", "jsonl":
+		data, err := json.Marshal(src)
+		if err != nil {
+			return fmt.Errorf("failed to marshal source package to JSON: %w", err)
+		}
+		fmt.Fprintf(w, "%s\n", string(data))
+	case "tsv":
+		// TSV format: Package\tVersion\tArchitecture\tSection\tDirectory
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			src.Package,
+			src.Version,
+			src.Architecture,
+			src.Section,
+			src.Directory)
+	case "csv":
+		return writeCSVRow(w, []string{"package", "version", "architecture", "section", "directory"}, []string{
+			src.Package,
+			src.Version,
+			src.Architecture,
+			src.Section,
+			src.Directory,
+		})
+	case "raw":
+		// multi-line fields such as Checksums-Sha256 keep their continuation lines
+		for _, field := range src.Fields() {
+			lines := src.GetFieldLines(field)
+			if len(lines) == 0 {
 				continue
 			}
-
-			availableArchs := repo.GetAvailableArchitectures(src.Components)
-			if len(availableArchs) > 0 {
-				log.Warn().Msgf("No packages found for current architecture. Available architectures: %v", availableArchs)
-				break
+			fmt.Fprintf(w, "%s: %s\n", field, lines[0])
+			for _, line := range lines[1:] {
+				fmt.Fprintf(w, " %s\n", line)
 			}
 		}
+		fmt.Fprintf(w, "\n")
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
 	}
-
 	return nil
 }
 
 // outputPackage outputs a single package in the specified format
-func outputPackage(pkg *deb822.Package, format string) error {
+func outputPackage(w io.Writer, pkg *deb822.Package, format string) error {
+	emitPackage(pkg)
 	switch format {
 	case "text":
-		fmt.Printf("%s\n", pkg.Package)
-	case "json":
+		fmt.Fprintf(w, "%s\n", pkg.Package)
+	case "json", "jsonl":
+		// one compact object per line, written as each package is found
 		data, err := json.Marshal(pkg)
 		if err != nil {
 			return fmt.Errorf("failed to marshal package to JSON: %w", err)
 		}
-		fmt.Printf("%s\n", string(data))
+		fmt.Fprintf(w, "%s\n", string(data))
 	case "tsv":
-		// TSV format: Package\tVersion\tArchitecture\tSection\tDescription
-		fmt.Printf("%s\t%s\t%s\t%s\t%s\n",
+		// TSV format: Package\tVersion\tArchitecture\tSection\tSynopsis
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
 			pkg.Package,
 			pkg.Version,
 			pkg.Architecture,
 			pkg.Section,
-			strings.ReplaceAll(pkg.Description, "\n", " "))
+			pkg.Synopsis())
+	case "csv":
+		// encoding/csv quotes descriptions containing commas, quotes or newlines
+		return writeCSVRow(w, packageCSVHeader, []string{
+			pkg.Package,
+			pkg.Version,
+			pkg.Architecture,
+			pkg.Section,
+			pkg.Description,
+		})
 	case "raw":
-		// Output the raw RFC822 format
-		fmt.Printf("Package: %s\n", pkg.Package)
-		if pkg.Version != "" {
-			fmt.Printf("Version: %s\n", pkg.Version)
-		}
-		if pkg.Architecture != "" {
-			fmt.Printf("Architecture: %s\n", pkg.Architecture)
-		}
-		if pkg.Section != "" {
-			fmt.Printf("Section: %s\n", pkg.Section)
-		}
-		if pkg.Priority != "" {
-			fmt.Printf("Priority: %s\n", pkg.Priority)
-		}
-		if pkg.Maintainer != "" {
-			fmt.Printf("Maintainer: %s\n", pkg.Maintainer)
-		}
-		if pkg.Size > 0 {
-			fmt.Printf("Size: %d\n", pkg.Size)
-		}
-		if pkg.InstalledSize > 0 {
-			fmt.Printf("Installed-Size: %d\n", pkg.InstalledSize)
-		}
-		if pkg.Homepage != "" {
-			fmt.Printf("Homepage: %s\n", pkg.Homepage)
-		}
-		if pkg.Description != "" {
-			fmt.Printf("Description: %s\n", pkg.Description)
-		}
-		if pkg.Filename != "" {
-			fmt.Printf("Filename: %s\n", pkg.Filename)
-		}
-		if pkg.SHA256 != "" {
-			fmt.Printf("SHA256: %s\n", pkg.SHA256)
-		}
-		if pkg.MD5sum != "" {
-			fmt.Printf("MD5sum: %s\n", pkg.MD5sum)
-		}
-		if pkg.SHA1 != "" {
-			fmt.Printf("SHA1: %s\n", pkg.SHA1)
-		}
-		// Add dependency fields if they exist
-		if pkg.Depends != "" {
-			fmt.Printf("Depends: %s\n", pkg.Depends)
-		}
-		if pkg.Recommends != "" {
-			fmt.Printf("Recommends: %s\n", pkg.Recommends)
-		}
-		if pkg.Suggests != "" {
-			fmt.Printf("Suggests: %s\n", pkg.Suggests)
-		}
-		if pkg.Conflicts != "" {
-			fmt.Printf("Conflicts: %s\n", pkg.Conflicts)
-		}
-		if pkg.Provides != "" {
-			fmt.Printf("Provides: %s\n", pkg.Provides)
+		// every field of the record, in the order of the Packages index
+		if err := pkg.Write(w); err != nil {
+			return fmt.Errorf("failed to write package record: %w", err)
 		}
-		fmt.Printf("\n") // Blank line between packages
+		fmt.Fprintf(w, "\n") // Blank line between packages
 	default:
 		return fmt.Errorf("unsupported format: %s", format)
 	}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListFlatRepository(t *testing.T) {
+	repo, err := filepath.Abs("../../pkg/apt/testdata/flatrepo")
+	require.NoError(t, err)
+	source := "deb file://" + repo + "/ /"
+
+	tests := map[string][]string{
+		"amd64": {"kubeadm", "kubectl"},
+		"arm64": {"kubeadm"},
+	}
+	for arch, expected := range tests {
+		t.Run(arch, func(t *testing.T) {
+			output := runCommand(t, "list", source, "--no-cache", "--arch", arch, "--format", "text")
+			assert.Equal(t, expected, strings.Split(strings.TrimSpace(output), "\n"))
+		})
+	}
+}
+
+func TestListSkipsFailedSources(t *testing.T) {
+	repo := t.TempDir()
+	writeMirrorRepo(t, repo)
+	dead := "deb file://" + filepath.Join(t.TempDir(), "gone") + " stable main"
+	sourcesList := filepath.Join(t.TempDir(), "sources.list")
+	writeFile(t, filepath.Dir(sourcesList), "sources.list", dead+"\ndeb file://"+repo+" stable main\n")
+
+	output := runCommand(t, "list", sourcesList, "--no-cache", "--arch", "amd64", "--format", "text")
+	assert.Equal(t, "alpha\n", output)
+
+	rootCmd.SetArgs([]string{"list", sourcesList, "--no-cache", "--arch", "amd64", "--fail-fast"})
+	assert.ErrorContains(t, rootCmd.Execute(), "failed to mount repository")
+
+	writeFile(t, filepath.Dir(sourcesList), "sources.list", dead+"\n"+dead+"\n")
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"list", sourcesList, "--no-cache", "--arch", "amd64"})
+	assert.ErrorContains(t, rootCmd.Execute(), "all 2 sources failed")
+}
+
+func TestListExclude(t *testing.T) {
+	repo, err := filepath.Abs("../../pkg/apt/testdata/compressedrepo")
+	require.NoError(t, err)
+	source := "deb file://" + repo + " stable main"
+
+	output := runCommand(t, "list", source, "--no-cache", "--arch", "amd64", "--exclude", "rav")
+	assert.Equal(t, "alpha\n", output)
+	output = runCommand(t, "search", source, "a", "--no-cache", "--arch", "amd64", "--exclude", "glob:a*")
+	assert.Equal(t, "bravo - second test package\n", output)
+}
+
+func TestListNestedArchives(t *testing.T) {
+	vendor := t.TempDir()
+	writeMirrorRepo(t, filepath.Join(vendor, "debian"))
+	require.NoError(t, os.CopyFS(filepath.Join(vendor, "ubuntu", "22.04"), os.DirFS("../../pkg/apt/testdata/compressedrepo")))
+
+	output := runCommand(t, "list", "file://"+vendor, "--discover-depth", "2", "--no-cache", "--arch", "amd64", "--format", "tsv")
+	// alpha 1.0 is only in the debian archive, and bravo only in the ubuntu one
+	assert.Equal(t, "alpha\t1.0\tamd64\t\t\nbravo\t2.0-1\tall\tdoc\tsecond test package\n", output)
+
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"list", "file://" + vendor, "--no-cache", "--arch", "amd64"})
+	assert.ErrorContains(t, rootCmd.Execute(), "no valid distributions found")
+
+	// --depth is only the dependency depth of graph
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"list", "file://" + vendor, "--depth", "2", "--no-cache"})
+	assert.ErrorContains(t, rootCmd.Execute(), "unknown flag: --depth")
+
+	// deep searches probe too many directories to allow
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"list", "file://" + vendor, "--discover-depth", "4", "--no-cache"})
+	assert.ErrorContains(t, rootCmd.Execute(), "--discover-depth must be between 0 and 3")
+}
@@ -1,25 +1,115 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
 	"github.com/nicwaller/apt-look/pkg/apt"
 	apttransport2 "github.com/nicwaller/apt-look/pkg/apt/apttransport"
 	"github.com/nicwaller/apt-look/pkg/apt/sources"
 )
 
+// transports is shared by every subcommand so cache statistics cover the whole run.
+// It is set up in PersistentPreRunE, after the cache flags have been parsed.
+var transports *apttransport2.Registry
+
 var options struct {
-	format string
-	output string
-	debug  bool
-	arch   []string
+	format     string
+	output     string
+	outputFile string
+	debug      bool
+	quiet      bool
+	events     bool
+	arch       []string
+
+	components []string
+
+	keyring       []string
+	allowUnsigned bool
+	trusted       bool
+
+	strictFreshness bool
+
+	noCache  bool
+	cacheDir string
+	cacheTTL time.Duration
+	cacheMax int64
+	pdiff    bool
+
+	indexCache bool
+
+	timeout      time.Duration
+	deadline     time.Duration
+	retries      int
+	maxRedirects int
+	failFast     bool
+	mirrors      []string
+	userAgent    string
+	proxy        string
+	rateLimit    byteSize
+	concurrency  int
+
+	namesOnly      bool
+	lang           string
+	showFiles      bool
+	downloadSource bool
+	limit          int
+	sort           string
+
+	essentialOnly bool
+	priority      []string
+	exclude       []string
+
+	verifyHashes bool
+
+	bySectionSize bool
+
+	depth         int
+	discoverDepth int
+
+	includeDisabled bool
+}
+
+// validFormats lists the values accepted by --format
+var validFormats = []string{"text", "json", "jsonl", "tsv", "csv", "prom", "raw"}
+
+// envFlags are the environment variables that set the default of a flag, which the flag itself still overrides
+var envFlags = []struct{ env, flag string }{
+	{"APT_LOOK_FORMAT", "format"},
+	{"APT_LOOK_CACHE_DIR", "cache-dir"},
+	{"APT_LOOK_NO_CACHE", "no-cache"},
+	{"APT_LOOK_TIMEOUT", "timeout"},
+	{"APT_LOOK_USER_AGENT", "user-agent"},
+}
+
+// applyEnvFlags sets the flags that weren't given on the command line from their environment variables
+func applyEnvFlags(flags *pflag.FlagSet) error {
+	for _, ef := range envFlags {
+		value, ok := os.LookupEnv(ef.env)
+		if !ok || flags.Changed(ef.flag) {
+			continue
+		}
+		if err := flags.Set(ef.flag, value); err != nil {
+			return fmt.Errorf("invalid %s: %w", ef.env, err)
+		}
+	}
+	return nil
 }
 
 // Root command
@@ -32,6 +122,8 @@ and download specific packages without requiring system APT configuration.`,
 	Example: `  apt-look list "deb http://archive.ubuntu.com/ubuntu/ jammy main"
   apt-look info /etc/apt/sources.list golang-1.21
   apt-look stats "deb http://archive.ubuntu.com/ubuntu/ jammy main"`,
+	// main logs the error, or a short message when the command was cancelled
+	SilenceErrors: true,
 }
 
 // List command
@@ -39,14 +131,18 @@ var listCmd = &cobra.Command{
 	Use:   "list <source>",
 	Short: "List all packages in the repository",
 	Long: `List all packages available in the specified APT repository.
-Source can be either a full APT source line or a path to a sources.list file.`,
+Source can be either a full APT source line, a path to a sources.list file,
+or a directory of *.list and *.sources files such as /etc/apt/sources.list.d.
+Use - to read sources from standard input.`,
 	Args: cobra.ExactArgs(1),
 	Example: `  apt-look list "deb http://archive.ubuntu.com/ubuntu/ jammy main"
   apt-look list /etc/apt/sources.list
+  apt-look list /etc/apt/sources.list.d/
+  echo "deb http://archive.ubuntu.com/ubuntu/ jammy main" | apt-look list -
   apt-look list /etc/apt/sources.list.d/docker.list --format=json`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		source := args[0]
-		return runList(source, options.format)
+		return runList(cmd.Context(), source, options.format)
 	},
 }
 
@@ -58,11 +154,12 @@ var infoCmd = &cobra.Command{
 dependencies, description, and other available information.`,
 	Args: cobra.ExactArgs(2),
 	Example: `  apt-look info "deb http://archive.ubuntu.com/ubuntu/ jammy main" golang-1.21
-  apt-look info /etc/apt/sources.list python3-requests --format=json`,
+  apt-look info /etc/apt/sources.list python3-requests --format=json
+  apt-look info "deb http://deb.debian.org/debian bookworm main" curl --show-files`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		source := args[0]
 		packageName := args[1]
-		return runInfo(source, packageName, options.format)
+		return runInfo(cmd.Context(), source, packageName, options.format)
 	},
 }
 
@@ -71,21 +168,22 @@ var statsCmd = &cobra.Command{
 	Use:   "stats <source>",
 	Short: "Show repository statistics",
 	Long: `Display statistics about the repository including total number of packages,
-total size, breakdown by component, and other metadata.`,
+total download and installed size, breakdown by architecture and component, and other metadata.`,
 	Args: cobra.ExactArgs(1),
 	Example: `  apt-look stats "deb http://archive.ubuntu.com/ubuntu/ jammy main"
-  apt-look stats /etc/apt/sources.list --format=json`,
+  apt-look stats /etc/apt/sources.list --format=json
+  apt-look stats "deb http://archive.ubuntu.com/ubuntu/ noble main universe" --by-section-size`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		source := args[0]
 
 		// TODO: how to share this among all subcommands?
 		// Parse source input
-		sources, err := parseSourceInput(source)
+		sources, err := parseSourceInput(cmd.Context(), source)
 		if err != nil {
 			return fmt.Errorf("failed to parse source: %w", err)
 		}
 
-		return runStats(sources, options.format)
+		return runStats(cmd.Context(), sources, options.format)
 	},
 }
 
@@ -94,14 +192,21 @@ var downloadCmd = &cobra.Command{
 	Use:   "download <source> <package>",
 	Short: "Download the latest version of a package",
 	Long: `Download the latest version of the specified package from the repository.
-The package will be saved to the current directory or the path specified with --output.`,
+The package will be saved to the current directory or the path specified with --output.
+
+With --source, the argument names a source package, and the files listed for it in the
+repository's Sources indexes (the .dsc and its tarballs) are saved to the output directory.`,
 	Args: cobra.ExactArgs(2),
 	Example: `  apt-look download "deb http://archive.ubuntu.com/ubuntu/ jammy main" golang-1.21
-  apt-look download /etc/apt/sources.list containerd --output=/tmp/packages/`,
+  apt-look download /etc/apt/sources.list containerd --output=/tmp/packages/
+  apt-look download "deb-src http://deb.debian.org/debian bookworm main" hello --source --output=hello/`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		source := args[0]
 		packageName := args[1]
-		return runDownload(source, packageName, options.output)
+		if options.downloadSource {
+			return runDownloadSource(cmd.Context(), source, packageName, options.output)
+		}
+		return runDownload(cmd.Context(), source, packageName, options.output)
 	},
 }
 
@@ -117,7 +222,7 @@ The search is case-insensitive and matches partial strings.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		source := args[0]
 		searchTerm := args[1]
-		return runSearch(source, searchTerm, options.format)
+		return runSearch(cmd.Context(), source, searchTerm, options.format, options.namesOnly)
 	},
 }
 
@@ -132,7 +237,7 @@ Packages are grouped by (name, architecture) tuple and only the latest version i
   apt-look latest /etc/apt/sources.list --format=json`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		source := args[0]
-		return runLatest(source, options.format)
+		return runLatest(cmd.Context(), source, options.format)
 	},
 }
 
@@ -142,59 +247,347 @@ var checkCmd = &cobra.Command{
 	Short: "Verify repository integrity",
 	Long: `Perform integrity checks on APT repositories by verifying that files listed
 in Release file hash sections actually exist on the server. Reports missing files,
-broken references, and other repository integrity issues.`,
+broken references, and other repository integrity issues.
+
+Sizes are checked with HEAD requests where the transport supports them; with
+--verify-hashes every file is downloaded so its content can be hashed.`,
 	Args: cobra.ExactArgs(1),
 	Example: `  apt-look check "deb http://archive.ubuntu.com/ubuntu/ jammy main"
-  apt-look check /etc/apt/sources.list --format=json`,
+  apt-look check /etc/apt/sources.list --format=json
+  apt-look check "deb http://archive.ubuntu.com/ubuntu/ jammy main" --verify-hashes`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		source := args[0]
+		return runCheck(cmd.Context(), source, options.format, options.verifyHashes)
+	},
+}
+
+// Diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff <sourceA> <sourceB>",
+	Short: "Compare the packages of two repositories",
+	Long: `Compare the latest version of each package and architecture in two sources, such
+as two suites or a staging mirror and production. Reports packages added in sourceB,
+removed from it, and upgraded or downgraded by dpkg version order, sorted by name.`,
+	Args: cobra.ExactArgs(2),
+	Example: `  apt-look diff "deb http://archive.ubuntu.com/ubuntu/ jammy main" "deb http://archive.ubuntu.com/ubuntu/ noble main"
+  apt-look diff "deb http://staging.example.com/debian stable main" "deb http://deb.example.com/debian stable main" --format=tsv`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runDiff(cmd.Context(), args[0], args[1], options.format)
+	},
+}
+
+// Verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify <source> [package]",
+	Short: "Verify package files against the Packages index",
+	Long: `Download the .deb files referenced by the Packages indexes and check that their
+sizes and SHA256/SHA1/MD5 hashes match the values recorded in the index. Reports hash
+mismatches and missing pool files, and exits with an error if any package fails.
+
+With a package name only the files of that package are verified; otherwise every
+package in the repository is, which downloads the whole pool.`,
+	Args: cobra.RangeArgs(1, 2),
+	Example: `  apt-look verify "deb http://archive.ubuntu.com/ubuntu/ jammy main" golang-1.21
+  apt-look verify "deb [arch=amd64] http://repo.example.com/debian stable main" --format=json`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		source := args[0]
+		packageName := ""
+		if len(args) > 1 {
+			packageName = args[1]
+		}
+		return runVerify(cmd.Context(), source, packageName, options.format)
+	},
+}
+
+// Mirror command
+var mirrorCmd = &cobra.Command{
+	Use:   "mirror <source> <destdir>",
+	Short: "Copy a repository, or part of it, to a local directory",
+	Long: `Download the Release files, the Packages indexes and every .deb file they reference
+into destdir, laid out in the same dists/ and pool/ structure as the repository, so it
+can be served or used with a file: source.
+
+Use --arch and --components to mirror only what's needed. Files are verified against
+the hashes in the Release file and Packages indexes, and files already in destdir with
+a matching hash are skipped, so an interrupted mirror can be resumed by running it again.
+
+A mirror of part of a repository gets a Release file that only lists the indexes it holds.
+That file can't carry the repository's signature, so the mirror is unsigned.`,
+	Args: cobra.ExactArgs(2),
+	Example: `  apt-look mirror "deb http://archive.ubuntu.com/ubuntu/ jammy main" ./ubuntu --arch=amd64
+  apt-look mirror /etc/apt/sources.list.d/docker.list /srv/mirror/docker`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runMirror(cmd.Context(), args[0], args[1])
+	},
+}
+
+// Graph command
+var graphCmd = &cobra.Command{
+	Use:   "graph <source> [package]",
+	Short: "Export the dependency graph as Graphviz DOT",
+	Long: `Output the Pre-Depends, Depends and Recommends relationships between packages as a
+Graphviz DOT graph. Recommends are drawn dashed, and virtual packages are drawn as
+ellipses with dotted edges to the packages that provide them.
+
+With a package name only the packages it reaches are graphed, up to --depth
+relationships away. Use --format=json or --format=tsv for the raw nodes and edges.`,
+	Args: cobra.RangeArgs(1, 2),
+	Example: `  apt-look graph "deb http://deb.debian.org/debian bookworm main" curl --depth=2 | dot -Tsvg > curl.svg
+  apt-look graph "deb [arch=amd64] https://download.docker.com/linux/ubuntu jammy stable" --format=tsv`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		source := args[0]
+		packageName := ""
+		if len(args) > 1 {
+			packageName = args[1]
+		}
+		return runGraph(cmd.Context(), source, packageName, options.format, options.depth)
+	},
+}
+
+// Find-file command
+var findFileCmd = &cobra.Command{
+	Use:     "find-file <source> <path>",
+	Aliases: []string{"which-package"},
+	Short:   "Find which packages contain a file",
+	Long: `Find the packages that ship the file at the given path, using the Contents
+index for the target architectures. The path may be given with or without a leading slash.`,
+	Args: cobra.ExactArgs(2),
+	Example: `  apt-look find-file "deb http://deb.debian.org/debian bookworm main" /usr/bin/hello
+  apt-look find-file /etc/apt/sources.list usr/lib/x86_64-linux-gnu/libssl.so.3 --format=json`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		source := args[0]
+		filePath := args[1]
+		return runFindFile(cmd.Context(), source, filePath, options.format)
+	},
+}
+
+// Rdepends command
+var rdependsCmd = &cobra.Command{
+	Use:   "rdepends <source> <package>",
+	Short: "Find packages that depend on a package",
+	Long: `List the packages whose Pre-Depends, Depends or Recommends fields name the given
+package, either directly or through a virtual package it Provides. Useful for
+answering what would break if the package were removed.`,
+	Args: cobra.ExactArgs(2),
+	Example: `  apt-look rdepends "deb http://deb.debian.org/debian bookworm main" libssl3
+  apt-look rdepends /etc/apt/sources.list mail-transport-agent --format=json`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		source := args[0]
-		return runCheck(source, options.format)
+		packageName := args[1]
+		return runRdepends(cmd.Context(), source, packageName, options.format)
 	},
 }
 
 // Purge-cache command
 var purgeCacheCmd = &cobra.Command{
-	Use:   "purge-cache",
-	Short: "Remove all cached repository files",
+	Use:   "purge-cache [source]",
+	Short: "Remove cached repository files",
 	Long: `Remove all cached repository files from the apt-look cache directory.
-This forces fresh downloads of all repository metadata on subsequent operations.`,
-	Args:    cobra.NoArgs,
-	Example: `  apt-look purge-cache`,
+This forces fresh downloads of all repository metadata on subsequent operations.
+
+With a source, only the cached indexes of its repositories are removed, as found from
+their Release files, along with the copies kept by --index-cache and --pdiff, and the
+rest of the cache is kept. By-hash entries for indexes that the current Release files
+no longer list are kept too; purge the whole cache to remove them. The counts of removed
+files are written in the --format given, json and jsonl included.`,
+	Args: cobra.MaximumNArgs(1),
+	Example: `  apt-look purge-cache
+  apt-look purge-cache "deb http://deb.debian.org/debian bookworm main"`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 1 {
+			return runPurgeCacheSource(cmd.Context(), args[0], options.format)
+		}
 		return runPurgeCache()
 	},
 }
 
+// Cache-info command
+var cacheInfoCmd = &cobra.Command{
+	Use:   "cache-info",
+	Short: "Show what the cache holds and how well it works",
+	Long: `Show the apt-look cache directory, how many repository files it holds and their size on
+disk, and how many requests it has answered across runs. A low hit ratio means most
+indexes were fetched again anyway, e.g. because --cache-ttl is short.`,
+	Args: cobra.NoArgs,
+	Example: `  apt-look cache-info
+  apt-look cache-info --format=json`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runCacheInfo(options.format)
+	},
+}
+
 func init() {
 	// Global flags available to all commands
 	rootCmd.PersistentFlags().StringVarP(&options.format, "format", "f", "text",
-		"Output format (text, json, tsv, raw)")
+		"Output format ("+strings.Join(validFormats, ", ")+")")
+	rootCmd.PersistentFlags().StringVar(&options.outputFile, "output-file", "",
+		"Write command results to this file instead of stdout")
 	rootCmd.PersistentFlags().BoolVar(&options.debug, "debug", false,
 		"Enable debug logging")
+	rootCmd.PersistentFlags().BoolVarP(&options.quiet, "quiet", "q", false,
+		"Only log warnings and errors")
+	rootCmd.PersistentFlags().BoolVar(&options.events, "events", false,
+		"Write progress to stderr as newline-delimited JSON events instead of log lines")
 	rootCmd.PersistentFlags().StringSliceVar(&options.arch, "arch", nil,
 		"Target architectures (e.g., amd64,arm64). Defaults to current system architecture.")
+	rootCmd.PersistentFlags().StringSliceVar(&options.components, "components", nil,
+		"Only process these components (e.g., main,universe) of the components a source names")
+	rootCmd.PersistentFlags().StringSliceVar(&options.keyring, "keyring", nil,
+		"Keyring files to verify Release signatures with. Overrides signed-by in source entries.")
+	rootCmd.PersistentFlags().BoolVar(&options.allowUnsigned, "allow-unsigned", false,
+		"Allow repositories without a Release.gpg signature when verifying")
+	rootCmd.PersistentFlags().BoolVar(&options.trusted, "trusted", false,
+		"Skip Release signature verification, as if every source had trusted=yes")
+	rootCmd.PersistentFlags().BoolVar(&options.strictFreshness, "strict-freshness", false,
+		"Fail instead of warning when a Release file is past its Valid-Until date")
+	rootCmd.PersistentFlags().BoolVar(&options.noCache, "no-cache", false,
+		"Bypass the local cache; nothing is read from or written to the cache directory")
+	rootCmd.PersistentFlags().StringVar(&options.cacheDir, "cache-dir", "",
+		"Cache directory (default $XDG_CACHE_HOME/apt-look)")
+	rootCmd.PersistentFlags().BoolVar(&options.pdiff, "pdiff", false,
+		"Keep uncompressed Packages indexes in the cache directory and update them with PDiff patches when the repository publishes them")
+	rootCmd.PersistentFlags().BoolVar(&options.indexCache, "index-cache", false,
+		"Keep uncompressed Packages indexes in the cache directory so packages can be looked up by name without parsing them again")
+	rootCmd.PersistentFlags().DurationVar(&options.cacheTTL, "cache-ttl", apttransport2.DefaultCacheTTL,
+		"Maximum age of cached indexes before they are revalidated with the server (0 means no expiry)")
+	rootCmd.PersistentFlags().Int64Var(&options.cacheMax, "cache-max-bytes", 0,
+		"Evict least recently used cache entries beyond this total size (0 means no limit)")
+	rootCmd.PersistentFlags().DurationVar(&options.timeout, "timeout", apttransport2.DefaultTimeout,
+		"Maximum time for each request to a repository; package downloads allow 30m")
+	rootCmd.PersistentFlags().DurationVar(&options.deadline, "deadline", 0,
+		"Maximum total time for the command, across all requests (0 means no limit)")
+	rootCmd.PersistentFlags().IntVar(&options.retries, "retry", 3,
+		"Number of times to retry a failed HTTP request, with exponential backoff")
+	rootCmd.PersistentFlags().IntVar(&options.maxRedirects, "max-redirects", apttransport2.DefaultMaxRedirects,
+		"Maximum number of redirects to follow for each HTTP request (0 refuses redirects)")
+	rootCmd.PersistentFlags().BoolVar(&options.failFast, "fail-fast", false,
+		"Stop at the first source that can't be mounted, instead of skipping it and reading the others")
+	rootCmd.PersistentFlags().StringSliceVar(&options.mirrors, "fallback-mirror", nil,
+		"Archive roots serving the same repository, tried in turn when a request fails with a network error or 5xx")
+	rootCmd.PersistentFlags().StringVar(&options.userAgent, "user-agent", "",
+		"User-Agent header for HTTP requests (default apt-look/<version> with the project URL)")
+	rootCmd.PersistentFlags().StringVar(&options.proxy, "proxy", "",
+		"HTTP(S) proxy URL. Defaults to HTTP_PROXY/HTTPS_PROXY; NO_PROXY is always honored.")
+	rootCmd.PersistentFlags().Var(&options.rateLimit, "rate-limit",
+		"Cap each download at this many bytes per second, e.g. 500k or 2MB (0 means unlimited)")
+	rootCmd.PersistentFlags().IntVar(&options.concurrency, "concurrency", 4,
+		"Number of package indexes to download in parallel")
+	rootCmd.PersistentFlags().BoolVar(&options.includeDisabled, "include-disabled", false,
+		"Also use sources that are commented out or have Enabled: no")
 
 	// Command-specific flags
 	downloadCmd.Flags().StringVarP(&options.output, "output", "o", ".",
 		"Output directory for downloaded packages")
+	downloadCmd.Flags().BoolVar(&options.downloadSource, "source", false,
+		"Download the files of a source package, listed in the repository's Sources indexes")
+	searchCmd.Flags().BoolVar(&options.namesOnly, "names-only", false,
+		"Match the search term against package names only")
+	for _, cmd := range []*cobra.Command{listCmd, searchCmd, latestCmd} {
+		cmd.Flags().IntVar(&options.limit, "limit", 0,
+			"Stop after this many packages (0 means unlimited)")
+		cmd.Flags().StringSliceVar(&options.exclude, "exclude", nil,
+			"Hide packages whose name contains this, or matches it with a glob: prefix (e.g. -dbg, glob:lib*)")
+		cmd.Flags().IntVar(&options.discoverDepth, "discover-depth", 0,
+			fmt.Sprintf("With a repository URL, also look for archives nested up to this many directories below it, where they can be listed (at most %d)", maxDiscoverDepth))
+	}
+	for _, cmd := range []*cobra.Command{listCmd, latestCmd} {
+		cmd.Flags().StringVar(&options.sort, "sort", "",
+			"Sort by name, version, size or arch; prefix with - for descending (e.g. -size)")
+		cmd.Flags().BoolVar(&options.essentialOnly, "essential-only", false,
+			"Only show packages marked Essential: yes")
+		cmd.Flags().StringSliceVar(&options.priority, "priority", nil,
+			"Only show packages with these priorities (required, important, standard, optional, extra)")
+	}
+	checkCmd.Flags().BoolVar(&options.verifyHashes, "verify-hashes", false,
+		"Download and hash every file to compare with the Release file (slower than size checks)")
+	statsCmd.Flags().BoolVar(&options.bySectionSize, "by-section-size", false,
+		"Break sections down by the download size of their packages, largest first")
+	graphCmd.Flags().IntVar(&options.depth, "depth", 0,
+		"With a package, only follow this many relationships from it (0 means unlimited)")
+	infoCmd.Flags().StringVar(&options.lang, "lang", "en",
+		"Language of the long description, read from the repository's Translation files")
+	infoCmd.Flags().BoolVar(&options.showFiles, "show-files", false,
+		"List the files the package installs, read from the repository's Contents indexes")
 
 	// Add validation for format flag
 	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
-		// Set log level based on debug flag
-		if options.debug {
+		// cobra runs this for its completion request before the completed command's flags are parsed,
+		// so completion functions apply the environment and set up what they need themselves
+		if cmd.Name() == cobra.ShellCompRequestCmd || cmd.Name() == cobra.ShellCompNoDescRequestCmd {
+			return nil
+		}
+		if err := applyEnvFlags(cmd.Flags()); err != nil {
+			return err
+		}
+
+		// Set log level based on debug and quiet flags
+		switch {
+		case options.debug && options.quiet:
+			return fmt.Errorf("--debug and --quiet can't be used together")
+		case options.debug:
 			zerolog.SetGlobalLevel(zerolog.DebugLevel)
-		} else {
+		case options.quiet:
+			zerolog.SetGlobalLevel(zerolog.WarnLevel)
+		default:
 			zerolog.SetGlobalLevel(zerolog.InfoLevel)
 		}
 
-		validFormats := []string{"text", "json", "tsv", "prom", "raw"}
-		for _, validFormat := range validFormats {
-			if options.format == validFormat {
-				return nil
+		if !slices.Contains(validFormats, options.format) {
+			return fmt.Errorf("invalid format '%s'. Valid formats: %s",
+				options.format, strings.Join(validFormats, ", "))
+		}
+		if err := validatePriorities(options.priority); err != nil {
+			return err
+		}
+		if err := validateExcludes(options.exclude); err != nil {
+			return err
+		}
+		if _, err := parseMirrors(options.mirrors); err != nil {
+			return err
+		}
+		if options.discoverDepth < 0 || options.discoverDepth > maxDiscoverDepth {
+			return fmt.Errorf("--discover-depth must be between 0 and %d", maxDiscoverDepth)
+		}
+
+		// with --events, stderr only carries JSON, so log messages become events too
+		events = noEvents{}
+		if options.events {
+			events = newJSONEvents(os.Stderr)
+			log.Logger = zerolog.New(os.Stderr).With().Str("event", "log").Timestamp().Logger()
+		}
+
+		if options.outputFile != "" {
+			f, err := os.Create(options.outputFile)
+			if err != nil {
+				return fmt.Errorf("failed to create output file: %w", err)
+			}
+			stdout = f
+		}
+
+		transports = loadTransports()
+
+		// every fetch made by the command uses this context, so the deadline cancels whatever is in flight.
+		// It's derived from the root's context, since a subcommand keeps the context of an earlier run.
+		ctx := cmd.Root().Context()
+		if options.deadline > 0 {
+			ctx, cancelDeadline = context.WithTimeout(ctx, options.deadline)
+		}
+		cmd.SetContext(ctx)
+
+		// the flags and arguments are valid, so later errors are about the repository rather than usage
+		cmd.SilenceUsage = true
+		return nil
+	}
+	rootCmd.PersistentPostRunE = func(cmd *cobra.Command, args []string) error {
+		if cancelDeadline != nil {
+			cancelDeadline()
+		}
+		if f, ok := stdout.(*os.File); ok && f != os.Stdout {
+			if err := f.Close(); err != nil {
+				return fmt.Errorf("failed to write output file: %w", err)
 			}
 		}
-		return fmt.Errorf("invalid format '%s'. Valid formats: %s",
-			options.format, strings.Join(validFormats, ", "))
+		return nil
 	}
 
 	// Add subcommands to root
@@ -205,45 +598,135 @@ func init() {
 	rootCmd.AddCommand(searchCmd)
 	rootCmd.AddCommand(latestCmd)
 	rootCmd.AddCommand(checkCmd)
+	rootCmd.AddCommand(verifyCmd)
+	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(graphCmd)
+	rootCmd.AddCommand(mirrorCmd)
+	rootCmd.AddCommand(findFileCmd)
+	rootCmd.AddCommand(rdependsCmd)
 	rootCmd.AddCommand(purgeCacheCmd)
+	rootCmd.AddCommand(cacheInfoCmd)
+	registerCompletions()
 }
 
 func loadTransports() *apttransport2.Registry {
 	// Configure caching (enabled by default)
 	cacheConfig := apttransport2.CacheConfig{
-		Disabled: false, // TODO: add --no-cache flag
+		Disabled: options.noCache,
+		CacheDir: options.cacheDir,
+		TTL:      options.cacheTTL,
+		MaxBytes: options.cacheMax,
 	}
 
-	r := apttransport2.NewRegistryWithCache(cacheConfig)
-	r.Register(apttransport2.NewHTTPTransport())
-	r.Register(apttransport2.NewFileTransport())
-	// TODO: on Debian systems, register transports for all available plugins
+	// the registry takes zero as its default, and a negative number for no redirects
+	maxRedirects := options.maxRedirects
+	if maxRedirects == 0 {
+		maxRedirects = -1
+	}
+
+	r := apttransport2.NewRegistryWithConfig(apttransport2.RegistryConfig{
+		Cache:        cacheConfig,
+		Timeout:      options.timeout,
+		Retries:      options.retries,
+		MaxRedirects: maxRedirects,
+		UserAgent:    options.userAgent,
+		Proxy:        options.proxy,
+		RateLimit:    int64(options.rateLimit),
+	})
+	// on Debian systems, apt's own methods handle the schemes apt-look doesn't, e.g. tor+http
+	added, err := apttransport2.RegisterAptMethods(r, apttransport2.DefaultAptMethodsDir)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to register apt methods")
+	} else if len(added) > 0 {
+		log.Debug().Strs("schemes", added).Msg("Registered apt methods")
+	}
 	return r
 }
 
-func runInfo(source, packageName, format string) error {
-	log.Info().Msgf("Getting info for package '%s' from: %s", packageName, source)
-	log.Info().Msgf("Format: %s", format)
+// byteSize is a flag value for a number of bytes, with an optional k, M or G suffix in powers of 1024
+type byteSize int64
 
-	// TODO: Implement package info retrieval
-	// This would involve:
-	// 1. Finding the package in the repository
-	// 2. Extracting detailed metadata
-	// 3. Formatting according to --format flag
+func (s *byteSize) String() string {
+	return strconv.FormatInt(int64(*s), 10)
+}
 
+func (s *byteSize) Set(value string) error {
+	n, err := parseByteSize(value)
+	if err != nil {
+		return err
+	}
+	*s = byteSize(n)
 	return nil
 }
 
-func parseSourceInput(source string) ([]sources.Entry, error) {
+func (s *byteSize) Type() string {
+	return "size"
+}
+
+// parseByteSize parses sizes such as 1048576, 500k, 1.5M or 2MB
+func parseByteSize(value string) (int64, error) {
+	number := strings.TrimSuffix(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(value)), "b"), "i")
+	multiplier := 1.0
+	if suffix := strings.IndexAny(number, "kmg"); suffix >= 0 && suffix == len(number)-1 {
+		multiplier = map[byte]float64{'k': 1 << 10, 'm': 1 << 20, 'g': 1 << 30}[number[suffix]]
+		number = number[:suffix]
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return int64(n * multiplier), nil
+}
+
+// cancelDeadline releases the context set up for --deadline
+var cancelDeadline context.CancelFunc
+
+// stdin is where the "-" source is read from; tests replace it
+var stdin io.Reader = os.Stdin
+
+// stdout is where command results are written, replaced by the file named with --output-file
+var stdout io.Writer = os.Stdout
+
+// parseSourceInput reads the sources named by a command argument, leaving out disabled entries
+// unless --include-disabled is set
+func parseSourceInput(ctx context.Context, source string) ([]sources.Entry, error) {
+	entries, err := readSourceInput(ctx, source)
+	if err != nil || options.includeDisabled {
+		return entries, err
+	}
+
+	enabled := sources.EnabledEntries(entries)
+	if skipped := len(entries) - len(enabled); skipped > 0 {
+		log.Debug().Msgf("Skipping %d disabled sources; use --include-disabled to include them", skipped)
+	}
+	return enabled, nil
+}
+
+// maxDiscoverDepth bounds --discover-depth, since each level probes every directory listed in the one above
+const maxDiscoverDepth = 3
+
+func readSourceInput(ctx context.Context, source string) ([]sources.Entry, error) {
+	// "-" reads sources.list or deb822 content from standard input
+	if source == "-" {
+		sourcesList, err := sources.ParseSources(stdin)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse sources from stdin: %w", err)
+		}
+		return sourcesList, nil
+	}
+
 	// Check if it's a file path
 	if strings.HasPrefix(source, "/") || strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../") {
-		file, err := os.Open(source)
-		if err != nil {
-			return nil, fmt.Errorf("failed to open sources file: %w", err)
+		// A directory such as /etc/apt/sources.list.d holds many *.list and *.sources files
+		if info, err := os.Stat(source); err == nil && info.IsDir() {
+			sourcesList, err := sources.ParseSourcesDir(source)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse sources directory: %w", err)
+			}
+			return sourcesList, nil
 		}
-		defer file.Close()
 
-		sourcesList, err := sources.ParseSourcesList(file)
+		sourcesList, err := sources.ParseSourcesFile(source)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse sources file: %w", err)
 		}
@@ -252,9 +735,23 @@ func parseSourceInput(source string) ([]sources.Entry, error) {
 	}
 
 	// Check if it's a valid URL
-	if parsedURL, err := url.Parse(source); err == nil && parsedURL.Scheme != "" && parsedURL.Host != "" {
+	if isRepositoryURL(source) {
 		// Use apt.Discover to find available distributions and components
-		entries, err := apt.Discover(source)
+		// probing goes through the registry itself, like mounting, so it is cached and bound by --timeout
+		var discoverOpts []apt.DiscoverOption
+		if transports != nil && options.events {
+			discoverOpts = append(discoverOpts, apt.WithDiscoveryTransport(eventTransport{transports}))
+		} else if transports != nil {
+			discoverOpts = append(discoverOpts, apt.WithDiscoveryTransport(transports))
+		}
+		if options.discoverDepth > 0 {
+			discoverOpts = append(discoverOpts, apt.WithDiscoveryDepth(options.discoverDepth))
+		}
+		if len(options.arch) > 0 {
+			// components without packages for the selected architectures would list nothing
+			discoverOpts = append(discoverOpts, apt.WithDiscoveryArchitectures(options.arch...))
+		}
+		entries, err := apt.DiscoverContext(ctx, source, discoverOpts...)
 		if err != nil {
 			return nil, fmt.Errorf("failed to discover repository structure: %w", err)
 		}
@@ -270,64 +767,228 @@ func parseSourceInput(source string) ([]sources.Entry, error) {
 	return []sources.Entry{*entry}, nil
 }
 
+// isRepositoryURL reports whether a source is the URL of a repository to discover, rather than a source line.
+// Local repositories are given as file:// URLs, which have no host.
+func isRepositoryURL(source string) bool {
+	parsedURL, err := url.Parse(source)
+	return err == nil && parsedURL.Scheme != "" && (parsedURL.Host != "" || parsedURL.Scheme == "file")
+}
+
+// limitReached reports whether n results satisfy the --limit flag
+func limitReached(n int) bool {
+	return options.limit > 0 && n >= options.limit
+}
+
 // buildMountOptions creates mount options from global flags
 func buildMountOptions() []apt.MountOption {
 	var opts []apt.MountOption
+	if transports != nil && options.events {
+		opts = append(opts, apt.WithTransport(eventTransport{transports}))
+	} else if transports != nil {
+		opts = append(opts, apt.WithTransport(transports))
+	}
 	if len(options.arch) > 0 {
 		opts = append(opts, apt.WithArchitectures(options.arch...))
 	}
+	if len(options.components) > 0 {
+		opts = append(opts, apt.WithComponents(options.components...))
+	}
+	if options.concurrency > 1 {
+		opts = append(opts, apt.WithConcurrency(options.concurrency))
+	}
+	if len(options.keyring) > 0 {
+		opts = append(opts, apt.WithKeyring(options.keyring...))
+	}
+	if options.allowUnsigned {
+		opts = append(opts, apt.WithAllowUnsigned())
+	}
+	if options.trusted {
+		opts = append(opts, apt.WithTrusted())
+	}
+	if options.strictFreshness {
+		opts = append(opts, apt.WithStrictFreshness())
+	}
+	if options.pdiff && !options.noCache {
+		opts = append(opts, apt.WithPDiff(pdiffDir()))
+	}
+	if options.indexCache && !options.noCache {
+		opts = append(opts, apt.WithIndexCache(indexCacheDir()))
+	}
+	// the mirrors were checked in the root's pre-run
+	if mirrors, _ := parseMirrors(options.mirrors); len(mirrors) > 0 {
+		opts = append(opts, apt.WithMirrors(mirrors...))
+	}
 	return opts
 }
 
-func runDownload(source, packageName, outputPath string) error {
-	log.Info().Msgf("Downloading package '%s' from: %s", packageName, source)
-	log.Info().Msgf("Output path: %s", outputPath)
-
-	// TODO: Implement package download
-	// This would involve:
-	// 1. Finding the package and its download URL
-	// 2. Downloading the .deb file
-	// 3. Saving to the specified output path
-	// 4. Showing progress during download
-
-	return nil
+// parseMirrors parses the --fallback-mirror archive roots, which need a scheme like a source's URI
+func parseMirrors(values []string) ([]*url.URL, error) {
+	var mirrors []*url.URL
+	for _, value := range values {
+		mirror, err := url.Parse(value)
+		if err != nil || mirror.Scheme == "" {
+			return nil, fmt.Errorf("invalid fallback mirror '%s': must be a URL such as http://mirror.example.com/debian", value)
+		}
+		mirrors = append(mirrors, mirror)
+	}
+	return mirrors, nil
 }
 
-func runSearch(source, searchTerm, format string) error {
-	log.Info().Msgf("Searching for '%s' in: %s", searchTerm, source)
-	log.Info().Msgf("Format: %s", format)
+// pdiffDir returns where --pdiff keeps the Packages indexes it patches
+func pdiffDir() string {
+	return filepath.Join(cacheRoot(), "pdiff")
+}
 
-	// TODO: Implement package search
-	// This would involve:
-	// 1. Parsing package names and descriptions
-	// 2. Filtering by search term
-	// 3. Formatting results according to --format flag
+// indexCacheDir returns where Packages indexes are kept so packages can be looked up by name without parsing them
+func indexCacheDir() string {
+	return filepath.Join(cacheRoot(), "index")
+}
 
-	return nil
+func cacheRoot() string {
+	if options.cacheDir != "" {
+		return options.cacheDir
+	}
+	return apttransport2.DefaultCacheDir()
 }
 
 func runPurgeCache() error {
 	log.Info().Msg("Purging apt-look cache")
 
-	// Load transport registry to access cache functionality
-	registry := loadTransports()
-
 	// Purge the cache
-	err := registry.PurgeCache()
+	err := transports.PurgeCache()
 	if err != nil {
 		return fmt.Errorf("failed to purge cache: %w", err)
 	}
+	// the indexes kept for --pdiff and for looking up packages are cached data too
+	for _, dir := range []string{pdiffDir(), indexCacheDir()} {
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("failed to purge cache: %w", err)
+		}
+	}
 
 	log.Info().Msg("Cache purged successfully")
 	return nil
 }
 
-func main() {
+// runPurgeCacheSource removes the cache entries of the indexes of the repositories in source
+func runPurgeCacheSource(ctx context.Context, source, format string) error {
+	log.Info().Msgf("Purging apt-look cache for: %s", source)
+
+	sourceList, err := parseSourceInput(ctx, source)
+	if err != nil {
+		return fmt.Errorf("failed to parse source input: %w", err)
+	}
+
+	var purged, copies int
+	failures := newSourceFailures(sourceList)
+	// the copies kept by --index-cache and --pdiff are found whether or not those flags are set now
+	mountOpts := append(buildMountOptions(), apt.WithIndexCache(indexCacheDir()), apt.WithPDiff(pdiffDir()))
+	for _, src := range sourceList {
+		repo, err := apt.MountContext(ctx, src, mountOpts...)
+		if err != nil {
+			if err := failures.skip(src, fmt.Errorf("failed to mount repository: %w", err)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// entries already removed for another source of the same repository aren't counted twice
+		n, err := transports.PurgeCacheEntries(repo.IndexURLs())
+		if err != nil {
+			return fmt.Errorf("failed to purge cache: %w", err)
+		}
+		purged += n
+		// the copy of the Release or InRelease file kept for offline use goes too, but mounting just cached
+		// it again, so it isn't counted
+		releaseURLs := []*url.URL{repo.DistributionRoot().JoinPath("Release"), repo.DistributionRoot().JoinPath("InRelease")}
+		if _, err := transports.PurgeCacheEntries(releaseURLs); err != nil {
+			return fmt.Errorf("failed to purge cache: %w", err)
+		}
+		n, err = repo.PurgeIndexCopies()
+		if err != nil {
+			return fmt.Errorf("failed to purge cache: %w", err)
+		}
+		copies += n
+	}
+
+	if err := failures.done(); err != nil {
+		return err
+	}
+
+	return outputPurgeResult(stdout, purgeResult{Entries: purged, IndexCopies: copies}, format)
+}
+
+// purgeResult is the output of purge-cache with a source
+type purgeResult struct {
+	Entries int `json:"entries"`
+	// IndexCopies counts the Packages indexes kept by --index-cache and --pdiff
+	IndexCopies int `json:"index_copies"`
+}
+
+func outputPurgeResult(w io.Writer, result purgeResult, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	case "jsonl":
+		return json.NewEncoder(w).Encode(result)
+	default:
+		fmt.Fprintf(w, "Removed %d cache entries\n", result.Entries)
+		if result.IndexCopies > 0 {
+			fmt.Fprintf(w, "Removed %d kept Packages indexes\n", result.IndexCopies)
+		}
+		return nil
+	}
+}
+
+// configureLogging sends all log output to stderr, so stdout only carries command results
+// and can be piped into other tools
+func configureLogging() {
 	log.Logger = log.Output(zerolog.ConsoleWriter{
 		Out:     os.Stderr,
 		NoColor: false,
 	})
-	if err := rootCmd.Execute(); err != nil {
+}
+
+func main() {
+	configureLogging()
+
+	// Ctrl-C cancels the context shared by the command's fetches, so downloads stop and remove their
+	// partial files. Once it has been seen, a second Ctrl-C kills the process as usual.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := execute(ctx)
+	if ctx.Err() != nil {
+		log.Error().Msg("Cancelled")
+		os.Exit(130)
+	}
+	if err != nil {
 		log.Fatal().Msgf("%v", err)
 	}
 }
+
+// execute runs the command, then closes the transports it used, however it ended
+func execute(ctx context.Context) error {
+	defer func() {
+		if transports == nil {
+			return
+		}
+		if err := transports.Close(); err != nil {
+			log.Debug().Err(err).Msg("Failed to close transports")
+		}
+	}()
+	err := rootCmd.ExecuteContext(ctx)
+	if sink, ok := events.(*jsonEvents); ok {
+		if err != nil {
+			sink.emit(event{Event: "error", Error: err.Error()})
+		} else {
+			sink.done()
+		}
+	}
+	return err
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSourceInput_Formats(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"sources.list": "deb http://deb.debian.org/debian bookworm main\n",
+		// deb822 content is recognized even without the .sources extension
+		"modern.list": `Types: deb
+URIs: http://deb.debian.org/debian
+Suites: bookworm
+Components: main
+`,
+		"debian.sources": `Types: deb
+URIs: http://deb.debian.org/debian
+Suites: bookworm
+Components: main
+`,
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+			entries, err := parseSourceInput(context.Background(), path)
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			assert.Equal(t, "http://deb.debian.org/debian", entries[0].ArchiveRoot.String())
+			assert.Equal(t, "bookworm", entries[0].Distribution)
+			assert.Equal(t, []string{"main"}, entries[0].Components)
+			assert.Equal(t, path, entries[0].File)
+		})
+	}
+}
+
+func TestParseSourceInput_SourceLine(t *testing.T) {
+	entries, err := parseSourceInput(context.Background(), "deb http://deb.debian.org/debian bookworm main")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "bookworm", entries[0].Distribution)
+}
+
+func TestParseSourceInput_Stdin(t *testing.T) {
+	tests := map[string]string{
+		"one-line": "deb http://deb.debian.org/debian bookworm main\n",
+		"deb822":   "Types: deb\nURIs: http://deb.debian.org/debian\nSuites: bookworm\nComponents: main\n",
+	}
+
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			stdin = strings.NewReader(content)
+			t.Cleanup(func() { stdin = os.Stdin })
+
+			entries, err := parseSourceInput(context.Background(), "-")
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			assert.Equal(t, "bookworm", entries[0].Distribution)
+			assert.Empty(t, entries[0].File)
+		})
+	}
+}
+
+func TestParseSourceInput_Disabled(t *testing.T) {
+	stdin = strings.NewReader(`deb http://deb.debian.org/debian bookworm main
+# deb http://deb.debian.org/debian bookworm-backports main
+`)
+	t.Cleanup(func() { stdin = os.Stdin })
+
+	entries, err := parseSourceInput(context.Background(), "-")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "bookworm", entries[0].Distribution)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "debian.list"),
+		[]byte("# deb http://deb.debian.org/debian bookworm-backports main\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "updates.sources"),
+		[]byte("Types: deb\nURIs: http://deb.debian.org/debian\nSuites: bookworm-updates\nEnabled: no\n"), 0644))
+
+	entries, err = parseSourceInput(context.Background(), dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	options.includeDisabled = true
+	t.Cleanup(func() { options.includeDisabled = false })
+	entries, err = parseSourceInput(context.Background(), dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.False(t, entries[0].Enabled)
+	assert.False(t, entries[1].Enabled)
+}
+
+func TestDeadline(t *testing.T) {
+	// the server never answers, so only the deadline can end the command
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"list", "deb " + server.URL + " stable main", "--no-cache", "--deadline", "100ms"})
+	start := time.Now()
+	err := rootCmd.Execute()
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 10*time.Second)
+}
+
+func TestDiscoveryUsesTransports(t *testing.T) {
+	repo := t.TempDir()
+	writeMirrorRepo(t, repo)
+	files := http.FileServer(http.Dir(repo))
+	var mu sync.Mutex
+	var userAgents []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		userAgents = append(userAgents, r.UserAgent())
+		mu.Unlock()
+		files.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	// the suites are probed with the configured transports, like the fetches that follow
+	output := runCommand(t, "list", server.URL, "--no-cache", "--arch", "amd64", "--user-agent", "discovery-test")
+	assert.Equal(t, "alpha\n", output)
+	require.NotEmpty(t, userAgents)
+	for _, userAgent := range userAgents {
+		assert.Equal(t, "discovery-test", userAgent)
+	}
+}
+
+func TestDiscoveryUsesRegistryTimeout(t *testing.T) {
+	repo := t.TempDir()
+	writeMirrorRepo(t, repo)
+	files := http.FileServer(http.Dir(repo))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dists/stable/Release" {
+			select {
+			case <-time.After(5 * time.Second):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		files.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	// the registry's --timeout applies to the probes, not just to the fetches after mounting
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"list", server.URL, "--arch", "amd64", "--timeout", "100ms"})
+	start := time.Now()
+	assert.ErrorContains(t, rootCmd.Execute(), "no valid distributions found")
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestFallbackMirror(t *testing.T) {
+	repo := t.TempDir()
+	writeMirrorRepo(t, repo)
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(primary.Close)
+	mirror := httptest.NewServer(http.FileServer(http.Dir(repo)))
+	t.Cleanup(mirror.Close)
+
+	source := "deb " + primary.URL + " stable main"
+	output := runCommand(t, "list", source, "--no-cache", "--retry", "0", "--arch", "amd64", "--fallback-mirror", mirror.URL)
+	assert.Equal(t, "alpha\n", output)
+
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"list", source, "--no-cache", "--fallback-mirror", "mirror.example.com"})
+	assert.ErrorContains(t, rootCmd.Execute(), "invalid fallback mirror 'mirror.example.com'")
+}
+
+func TestFormatFlagHelp(t *testing.T) {
+	usage := rootCmd.PersistentFlags().Lookup("format").Usage
+	for _, format := range validFormats {
+		assert.Contains(t, usage, format)
+	}
+}
+
+func TestEnvFlags(t *testing.T) {
+	repo, err := filepath.Abs("../../pkg/apt/testdata/compressedrepo")
+	require.NoError(t, err)
+	source := "deb file://" + repo + " stable main"
+
+	t.Setenv("APT_LOOK_FORMAT", "tsv")
+	t.Setenv("APT_LOOK_NO_CACHE", "true")
+	output := runCommand(t, "list", source, "--arch", "amd64")
+	assert.Equal(t, "alpha\t1.0-1\tamd64\tutils\tfirst test package\n", strings.SplitAfter(output, "\n")[0])
+	assert.True(t, options.noCache)
+
+	// flags override the environment
+	output = runCommand(t, "list", source, "--arch", "amd64", "--format", "text")
+	assert.Equal(t, "alpha\nbravo\n", output)
+
+	t.Setenv("APT_LOOK_TIMEOUT", "soon")
+	resetFlags(t)
+	rootCmd.SetArgs([]string{"list", source})
+	assert.ErrorContains(t, rootCmd.Execute(), "invalid APT_LOOK_TIMEOUT")
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]int64{
+		"0":       0,
+		"1048576": 1048576,
+		"500k":    500 * 1024,
+		"500KB":   500 * 1024,
+		"2MB":     2 * 1024 * 1024,
+		"1.5M":    1536 * 1024,
+		"2MiB":    2 * 1024 * 1024,
+		"1g":      1 << 30,
+	}
+	for value, expected := range tests {
+		n, err := parseByteSize(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, expected, n, value)
+	}
+
+	for _, value := range []string{"", "fast", "-1k", "2TB", "k"} {
+		_, err := parseByteSize(value)
+		assert.Error(t, err, value)
+	}
+}
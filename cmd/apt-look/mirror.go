@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/nicwaller/apt-look/pkg/apt"
+	apttransport2 "github.com/nicwaller/apt-look/pkg/apt/apttransport"
+	"github.com/nicwaller/apt-look/pkg/deb822"
+)
+
+// mirrorStats counts the files handled while mirroring
+type mirrorStats struct {
+	fetched int
+	skipped int
+	failed  int
+	bytes   int64
+	// pool files shared by several sources or Packages indexes are only mirrored once
+	seen map[string]bool
+	// progress tracks the files to mirror, including those already up to date
+	progress *apttransport2.Progress
+}
+
+func newMirrorStats(progress *apttransport2.Progress) *mirrorStats {
+	return &mirrorStats{seen: make(map[string]bool), progress: progress}
+}
+
+// runMirror copies the Release files, the selected Packages indexes and the pool files they
+// reference into destDir, in the same layout as the archive
+func runMirror(ctx context.Context, source, destDir string) error {
+	log.Info().Msgf("Mirroring %s to %s", source, destDir)
+
+	sourceList, err := parseSourceInput(ctx, source)
+	if err != nil {
+		return fmt.Errorf("failed to parse source input: %w", err)
+	}
+
+	progress, stopProgress := startProgress(true)
+	defer stopProgress()
+	stats := newMirrorStats(progress)
+	failures := newSourceFailures(sourceList)
+	for _, src := range sourceList {
+		repo, err := apt.MountContext(ctx, src, buildMountOptions()...)
+		if err != nil {
+			if err := failures.skip(src, fmt.Errorf("failed to mount repository: %w", err)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := mirrorRepository(ctx, repo, destDir, stats); err != nil {
+			return err
+		}
+	}
+	if err := failures.done(); err != nil {
+		return err
+	}
+
+	log.Info().Msgf("Mirrored %d files (%.1f MB), %d already up to date",
+		stats.fetched, float64(stats.bytes)/(1024*1024), stats.skipped)
+	if stats.failed > 0 {
+		return fmt.Errorf("%d files failed to mirror", stats.failed)
+	}
+	return nil
+}
+
+// mirrorRepository mirrors one distribution. The Release files are written last, so a partial
+// mirror never has a Release file describing indexes that aren't there yet.
+func mirrorRepository(ctx context.Context, repo *apt.Repository, destDir string, stats *mirrorStats) error {
+	tpt := repo.Transport()
+	distDir := strings.TrimPrefix(strings.TrimPrefix(repo.DistributionRoot().Path, repo.ArchiveRoot().Path), "/")
+
+	// every compressed variant of a selected index is kept, since clients choose which one to fetch
+	selected := make(map[string]bool)
+	for _, fi := range repo.PackagesIndexes() {
+		selected[strings.TrimSuffix(fi.Path, fi.Compression)] = true
+	}
+	var indexes []deb822.FileInfo
+	var indexesSize int64
+	for _, fi := range repo.Release().GetAvailableFiles() {
+		if fi.Type == "Packages" && selected[strings.TrimSuffix(fi.Path, fi.Compression)] {
+			indexes = append(indexes, fi)
+			indexesSize += fi.Size
+		}
+	}
+	stats.progress.Expect(len(indexes), indexesSize)
+	mirrored := make(map[string]bool)
+	for _, fi := range indexes {
+		if mirrorIndex(ctx, repo, destDir, distDir, fi, stats) {
+			mirrored[fi.Path] = true
+		}
+	}
+
+	// the pool files are listed first, so the progress shows how much of the whole mirror is done
+	var pool []*deb822.Package
+	var poolSize int64
+	for pkg, err := range repo.Packages(ctx) {
+		if err != nil {
+			return fmt.Errorf("failed to list packages: %w", err)
+		}
+		if !matchesArchFilter(pkg) || stats.seen[pkg.Filename] {
+			continue
+		}
+		stats.seen[pkg.Filename] = true
+		pool = append(pool, pkg)
+		poolSize += pkg.Size
+	}
+	stats.progress.Expect(len(pool), poolSize)
+	for _, pkg := range pool {
+		// once cancelled, every remaining fetch would fail the same way
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		mirrorFile(ctx, tpt, []*url.URL{repo.ArchiveRoot().JoinPath(pkg.Filename)}, destDir, pkg.Filename,
+			pkg.Size, packageHashes(pkg), stats)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return mirrorRelease(ctx, repo, destDir, distDir, mirrored, stats)
+}
+
+// mirrorRelease writes the Release files of a mirror holding the indexes in mirrored. When that's every
+// file the Release file lists, the Release file and its signatures are copied as they are. Otherwise the
+// mirror gets a Release file that only lists what it holds, so that clients don't look for the rest, and
+// no signatures, since they would no longer match it.
+func mirrorRelease(ctx context.Context, repo *apt.Repository, destDir, distDir string, mirrored map[string]bool, stats *mirrorStats) error {
+	tpt := repo.Transport()
+	release := *repo.Release()
+	release.MD5Sum = mirroredEntries(release.MD5Sum, mirrored)
+	release.SHA1 = mirroredEntries(release.SHA1, mirrored)
+	release.SHA256 = mirroredEntries(release.SHA256, mirrored)
+	complete := len(release.MD5Sum) == len(repo.Release().MD5Sum) &&
+		len(release.SHA1) == len(repo.Release().SHA1) && len(release.SHA256) == len(repo.Release().SHA256)
+
+	if !complete {
+		var buf bytes.Buffer
+		if err := release.Write(&buf); err != nil {
+			return fmt.Errorf("failed to write Release file: %w", err)
+		}
+		dest := filepath.Join(destDir, filepath.FromSlash(mirrorPath(distDir, "Release")))
+		if err := writeFileAtomic(dest, buf.Bytes()); err != nil {
+			return fmt.Errorf("failed to write Release file: %w", err)
+		}
+		// signatures from an earlier, complete mirror would no longer match
+		for _, name := range []string{"Release.gpg", "InRelease"} {
+			if err := os.Remove(filepath.Join(destDir, filepath.FromSlash(mirrorPath(distDir, name)))); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove stale %s: %w", name, err)
+			}
+		}
+		log.Warn().Msgf("The mirror of %s holds only part of the repository, so its Release file isn't signed", repo.DistributionRoot())
+		stats.fetched++
+		stats.bytes += int64(buf.Len())
+		return nil
+	}
+
+	// a Release or InRelease file is required, while unsigned repositories have no signature files
+	var missingRelease error
+	for _, name := range []string{"Release", "Release.gpg", "InRelease"} {
+		req := &apttransport2.AcquireRequest{URI: repo.DistributionRoot().JoinPath(name)}
+		n, err := fetchToFile(ctx, tpt, req, filepath.Join(destDir, filepath.FromSlash(mirrorPath(distDir, name))))
+		switch {
+		case err == nil:
+			stats.fetched++
+			stats.bytes += n
+		case name == "Release" && apttransport2.IsNotFound(err):
+			// repositories that only publish InRelease have no Release file
+			missingRelease = fmt.Errorf("failed to mirror %s: %w", req.URI, err)
+		case name == "InRelease" && apttransport2.IsNotFound(err) && missingRelease != nil:
+			return missingRelease
+		case apttransport2.IsNotFound(err):
+			log.Debug().Msgf("No %s in %s", name, repo.DistributionRoot())
+		default:
+			return fmt.Errorf("failed to mirror %s: %w", req.URI, err)
+		}
+	}
+	return nil
+}
+
+// mirroredEntries returns the hash entries for the files in mirrored
+func mirroredEntries(entries []deb822.HashEntry, mirrored map[string]bool) []deb822.HashEntry {
+	var kept []deb822.HashEntry
+	for _, entry := range entries {
+		if mirrored[entry.Path] {
+			kept = append(kept, entry)
+		}
+	}
+	return kept
+}
+
+// mirrorPath joins the parts of a path relative to the archive root, where distDir is empty for flat repositories
+func mirrorPath(distDir, name string) string {
+	if distDir == "" {
+		return name
+	}
+	return distDir + "/" + name
+}
+
+// mirrorIndex mirrors an index listed in the Release file. When the Release file sets Acquire-By-Hash,
+// apt fetches indexes from by-hash/SHA256, so the mirror keeps that copy too. It's fetched from either
+// location, since upstream mirrors don't always carry both, and the other copy is made locally.
+// The result reports whether the index is in place at its path.
+func mirrorIndex(ctx context.Context, repo *apt.Repository, destDir, distDir string, fi deb822.FileInfo, stats *mirrorStats) bool {
+	uris := []*url.URL{repo.DistributionRoot().JoinPath(fi.Path)}
+	if !repo.Release().AcquireByHash || fi.SHA256 == "" {
+		return mirrorFile(ctx, repo.Transport(), uris, destDir, mirrorPath(distDir, fi.Path), fi.Size, strongestHash(fi), stats)
+	}
+
+	byHash := path.Join(path.Dir(fi.Path), "by-hash", "SHA256", fi.SHA256)
+	uris = append([]*url.URL{repo.DistributionRoot().JoinPath(byHash)}, uris...)
+	hashes := map[string]string{"sha256": fi.SHA256}
+	if !mirrorFile(ctx, repo.Transport(), uris, destDir, mirrorPath(distDir, byHash), fi.Size, hashes, stats) {
+		return false
+	}
+
+	src := filepath.Join(destDir, filepath.FromSlash(mirrorPath(distDir, byHash)))
+	dest := filepath.Join(destDir, filepath.FromSlash(mirrorPath(distDir, fi.Path)))
+	if hasContent(dest, fi.Size, hashes) {
+		return true
+	}
+	if err := copyFile(src, dest); err != nil {
+		log.Error().Msgf("Failed to copy %s to %s: %v", src, dest, err)
+		stats.failed++
+		return false
+	}
+	return true
+}
+
+// mirrorFile fetches a file to relPath below destDir unless a copy with the expected size and hash
+// is already there. Each URI is tried in turn until one is found. Failures are logged and counted so
+// that the rest of the mirror still completes, and the result reports whether the file is in place.
+func mirrorFile(ctx context.Context, tpt apttransport2.Transport, uris []*url.URL, destDir, relPath string,
+	size int64, hashes map[string]string, stats *mirrorStats) bool {
+	transfer := stats.progress.Start(relPath, size)
+	defer transfer.Done()
+
+	// paths come from the repository, so don't let them escape the mirror
+	if !filepath.IsLocal(filepath.FromSlash(relPath)) {
+		log.Error().Msgf("Refusing to mirror %s outside of %s", relPath, destDir)
+		stats.failed++
+		return false
+	}
+	dest := filepath.Join(destDir, filepath.FromSlash(relPath))
+
+	if hasContent(dest, size, hashes) {
+		log.Debug().Msgf("Already up to date: %s", relPath)
+		stats.skipped++
+		return true
+	}
+
+	var n int64
+	var err error
+	for _, uri := range uris {
+		req := &apttransport2.AcquireRequest{
+			URI:              uri,
+			ExpectedHashes:   hashes,
+			ExpectedSize:     size,
+			Timeout:          30 * time.Minute, // packages can be much larger than index files
+			ProgressCallback: transfer.Callback(nil),
+		}
+		if n, err = fetchToFile(ctx, tpt, req, dest); err == nil || !apttransport2.IsNotFound(err) {
+			break
+		}
+		log.Debug().Msgf("No %s, trying the next location", uri)
+	}
+	if err != nil && ctx.Err() != nil {
+		return false // the caller stops on cancellation, so this isn't counted as a failure
+	}
+	if err != nil {
+		log.Error().Msgf("Failed to mirror %s: %v", relPath, err)
+		stats.failed++
+		return false
+	}
+	log.Debug().Msgf("Mirrored %s (%d bytes)", relPath, n)
+	stats.fetched++
+	stats.bytes += n
+	return true
+}
+
+// copyFile copies a file that is already in the mirror to another path, through a temporary file like fetchToFile
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	partial := dest + ".partial"
+	out, err := os.Create(partial)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(partial)
+		return err
+	}
+	return os.Rename(partial, dest)
+}
+
+// writeFileAtomic writes data to dest through a temporary file like fetchToFile
+func writeFileAtomic(dest string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	partial := dest + ".partial"
+	if err := os.WriteFile(partial, data, 0644); err != nil {
+		os.Remove(partial)
+		return err
+	}
+	return os.Rename(partial, dest)
+}
+
+// fetchToFile streams a file into dest. The content is written to a temporary file that is only
+// moved into place once the transport has verified it, so an interrupted run leaves no bad files.
+func fetchToFile(ctx context.Context, tpt apttransport2.Transport, req *apttransport2.AcquireRequest, dest string) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return 0, err
+	}
+
+	resp, err := tpt.Acquire(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Content.Close()
+
+	partial := dest + ".partial"
+	file, err := os.Create(partial)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(file, resp.Content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && req.ExpectedSize > 0 && n != req.ExpectedSize {
+		err = fmt.Errorf("size mismatch: expected %d bytes, got %d", req.ExpectedSize, n)
+	}
+	if err != nil {
+		os.Remove(partial)
+		return 0, err
+	}
+	return n, os.Rename(partial, dest)
+}
+
+// hasContent reports whether path already holds a file of the given size whose strongest hash matches
+func hasContent(path string, size int64, hashes map[string]string) bool {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() != size {
+		return false
+	}
+
+	var algo string
+	var hasher hash.Hash
+	switch {
+	case hashes["sha256"] != "":
+		algo, hasher = "sha256", sha256.New()
+	case hashes["sha1"] != "":
+		algo, hasher = "sha1", sha1.New()
+	case hashes["md5"] != "":
+		algo, hasher = "md5", md5.New()
+	default:
+		return false
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return false
+	}
+	return strings.EqualFold(fmt.Sprintf("%x", hasher.Sum(nil)), hashes[algo])
+}
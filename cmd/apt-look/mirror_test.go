@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nicwaller/apt-look/pkg/apt"
+	apttransport2 "github.com/nicwaller/apt-look/pkg/apt/apttransport"
+	"github.com/nicwaller/apt-look/pkg/apt/sources"
+)
+
+// writeFile creates a file below dir, along with its parent directories
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+// writeMirrorRepo creates a repository with one package in each of binary-amd64 and binary-arm64
+func writeMirrorRepo(t *testing.T, dir string) {
+	t.Helper()
+	writeRepoLayout(t, dir, "dists/stable", []string{"main/binary-amd64", "main/binary-arm64"}, false)
+}
+
+// writeRepoLayout creates a repository whose Release file is in distDir, with one package in each of
+// the index directories. An empty index directory puts the Packages index next to the Release file, as in
+// flat repositories. With byHash, the indexes are only published below by-hash/SHA256.
+func writeRepoLayout(t *testing.T, dir, distDir string, indexDirs []string, byHash bool) {
+	t.Helper()
+	var release strings.Builder
+	release.WriteString("Suite: stable\nArchitectures: amd64 arm64\nComponents: main\nDate: Sat, 27 Apr 2024 15:24:47 UTC\n")
+	if byHash {
+		release.WriteString("Acquire-By-Hash: yes\n")
+	}
+	release.WriteString("SHA256:\n")
+	for i, indexDir := range indexDirs {
+		name, arch := []string{"alpha", "beta"}[i%2], []string{"amd64", "arm64"}[i%2]
+		deb := "contents of " + name
+		filename := fmt.Sprintf("pool/main/%s_1.0_%s.deb", name, arch)
+		writeFile(t, dir, filename, deb)
+
+		index := fmt.Sprintf("Package: %s\nVersion: 1.0\nArchitecture: %s\nFilename: %s\nSize: %d\nSHA256: %x\n",
+			name, arch, filename, len(deb), sha256.Sum256([]byte(deb)))
+		indexPath := path.Join(indexDir, "Packages")
+		sum := sha256.Sum256([]byte(index))
+		if byHash {
+			writeFile(t, dir, path.Join(distDir, indexDir, "by-hash/SHA256", fmt.Sprintf("%x", sum)), index)
+		} else {
+			writeFile(t, dir, path.Join(distDir, indexPath), index)
+		}
+		fmt.Fprintf(&release, " %x %d %s\n", sum, len(index), indexPath)
+	}
+	writeFile(t, dir, path.Join(distDir, "Release"), release.String())
+}
+
+func TestMirror(t *testing.T) {
+	repo := t.TempDir()
+	writeMirrorRepo(t, repo)
+	dest := t.TempDir()
+	source := "deb file://" + repo + " stable main"
+
+	runCommand(t, "mirror", source, dest, "--no-cache", "--arch", "amd64")
+	for _, name := range []string{"dists/stable/Release", "dists/stable/main/binary-amd64/Packages", "pool/main/alpha_1.0_amd64.deb"} {
+		assert.FileExists(t, filepath.Join(dest, filepath.FromSlash(name)))
+	}
+	assert.NoFileExists(t, filepath.Join(dest, "pool", "main", "beta_1.0_arm64.deb"))
+	assert.NoDirExists(t, filepath.Join(dest, "dists", "stable", "main", "binary-arm64"))
+
+	// the Release file only lists the indexes that were mirrored
+	release, err := os.ReadFile(filepath.Join(dest, "dists", "stable", "Release"))
+	require.NoError(t, err)
+	assert.Contains(t, string(release), "main/binary-amd64/Packages")
+	assert.NotContains(t, string(release), "binary-arm64")
+	assert.Contains(t, runCommand(t, "list", "deb file://"+dest+" stable main", "--no-cache", "--arch", "amd64"), "alpha")
+
+	// a damaged file is fetched again, while the others are already up to date
+	deb := filepath.Join(dest, "pool", "main", "alpha_1.0_amd64.deb")
+	require.NoError(t, os.WriteFile(deb, []byte("contents of alphX"), 0644))
+	runCommand(t, "mirror", source, dest, "--no-cache", "--arch", "amd64")
+	content, err := os.ReadFile(deb)
+	require.NoError(t, err)
+	assert.Equal(t, "contents of alpha", string(content))
+
+	// a pool file that doesn't match the index fails the mirror and isn't kept
+	writeFile(t, repo, "pool/main/alpha_1.0_amd64.deb", "contents of ALPHA")
+	require.NoError(t, os.Remove(deb))
+	rootCmd.SetArgs([]string{"mirror", source, dest, "--no-cache", "--arch", "amd64"})
+	assert.ErrorContains(t, rootCmd.Execute(), "1 files failed to mirror")
+	assert.NoFileExists(t, deb)
+	assert.NoFileExists(t, deb+".partial")
+}
+
+// TestMirrorRemount mirrors a repository from a web server and mounts the mirror again with
+// the file transport, which should list exactly the same packages
+func TestMirrorRemount(t *testing.T) {
+	tests := map[string]struct {
+		distDir      string
+		distribution string
+		indexDirs    []string
+		byHash       bool
+		inRelease    bool // only an InRelease file is published
+	}{
+		"dists":     {"dists/stable", "stable main", []string{"main/binary-amd64", "main/binary-arm64"}, false, false},
+		"by-hash":   {"dists/stable", "stable main", []string{"main/binary-amd64", "main/binary-arm64"}, true, false},
+		"flat":      {"", "/", []string{""}, false, false},
+		"flat-dot":  {"", ".", []string{""}, false, false},
+		"inrelease": {"dists/stable", "stable main", []string{"main/binary-amd64", "main/binary-arm64"}, false, true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			repo := t.TempDir()
+			writeRepoLayout(t, repo, tt.distDir, tt.indexDirs, tt.byHash)
+			if tt.inRelease {
+				clearsignRelease(t, filepath.Join(repo, filepath.FromSlash(tt.distDir)))
+			}
+			server := httptest.NewServer(http.FileServer(http.Dir(repo)))
+			t.Cleanup(server.Close)
+			dest := t.TempDir()
+
+			list := func(archiveRoot string) []string {
+				output := runCommand(t, "list", "deb "+archiveRoot+" "+tt.distribution, "--no-cache", "--arch", "amd64,arm64", "--format", "tsv")
+				lines := strings.Split(strings.TrimSpace(output), "\n")
+				slices.Sort(lines)
+				return lines
+			}
+			expected := list(server.URL)
+			require.Len(t, expected, len(tt.indexDirs))
+
+			runCommand(t, "mirror", "deb "+server.URL+" "+tt.distribution, dest, "--no-cache", "--arch", "amd64,arm64")
+			assert.Equal(t, expected, list("file://"+dest))
+			for _, indexDir := range tt.indexDirs {
+				assert.FileExists(t, filepath.Join(dest, filepath.FromSlash(path.Join(tt.distDir, indexDir, "Packages"))))
+				if tt.byHash {
+					assert.DirExists(t, filepath.Join(dest, filepath.FromSlash(path.Join(tt.distDir, indexDir, "by-hash/SHA256"))))
+				}
+			}
+			if tt.inRelease {
+				assert.FileExists(t, filepath.Join(dest, filepath.FromSlash(path.Join(tt.distDir, "InRelease"))))
+				assert.NoFileExists(t, filepath.Join(dest, filepath.FromSlash(path.Join(tt.distDir, "Release"))))
+			}
+		})
+	}
+}
+
+// clearsignRelease replaces the Release file in distPath with an InRelease file signed by a new key
+func clearsignRelease(t *testing.T, distPath string) {
+	t.Helper()
+	release, err := os.ReadFile(filepath.Join(distPath, "Release"))
+	require.NoError(t, err)
+	signer, err := openpgp.NewEntity("test", "", "test@example.com", nil)
+	require.NoError(t, err)
+
+	var signed bytes.Buffer
+	w, err := clearsign.Encode(&signed, signer.PrivateKey, nil)
+	require.NoError(t, err)
+	_, err = w.Write(release)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, os.WriteFile(filepath.Join(distPath, "InRelease"), signed.Bytes(), 0644))
+	require.NoError(t, os.Remove(filepath.Join(distPath, "Release")))
+}
+
+func TestMirrorRepository_Cancelled(t *testing.T) {
+	repo := t.TempDir()
+	writeMirrorRepo(t, repo)
+	entry, err := sources.ParseSourceLine("deb file://"+repo+" stable main", 1)
+	require.NoError(t, err)
+	mounted, err := apt.Mount(*entry, apt.WithArchitectures("amd64", "arm64"))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	dest := t.TempDir()
+	stats := newMirrorStats(apttransport2.NewProgress(nil))
+	assert.ErrorIs(t, mirrorRepository(ctx, mounted, dest, stats), context.Canceled)
+
+	// cancelled fetches aren't failures, and nothing that describes a complete mirror is written
+	assert.Zero(t, stats.failed)
+	assert.NoFileExists(t, filepath.Join(dest, "dists", "stable", "Release"))
+}
+
+func TestHasContent(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "file", "content")
+	path := filepath.Join(dir, "file")
+	sum := fmt.Sprintf("%x", sha256.Sum256([]byte("content")))
+
+	assert.True(t, hasContent(path, 7, map[string]string{"sha256": sum}))
+	assert.False(t, hasContent(path, 8, map[string]string{"sha256": sum}))
+	assert.False(t, hasContent(path, 7, map[string]string{"sha256": strings.Repeat("0", 64)}))
+	assert.False(t, hasContent(path, 7, nil))
+	assert.False(t, hasContent(filepath.Join(dir, "missing"), 7, map[string]string{"sha256": sum}))
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	apttransport2 "github.com/nicwaller/apt-look/pkg/apt/apttransport"
+)
+
+// startProgress returns the Progress that a command's transfers report to. When show is set and
+// stderr is a terminal, and neither --quiet nor --events is, it's drawn on stderr until stop is called.
+func startProgress(show bool) (progress *apttransport2.Progress, stop func()) {
+	if !show || options.quiet || options.events || !isTerminal(os.Stderr) {
+		return apttransport2.NewProgress(nil), func() {}
+	}
+
+	display := &progressDisplay{out: os.Stderr}
+	// log messages are written through the display, so they appear above the progress bar
+	logger := log.Logger
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: display})
+	return apttransport2.NewProgress(display.render), func() {
+		display.clear()
+		log.Logger = logger
+	}
+}
+
+// isTerminal reports whether w is a terminal rather than a file or pipe
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// progressDisplay draws the overall progress of a command as two lines, a bar for all the
+// transfers and the file currently being fetched, redrawing them in place
+type progressDisplay struct {
+	mu       sync.Mutex
+	out      io.Writer
+	state    apttransport2.ProgressState
+	drawn    bool
+	lastDraw time.Time
+}
+
+// render draws state, at most ten times a second unless a transfer has completed
+func (d *progressDisplay) render(state apttransport2.ProgressState) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	completed := state.Completed != d.state.Completed
+	d.state = state
+	if !completed && time.Since(d.lastDraw) < 100*time.Millisecond {
+		return
+	}
+	d.erase()
+	d.draw()
+}
+
+// Write writes a log message above the progress bar
+func (d *progressDisplay) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	wasDrawn := d.drawn
+	d.erase()
+	n, err := d.out.Write(p)
+	if wasDrawn {
+		d.draw()
+	}
+	return n, err
+}
+
+// clear removes the progress bar once the command is done with it
+func (d *progressDisplay) clear() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.erase()
+}
+
+// erase clears the two lines and leaves the cursor at the start of the first; d.mu must be held
+func (d *progressDisplay) erase() {
+	if d.drawn {
+		fmt.Fprint(d.out, "\r\033[K\033[1A\033[K")
+		d.drawn = false
+	}
+}
+
+// draw writes the two lines, leaving the cursor at the end of the second; d.mu must be held
+func (d *progressDisplay) draw() {
+	const width = 30
+	state := d.state
+	percent := 0
+	if state.Total > 0 {
+		percent = int(min(state.Downloaded*100/state.Total, 100))
+	}
+	filled := width * percent / 100
+	fmt.Fprintf(d.out, "[%s%s] %3d%% %.1f/%.1f MB, %d/%d files\n",
+		strings.Repeat("=", filled), strings.Repeat(" ", width-filled), percent,
+		float64(state.Downloaded)/(1024*1024), float64(state.Total)/(1024*1024), state.Completed, state.Files)
+
+	// long paths are cut from the start, so the line doesn't wrap and the file name stays visible
+	current := state.Current
+	if len(current) > 60 {
+		current = "..." + current[len(current)-57:]
+	}
+	if current != "" && state.CurrentTotal > 0 {
+		fmt.Fprintf(d.out, "%s %d%%", current, int(min(state.CurrentDownloaded*100/state.CurrentTotal, 100)))
+	} else {
+		fmt.Fprint(d.out, current)
+	}
+	d.drawn = true
+	d.lastDraw = time.Now()
+}
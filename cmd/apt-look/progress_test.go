@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	apttransport2 "github.com/nicwaller/apt-look/pkg/apt/apttransport"
+)
+
+func TestProgressDisplay(t *testing.T) {
+	var buf bytes.Buffer
+	display := &progressDisplay{out: &buf}
+	progress := apttransport2.NewProgress(display.render)
+
+	progress.Expect(2, 2*1024*1024)
+	transfer := progress.Start("pool/main/a/alpha_1.0_amd64.deb", 1024*1024)
+	transfer.Callback(nil)(512*1024, 1024*1024)
+	// the first state is drawn, and the updates straight after it wait for the next redraw
+	assert.Equal(t, "[                              ]   0% 0.0/2.0 MB, 0/2 files\n", buf.String())
+
+	// a completed transfer is always drawn, even straight after the last redraw
+	buf.Reset()
+	transfer.Done()
+	assert.Equal(t, "\r\033[K\033[1A\033[K[===============               ]  50% 1.0/2.0 MB, 1/2 files\n", buf.String())
+
+	// log messages are written above the bar, which is then drawn again
+	buf.Reset()
+	display.Write([]byte("INF message\n"))
+	assert.Equal(t, "\r\033[K\033[1A\033[KINF message\n[===============               ]  50% 1.0/2.0 MB, 1/2 files\n", buf.String())
+
+	buf.Reset()
+	display.clear()
+	assert.Equal(t, "\r\033[K\033[1A\033[K", buf.String())
+	display.clear()
+	assert.Equal(t, "\r\033[K\033[1A\033[K", buf.String())
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/nicwaller/apt-look/pkg/apt"
+)
+
+// runRdepends reports the packages that depend on packageName in each repository of the source
+func runRdepends(ctx context.Context, source, packageName, format string) error {
+	log.Info().Msgf("Finding reverse dependencies of '%s' in: %s", packageName, source)
+
+	sourceList, err := parseSourceInput(ctx, source)
+	if err != nil {
+		return fmt.Errorf("failed to parse source input: %w", err)
+	}
+
+	var rdeps []apt.ReverseDependency
+	failures := newSourceFailures(sourceList)
+	for _, src := range sourceList {
+		repo, err := apt.MountContext(ctx, src, buildMountOptions()...)
+		if err != nil {
+			if err := failures.skip(src, fmt.Errorf("failed to mount repository: %w", err)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		found, err := repo.ReverseDependencies(ctx, packageName)
+		if err != nil {
+			return fmt.Errorf("failed to find reverse dependencies: %w", err)
+		}
+		rdeps = append(rdeps, found...)
+	}
+
+	if err := failures.done(); err != nil {
+		return err
+	}
+
+	log.Info().Msgf("Found %d packages depending on %s", len(rdeps), packageName)
+	return outputReverseDependencies(stdout, rdeps, format)
+}
+
+// outputReverseDependencies outputs reverse dependencies in the specified format
+func outputReverseDependencies(w io.Writer, rdeps []apt.ReverseDependency, format string) error {
+	switch format {
+	case "text":
+		for _, rdep := range rdeps {
+			if rdep.Via != "" {
+				fmt.Fprintf(w, "%s %s: %s (via %s)\n", rdep.Package, rdep.Field, rdep.Relation, rdep.Via)
+			} else {
+				fmt.Fprintf(w, "%s %s: %s\n", rdep.Package, rdep.Field, rdep.Relation)
+			}
+		}
+	case "json", "jsonl":
+		for _, rdep := range rdeps {
+			data, err := json.Marshal(rdep)
+			if err != nil {
+				return fmt.Errorf("failed to marshal reverse dependency to JSON: %w", err)
+			}
+			fmt.Fprintf(w, "%s\n", string(data))
+		}
+	case "tsv":
+		// TSV format: Package\tField\tRelation\tVia
+		for _, rdep := range rdeps {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", rdep.Package, rdep.Field, rdep.Relation, rdep.Via)
+		}
+	case "csv":
+		for _, rdep := range rdeps {
+			if err := writeCSVRow(w, []string{"package", "field", "relation", "via"},
+				[]string{rdep.Package, rdep.Field, rdep.Relation, rdep.Via}); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/nicwaller/apt-look/pkg/apt"
+	"github.com/nicwaller/apt-look/pkg/deb822"
+)
+
+// runSearch prints packages whose name (or description) contains searchTerm, case-insensitively
+func runSearch(ctx context.Context, source, searchTerm, format string, namesOnly bool) error {
+	log.Info().Msgf("Searching for '%s' in: %s", searchTerm, source)
+
+	sourceList, err := parseSourceInput(ctx, source)
+	if err != nil {
+		return fmt.Errorf("failed to parse source input: %w", err)
+	}
+
+	term := strings.ToLower(searchTerm)
+	matches := make(map[PackageKey]*deb822.Package)
+
+	failures := newSourceFailures(sourceList)
+	for _, src := range sourceList {
+		if limitReached(len(matches)) {
+			break
+		}
+		repo, err := apt.MountContext(ctx, src, buildMountOptions()...)
+		if err != nil {
+			if err := failures.skip(src, fmt.Errorf("failed to mount repository: %w", err)); err != nil {
+				return err
+			}
+			continue
+		}
+		for pkg, err := range repo.Packages(ctx) {
+			if err != nil {
+				return fmt.Errorf("failed to list packages: %w", err)
+			}
+			if !matchesSearch(pkg, term, namesOnly) || !matchesPackageFilters(pkg) {
+				continue
+			}
+
+			// The same package is often repeated across components and index files
+			key := PackageKey{
+				Name:         pkg.Package,
+				Architecture: pkg.Architecture,
+			}
+			if _, exists := matches[key]; !exists {
+				matches[key] = pkg
+			}
+			if limitReached(len(matches)) {
+				break
+			}
+		}
+	}
+
+	if err := failures.done(); err != nil {
+		return err
+	}
+
+	packages := make([]*deb822.Package, 0, len(matches))
+	for _, pkg := range matches {
+		packages = append(packages, pkg)
+	}
+
+	sort.Slice(packages, func(i, j int) bool {
+		if packages[i].Package != packages[j].Package {
+			return packages[i].Package < packages[j].Package
+		}
+		return packages[i].Architecture < packages[j].Architecture
+	})
+
+	log.Info().Msgf("%d packages match '%s'", len(packages), searchTerm)
+
+	for _, pkg := range packages {
+		if err := outputSearchResult(stdout, pkg, format); err != nil {
+			return fmt.Errorf("failed to output package: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// outputSearchResult writes a matching package as a name and synopsis in text format,
+// and like list in other formats
+func outputSearchResult(w io.Writer, pkg *deb822.Package, format string) error {
+	if format == "text" {
+		emitPackage(pkg)
+		fmt.Fprintf(w, "%s - %s\n", pkg.Package, pkg.Synopsis())
+		return nil
+	}
+	return outputPackage(w, pkg, format)
+}
+
+// matchesSearch reports whether a package matches a lowercase search term
+func matchesSearch(pkg *deb822.Package, term string, namesOnly bool) bool {
+	if strings.Contains(strings.ToLower(pkg.Package), term) {
+		return true
+	}
+	if namesOnly {
+		return false
+	}
+	return strings.Contains(strings.ToLower(pkg.Description), term)
+}
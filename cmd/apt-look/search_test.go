@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nicwaller/apt-look/pkg/deb822"
+)
+
+func TestOutputSearchResult(t *testing.T) {
+	control := "Package: alpha\nVersion: 1.0\nArchitecture: amd64\nSection: utils\nFilename: pool/a/alpha_1.0_amd64.deb\nSize: 10\nDescription: first letter\n more detail\n"
+	var pkg *deb822.Package
+	for p, err := range deb822.ParsePackages(strings.NewReader(control)) {
+		require.NoError(t, err)
+		pkg = p
+	}
+	require.NotNil(t, pkg)
+
+	var buf bytes.Buffer
+	require.NoError(t, outputSearchResult(&buf, pkg, "text"))
+	assert.Equal(t, "alpha - first letter\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, outputSearchResult(&buf, pkg, "tsv"))
+	assert.True(t, strings.HasPrefix(buf.String(), "alpha\t1.0\tamd64\tutils\tfirst letter"), buf.String())
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+
+	"github.com/nicwaller/apt-look/pkg/deb822"
+)
+
+// packageSortKeys maps each --sort key to a comparison of two packages on that key
+var packageSortKeys = map[string]func(a, b *deb822.Package) int{
+	"name": func(a, b *deb822.Package) int {
+		return strings.Compare(a.Package, b.Package)
+	},
+	"version": func(a, b *deb822.Package) int {
+		return deb822.CompareVersions(a.Version, b.Version)
+	},
+	"size": func(a, b *deb822.Package) int {
+		return cmp.Compare(a.Size, b.Size)
+	},
+	"arch": func(a, b *deb822.Package) int {
+		return strings.Compare(a.Architecture, b.Architecture)
+	},
+}
+
+// packageComparator builds a comparison function from a --sort value such as "size" or "-version".
+// A leading "-" sorts in descending order. Ties are broken by name, then architecture.
+func packageComparator(spec string) (func(a, b *deb822.Package) int, error) {
+	key, descending := strings.CutPrefix(spec, "-")
+	compare, ok := packageSortKeys[key]
+	if !ok {
+		return nil, fmt.Errorf("invalid sort key '%s'. Valid keys: name, version, size, arch (prefix with - to reverse)", spec)
+	}
+
+	return func(a, b *deb822.Package) int {
+		c := compare(a, b)
+		if descending {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Package, b.Package); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Architecture, b.Architecture)
+	}, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nicwaller/apt-look/pkg/deb822"
+)
+
+func TestPackageComparator(t *testing.T) {
+	packages := []*deb822.Package{
+		{Package: "bravo", Version: "1.0-10", Size: 300, Architecture: "amd64"},
+		{Package: "alpha", Version: "1:0.1", Size: 100, Architecture: "arm64"},
+		{Package: "charlie", Version: "1.0-9", Size: 200, Architecture: "all"},
+		{Package: "alpha", Version: "1:0.1", Size: 100, Architecture: "amd64"},
+	}
+
+	tests := []struct {
+		spec string
+		want []string
+	}{
+		{spec: "name", want: []string{"alpha/amd64", "alpha/arm64", "bravo/amd64", "charlie/all"}},
+		{spec: "-name", want: []string{"charlie/all", "bravo/amd64", "alpha/amd64", "alpha/arm64"}},
+		{spec: "version", want: []string{"charlie/all", "bravo/amd64", "alpha/amd64", "alpha/arm64"}},
+		{spec: "-size", want: []string{"bravo/amd64", "charlie/all", "alpha/amd64", "alpha/arm64"}},
+		{spec: "arch", want: []string{"charlie/all", "alpha/amd64", "bravo/amd64", "alpha/arm64"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			compare, err := packageComparator(tt.spec)
+			require.NoError(t, err)
+
+			sorted := slices.Clone(packages)
+			slices.SortFunc(sorted, compare)
+			var got []string
+			for _, pkg := range sorted {
+				got = append(got, pkg.Package+"/"+pkg.Architecture)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := packageComparator("popularity")
+	assert.ErrorContains(t, err, "invalid sort key")
+}
@@ -1,44 +1,43 @@
 package main
 
 import (
+	"cmp"
+	"context"
 	"encoding/json"
 	"fmt"
-	"os"
+	"io"
+	"maps"
+	"slices"
 	"strings"
-	"time"
 
 	"github.com/rs/zerolog/log"
 
-	apttransport2 "github.com/nicwaller/apt-look/pkg/apt/apttransport"
+	"github.com/nicwaller/apt-look/pkg/apt"
 	"github.com/nicwaller/apt-look/pkg/apt/sources"
 )
 
-func runStats(sources []sources.Entry, format string) error {
-	if len(sources) == 0 {
-		return fmt.Errorf("no sources provided")
-	}
+func runStats(ctx context.Context, sources []sources.Entry, format string) error {
 	// Use the first source when multiple are discovered
-	source := sources[0]
-	if len(sources) > 1 {
-		log.Info().Msgf("Multiple sources discovered, using: %s %s %v",
-			source.Type, source.ArchiveRoot.String(), source.Components)
+	repo, source, err := mountFirstSource(ctx, sources)
+	if err != nil {
+		return err
 	}
 	log.Info().Msgf("Getting statistics for: %v", source)
 
 	// Calculate statistics
-	stats, registry, err := calculateRepositoryStats(source)
+	stats, err := repo.Stats(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to calculate statistics: %w", err)
 	}
 
 	// Format and output results
-	err = outputStats(source, stats, format)
+	err = outputStats(stdout, source, stats, format)
 	if err != nil {
 		return err
 	}
 
 	// Display cache statistics
-	hits, misses, hitRatio := registry.GetCacheStats()
+	hits, misses, hitRatio := transports.GetCacheStats()
 	if hits > 0 || misses > 0 {
 		log.Info().
 			Int64("cache_hits", hits).
@@ -51,150 +50,159 @@ func runStats(sources []sources.Entry, format string) error {
 	return nil
 }
 
-// RepositoryStats holds statistics about a repository
-// TODO: should size stats be calculated per-architecture and per-component? I think yes.
-type RepositoryStats struct {
-	Repository struct {
-		Origin        string    `json:"origin,omitempty"`
-		Label         string    `json:"label,omitempty"`
-		Suite         string    `json:"suite,omitempty"`
-		Codename      string    `json:"codename,omitempty"`
-		Date          time.Time `json:"date"`
-		Architectures []string  `json:"architectures"`
-		Components    []string  `json:"components"`
-	} `json:"repository"`
-
-	Packages struct {
-		Total          int            `json:"total"`
-		TotalSize      int64          `json:"total_size_bytes"`
-		TotalSizeMB    int64          `json:"total_size_mb"`
-		ByArchitecture map[string]int `json:"by_architecture"`
-		ByComponent    map[string]int `json:"by_component"`
-		BySection      map[string]int `json:"by_section"`
-		ByPriority     map[string]int `json:"by_priority"`
-	} `json:"packages"`
-}
-
-func calculateRepositoryStats(source sources.Entry) (*RepositoryStats, *apttransport2.Registry, error) {
-	// TODO: implement this again
-	panic("not yet implemented")
-}
-
-func outputStats(source sources.Entry, stats *RepositoryStats, format string) error {
+func outputStats(w io.Writer, source sources.Entry, stats *apt.RepositoryStats, format string) error {
 	switch format {
 	case "json":
-		encoder := json.NewEncoder(os.Stdout)
+		encoder := json.NewEncoder(w)
 		encoder.SetIndent("", "  ")
 		return encoder.Encode(stats)
 
+	case "jsonl":
+		return json.NewEncoder(w).Encode(stats)
+
 	case "tsv":
-		return outputStatsTSV(stats)
+		return outputStatsTSV(w, stats)
 
 	case "prom":
-		return outputStatsPrometheus(source, stats)
+		return outputStatsPrometheus(w, source, stats)
 
 	case "raw":
-		return outputStatsRaw(stats)
+		return outputStatsRaw(w, stats)
 
 	case "text":
 		fallthrough
 	default:
-		return outputStatsText(stats)
+		return outputStatsText(w, stats)
 	}
 }
 
-func outputStatsText(stats *RepositoryStats) error {
-	fmt.Printf("Repository Statistics\n")
-	fmt.Printf("====================\n\n")
+func outputStatsText(w io.Writer, stats *apt.RepositoryStats) error {
+	fmt.Fprintf(w, "Repository Statistics\n")
+	fmt.Fprintf(w, "====================\n\n")
 
 	// Repository information
-	fmt.Printf("Repository Information:\n")
+	fmt.Fprintf(w, "Repository Information:\n")
 	if stats.Repository.Origin != "" {
-		fmt.Printf("  Origin: %s\n", stats.Repository.Origin)
+		fmt.Fprintf(w, "  Origin: %s\n", stats.Repository.Origin)
 	}
 	if stats.Repository.Label != "" {
-		fmt.Printf("  Label: %s\n", stats.Repository.Label)
+		fmt.Fprintf(w, "  Label: %s\n", stats.Repository.Label)
 	}
 	if stats.Repository.Suite != "" {
-		fmt.Printf("  Suite: %s\n", stats.Repository.Suite)
+		fmt.Fprintf(w, "  Suite: %s\n", stats.Repository.Suite)
 	}
 	if stats.Repository.Codename != "" {
-		fmt.Printf("  Codename: %s\n", stats.Repository.Codename)
+		fmt.Fprintf(w, "  Codename: %s\n", stats.Repository.Codename)
 	}
-	fmt.Printf("  Date: %s\n", stats.Repository.Date.Format("2006-01-02 15:04:05 MST"))
-	fmt.Printf("  Architectures: %s\n", strings.Join(stats.Repository.Architectures, ", "))
-	fmt.Printf("  Components: %s\n", strings.Join(stats.Repository.Components, ", "))
+	fmt.Fprintf(w, "  Date: %s\n", stats.Repository.Date.Format("2006-01-02 15:04:05 MST"))
+	fmt.Fprintf(w, "  Architectures: %s\n", strings.Join(stats.Repository.Architectures, ", "))
+	fmt.Fprintf(w, "  Components: %s\n", strings.Join(stats.Repository.Components, ", "))
 
 	// Package statistics
-	fmt.Printf("\nPackage Statistics:\n")
-	fmt.Printf("  Total Packages: %d\n", stats.Packages.Total)
-	fmt.Printf("  Total Size: %d bytes (%.1f MB)\n", stats.Packages.TotalSize, float64(stats.Packages.TotalSize)/(1024*1024))
+	fmt.Fprintf(w, "\nPackage Statistics:\n")
+	fmt.Fprintf(w, "  Total Packages: %d\n", stats.Packages.Total)
+	fmt.Fprintf(w, "  Total Size: %d bytes (%.1f MB)\n", stats.Packages.TotalSize, megabytes(stats.Packages.TotalSize))
+	fmt.Fprintf(w, "  Total Installed Size: %d bytes (%.1f MB)\n", stats.Packages.TotalInstalledSize, megabytes(stats.Packages.TotalInstalledSize))
 
 	if len(stats.Packages.ByArchitecture) > 0 {
-		fmt.Printf("\n  By Architecture:\n")
-		for arch, count := range stats.Packages.ByArchitecture {
-			fmt.Printf("    %s: %d packages\n", arch, count)
+		fmt.Fprintf(w, "\n  By Architecture:\n")
+		for _, arch := range slices.Sorted(maps.Keys(stats.Packages.ByArchitecture)) {
+			fmt.Fprintf(w, "    %s: %d packages (%.1f MB)\n", arch, stats.Packages.ByArchitecture[arch],
+				megabytes(stats.Packages.SizeByArchitecture[arch]))
 		}
 	}
 
 	if len(stats.Packages.ByComponent) > 0 {
-		fmt.Printf("\n  By Component:\n")
-		for component, count := range stats.Packages.ByComponent {
-			fmt.Printf("    %s: %d packages\n", component, count)
+		fmt.Fprintf(w, "\n  By Component:\n")
+		for _, component := range slices.Sorted(maps.Keys(stats.Packages.ByComponent)) {
+			fmt.Fprintf(w, "    %s: %d packages (%.1f MB)\n", component, stats.Packages.ByComponent[component],
+				megabytes(stats.Packages.SizeByComponent[component]))
 		}
 	}
 
 	if len(stats.Packages.BySection) > 0 {
-		fmt.Printf("\n  By Section:\n")
-		for section, count := range stats.Packages.BySection {
-			fmt.Printf("    %s: %d packages\n", section, count)
+		fmt.Fprintf(w, "\n  By Section:\n")
+		if options.bySectionSize {
+			// largest first, by name when sizes are equal
+			sections := slices.SortedFunc(maps.Keys(stats.Packages.BySection), func(a, b string) int {
+				if c := cmp.Compare(stats.Packages.SizeBySection[b], stats.Packages.SizeBySection[a]); c != 0 {
+					return c
+				}
+				return strings.Compare(a, b)
+			})
+			for _, section := range sections {
+				fmt.Fprintf(w, "    %s: %.1f MB (%d packages)\n", section, megabytes(stats.Packages.SizeBySection[section]),
+					stats.Packages.BySection[section])
+			}
+		} else {
+			for _, section := range slices.Sorted(maps.Keys(stats.Packages.BySection)) {
+				fmt.Fprintf(w, "    %s: %d packages\n", section, stats.Packages.BySection[section])
+			}
 		}
 	}
 
 	if len(stats.Packages.ByPriority) > 0 {
-		fmt.Printf("\n  By Priority:\n")
-		for priority, count := range stats.Packages.ByPriority {
-			fmt.Printf("    %s: %d packages\n", priority, count)
+		fmt.Fprintf(w, "\n  By Priority:\n")
+		for _, priority := range slices.Sorted(maps.Keys(stats.Packages.ByPriority)) {
+			fmt.Fprintf(w, "    %s: %d packages\n", priority, stats.Packages.ByPriority[priority])
 		}
 	}
 
 	return nil
 }
 
-func outputStatsTSV(stats *RepositoryStats) error {
-	fmt.Printf("field\tvalue\n")
-	fmt.Printf("origin\t%s\n", stats.Repository.Origin)
-	fmt.Printf("label\t%s\n", stats.Repository.Label)
-	fmt.Printf("suite\t%s\n", stats.Repository.Suite)
-	fmt.Printf("codename\t%s\n", stats.Repository.Codename)
-	fmt.Printf("date\t%s\n", stats.Repository.Date.Format("2006-01-02T15:04:05Z07:00"))
-	fmt.Printf("architectures\t%s\n", strings.Join(stats.Repository.Architectures, ","))
-	fmt.Printf("components\t%s\n", strings.Join(stats.Repository.Components, ","))
-	fmt.Printf("total_packages\t%d\n", stats.Packages.Total)
-	fmt.Printf("total_size_bytes\t%d\n", stats.Packages.TotalSize)
-	fmt.Printf("total_size_mb\t%d\n", stats.Packages.TotalSizeMB)
-
-	for arch, count := range stats.Packages.ByArchitecture {
-		fmt.Printf("arch_%s\t%d\n", arch, count)
+func megabytes(bytes int64) float64 {
+	return float64(bytes) / (1024 * 1024)
+}
+
+func outputStatsTSV(w io.Writer, stats *apt.RepositoryStats) error {
+	fmt.Fprintf(w, "field\tvalue\n")
+	fmt.Fprintf(w, "origin\t%s\n", stats.Repository.Origin)
+	fmt.Fprintf(w, "label\t%s\n", stats.Repository.Label)
+	fmt.Fprintf(w, "suite\t%s\n", stats.Repository.Suite)
+	fmt.Fprintf(w, "codename\t%s\n", stats.Repository.Codename)
+	fmt.Fprintf(w, "date\t%s\n", stats.Repository.Date.Format("2006-01-02T15:04:05Z07:00"))
+	fmt.Fprintf(w, "architectures\t%s\n", strings.Join(stats.Repository.Architectures, ","))
+	fmt.Fprintf(w, "components\t%s\n", strings.Join(stats.Repository.Components, ","))
+	fmt.Fprintf(w, "total_packages\t%d\n", stats.Packages.Total)
+	fmt.Fprintf(w, "total_size_bytes\t%d\n", stats.Packages.TotalSize)
+	fmt.Fprintf(w, "total_size_mb\t%d\n", stats.Packages.TotalSizeMB)
+	fmt.Fprintf(w, "total_installed_size_bytes\t%d\n", stats.Packages.TotalInstalledSize)
+
+	for _, arch := range slices.Sorted(maps.Keys(stats.Packages.ByArchitecture)) {
+		fmt.Fprintf(w, "arch_%s\t%d\n", arch, stats.Packages.ByArchitecture[arch])
+		fmt.Fprintf(w, "arch_%s_size_bytes\t%d\n", arch, stats.Packages.SizeByArchitecture[arch])
 	}
 
-	for component, count := range stats.Packages.ByComponent {
-		fmt.Printf("component_%s\t%d\n", component, count)
+	for _, component := range slices.Sorted(maps.Keys(stats.Packages.ByComponent)) {
+		fmt.Fprintf(w, "component_%s\t%d\n", component, stats.Packages.ByComponent[component])
+		fmt.Fprintf(w, "component_%s_size_bytes\t%d\n", component, stats.Packages.SizeByComponent[component])
+	}
+
+	if options.bySectionSize {
+		for _, section := range slices.Sorted(maps.Keys(stats.Packages.BySection)) {
+			fmt.Fprintf(w, "section_%s_size_bytes\t%d\n", section, stats.Packages.SizeBySection[section])
+		}
 	}
 
 	return nil
 }
 
+// prometheusLabelEscaper escapes label values as required by the Prometheus text exposition format
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
 func formatPrometheusMetric(name string, labels map[string]string, value float64) string {
 	var sb strings.Builder
 	sb.WriteString(name)
-	if labels != nil && len(labels) > 0 {
+	if len(labels) > 0 {
 		sb.WriteRune('{')
-		parts := make([]string, 0, len(labels))
-		for k, v := range labels {
-			parts = append(parts, fmt.Sprintf(`%s=%q`, k, v))
+		// sorted label names keep the output stable for diffing
+		for i, k := range slices.Sorted(maps.Keys(labels)) {
+			if i > 0 {
+				sb.WriteRune(',')
+			}
+			fmt.Fprintf(&sb, `%s="%s"`, k, prometheusLabelEscaper.Replace(labels[k]))
 		}
-		sb.WriteString(strings.Join(parts, ","))
 		sb.WriteRune('}')
 	}
 	sb.WriteRune(' ')
@@ -202,7 +210,14 @@ func formatPrometheusMetric(name string, labels map[string]string, value float64
 	return sb.String()
 }
 
-func outputStatsPrometheus(source sources.Entry, stats *RepositoryStats) error {
+// prometheusFamily is a metric name with the HELP and TYPE metadata that precede its samples
+type prometheusFamily struct {
+	name    string
+	help    string
+	samples []string
+}
+
+func outputStatsPrometheus(w io.Writer, source sources.Entry, stats *apt.RepositoryStats) error {
 	labels := map[string]string{
 		"host":         source.ArchiveRoot.Host,
 		"path":         source.ArchiveRoot.Path,
@@ -212,49 +227,68 @@ func outputStatsPrometheus(source sources.Entry, stats *RepositoryStats) error {
 		"suite":        stats.Repository.Suite,
 	}
 
-	// TODO: HELP and TYPE lines
-	//# HELP http_requests_total The total number of HTTP requests
-	//# TYPE http_requests_total counter
-	// maybe I should import a real prom module?
+	totalBytes := prometheusFamily{
+		name: "apt_repo_total_bytes",
+		help: "Total size in bytes of all packages in the repository, overall and by architecture or component",
+	}
+	installedBytes := prometheusFamily{
+		name: "apt_repo_installed_bytes",
+		help: "Total installed size in bytes of all packages in the repository",
+	}
+	totalPackages := prometheusFamily{
+		name: "apt_repo_total_packages",
+		help: "Number of packages in the repository, overall and by architecture or component",
+	}
 
-	var metrics []string
 	labels["arch"] = "combined"
-	metrics = append(metrics, formatPrometheusMetric("apt_repo_total_bytes", labels,
+	totalBytes.samples = append(totalBytes.samples, formatPrometheusMetric(totalBytes.name, labels,
 		float64(stats.Packages.TotalSize)))
-	metrics = append(metrics, formatPrometheusMetric("apt_repo_total_packages", labels,
+	totalPackages.samples = append(totalPackages.samples, formatPrometheusMetric(totalPackages.name, labels,
 		float64(stats.Packages.Total)))
+	installedBytes.samples = append(installedBytes.samples, formatPrometheusMetric(installedBytes.name, labels,
+		float64(stats.Packages.TotalInstalledSize)))
 
-	for arch, pkgCount := range stats.Packages.ByArchitecture {
+	for _, arch := range slices.Sorted(maps.Keys(stats.Packages.ByArchitecture)) {
 		labels["arch"] = arch
-		metrics = append(metrics, formatPrometheusMetric("apt_repo_total_packages", labels,
-			float64(pkgCount)))
+		totalBytes.samples = append(totalBytes.samples, formatPrometheusMetric(totalBytes.name, labels,
+			float64(stats.Packages.SizeByArchitecture[arch])))
+		totalPackages.samples = append(totalPackages.samples, formatPrometheusMetric(totalPackages.name, labels,
+			float64(stats.Packages.ByArchitecture[arch])))
 	}
 	delete(labels, "arch")
 
-	for arch, pkgCount := range stats.Packages.ByArchitecture {
-		labels["component"] = arch
-		metrics = append(metrics, formatPrometheusMetric("apt_repo_total_packages", labels,
-			float64(pkgCount)))
+	for _, component := range slices.Sorted(maps.Keys(stats.Packages.ByComponent)) {
+		labels["component"] = component
+		totalBytes.samples = append(totalBytes.samples, formatPrometheusMetric(totalBytes.name, labels,
+			float64(stats.Packages.SizeByComponent[component])))
+		totalPackages.samples = append(totalPackages.samples, formatPrometheusMetric(totalPackages.name, labels,
+			float64(stats.Packages.ByComponent[component])))
 	}
 	delete(labels, "component")
 
-	for _, metric := range metrics {
-		_, _ = os.Stdout.WriteString(metric + "\n")
+	// all samples of a metric must directly follow its HELP and TYPE lines
+	for _, family := range []prometheusFamily{totalBytes, installedBytes, totalPackages} {
+		fmt.Fprintf(w, "# HELP %s %s\n", family.name, family.help)
+		fmt.Fprintf(w, "# TYPE %s gauge\n", family.name)
+		for _, sample := range family.samples {
+			fmt.Fprintln(w, sample)
+		}
 	}
 
 	return nil
 }
 
-func outputStatsRaw(stats *RepositoryStats) error {
-	fmt.Printf("Origin: %s\n", stats.Repository.Origin)
-	fmt.Printf("Label: %s\n", stats.Repository.Label)
-	fmt.Printf("Suite: %s\n", stats.Repository.Suite)
-	fmt.Printf("Codename: %s\n", stats.Repository.Codename)
-	fmt.Printf("Date: %s\n", stats.Repository.Date.Format("Mon, 02 Jan 2006 15:04:05 MST"))
-	fmt.Printf("Architectures: %s\n", strings.Join(stats.Repository.Architectures, " "))
-	fmt.Printf("Components: %s\n", strings.Join(stats.Repository.Components, " "))
-	fmt.Printf("Total-Packages: %d\n", stats.Packages.Total)
-	fmt.Printf("Total-Size: %d\n", stats.Packages.TotalSize)
+func outputStatsRaw(w io.Writer, stats *apt.RepositoryStats) error {
+	fmt.Fprintf(w, "Origin: %s\n", stats.Repository.Origin)
+	fmt.Fprintf(w, "Label: %s\n", stats.Repository.Label)
+	fmt.Fprintf(w, "Suite: %s\n", stats.Repository.Suite)
+	fmt.Fprintf(w, "Codename: %s\n", stats.Repository.Codename)
+	fmt.Fprintf(w, "Date: %s\n", stats.Repository.Date.Format("Mon, 02 Jan 2006 15:04:05 MST"))
+	fmt.Fprintf(w, "Architectures: %s\n", strings.Join(stats.Repository.Architectures, " "))
+	fmt.Fprintf(w, "Components: %s\n", strings.Join(stats.Repository.Components, " "))
+	fmt.Fprintf(w, "Total-Packages: %d\n", stats.Packages.Total)
+	fmt.Fprintf(w, "Total-Size: %d\n", stats.Packages.TotalSize)
+	fmt.Fprintf(w, "Total-Installed-Size: %d\n", stats.Packages.TotalInstalledSize)
 
 	return nil
 }
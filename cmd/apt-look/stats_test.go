@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nicwaller/apt-look/pkg/apt"
+)
+
+func TestStats(t *testing.T) {
+	// common is architecture "all", so both main indexes list it
+	indexes := map[string]string{
+		"main/binary-amd64/Packages": "Package: alpha\nVersion: 1.0\nArchitecture: amd64\nSection: utils\nPriority: optional\nFilename: pool/alpha_1.0_amd64.deb\nSize: 1000\nInstalled-Size: 4\n\n" +
+			"Package: common\nVersion: 1.0\nArchitecture: all\nSection: doc\nFilename: pool/common_1.0_all.deb\nSize: 200\nInstalled-Size: 1\n",
+		"main/binary-arm64/Packages": "Package: alpha\nVersion: 1.0\nArchitecture: arm64\nSection: utils\nPriority: optional\nFilename: pool/alpha_1.0_arm64.deb\nSize: 1100\nInstalled-Size: 4\n\n" +
+			"Package: common\nVersion: 1.0\nArchitecture: all\nSection: doc\nFilename: pool/common_1.0_all.deb\nSize: 200\nInstalled-Size: 1\n",
+		"contrib/binary-amd64/Packages": "Package: gamma\nVersion: 2.0\nArchitecture: amd64\nSection: net\nPriority: extra\nFilename: pool/gamma_2.0_amd64.deb\nSize: 300\n",
+	}
+	repo := t.TempDir()
+	var release strings.Builder
+	release.WriteString("Origin: Test\nLabel: Stats\nSuite: stable\nArchitectures: amd64 arm64\nComponents: main contrib\nDate: Sat, 27 Apr 2024 15:24:47 UTC\nSHA256:\n")
+	for name, index := range indexes {
+		writeFile(t, repo, "dists/stable/"+name, index)
+		fmt.Fprintf(&release, " %x %d %s\n", sha256.Sum256([]byte(index)), len(index), name)
+	}
+	writeFile(t, repo, "dists/stable/Release", release.String())
+	source := "deb file://" + repo + " stable main contrib"
+
+	var stats apt.RepositoryStats
+	require.NoError(t, json.Unmarshal([]byte(runCommand(t, "stats", source, "--no-cache", "--arch", "amd64,arm64", "--format", "json")), &stats))
+	assert.Equal(t, "Test", stats.Repository.Origin)
+	assert.Equal(t, []string{"main", "contrib"}, stats.Repository.Components)
+	assert.Equal(t, 4, stats.Packages.Total)
+	assert.Equal(t, int64(2600), stats.Packages.TotalSize)
+	assert.Equal(t, int64(9*1024), stats.Packages.TotalInstalledSize)
+	assert.Equal(t, map[string]int{"amd64": 2, "arm64": 1, "all": 1}, stats.Packages.ByArchitecture)
+	assert.Equal(t, map[string]int64{"amd64": 1300, "arm64": 1100, "all": 200}, stats.Packages.SizeByArchitecture)
+	assert.Equal(t, map[string]int{"main": 3, "contrib": 1}, stats.Packages.ByComponent)
+	assert.Equal(t, map[string]int64{"main": 2300, "contrib": 300}, stats.Packages.SizeByComponent)
+	assert.Equal(t, map[string]int{"utils": 2, "doc": 1, "net": 1}, stats.Packages.BySection)
+	assert.Equal(t, map[string]int{"optional": 2, "extra": 1}, stats.Packages.ByPriority)
+
+	// --arch narrows the indexes that are counted
+	output := runCommand(t, "stats", source, "--no-cache", "--arch", "arm64", "--format", "tsv")
+	assert.Contains(t, output, "total_packages\t2\n")
+	assert.Contains(t, output, "arch_arm64\t1\n")
+	assert.NotContains(t, output, "arch_amd64")
+	assert.Contains(t, output, "component_main\t2\n")
+}
+
+func TestFormatPrometheusMetric(t *testing.T) {
+	labels := map[string]string{
+		"path": `/repo "stable"\debian`,
+		"arch": "amd64",
+		"host": "line\nbreak",
+	}
+
+	// labels are sorted by name and values escaped per the exposition format
+	assert.Equal(t,
+		`apt_repo_total_packages{arch="amd64",host="line\nbreak",path="/repo \"stable\"\\debian"} 42.000000`,
+		formatPrometheusMetric("apt_repo_total_packages", labels, 42))
+	assert.Equal(t, "apt_repo_total_bytes 1.000000", formatPrometheusMetric("apt_repo_total_bytes", nil, 1))
+}
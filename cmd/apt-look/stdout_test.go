@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runCommand executes apt-look with args and returns what it wrote to stdout
+func runCommand(t *testing.T, args ...string) string {
+	t.Helper()
+	resetFlags(t)
+	// flags are bound to package variables, so leave them as the next test expects to find them
+	t.Cleanup(func() { resetFlags(t) })
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	realStdout, resultWriter := os.Stdout, stdout
+	os.Stdout, stdout = w, w
+	t.Cleanup(func() { os.Stdout, stdout = realStdout, resultWriter })
+
+	// set up logging the way main does, after stdout has been replaced
+	configureLogging()
+	output := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		output <- data
+	}()
+
+	rootCmd.SetArgs(args)
+	err = rootCmd.Execute()
+	w.Close()
+	os.Stdout, stdout = realStdout, resultWriter
+	data := <-output
+	require.NoError(t, err)
+	return string(data)
+}
+
+// resetFlags returns every flag to its default, since rootCmd keeps the flags of earlier runs.
+// A slice flag that has been set appends to its value on the next run instead of replacing it.
+func resetFlags(t *testing.T) {
+	t.Helper()
+	reset := func(flag *pflag.Flag) {
+		if !flag.Changed {
+			return
+		}
+		if slice, ok := flag.Value.(pflag.SliceValue); ok {
+			require.NoError(t, slice.Replace(nil))
+		} else {
+			require.NoError(t, flag.Value.Set(flag.DefValue))
+		}
+		flag.Changed = false
+	}
+	for _, cmd := range append(rootCmd.Commands(), rootCmd) {
+		cmd.Flags().VisitAll(reset)
+		cmd.PersistentFlags().VisitAll(reset)
+	}
+}
+
+func TestStdoutIsOnlyJSON(t *testing.T) {
+	repo, err := filepath.Abs("../../pkg/apt/testdata/allarchrepo")
+	require.NoError(t, err)
+	source := "deb file://" + repo + " stable main"
+	common := []string{"--no-cache", "--arch", "amd64", "--format", "json"}
+
+	t.Run("list", func(t *testing.T) {
+		output := runCommand(t, append([]string{"list", source}, common...)...)
+		scanner := bufio.NewScanner(bytes.NewBufferString(output))
+		lines := 0
+		for scanner.Scan() {
+			lines++
+			assert.True(t, json.Valid(scanner.Bytes()), "not JSON: %s", scanner.Text())
+		}
+		assert.Equal(t, 2, lines)
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		output := runCommand(t, append([]string{"stats", source}, common...)...)
+		assert.True(t, json.Valid([]byte(output)), "not JSON: %s", output)
+	})
+}
+
+func TestStdoutIsOnlyJSONForEveryCommand(t *testing.T) {
+	repo := t.TempDir()
+	writeMirrorRepo(t, repo)
+	source := "deb file://" + repo + " stable main"
+	cacheDir := t.TempDir()
+	runCommand(t, "list", source, "--cache-dir", cacheDir, "--arch", "amd64")
+
+	// every command that takes --format and writes results, with the logs they write at the info level
+	commands := [][]string{
+		{"list", source},
+		{"latest", source},
+		{"search", source, "alpha"},
+		{"info", source, "alpha"},
+		{"rdepends", source, "alpha"},
+		{"stats", source},
+		{"check", source},
+		{"diff", source, source},
+		{"verify", source},
+		{"cache-info"},
+		{"purge-cache", source},
+	}
+	for _, args := range commands {
+		for _, format := range []string{"json", "jsonl"} {
+			t.Run(args[0]+"/"+format, func(t *testing.T) {
+				// the output is a stream of JSON values, and nothing at all for commands that find nothing,
+				// like diff of a source with itself
+				output := runCommand(t, append(args, "--cache-dir", cacheDir, "--arch", "amd64,arm64", "--format", format)...)
+				decoder := json.NewDecoder(strings.NewReader(output))
+				for {
+					var value any
+					if err := decoder.Decode(&value); err == io.EOF {
+						break
+					} else if !assert.NoError(t, err, "not JSON: %s", output) {
+						break
+					}
+				}
+				if format == "jsonl" {
+					scanner := bufio.NewScanner(strings.NewReader(output))
+					for scanner.Scan() {
+						assert.True(t, json.Valid(scanner.Bytes()), "not JSON: %s", scanner.Text())
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestOutputFile(t *testing.T) {
+	repo, err := filepath.Abs("../../pkg/apt/testdata/allarchrepo")
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "packages.tsv")
+	t.Cleanup(func() { options.outputFile = "" })
+
+	output := runCommand(t, "list", "deb file://"+repo+" stable main", "--no-cache", "--arch", "amd64",
+		"--format", "tsv", "--output-file", path)
+	assert.Empty(t, output)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "alpha\t")
+}
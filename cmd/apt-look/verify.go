@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/nicwaller/apt-look/pkg/apt"
+	apttransport2 "github.com/nicwaller/apt-look/pkg/apt/apttransport"
+	"github.com/nicwaller/apt-look/pkg/deb822"
+)
+
+// VerifyResult represents the results of verifying the .deb files referenced by Packages indexes
+type VerifyResult struct {
+	Summary struct {
+		TotalPackages  int `json:"total_packages"`
+		Verified       int `json:"verified"`
+		Missing        int `json:"missing"`
+		HashMismatches int `json:"hash_mismatches"`
+		SizeMismatches int `json:"size_mismatches"`
+		Errors         int `json:"errors"`
+	} `json:"summary"`
+
+	Missing        []PackageVerifyResult `json:"missing,omitempty"`
+	HashMismatches []PackageVerifyResult `json:"hash_mismatches,omitempty"`
+	SizeMismatches []PackageVerifyResult `json:"size_mismatches,omitempty"`
+	Errors         []PackageVerifyResult `json:"errors,omitempty"`
+}
+
+// PackageVerifyResult represents the result of verifying a single .deb file
+type PackageVerifyResult struct {
+	Package      string `json:"package"`
+	Version      string `json:"version"`
+	Architecture string `json:"architecture"`
+	Filename     string `json:"filename"`
+	URL          string `json:"url"`
+	Status       string `json:"status"`
+	Size         int64  `json:"size"`
+	ActualSize   int64  `json:"actual_size,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// Verification outcomes for a single .deb file
+const (
+	verifyStatusOK           = "ok"
+	verifyStatusMissing      = "missing"
+	verifyStatusHashMismatch = "hash_mismatch"
+	verifyStatusSizeMismatch = "size_mismatch"
+	verifyStatusError        = "error"
+)
+
+// runVerify downloads the .deb files referenced by the Packages indexes of the source, or only
+// those of packageName when it isn't empty, and compares them with the recorded hashes and sizes
+func runVerify(ctx context.Context, source, packageName, format string) error {
+	if packageName != "" {
+		log.Info().Msgf("Verifying package '%s' in: %s", packageName, source)
+	} else {
+		log.Info().Msgf("Verifying packages in: %s", source)
+	}
+
+	sourceList, err := parseSourceInput(ctx, source)
+	if err != nil {
+		return fmt.Errorf("failed to parse source input: %w", err)
+	}
+
+	result := &VerifyResult{}
+	// packages for Architecture: all are listed in every binary index but share one pool file
+	seen := make(map[string]bool)
+	failures := newSourceFailures(sourceList)
+	for _, src := range sourceList {
+		repo, err := apt.MountContext(ctx, src, buildMountOptions()...)
+		if err != nil {
+			if err := failures.skip(src, fmt.Errorf("failed to mount repository: %w", err)); err != nil {
+				return err
+			}
+			continue
+		}
+		// the packages are listed before any are fetched, so a slow download doesn't hold the index open
+		var pool []*deb822.Package
+		for pkg, err := range repo.PackagesFiltered(ctx, apt.Filter{Name: packageName}) {
+			if err != nil {
+				return fmt.Errorf("failed to list packages: %w", err)
+			}
+			debURL := repo.ArchiveRoot().JoinPath(pkg.Filename).String()
+			if !matchesArchFilter(pkg) || seen[debURL] {
+				continue
+			}
+			seen[debURL] = true
+			pool = append(pool, pkg)
+		}
+		for _, pkg := range pool {
+			// once cancelled, every remaining package would be reported as an error
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			result.add(verifyPackage(ctx, repo.Transport(), repo.ArchiveRoot().JoinPath(pkg.Filename), pkg))
+		}
+	}
+
+	if err := failures.done(); err != nil {
+		return err
+	}
+
+	if packageName != "" && result.Summary.TotalPackages == 0 {
+		return fmt.Errorf("package %q not found in repository", packageName)
+	}
+
+	if err := outputVerifyResults(stdout, result, format); err != nil {
+		return err
+	}
+
+	if problems := result.Summary.TotalPackages - result.Summary.Verified; problems > 0 {
+		return fmt.Errorf("%d of %d packages failed verification", problems, result.Summary.TotalPackages)
+	}
+	return nil
+}
+
+// add counts a verified file and records it in the list for its outcome
+func (r *VerifyResult) add(pkgResult PackageVerifyResult) {
+	r.Summary.TotalPackages++
+	switch pkgResult.Status {
+	case verifyStatusOK:
+		r.Summary.Verified++
+	case verifyStatusMissing:
+		r.Missing = append(r.Missing, pkgResult)
+		r.Summary.Missing++
+	case verifyStatusHashMismatch:
+		r.HashMismatches = append(r.HashMismatches, pkgResult)
+		r.Summary.HashMismatches++
+	case verifyStatusSizeMismatch:
+		r.SizeMismatches = append(r.SizeMismatches, pkgResult)
+		r.Summary.SizeMismatches++
+	default:
+		r.Errors = append(r.Errors, pkgResult)
+		r.Summary.Errors++
+	}
+}
+
+// verifyPackage streams a .deb file through the transport, which hashes it on the way and
+// reports a mismatch with the hashes from the Packages index when the content is read to the end
+func verifyPackage(ctx context.Context, tpt apttransport2.Transport, debURL *url.URL, pkg *deb822.Package) PackageVerifyResult {
+	pkgResult := PackageVerifyResult{
+		Package:      pkg.Package,
+		Version:      pkg.Version,
+		Architecture: pkg.Architecture,
+		Filename:     pkg.Filename,
+		URL:          debURL.String(),
+		Size:         pkg.Size,
+	}
+
+	req := &apttransport2.AcquireRequest{
+		URI:            debURL,
+		ExpectedHashes: packageHashes(pkg),
+		Timeout:        30 * time.Minute, // packages can be much larger than index files
+	}
+	if len(req.ExpectedHashes) == 0 {
+		pkgResult.Status = verifyStatusError
+		pkgResult.Error = "no hashes recorded in the Packages index"
+		return pkgResult
+	}
+
+	resp, err := tpt.Acquire(ctx, req)
+	if err == nil {
+		_, err = io.Copy(io.Discard, resp.Content)
+		resp.Content.Close()
+	}
+	switch {
+	case errors.Is(err, apttransport2.ErrHashMismatch):
+		pkgResult.Status = verifyStatusHashMismatch
+		pkgResult.Error = err.Error()
+		// report the expected and actual hashes rather than the generic acquire error
+		var acquireErr *apttransport2.AcquireError
+		if errors.As(err, &acquireErr) && acquireErr.Err != nil {
+			pkgResult.Error = acquireErr.Err.Error()
+		}
+	case err != nil && apttransport2.IsNotFound(err):
+		pkgResult.Status = verifyStatusMissing
+		pkgResult.Error = err.Error()
+	case err != nil:
+		pkgResult.Status = verifyStatusError
+		pkgResult.Error = err.Error()
+	case resp.Size != pkg.Size:
+		pkgResult.Status = verifyStatusSizeMismatch
+		pkgResult.ActualSize = resp.Size
+	default:
+		pkgResult.Status = verifyStatusOK
+		pkgResult.ActualSize = resp.Size
+	}
+	return pkgResult
+}
+
+// packageHashes returns every hash the Packages index records for a package, for use as ExpectedHashes
+func packageHashes(pkg *deb822.Package) map[string]string {
+	hashes := make(map[string]string)
+	if pkg.SHA256 != "" {
+		hashes["sha256"] = pkg.SHA256
+	}
+	if pkg.SHA1 != "" {
+		hashes["sha1"] = pkg.SHA1
+	}
+	if pkg.MD5sum != "" {
+		hashes["md5"] = pkg.MD5sum
+	}
+	return hashes
+}
+
+func outputVerifyResults(w io.Writer, result *VerifyResult, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+
+	case "jsonl":
+		return json.NewEncoder(w).Encode(result)
+
+	case "tsv", "csv":
+		return outputVerifyResultsTable(w, result, format)
+
+	case "text":
+		fallthrough
+	default:
+		return outputVerifyResultsText(w, result)
+	}
+}
+
+func outputVerifyResultsText(w io.Writer, result *VerifyResult) error {
+	fmt.Fprintf(w, "Package Verification\n")
+	fmt.Fprintf(w, "====================\n\n")
+
+	fmt.Fprintf(w, "Verification Summary:\n")
+	fmt.Fprintf(w, "  Total packages: %d\n", result.Summary.TotalPackages)
+	fmt.Fprintf(w, "  Verified: %d\n", result.Summary.Verified)
+	fmt.Fprintf(w, "  Missing: %d\n", result.Summary.Missing)
+	fmt.Fprintf(w, "  Hash Mismatches: %d\n", result.Summary.HashMismatches)
+	fmt.Fprintf(w, "  Size Mismatches: %d\n", result.Summary.SizeMismatches)
+	fmt.Fprintf(w, "  Errors: %d\n", result.Summary.Errors)
+
+	if len(result.Missing) > 0 {
+		fmt.Fprintf(w, "\nMissing pool files:\n")
+		for _, pkg := range result.Missing {
+			fmt.Fprintf(w, "  - %s (%s %s %s)\n", pkg.Filename, pkg.Package, pkg.Version, pkg.Architecture)
+		}
+	}
+
+	if len(result.HashMismatches) > 0 {
+		fmt.Fprintf(w, "\nHash Mismatches:\n")
+		for _, pkg := range result.HashMismatches {
+			fmt.Fprintf(w, "  - %s: %s\n", pkg.Filename, pkg.Error)
+		}
+	}
+
+	if len(result.SizeMismatches) > 0 {
+		fmt.Fprintf(w, "\nSize Mismatches:\n")
+		for _, pkg := range result.SizeMismatches {
+			fmt.Fprintf(w, "  - %s: expected %d bytes, got %d\n", pkg.Filename, pkg.Size, pkg.ActualSize)
+		}
+	}
+
+	if len(result.Errors) > 0 {
+		fmt.Fprintf(w, "\nErrors:\n")
+		for _, pkg := range result.Errors {
+			fmt.Fprintf(w, "  - %s: %s\n", pkg.Filename, pkg.Error)
+		}
+	}
+
+	return nil
+}
+
+// outputVerifyResultsTable writes one row for each package that failed verification
+func outputVerifyResultsTable(w io.Writer, result *VerifyResult, format string) error {
+	header := []string{"package", "version", "architecture", "filename", "status", "size", "actual_size", "error"}
+	if format == "tsv" {
+		fmt.Fprintln(w, strings.Join(header, "\t"))
+	}
+	for _, group := range [][]PackageVerifyResult{result.Missing, result.HashMismatches, result.SizeMismatches, result.Errors} {
+		for _, pkg := range group {
+			record := []string{pkg.Package, pkg.Version, pkg.Architecture, pkg.Filename, pkg.Status,
+				strconv.FormatInt(pkg.Size, 10), strconv.FormatInt(pkg.ActualSize, 10), pkg.Error}
+			if format == "csv" {
+				if err := writeCSVRow(w, header, record); err != nil {
+					return err
+				}
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%s\n", pkg.Package, pkg.Version, pkg.Architecture,
+				pkg.Filename, pkg.Status, pkg.Size, pkg.ActualSize, pkg.Error)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	apttransport2 "github.com/nicwaller/apt-look/pkg/apt/apttransport"
+	"github.com/nicwaller/apt-look/pkg/deb822"
+)
+
+func TestVerifyPackage(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte("not really a deb\n")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "pool", "main"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pool", "main", "alpha_1.0_all.deb"), content, 0644))
+	archiveRoot, err := url.Parse("file://" + dir)
+	require.NoError(t, err)
+	tpt := apttransport2.NewFileTransport()
+
+	verify := func(pkg *deb822.Package) PackageVerifyResult {
+		return verifyPackage(context.Background(), tpt, archiveRoot.JoinPath(pkg.Filename), pkg)
+	}
+	pkg := func(filename string, size int64, sha string) *deb822.Package {
+		return &deb822.Package{Package: "alpha", Version: "1.0", Filename: filename, Size: size, SHA256: sha}
+	}
+	goodHash := fmt.Sprintf("%x", sha256.Sum256(content))
+
+	result := verify(pkg("pool/main/alpha_1.0_all.deb", int64(len(content)), goodHash))
+	assert.Equal(t, verifyStatusOK, result.Status)
+	assert.Equal(t, int64(len(content)), result.ActualSize)
+
+	result = verify(pkg("pool/main/alpha_1.0_all.deb", int64(len(content)), fmt.Sprintf("%x", sha256.Sum256(nil))))
+	assert.Equal(t, verifyStatusHashMismatch, result.Status)
+	assert.Contains(t, result.Error, "sha256")
+
+	result = verify(pkg("pool/main/alpha_1.0_all.deb", 1, goodHash))
+	assert.Equal(t, verifyStatusSizeMismatch, result.Status)
+
+	result = verify(pkg("pool/main/beta_1.0_all.deb", 1, goodHash))
+	assert.Equal(t, verifyStatusMissing, result.Status)
+
+	result = verify(pkg("pool/main/alpha_1.0_all.deb", int64(len(content)), ""))
+	assert.Equal(t, verifyStatusError, result.Status)
+
+	var summary VerifyResult
+	summary.add(PackageVerifyResult{Status: verifyStatusOK})
+	summary.add(PackageVerifyResult{Status: verifyStatusMissing})
+	assert.Equal(t, 2, summary.Summary.TotalPackages)
+	assert.Equal(t, 1, summary.Summary.Verified)
+	assert.Len(t, summary.Missing, 1)
+}
+
+func TestVerify(t *testing.T) {
+	repo := t.TempDir()
+	writeMirrorRepo(t, repo)
+	source := "deb file://" + repo + " stable main"
+
+	output := runCommand(t, "verify", source, "--no-cache", "--arch", "amd64,arm64", "--format", "json")
+	assert.Contains(t, output, `"total_packages": 2`)
+	assert.Contains(t, output, `"verified": 2`)
+
+	output = runCommand(t, "verify", source, "beta", "--no-cache", "--arch", "amd64,arm64", "--format", "json")
+	assert.Contains(t, output, `"total_packages": 1`)
+	assert.Contains(t, output, `"verified": 1`)
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package apttransport
+
+import (
+	"os"
+	"time"
+)
+
+// accessTime returns the modification time, since access times aren't available on this platform
+func accessTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
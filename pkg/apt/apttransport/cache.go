@@ -4,13 +4,18 @@ import (
 	"compress/gzip"
 	"context"
 	"crypto/md5"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/rs/zerolog/log"
 )
@@ -42,6 +47,15 @@ func (cs *CacheStats) GetStats() (hits, misses int64) {
 	return cs.hits, cs.misses
 }
 
+// take returns the counts and resets them, so they are only recorded once
+func (cs *CacheStats) take() (hits, misses int64) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	hits, misses = cs.hits, cs.misses
+	cs.hits, cs.misses = 0, 0
+	return hits, misses
+}
+
 func (cs *CacheStats) GetHitRatio() float64 {
 	hits, misses := cs.GetStats()
 	total := hits + misses
@@ -56,9 +70,16 @@ type CacheTransport struct {
 	wrapped  Transport
 	cacheDir string
 	disabled bool
+	ttl      time.Duration
+	maxBytes int64
 	stats    *CacheStats
+
+	evictMu sync.Mutex
 }
 
+// DefaultCacheTTL is how long cached indexes are trusted before being fetched again
+const DefaultCacheTTL = 24 * time.Hour
+
 // CacheConfig configures the caching behavior
 type CacheConfig struct {
 	// Disabled completely disables caching
@@ -66,13 +87,21 @@ type CacheConfig struct {
 
 	// CacheDir specifies the cache directory. If empty, uses XDG_CACHE_HOME/apt-look
 	CacheDir string
+
+	// TTL is the maximum age of a cache entry before it is fetched again, with If-Modified-Since when the
+	// original response had a Last-Modified time. Zero means no expiry.
+	TTL time.Duration
+
+	// MaxBytes caps the total size of the cache directory by evicting the least recently used entries.
+	// Zero means no limit.
+	MaxBytes int64
 }
 
 // NewCacheTransport creates a new caching transport that wraps another transport
 func NewCacheTransport(wrapped Transport, config CacheConfig) (*CacheTransport, error) {
 	cacheDir := config.CacheDir
 	if cacheDir == "" {
-		cacheDir = getDefaultCacheDir()
+		cacheDir = DefaultCacheDir()
 	}
 
 	// Create cache directory if it doesn't exist
@@ -89,6 +118,8 @@ func NewCacheTransport(wrapped Transport, config CacheConfig) (*CacheTransport,
 		wrapped:  wrapped,
 		cacheDir: cacheDir,
 		disabled: config.Disabled,
+		ttl:      config.TTL,
+		maxBytes: config.MaxBytes,
 		stats:    &CacheStats{},
 	}, nil
 }
@@ -98,10 +129,15 @@ func (c *CacheTransport) Schemes() []string {
 }
 
 func (c *CacheTransport) Acquire(ctx context.Context, req *AcquireRequest) (*AcquireResponse, error) {
-	// Never cache Release files - always fetch fresh
+	// Never serve Release files from the cache - always fetch fresh. The last copy of each Release file
+	// is kept for Lookup though, so that offline reads can find the indexes it lists.
 	if isReleaseFile(req.URI) {
 		log.Debug().Str("uri", req.URI.String()).Msg("cache: bypassing cache for Release file")
-		return c.wrapped.Acquire(ctx, req)
+		resp, err := c.wrapped.Acquire(ctx, req)
+		if err != nil || c.disabled || resp.Content == nil || !keepsReleaseCopy(req.URI) {
+			return resp, err
+		}
+		return c.cacheResponse(resp, filepath.Join(c.cacheDir, c.getCacheKey(req.URI)+".gz"), req)
 	}
 
 	// If caching is disabled, pass through
@@ -110,31 +146,54 @@ func (c *CacheTransport) Acquire(ctx context.Context, req *AcquireRequest) (*Acq
 		return c.wrapped.Acquire(ctx, req)
 	}
 
+	// Only indexes are cached; packages and other files are fetched directly and left out of the stats
+	if !isCacheableFile(req.URI) {
+		return c.wrapped.Acquire(ctx, req)
+	}
+
 	// Check if we have a cached version
 	cacheKey := c.getCacheKey(req.URI)
 	cachePath := filepath.Join(c.cacheDir, cacheKey+".gz")
 
 	// Try to load from cache first
-	if cached, err := c.loadFromCache(cachePath, req); err == nil && cached != nil {
+	cached, expired, err := c.loadFromCache(cachePath, req)
+	if err == nil && !expired {
 		c.stats.Hit()
 		log.Debug().Str("uri", req.URI.String()).Str("cache_key", cacheKey).Msg("cache: HIT")
 		return cached, nil
 	}
 
-	// Only count cache misses for cacheable files (not Release files or when disabled)
-	if isCacheableFile(req.URI) {
-		c.stats.Miss()
+	// An expired entry only needs to be downloaded again if it changed since it was cached
+	fetchReq := req
+	if err == nil && (cached.LastModified != nil || cached.Headers["ETag"] != "") {
+		conditional := *req
+		conditional.LastModified = cached.LastModified
+		conditional.ETag = cached.Headers["ETag"]
+		fetchReq = &conditional
 	}
-	log.Debug().Str("uri", req.URI.String()).Str("cache_key", cacheKey).Msg("cache: MISS")
 
 	// Fetch from wrapped transport
-	resp, err := c.wrapped.Acquire(ctx, req)
+	resp, err := c.wrapped.Acquire(ctx, fetchReq)
+	if err == nil && fetchReq != req && resp.Content == nil && resp.Filename == "" {
+		// Not modified, so the cached copy is good for another TTL
+		now := time.Now()
+		_ = os.Chtimes(cachePath, now, now)
+		c.stats.Hit()
+		log.Debug().Str("uri", req.URI.String()).Str("cache_key", cacheKey).Msg("cache: HIT after revalidation")
+		return cached, nil
+	}
+	if cached != nil {
+		cached.Content.Close()
+	}
+
+	c.stats.Miss()
+	log.Debug().Str("uri", req.URI.String()).Str("cache_key", cacheKey).Msg("cache: MISS")
 	if err != nil {
 		return nil, err
 	}
 
-	// If this is a cacheable file and we got content, cache it
-	if isCacheableFile(req.URI) && resp.Content != nil {
+	// Store the content, unless it was saved to a file instead
+	if resp.Content != nil {
 		log.Debug().Str("uri", req.URI.String()).Str("cache_key", cacheKey).Msg("cache: storing cacheable file")
 		return c.cacheResponse(resp, cachePath, req)
 	}
@@ -142,7 +201,31 @@ func (c *CacheTransport) Acquire(ctx context.Context, req *AcquireRequest) (*Acq
 	return resp, nil
 }
 
-// PurgeCache removes all files from the cache directory
+// Close closes the wrapped transport. Cache entries are written out as soon as their content has
+// been read in full, so there is nothing left to flush; entries still being read are discarded
+// when their content is closed.
+func (c *CacheTransport) Close() error {
+	return c.wrapped.Close()
+}
+
+// ErrNotCached is returned by Lookup when the cache has no entry for a request
+var ErrNotCached = errors.New("not cached")
+
+// Lookup serves a request from the cache alone, however old the entry is, without using the wrapped
+// transport. It yields ErrNotCached when there is no entry that matches the request's expected hashes.
+// Release and InRelease files are served from the last copy fetched, but detached signatures aren't kept.
+func (c *CacheTransport) Lookup(req *AcquireRequest) (*AcquireResponse, error) {
+	if c.disabled || (!isCacheableFile(req.URI) && !keepsReleaseCopy(req.URI)) {
+		return nil, ErrNotCached
+	}
+	resp, _, err := c.loadFromCache(filepath.Join(c.cacheDir, c.getCacheKey(req.URI)+".gz"), req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotCached, req.URI)
+	}
+	return resp, nil
+}
+
+// PurgeCache removes all cache files from the cache directory, along with the recorded hits and misses
 func (c *CacheTransport) PurgeCache() error {
 	if c.disabled {
 		log.Debug().Msg("cache: purge skipped, caching disabled")
@@ -160,7 +243,10 @@ func (c *CacheTransport) PurgeCache() error {
 
 	var purged int
 	for _, entry := range entries {
-		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".gz") {
+		// temporary files are left behind when apt-look is interrupted while caching, and the hit ratio
+		// recorded so far says nothing about the cache once it is empty
+		if !entry.IsDir() && (strings.HasSuffix(entry.Name(), ".gz") || strings.HasSuffix(entry.Name(), ".tmp") ||
+			entry.Name() == cacheStatsFile) {
 			path := filepath.Join(c.cacheDir, entry.Name())
 			if err := os.Remove(path); err != nil {
 				return err
@@ -173,103 +259,324 @@ func (c *CacheTransport) PurgeCache() error {
 	return nil
 }
 
+// PurgeEntries removes the cache entries of the given URIs, leaving the rest of the cache alone,
+// and returns how many were removed
+func (c *CacheTransport) PurgeEntries(uris []*url.URL) (int, error) {
+	if c.disabled {
+		log.Debug().Msg("cache: purge skipped, caching disabled")
+		return 0, nil
+	}
+
+	var purged int
+	for _, uri := range uris {
+		err := os.Remove(filepath.Join(c.cacheDir, c.getCacheKey(uri)+".gz"))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return purged, err
+		}
+		log.Debug().Str("uri", uri.String()).Msg("cache: purged entry")
+		purged++
+	}
+
+	log.Debug().Str("cache_dir", c.cacheDir).Int("files_removed", purged).Msg("cache: purged entries")
+	return purged, nil
+}
+
 func (c *CacheTransport) getCacheKey(uri *url.URL) string {
 	// Use MD5 hash of the archiveRoot as cache key
 	hash := md5.Sum([]byte(uri.String()))
 	return fmt.Sprintf("%x", hash)
 }
 
-func (c *CacheTransport) loadFromCache(cachePath string, req *AcquireRequest) (*AcquireResponse, error) {
+// loadFromCache reads a cache entry and reports whether it is older than the TTL.
+// The response carries the Last-Modified time and ETag of the original download, if the server sent them.
+func (c *CacheTransport) loadFromCache(cachePath string, req *AcquireRequest) (*AcquireResponse, bool, error) {
 	file, err := os.Open(cachePath)
 	if err != nil {
-		return nil, err // Cache miss
+		return nil, false, err // Cache miss
 	}
 	defer file.Close()
 
 	// Get file info for last modified time
 	info, err := file.Stat()
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+
+	// The index may have been republished at the same URL since it was cached,
+	// except at by-hash URLs whose content never changes
+	expired := c.ttl > 0 && !isByHashFile(req.URI) && time.Since(info.ModTime()) > c.ttl
+	if expired {
+		log.Debug().Str("cache_path", cachePath).Time("cached_at", info.ModTime()).Msg("cache: entry expired")
 	}
 
-	// Create gzip reader
+	// Hash the cached content without holding it in memory; it is read again when served
 	gzipReader, err := gzip.NewReader(file)
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+	hashers := map[string]hash.Hash{"md5": md5.New()}
+	for algo := range req.ExpectedHashes {
+		if hasher := createHasher(algo); hasher != nil {
+			hashers[algo] = hasher
+		}
+	}
+	writers := make([]io.Writer, 0, len(hashers))
+	for _, hasher := range hashers {
+		writers = append(writers, hasher)
+	}
+	size, err := io.Copy(io.MultiWriter(writers...), gzipReader)
+	gzipReader.Close()
+	if err != nil {
+		return nil, false, err
+	}
+	hashes := make(map[string]string)
+	for algo, hasher := range hashers {
+		hashes[algo] = fmt.Sprintf("%x", hasher.Sum(nil))
 	}
 
-	// Read the cached content
-	content, err := io.ReadAll(gzipReader)
+	// A cached copy that no longer matches the expected hashes is stale, so treat it as a miss
+	if err := verifyHashes(hashes, req.ExpectedHashes); err != nil {
+		return nil, false, err
+	}
+
+	content, err := openCacheFile(cachePath)
 	if err != nil {
-		gzipReader.Close()
-		return nil, err
+		return nil, false, err
 	}
-	gzipReader.Close()
+
+	// Record the access for LRU eviction, keeping the mtime that the TTL is based on
+	_ = os.Chtimes(cachePath, time.Now(), info.ModTime())
 
 	// Create response with cached content
-	modTime := info.ModTime()
 	resp := &AcquireResponse{
-		URI:          req.URI,
-		Content:      io.NopCloser(strings.NewReader(string(content))),
-		Size:         int64(len(content)),
-		LastModified: &modTime,
-		Headers:      make(map[string]string),
+		URI:     req.URI,
+		Content: content,
+		Size:    size,
+		Hashes:  hashes,
+		Headers: make(map[string]string),
+		Cached:  true,
 	}
 
-	// Calculate MD5 hash of the content for verification
-	hash := md5.Sum(content)
-	resp.Hashes = map[string]string{
-		"md5": fmt.Sprintf("%x", hash),
+	// The gzip header holds the Last-Modified time of the original response
+	if lastModified := gzipReader.Header.ModTime; !lastModified.IsZero() {
+		resp.LastModified = &lastModified
+	}
+	if etag := gzipReader.Header.Comment; etag != "" {
+		resp.Headers["ETag"] = etag
 	}
 
-	return resp, nil
+	return resp, expired, nil
 }
 
-func (c *CacheTransport) cacheResponse(resp *AcquireResponse, cachePath string, req *AcquireRequest) (*AcquireResponse, error) {
-	// Read all content from the response
-	content, err := io.ReadAll(resp.Content)
+// cacheFileReader reads the decompressed content of a cache file
+type cacheFileReader struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func openCacheFile(cachePath string) (*cacheFileReader, error) {
+	file, err := os.Open(cachePath)
+	if err != nil {
+		return nil, err
+	}
+	gzipReader, err := gzip.NewReader(file)
 	if err != nil {
+		file.Close()
 		return nil, err
 	}
-	resp.Content.Close()
+	return &cacheFileReader{Reader: gzipReader, file: file}, nil
+}
 
-	// Create cache file
-	file, err := os.Create(cachePath)
+func (r *cacheFileReader) Close() error {
+	r.Reader.Close()
+	return r.file.Close()
+}
+
+// cacheResponse stores the content in the cache as the caller reads it
+func (c *CacheTransport) cacheResponse(resp *AcquireResponse, cachePath string, req *AcquireRequest) (*AcquireResponse, error) {
+	// Write to a temporary file so that readers never see a partial entry
+	file, err := os.CreateTemp(c.cacheDir, filepath.Base(cachePath)+".*.tmp")
 	if err != nil {
 		// If caching fails, still return the response
-		resp.Content = io.NopCloser(strings.NewReader(string(content)))
+		log.Debug().Err(err).Str("cache_path", cachePath).Msg("cache: failed to store file")
 		return resp, nil
 	}
-	defer file.Close()
 
-	// Create gzip writer
+	// The gzip modification time and comment record Last-Modified and the ETag so that the entry
+	// can be revalidated once it expires
 	gzipWriter := gzip.NewWriter(file)
-	defer gzipWriter.Close()
+	if resp.LastModified != nil {
+		gzipWriter.ModTime = *resp.LastModified
+	}
+	gzipWriter.Comment = resp.Headers["ETag"]
+
+	resp.Content = &cachingReader{
+		content:   resp.Content,
+		file:      file,
+		gzip:      gzipWriter,
+		cachePath: cachePath,
+		cache:     c,
+	}
+	return resp, nil
+}
 
-	// Write compressed content to cache
-	if _, err := gzipWriter.Write(content); err != nil {
-		// If caching fails, still return the response
-		resp.Content = io.NopCloser(strings.NewReader(string(content)))
-		return resp, nil
+// cachingReader copies content into a new cache entry as it is read. The entry is only stored
+// once the content has been read to EOF without error, e.g. after hash verification succeeded.
+type cachingReader struct {
+	content   io.ReadCloser
+	file      *os.File
+	gzip      *gzip.Writer
+	cachePath string
+	cache     *CacheTransport
+}
+
+func (r *cachingReader) Read(p []byte) (int, error) {
+	n, err := r.content.Read(p)
+	if r.file != nil && n > 0 {
+		if _, writeErr := r.gzip.Write(p[:n]); writeErr != nil {
+			r.discard(writeErr)
+		}
+	}
+	if r.file != nil {
+		if err == io.EOF {
+			r.store()
+		} else if err != nil {
+			r.discard(err)
+		}
 	}
+	return n, err
+}
 
-	// update response with new content reader
-	resp.Content = io.NopCloser(strings.NewReader(string(content)))
-	resp.Size = int64(len(content))
+// Close abandons the entry if the content wasn't read to the end, rather than fetching the rest of it
+// just for the cache: a caller that stops early, e.g. with --limit, shouldn't download the whole index
+func (r *cachingReader) Close() error {
+	if r.file != nil {
+		r.discard(errors.New("closed before the end of the content"))
+	}
+	return r.content.Close()
+}
 
-	// update hash if not already set
-	if resp.Hashes == nil {
-		resp.Hashes = make(map[string]string)
+// store moves the completed cache file into place
+func (r *cachingReader) store() {
+	tmpPath := r.file.Name()
+	err := r.gzip.Close()
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+	r.file = nil
+	if err == nil {
+		err = os.Rename(tmpPath, r.cachePath)
 	}
-	if _, exists := resp.Hashes["md5"]; !exists {
-		hash := md5.Sum(content)
-		resp.Hashes["md5"] = fmt.Sprintf("%x", hash)
+	if err != nil {
+		os.Remove(tmpPath)
+		log.Debug().Err(err).Str("cache_path", r.cachePath).Msg("cache: failed to store file")
+		return
 	}
 
-	return resp, nil
+	if r.cache.maxBytes > 0 {
+		if err := r.cache.evict(); err != nil {
+			log.Debug().Err(err).Str("cache_dir", r.cache.cacheDir).Msg("cache: eviction failed")
+		}
+	}
+}
+
+// discard abandons the cache file, leaving any previous entry in place
+func (r *cachingReader) discard(err error) {
+	r.file.Close()
+	os.Remove(r.file.Name())
+	r.file = nil
+	log.Debug().Err(err).Str("cache_path", r.cachePath).Msg("cache: not storing file")
+}
+
+// cacheEntry describes a file in the cache directory
+type cacheEntry struct {
+	path     string
+	size     int64
+	accessed time.Time
+}
+
+// entries lists the cache files in the cache directory
+func (c *CacheTransport) entries() ([]cacheEntry, error) {
+	dirEntries, err := os.ReadDir(c.cacheDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var entries []cacheEntry
+	for _, entry := range dirEntries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".gz") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue // removed since the directory was read
+		}
+		entries = append(entries, cacheEntry{
+			path:     filepath.Join(c.cacheDir, entry.Name()),
+			size:     info.Size(),
+			accessed: accessTime(info),
+		})
+	}
+	return entries, nil
+}
+
+// Size returns the total size in bytes of the files in the cache directory
+func (c *CacheTransport) Size() (int64, error) {
+	entries, err := c.entries()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, entry := range entries {
+		total += entry.size
+	}
+	return total, nil
 }
 
-func getDefaultCacheDir() string {
+// evict removes the least recently accessed cache files until the cache fits within maxBytes
+func (c *CacheTransport) evict() error {
+	c.evictMu.Lock()
+	defer c.evictMu.Unlock()
+
+	entries, err := c.entries()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, entry := range entries {
+		total += entry.size
+	}
+	if total <= c.maxBytes {
+		return nil
+	}
+
+	slices.SortFunc(entries, func(a, b cacheEntry) int {
+		return a.accessed.Compare(b.accessed)
+	})
+	var evicted int
+	for _, entry := range entries {
+		if total <= c.maxBytes {
+			break
+		}
+		if err := os.Remove(entry.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= entry.size
+		evicted++
+	}
+
+	log.Debug().Str("cache_dir", c.cacheDir).Int("files_evicted", evicted).Int64("size", total).Msg("cache: evicted")
+	return nil
+}
+
+// DefaultCacheDir returns the cache directory used when CacheConfig.CacheDir is empty
+func DefaultCacheDir() string {
 	// Try XDG_CACHE_HOME first
 	if xdgCache := os.Getenv("XDG_CACHE_HOME"); xdgCache != "" {
 		return filepath.Join(xdgCache, "apt-look")
@@ -291,46 +598,52 @@ func isReleaseFile(uri *url.URL) bool {
 		strings.HasSuffix(path, "/inrelease")
 }
 
-func isPackagesFile(uri *url.URL) bool {
-	path := strings.ToLower(uri.Path)
-	return strings.Contains(path, "/packages") ||
-		strings.HasSuffix(path, "/packages.gz") ||
-		strings.HasSuffix(path, "/packages.bz2") ||
-		strings.HasSuffix(path, "/packages.xz")
+// keepsReleaseCopy reports whether the last copy of a Release file is kept for Lookup. That is the Release
+// file itself, or InRelease for repositories that only publish that; detached signatures aren't kept.
+func keepsReleaseCopy(uri *url.URL) bool {
+	name := path.Base(uri.Path)
+	return name == "Release" || name == "InRelease"
 }
 
-func isCacheableFile(uri *url.URL) bool {
-	path := strings.ToLower(uri.Path)
-
-	// Cache Packages files
-	if isPackagesFile(uri) {
-		return true
+// indexCompressions are the extensions of the compressed variants of an index
+var indexCompressions = []string{".gz", ".bz2", ".xz", ".lzma", ".zst"}
+
+// indexName returns the lowercased name of the file a URI points to, without its compression extension,
+// e.g. "packages" for main/binary-amd64/Packages.xz. Only the file name counts, so an archive published
+// below a directory such as /packages/ doesn't make its pool files look like indexes.
+func indexName(uri *url.URL) string {
+	name := strings.ToLower(path.Base(uri.Path))
+	for _, ext := range indexCompressions {
+		if trimmed, ok := strings.CutSuffix(name, ext); ok {
+			return trimmed
+		}
 	}
+	return name
+}
 
-	// Cache Contents files
-	if strings.Contains(path, "/contents") ||
-		strings.Contains(path, "contents-") ||
-		strings.HasSuffix(path, "/contents.gz") ||
-		strings.HasSuffix(path, "/contents.bz2") ||
-		strings.HasSuffix(path, "/contents.xz") {
-		return true
-	}
+func isPackagesFile(uri *url.URL) bool {
+	return indexName(uri) == "packages"
+}
 
-	// Cache Sources files
-	if strings.Contains(path, "/sources") ||
-		strings.HasSuffix(path, "/sources.gz") ||
-		strings.HasSuffix(path, "/sources.bz2") ||
-		strings.HasSuffix(path, "/sources.xz") {
+// isByHashFile reports whether a URI is an immutable Acquire-By-Hash location
+func isByHashFile(uri *url.URL) bool {
+	return strings.Contains(uri.Path, "/by-hash/")
+}
+
+func isCacheableFile(uri *url.URL) bool {
+	// Cache any index fetched by hash
+	if isByHashFile(uri) {
 		return true
 	}
 
-	// Cache Translation files
-	if strings.Contains(path, "/translation") ||
-		strings.Contains(path, "translation-") {
+	// Cache Packages files
+	if isPackagesFile(uri) {
 		return true
 	}
 
-	return false
+	// Cache Sources, Contents-<arch> and Translation-<lang> files
+	name := indexName(uri)
+	return name == "sources" || strings.HasPrefix(name, "contents-") || strings.HasPrefix(name, "translation-")
 }
 
 // GetStats returns the cache statistics
@@ -4,8 +4,12 @@ import (
 	"compress/gzip"
 	"context"
 	"crypto/md5"
+	"crypto/sha256"
 	"fmt"
 	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -62,6 +66,10 @@ func (m *mockTransport) Acquire(ctx context.Context, req *AcquireRequest) (*Acqu
 	}
 }
 
+func (m *mockTransport) Close() error {
+	return nil
+}
+
 func (m *mockTransport) setResponse(uri string, content string) {
 	m.responses[uri] = content
 }
@@ -120,10 +128,21 @@ func TestCacheTransport_ReleaseFileBypass(t *testing.T) {
 	// Verify both requests hit the wrapped transport
 	assert.Equal(t, 2, mock.getCallCount(releaseURI))
 
-	// Verify no cache files were created
+	// Verify the only cache file is the copy kept for Lookup
 	entries, err := os.ReadDir(cacheDir)
 	require.NoError(t, err)
-	assert.Len(t, entries, 0)
+	assert.Len(t, entries, 1)
+
+	// Signatures aren't kept
+	gpgURI, err := url.Parse(releaseURI + ".gpg")
+	require.NoError(t, err)
+	mock.setResponse(gpgURI.String(), "signature")
+	resp3, err := cache.Acquire(ctx, &AcquireRequest{URI: gpgURI})
+	require.NoError(t, err)
+	consume(t, resp3)
+	entries, err = os.ReadDir(cacheDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
 }
 
 func TestCacheTransport_PackagesFileCaching(t *testing.T) {
@@ -169,6 +188,8 @@ func TestCacheTransport_PackagesFileCaching(t *testing.T) {
 	content2, err := io.ReadAll(resp2.Content)
 	require.NoError(t, err)
 	assert.Equal(t, packagesContent, string(content2))
+	assert.False(t, resp1.Cached)
+	assert.True(t, resp2.Cached)
 
 	// Verify wrapped transport was only called once
 	assert.Equal(t, 1, mock.getCallCount(packagesURI))
@@ -202,7 +223,7 @@ func TestRegistry_CacheStats(t *testing.T) {
 	// First request - should be a miss
 	resp1, err := registry.Acquire(ctx, req)
 	require.NoError(t, err)
-	resp1.Content.Close()
+	consume(t, resp1)
 
 	hits, misses, hitRatio = registry.GetCacheStats()
 	assert.Equal(t, int64(0), hits)
@@ -212,7 +233,7 @@ func TestRegistry_CacheStats(t *testing.T) {
 	// Second request - should be a hit
 	resp2, err := registry.Acquire(ctx, req)
 	require.NoError(t, err)
-	resp2.Content.Close()
+	consume(t, resp2)
 
 	hits, misses, hitRatio = registry.GetCacheStats()
 	assert.Equal(t, int64(1), hits)
@@ -222,7 +243,7 @@ func TestRegistry_CacheStats(t *testing.T) {
 	// Third request - another hit
 	resp3, err := registry.Acquire(ctx, req)
 	require.NoError(t, err)
-	resp3.Content.Close()
+	consume(t, resp3)
 
 	hits, misses, hitRatio = registry.GetCacheStats()
 	assert.Equal(t, int64(2), hits)
@@ -230,6 +251,99 @@ func TestRegistry_CacheStats(t *testing.T) {
 	assert.InDelta(t, 0.6667, hitRatio, 0.001) // 2/3 ≈ 0.6667
 }
 
+func TestRegistry_CacheInfo(t *testing.T) {
+	cacheDir := t.TempDir()
+	config := CacheConfig{CacheDir: cacheDir}
+	packagesURI, err := url.Parse("mock://example.com/dists/jammy/main/binary-amd64/Packages")
+	require.NoError(t, err)
+	packagesContent := "Package: test-package\nVersion: 1.0.0\n"
+
+	// acquire fetches the index through a new registry, as a separate run would
+	acquire := func(times int) {
+		mock := newMockTransport()
+		mock.setResponse(packagesURI.String(), packagesContent)
+		registry := NewRegistryWithCache(config)
+		registry.Register(mock)
+		for range times {
+			resp, err := registry.Acquire(context.Background(), &AcquireRequest{URI: packagesURI})
+			require.NoError(t, err)
+			consume(t, resp)
+		}
+		require.NoError(t, registry.Close())
+		// closing again records nothing more
+		require.NoError(t, registry.Close())
+	}
+
+	info, err := NewRegistryWithCache(config).CacheInfo()
+	require.NoError(t, err)
+	assert.Equal(t, &CacheInfo{Dir: cacheDir}, info)
+	assert.Equal(t, 0.0, info.HitRatio())
+
+	// the counts of every run add up
+	acquire(2)
+	acquire(2)
+	info, err = NewRegistryWithCache(config).CacheInfo()
+	require.NoError(t, err)
+	assert.Equal(t, 1, info.Entries)
+	assert.Positive(t, info.Bytes)
+	assert.Equal(t, int64(3), info.Hits)
+	assert.Equal(t, int64(1), info.Misses)
+	assert.Equal(t, 0.75, info.HitRatio())
+
+	// the cache can be inspected when it isn't used
+	info, err = NewRegistryWithCache(CacheConfig{CacheDir: cacheDir, Disabled: true}).CacheInfo()
+	require.NoError(t, err)
+	assert.Equal(t, 1, info.Entries)
+
+	require.NoError(t, NewRegistryWithCache(config).PurgeCache())
+	info, err = NewRegistryWithCache(config).CacheInfo()
+	require.NoError(t, err)
+	assert.Equal(t, &CacheInfo{Dir: cacheDir}, info)
+}
+
+func TestCacheTransport_Lookup(t *testing.T) {
+	mock := newMockTransport()
+	// a TTL short enough that the entry has expired by the time it's looked up
+	cache, err := NewCacheTransport(mock, CacheConfig{CacheDir: t.TempDir(), TTL: time.Nanosecond})
+	require.NoError(t, err)
+
+	packagesURI, err := url.Parse("mock://example.com/dists/jammy/main/binary-amd64/Packages")
+	require.NoError(t, err)
+	releaseURI, err := url.Parse("mock://example.com/dists/jammy/Release")
+	require.NoError(t, err)
+	mock.setResponse(packagesURI.String(), "Package: test-package\n")
+	mock.setResponse(releaseURI.String(), "Suite: jammy\n")
+
+	_, err = cache.Lookup(&AcquireRequest{URI: packagesURI})
+	assert.ErrorIs(t, err, ErrNotCached)
+
+	for _, uri := range []*url.URL{packagesURI, releaseURI} {
+		resp, err := cache.Acquire(context.Background(), &AcquireRequest{URI: uri})
+		require.NoError(t, err)
+		_, err = io.ReadAll(resp.Content)
+		require.NoError(t, err)
+		resp.Content.Close()
+	}
+
+	resp, err := cache.Lookup(&AcquireRequest{URI: packagesURI})
+	require.NoError(t, err)
+	content, err := io.ReadAll(resp.Content)
+	resp.Content.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "Package: test-package\n", string(content))
+	assert.True(t, resp.Cached)
+	assert.Equal(t, 1, mock.getCallCount(packagesURI.String()))
+
+	_, err = cache.Lookup(&AcquireRequest{URI: packagesURI, ExpectedHashes: map[string]string{"sha256": "0000"}})
+	assert.ErrorIs(t, err, ErrNotCached)
+
+	// the last copy of a Release file is served too, however old
+	resp, err = cache.Lookup(&AcquireRequest{URI: releaseURI})
+	require.NoError(t, err)
+	consume(t, resp)
+	assert.Equal(t, 1, mock.getCallCount(releaseURI.String()))
+}
+
 func TestCacheTransport_CacheKeyGeneration(t *testing.T) {
 	mock := newMockTransport()
 	config := CacheConfig{Disabled: false, CacheDir: t.TempDir()}
@@ -273,10 +387,10 @@ func TestCacheTransport_CacheFileCompression(t *testing.T) {
 	req := &AcquireRequest{URI: parsedURI}
 	ctx := context.Background()
 
-	// Make request to create cache file
+	// Make request to create cache file, which is stored once the content has been read
 	resp, err := cache.Acquire(ctx, req)
 	require.NoError(t, err)
-	defer resp.Content.Close()
+	consume(t, resp)
 
 	// Find the cache file
 	entries, err := os.ReadDir(cacheDir)
@@ -321,11 +435,11 @@ func TestCacheTransport_DisabledCache(t *testing.T) {
 	// Make two requests
 	resp1, err := cache.Acquire(ctx, req)
 	require.NoError(t, err)
-	resp1.Content.Close()
+	consume(t, resp1)
 
 	resp2, err := cache.Acquire(ctx, req)
 	require.NoError(t, err)
-	resp2.Content.Close()
+	consume(t, resp2)
 
 	// Both should hit wrapped transport (no caching)
 	assert.Equal(t, 2, mock.getCallCount(packagesURI))
@@ -346,7 +460,7 @@ func TestCacheTransport_PurgeCache(t *testing.T) {
 
 	// Create some cache files by making requests
 	for i := 0; i < 3; i++ {
-		uri := fmt.Sprintf("mock://example.com/packages%d", i)
+		uri := fmt.Sprintf("mock://example.com/dists/jammy/main/binary-arch%d/Packages", i)
 		content := fmt.Sprintf("Package: test-package-%d\nVersion: 1.0.0\n", i)
 		mock.setResponse(uri, content)
 
@@ -354,7 +468,7 @@ func TestCacheTransport_PurgeCache(t *testing.T) {
 		req := &AcquireRequest{URI: parsedURI}
 		resp, err := cache.Acquire(context.Background(), req)
 		require.NoError(t, err)
-		resp.Content.Close()
+		consume(t, resp)
 	}
 
 	// Verify cache files were created
@@ -372,6 +486,39 @@ func TestCacheTransport_PurgeCache(t *testing.T) {
 	assert.Len(t, entries, 0)
 }
 
+func TestCacheTransport_PurgeEntries(t *testing.T) {
+	mock := newMockTransport()
+	cache, err := NewCacheTransport(mock, CacheConfig{CacheDir: t.TempDir()})
+	require.NoError(t, err)
+
+	var uris []*url.URL
+	for i := 0; i < 3; i++ {
+		uri := fmt.Sprintf("mock://example.com/dists/jammy/main/binary-arch%d/Packages", i)
+		mock.setResponse(uri, fmt.Sprintf("Package: test-package-%d\nVersion: 1.0.0\n", i))
+		parsedURI, _ := url.Parse(uri)
+		uris = append(uris, parsedURI)
+		resp, err := cache.Acquire(context.Background(), &AcquireRequest{URI: parsedURI})
+		require.NoError(t, err)
+		consume(t, resp)
+	}
+
+	// URIs that were never cached are not counted
+	notCached, _ := url.Parse("mock://example.com/dists/jammy/main/binary-arch9/Packages")
+	purged, err := cache.PurgeEntries([]*url.URL{uris[0], uris[2], notCached})
+	require.NoError(t, err)
+	assert.Equal(t, 2, purged)
+
+	_, err = cache.Lookup(&AcquireRequest{URI: uris[0]})
+	assert.ErrorIs(t, err, ErrNotCached)
+	resp, err := cache.Lookup(&AcquireRequest{URI: uris[1]})
+	require.NoError(t, err)
+	consume(t, resp)
+
+	purged, err = cache.PurgeEntries(uris)
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+}
+
 func TestCacheTransport_PurgeCacheDisabled(t *testing.T) {
 	mock := newMockTransport()
 	config := CacheConfig{Disabled: true, CacheDir: t.TempDir()}
@@ -392,16 +539,24 @@ func TestCacheTransport_DefaultCacheDir(t *testing.T) {
 	testDir := t.TempDir()
 	os.Setenv("XDG_CACHE_HOME", testDir)
 
-	cacheDir := getDefaultCacheDir()
+	cacheDir := DefaultCacheDir()
 	assert.Equal(t, filepath.Join(testDir, "apt-look"), cacheDir)
 
 	// Test fallback to ~/.cache
 	os.Unsetenv("XDG_CACHE_HOME")
-	cacheDir = getDefaultCacheDir()
+	cacheDir = DefaultCacheDir()
 	homeDir, _ := os.UserHomeDir()
 	assert.Equal(t, filepath.Join(homeDir, ".cache", "apt-look"), cacheDir)
 }
 
+// consume reads a response's content to the end, which is when its cache entry is stored, and closes it
+func consume(t *testing.T, resp *AcquireResponse) {
+	t.Helper()
+	_, err := io.ReadAll(resp.Content)
+	require.NoError(t, err)
+	require.NoError(t, resp.Content.Close())
+}
+
 func TestCacheTransport_FileDetection(t *testing.T) {
 	tests := []struct {
 		uri         string
@@ -416,18 +571,27 @@ func TestCacheTransport_FileDetection(t *testing.T) {
 		{"http://example.com/dists/jammy/main/binary-amd64/Packages.gz", false, true, true},
 		{"http://example.com/dists/jammy/main/binary-amd64/Packages.bz2", false, true, true},
 		{"http://example.com/dists/jammy/main/binary-amd64/Packages.xz", false, true, true},
+		{"http://example.com/dists/jammy/main/binary-amd64/Packages.zst", false, true, true},
 		{"http://example.com/dists/jammy/Contents-amd64", false, false, true},
 		{"http://example.com/dists/jammy/Contents-amd64.gz", false, false, true},
 		{"http://example.com/dists/jammy/Contents-amd64.bz2", false, false, true},
 		{"http://example.com/dists/jammy/Contents-amd64.xz", false, false, true},
+		{"http://example.com/dists/jammy/main/Contents-amd64.zst", false, false, true},
 		{"http://example.com/dists/jammy/main/source/Sources", false, false, true},
 		{"http://example.com/dists/jammy/main/source/Sources.gz", false, false, true},
 		{"http://example.com/dists/jammy/main/source/Sources.bz2", false, false, true},
 		{"http://example.com/dists/jammy/main/source/Sources.xz", false, false, true},
 		{"http://example.com/dists/jammy/main/i18n/Translation-en", false, false, true},
 		{"http://example.com/dists/jammy/main/i18n/Translation-en.gz", false, false, true},
+		{"http://example.com/dists/jammy/main/binary-amd64/by-hash/SHA256/9a43dc1f54cad06ffd8d2777b92806377a4cb36f5baf5cf86214b42e8d9dc460", false, false, true},
 		{"http://example.com/some/other/file", false, false, false},
 		{"http://example.com/pool/main/a/apache2/apache2_2.4.41-4ubuntu3_amd64.deb", false, false, false},
+		// archives published below directories named like indexes
+		{"http://example.com/packages/pool/main/a/apache2/apache2_2.4.41-4ubuntu3_amd64.deb", false, false, false},
+		{"http://example.com/sources/debian/pool/main/a/apache2/apache2_2.4.41-4ubuntu3.dsc", false, false, false},
+		{"http://example.com/translation-mirror/pool/main/a/apache2/apache2_2.4.41.orig.tar.gz", false, false, false},
+		{"http://example.com/contents/pool/main/a/apache2/apache2_2.4.41-4ubuntu3_amd64.deb", false, false, false},
+		{"http://example.com/packages/dists/jammy/main/binary-amd64/Packages.lzma", false, true, true},
 	}
 
 	for _, test := range tests {
@@ -460,7 +624,7 @@ func TestRegistry_WithCaching(t *testing.T) {
 	// First request
 	resp1, err := registry.Acquire(ctx, req)
 	require.NoError(t, err)
-	defer resp1.Content.Close()
+	consume(t, resp1)
 
 	// Second request - should hit cache
 	resp2, err := registry.Acquire(ctx, req)
@@ -497,11 +661,11 @@ func TestRegistry_CacheDisabled(t *testing.T) {
 	// Make two requests
 	resp1, err := registry.Acquire(ctx, req)
 	require.NoError(t, err)
-	resp1.Content.Close()
+	consume(t, resp1)
 
 	resp2, err := registry.Acquire(ctx, req)
 	require.NoError(t, err)
-	resp2.Content.Close()
+	consume(t, resp2)
 
 	// Both should hit wrapped transport (no caching)
 	assert.Equal(t, 2, mock.getCallCount(packagesURI))
@@ -526,7 +690,7 @@ func TestRegistry_PurgeCache(t *testing.T) {
 	req := &AcquireRequest{URI: parsedURI}
 	resp, err := registry.Acquire(context.Background(), req)
 	require.NoError(t, err)
-	resp.Content.Close()
+	consume(t, resp)
 
 	// Verify cache file exists
 	entries, err := os.ReadDir(cacheDir)
@@ -580,3 +744,434 @@ func TestCacheTransport_CacheReadError(t *testing.T) {
 	// Verify wrapped transport was called
 	assert.Equal(t, 1, mock.getCallCount(packagesURI))
 }
+
+func TestCacheTransport_StaleHashIsMiss(t *testing.T) {
+	mock := newMockTransport()
+	cache, err := NewCacheTransport(mock, CacheConfig{CacheDir: t.TempDir()})
+	require.NoError(t, err)
+
+	packagesURI := "mock://example.com/dists/jammy/main/binary-amd64/Packages"
+	parsedURI, err := url.Parse(packagesURI)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	mock.setResponse(packagesURI, "Package: old\n")
+	resp, err := cache.Acquire(ctx, &AcquireRequest{URI: parsedURI})
+	require.NoError(t, err)
+	consume(t, resp)
+
+	// The index was republished, so the cached copy no longer matches the Release hash
+	newContent := "Package: new\n"
+	mock.setResponse(packagesURI, newContent)
+	resp, err = cache.Acquire(ctx, &AcquireRequest{
+		URI:            parsedURI,
+		ExpectedHashes: map[string]string{"sha256": fmt.Sprintf("%x", sha256.Sum256([]byte(newContent)))},
+	})
+	require.NoError(t, err)
+	defer resp.Content.Close()
+
+	content, err := io.ReadAll(resp.Content)
+	require.NoError(t, err)
+	assert.Equal(t, newContent, string(content))
+	assert.Equal(t, 2, mock.getCallCount(packagesURI))
+}
+
+func TestCacheTransport_ExpiredEntryIsMiss(t *testing.T) {
+	mock := newMockTransport()
+	cacheDir := t.TempDir()
+	cache, err := NewCacheTransport(mock, CacheConfig{CacheDir: cacheDir, TTL: time.Hour})
+	require.NoError(t, err)
+
+	packagesURI := "mock://example.com/dists/jammy/main/binary-amd64/Packages"
+	mock.setResponse(packagesURI, "Package: test-package\n")
+	parsedURI, err := url.Parse(packagesURI)
+	require.NoError(t, err)
+	req := &AcquireRequest{URI: parsedURI}
+	ctx := context.Background()
+
+	resp, err := cache.Acquire(ctx, req)
+	require.NoError(t, err)
+	consume(t, resp)
+
+	// A fresh entry is served from the cache
+	resp, err = cache.Acquire(ctx, req)
+	require.NoError(t, err)
+	consume(t, resp)
+	assert.Equal(t, 1, mock.getCallCount(packagesURI))
+
+	// Backdate the entry past the TTL
+	cachePath := filepath.Join(cacheDir, cache.getCacheKey(parsedURI)+".gz")
+	old := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(cachePath, old, old))
+
+	resp, err = cache.Acquire(ctx, req)
+	require.NoError(t, err)
+	consume(t, resp)
+	assert.Equal(t, 2, mock.getCallCount(packagesURI))
+
+	// The refetched entry replaces the expired one
+	info, err := os.Stat(cachePath)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), info.ModTime(), time.Minute)
+}
+
+func TestCacheTransport_ZeroTTLNeverExpires(t *testing.T) {
+	mock := newMockTransport()
+	cacheDir := t.TempDir()
+	cache, err := NewCacheTransport(mock, CacheConfig{CacheDir: cacheDir})
+	require.NoError(t, err)
+
+	packagesURI := "mock://example.com/dists/jammy/main/binary-amd64/Packages"
+	mock.setResponse(packagesURI, "Package: test-package\n")
+	parsedURI, err := url.Parse(packagesURI)
+	require.NoError(t, err)
+	req := &AcquireRequest{URI: parsedURI}
+	ctx := context.Background()
+
+	resp, err := cache.Acquire(ctx, req)
+	require.NoError(t, err)
+	consume(t, resp)
+
+	cachePath := filepath.Join(cacheDir, cache.getCacheKey(parsedURI)+".gz")
+	old := time.Now().Add(-365 * 24 * time.Hour)
+	require.NoError(t, os.Chtimes(cachePath, old, old))
+
+	resp, err = cache.Acquire(ctx, req)
+	require.NoError(t, err)
+	consume(t, resp)
+	assert.Equal(t, 1, mock.getCallCount(packagesURI))
+}
+
+func TestCacheTransport_EvictsLeastRecentlyUsed(t *testing.T) {
+	mock := newMockTransport()
+	cacheDir := t.TempDir()
+	ctx := context.Background()
+
+	// Random content doesn't compress, so each entry is a little over 1000 bytes on disk
+	randomContent := func(seed int64) string {
+		buf := make([]byte, 1000)
+		rand.New(rand.NewSource(seed)).Read(buf)
+		return string(buf)
+	}
+	uris := make([]*url.URL, 4)
+	for i := range uris {
+		uri := fmt.Sprintf("mock://example.com/dists/jammy/main/binary-arch%d/Packages", i)
+		mock.setResponse(uri, randomContent(int64(i)))
+		parsed, err := url.Parse(uri)
+		require.NoError(t, err)
+		uris[i] = parsed
+	}
+
+	cache, err := NewCacheTransport(mock, CacheConfig{CacheDir: cacheDir, MaxBytes: 3500})
+	require.NoError(t, err)
+	cachePath := func(uri *url.URL) string {
+		return filepath.Join(cacheDir, cache.getCacheKey(uri)+".gz")
+	}
+
+	for _, uri := range uris[:3] {
+		resp, err := cache.Acquire(ctx, &AcquireRequest{URI: uri})
+		require.NoError(t, err)
+		consume(t, resp)
+	}
+	size, err := cache.Size()
+	require.NoError(t, err)
+	assert.Greater(t, size, int64(3000))
+	assert.LessOrEqual(t, size, int64(3500))
+
+	// Entry 1 is the least recently used, even though entry 0 was written first
+	now := time.Now()
+	mtime := now.Add(-time.Minute)
+	require.NoError(t, os.Chtimes(cachePath(uris[0]), now.Add(-3*time.Hour), mtime))
+	require.NoError(t, os.Chtimes(cachePath(uris[1]), now.Add(-4*time.Hour), mtime))
+	require.NoError(t, os.Chtimes(cachePath(uris[2]), now.Add(-2*time.Hour), mtime))
+
+	// A cache hit refreshes the access time of entry 0
+	resp, err := cache.Acquire(ctx, &AcquireRequest{URI: uris[0]})
+	require.NoError(t, err)
+	consume(t, resp)
+	info, err := os.Stat(cachePath(uris[0]))
+	require.NoError(t, err)
+	assert.WithinDuration(t, now, accessTime(info), time.Minute)
+	assert.WithinDuration(t, mtime, info.ModTime(), time.Second, "mtime must be preserved for the TTL")
+
+	// Writing a fourth entry exceeds the limit and evicts only entry 1
+	resp, err = cache.Acquire(ctx, &AcquireRequest{URI: uris[3]})
+	require.NoError(t, err)
+	consume(t, resp)
+
+	assert.FileExists(t, cachePath(uris[0]))
+	assert.NoFileExists(t, cachePath(uris[1]))
+	assert.FileExists(t, cachePath(uris[2]))
+	assert.FileExists(t, cachePath(uris[3]))
+
+	size, err = cache.Size()
+	require.NoError(t, err)
+	assert.LessOrEqual(t, size, int64(3500))
+}
+
+func TestCacheTransport_SizeMissingDir(t *testing.T) {
+	cache := &CacheTransport{cacheDir: filepath.Join(t.TempDir(), "missing")}
+	size, err := cache.Size()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), size)
+}
+
+func TestCacheTransport_ByHashNeverExpires(t *testing.T) {
+	mock := newMockTransport()
+	cacheDir := t.TempDir()
+	cache, err := NewCacheTransport(mock, CacheConfig{CacheDir: cacheDir, TTL: time.Hour})
+	require.NoError(t, err)
+
+	byHashURI := "mock://example.com/dists/jammy/main/binary-amd64/by-hash/SHA256/0123abcd"
+	mock.setResponse(byHashURI, "Package: test-package\n")
+	parsedURI, err := url.Parse(byHashURI)
+	require.NoError(t, err)
+	req := &AcquireRequest{URI: parsedURI}
+	ctx := context.Background()
+
+	resp, err := cache.Acquire(ctx, req)
+	require.NoError(t, err)
+	consume(t, resp)
+
+	cachePath := filepath.Join(cacheDir, cache.getCacheKey(parsedURI)+".gz")
+	old := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, os.Chtimes(cachePath, old, old))
+
+	resp, err = cache.Acquire(ctx, req)
+	require.NoError(t, err)
+	consume(t, resp)
+	assert.Equal(t, 1, mock.getCallCount(byHashURI))
+}
+
+func TestCacheTransport_ExpiredEntryIsRevalidated(t *testing.T) {
+	lastModified := time.Date(2025, 6, 9, 12, 0, 0, 0, time.UTC)
+	content := "Package: test-package\n"
+	var requests, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !lastModified.After(since) {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		fmt.Fprint(w, content)
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	cache, err := NewCacheTransport(NewHTTPTransport(), CacheConfig{CacheDir: cacheDir, TTL: time.Hour})
+	require.NoError(t, err)
+
+	parsedURI, err := url.Parse(server.URL + "/dists/jammy/main/binary-amd64/Packages")
+	require.NoError(t, err)
+	req := &AcquireRequest{URI: parsedURI}
+	ctx := context.Background()
+	cachePath := filepath.Join(cacheDir, cache.getCacheKey(parsedURI)+".gz")
+	old := time.Now().Add(-2 * time.Hour)
+
+	resp, err := cache.Acquire(ctx, req)
+	require.NoError(t, err)
+	consume(t, resp)
+
+	// An unchanged index is served from the cache and its TTL restarts
+	require.NoError(t, os.Chtimes(cachePath, old, old))
+	resp, err = cache.Acquire(ctx, req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Content)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(body))
+	require.NotNil(t, resp.LastModified)
+	assert.True(t, lastModified.Equal(*resp.LastModified))
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, 1, notModified)
+	info, err := os.Stat(cachePath)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), info.ModTime(), time.Minute)
+
+	// A republished index replaces the cache entry
+	lastModified = lastModified.Add(time.Hour)
+	content = "Package: new-package\n"
+	require.NoError(t, os.Chtimes(cachePath, old, old))
+	resp, err = cache.Acquire(ctx, req)
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Content)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(body))
+	assert.Equal(t, 3, requests)
+	assert.Equal(t, 1, notModified)
+
+	resp, err = cache.Acquire(ctx, req)
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Content)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(body))
+	assert.Equal(t, 3, requests)
+}
+
+func TestCacheTransport_ExpiredEntryIsRevalidatedByETag(t *testing.T) {
+	etag := `"5f2b-61d8"`
+	content := "Package: test-package\n"
+	var requests, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// a CDN that keys on the ETag alone and sends no Last-Modified
+		assert.Empty(t, r.Header.Get("If-Modified-Since"))
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		fmt.Fprint(w, content)
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	cache, err := NewCacheTransport(NewHTTPTransport(), CacheConfig{CacheDir: cacheDir, TTL: time.Hour})
+	require.NoError(t, err)
+
+	parsedURI, err := url.Parse(server.URL + "/dists/jammy/main/binary-amd64/Packages")
+	require.NoError(t, err)
+	req := &AcquireRequest{URI: parsedURI}
+	ctx := context.Background()
+	cachePath := filepath.Join(cacheDir, cache.getCacheKey(parsedURI)+".gz")
+	old := time.Now().Add(-2 * time.Hour)
+
+	resp, err := cache.Acquire(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, etag, resp.Headers["ETag"])
+	consume(t, resp)
+
+	// An unchanged index is served from the cache and its TTL restarts
+	require.NoError(t, os.Chtimes(cachePath, old, old))
+	resp, err = cache.Acquire(ctx, req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Content)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(body))
+	assert.True(t, resp.Cached)
+	assert.Equal(t, etag, resp.Headers["ETag"])
+	assert.Nil(t, resp.LastModified)
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, 1, notModified)
+	info, err := os.Stat(cachePath)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), info.ModTime(), time.Minute)
+
+	// A republished index has a new ETag and replaces the cache entry
+	etag = `"61aa-61d9"`
+	content = "Package: new-package\n"
+	require.NoError(t, os.Chtimes(cachePath, old, old))
+	resp, err = cache.Acquire(ctx, req)
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Content)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(body))
+	assert.Equal(t, 3, requests)
+	assert.Equal(t, 1, notModified)
+}
+
+func TestCacheTransport_HashMismatchIsNotStored(t *testing.T) {
+	repoDir := t.TempDir()
+	packagesPath := filepath.Join(repoDir, "Packages")
+	require.NoError(t, os.WriteFile(packagesPath, []byte("Package: test-package\n"), 0644))
+
+	cacheDir := t.TempDir()
+	cache, err := NewCacheTransport(NewFileTransport(), CacheConfig{CacheDir: cacheDir})
+	require.NoError(t, err)
+
+	parsedURI, err := url.Parse("file://" + packagesPath)
+	require.NoError(t, err)
+	resp, err := cache.Acquire(context.Background(), &AcquireRequest{
+		URI:            parsedURI,
+		ExpectedHashes: map[string]string{"sha256": "0000"},
+	})
+	require.NoError(t, err)
+
+	// The content is cached as it streams, but only kept once its hash has been verified
+	_, err = io.ReadAll(resp.Content)
+	assert.ErrorIs(t, err, ErrHashMismatch)
+	require.NoError(t, resp.Content.Close())
+
+	entries, err := os.ReadDir(cacheDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestCacheTransport_EarlyCloseIsNotStored(t *testing.T) {
+	repoDir := t.TempDir()
+	packagesPath := filepath.Join(repoDir, "Packages")
+	require.NoError(t, os.WriteFile(packagesPath, []byte(strings.Repeat("Package: test-package\n\n", 100)), 0644))
+
+	cacheDir := t.TempDir()
+	cache, err := NewCacheTransport(NewFileTransport(), CacheConfig{CacheDir: cacheDir})
+	require.NoError(t, err)
+
+	parsedURI, err := url.Parse("file://" + packagesPath)
+	require.NoError(t, err)
+	resp, err := cache.Acquire(context.Background(), &AcquireRequest{URI: parsedURI})
+	require.NoError(t, err)
+
+	// Closing part-way through abandons the entry instead of reading the rest
+	_, err = io.ReadFull(resp.Content, make([]byte, 10))
+	require.NoError(t, err)
+	require.NoError(t, resp.Content.Close())
+
+	entries, err := os.ReadDir(cacheDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	_, err = cache.Lookup(&AcquireRequest{URI: parsedURI})
+	assert.ErrorIs(t, err, ErrNotCached)
+}
+
+func TestCacheTransport_CachesAllIndexTypes(t *testing.T) {
+	mock := newMockTransport()
+	cache, err := NewCacheTransport(mock, CacheConfig{CacheDir: t.TempDir()})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	uris := []string{
+		"mock://example.com/dists/jammy/main/binary-amd64/Packages.gz",
+		"mock://example.com/dists/jammy/main/Contents-amd64.gz",
+		"mock://example.com/dists/jammy/main/source/Sources.xz",
+		"mock://example.com/dists/jammy/main/i18n/Translation-en.bz2",
+	}
+	for _, uri := range uris {
+		mock.setResponse(uri, "content of "+uri)
+		parsedURI, err := url.Parse(uri)
+		require.NoError(t, err)
+
+		for range 2 {
+			resp, err := cache.Acquire(ctx, &AcquireRequest{URI: parsedURI})
+			require.NoError(t, err)
+			content, err := io.ReadAll(resp.Content)
+			require.NoError(t, err)
+			require.NoError(t, resp.Content.Close())
+			assert.Equal(t, "content of "+uri, string(content))
+		}
+		assert.Equal(t, 1, mock.getCallCount(uri), "%s should be served from the cache", uri)
+	}
+
+	// Packages themselves aren't cached and don't count towards the stats, even in an archive
+	// published below a directory named like an index
+	for _, debURI := range []string{
+		"mock://example.com/pool/main/a/alpha/alpha_1.0_amd64.deb",
+		"mock://example.com/packages/pool/main/a/alpha/alpha_1.0_amd64.deb",
+	} {
+		mock.setResponse(debURI, "deb")
+		parsedURI, err := url.Parse(debURI)
+		require.NoError(t, err)
+		for range 2 {
+			resp, err := cache.Acquire(ctx, &AcquireRequest{URI: parsedURI})
+			require.NoError(t, err)
+			consume(t, resp)
+		}
+		assert.Equal(t, 2, mock.getCallCount(debURI), "%s should not be cached", debURI)
+	}
+
+	hits, misses := cache.GetStats().GetStats()
+	assert.Equal(t, int64(len(uris)), hits)
+	assert.Equal(t, int64(len(uris)), misses)
+}
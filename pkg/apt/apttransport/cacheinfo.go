@@ -0,0 +1,133 @@
+package apttransport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// cacheStatsFile holds the hits and misses of earlier runs, in the cache directory
+const cacheStatsFile = "stats.json"
+
+// CacheInfo describes what a cache directory holds, and how well it has served requests
+type CacheInfo struct {
+	Dir     string `json:"dir"`
+	Entries int    `json:"entries"`
+	Bytes   int64  `json:"bytes"`
+	// Hits and Misses add up the requests of every run that used the cache directory, as recorded when
+	// each registry was closed, plus those of this registry so far
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
+
+// HitRatio returns the share of requests answered from the cache, or zero if none were recorded
+func (i *CacheInfo) HitRatio() float64 {
+	total := i.Hits + i.Misses
+	if total == 0 {
+		return 0.0
+	}
+	return float64(i.Hits) / float64(total)
+}
+
+// cacheCounters are the contents of the stats file
+type cacheCounters struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
+
+// CacheInfo inspects the registry's cache directory, whether or not caching is enabled
+func (r *Registry) CacheInfo() (*CacheInfo, error) {
+	// Create a temporary cache transport just to read the cache directory
+	config := r.cacheConfig
+	config.Disabled = true
+	cacheTransport, err := NewCacheTransport(NewFileTransport(), config)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := cacheTransport.entries()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+
+	info := &CacheInfo{Dir: cacheTransport.cacheDir, Entries: len(entries)}
+	for _, entry := range entries {
+		info.Bytes += entry.size
+	}
+	counters, err := readCacheCounters(cacheTransport.cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	hits, misses, _ := r.GetCacheStats()
+	info.Hits = counters.Hits + hits
+	info.Misses = counters.Misses + misses
+	return info, nil
+}
+
+func readCacheCounters(cacheDir string) (cacheCounters, error) {
+	var counters cacheCounters
+	data, err := os.ReadFile(filepath.Join(cacheDir, cacheStatsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return counters, nil
+	}
+	if err != nil {
+		return counters, fmt.Errorf("failed to read cache stats: %w", err)
+	}
+	if err := json.Unmarshal(data, &counters); err != nil {
+		return counters, fmt.Errorf("failed to parse cache stats: %w", err)
+	}
+	return counters, nil
+}
+
+// saveCacheStats adds the hits and misses of this registry since they were last saved to the stats file,
+// and resets them, so closing the registry again doesn't count them twice. Runs that finish at the same
+// moment can lose each other's counts, which only makes the hit ratio a little less precise.
+// The caller holds r.mu.
+func (r *Registry) saveCacheStats() error {
+	if r.cacheConfig.Disabled {
+		return nil
+	}
+	var hits, misses int64
+	for _, cachedTransport := range r.cachedTransports {
+		h, m := cachedTransport.GetStats().take()
+		hits += h
+		misses += m
+	}
+	if hits+misses == 0 {
+		return nil
+	}
+	cacheDir := r.cacheConfig.CacheDir
+	if cacheDir == "" {
+		cacheDir = DefaultCacheDir()
+	}
+
+	counters, err := readCacheCounters(cacheDir)
+	if err != nil {
+		// a damaged file is replaced rather than blocking the counts from ever being recorded again
+		counters = cacheCounters{}
+	}
+	counters.Hits += hits
+	counters.Misses += misses
+	data, err := json.Marshal(counters)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(cacheDir, cacheStatsFile+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to save cache stats: %w", err)
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), filepath.Join(cacheDir, cacheStatsFile))
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return fmt.Errorf("failed to save cache stats: %w", err)
+	}
+	return nil
+}
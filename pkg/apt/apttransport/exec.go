@@ -0,0 +1,299 @@
+package apttransport
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var _ Transport = &ExecTransport{}
+
+// DefaultAptMethodsDir is where apt installs its method binaries on Debian systems
+const DefaultAptMethodsDir = "/usr/lib/apt/methods"
+
+// internalAptMethods are helpers that apt runs on files it already has, rather than URI schemes
+var internalAptMethods = []string{"copy", "gpgv", "rred", "store"}
+
+// ExecTransport fetches files by running an apt method binary, such as /usr/lib/apt/methods/ftp,
+// and speaking the apt method protocol with it over stdin and stdout.
+// See https://salsa.debian.org/apt-team/apt/-/blob/main/doc/method.dbk
+type ExecTransport struct {
+	path    string
+	schemes []string
+}
+
+// NewExecTransport creates a transport that runs the method binary at path for the given schemes
+func NewExecTransport(path string, schemes ...string) *ExecTransport {
+	return &ExecTransport{path: path, schemes: schemes}
+}
+
+func (t *ExecTransport) Schemes() []string {
+	return t.schemes
+}
+
+// Close does nothing, since a method only runs for the duration of a single request
+func (t *ExecTransport) Close() error {
+	return nil
+}
+
+// Acquire runs the method for a single request. The method always writes to a file, so the result
+// is handed to the file transport, which copies it to req.Filename or streams it, verifying hashes.
+func (t *ExecTransport) Acquire(ctx context.Context, req *AcquireRequest) (*AcquireResponse, error) {
+	// the method writes next to the destination so that the copy stays on one filesystem. Methods
+	// resume into files that already exist, so it gets a name in a directory of its own rather than
+	// a file that was created for it.
+	dir := os.TempDir()
+	if req.Filename != "" {
+		dir = filepath.Dir(req.Filename)
+	}
+	tmpDir, err := os.MkdirTemp(dir, ".apt-look-method-*")
+	if err != nil {
+		return nil, &AcquireError{URI: req.URI, Reason: "failed to create temporary directory", Err: err}
+	}
+	tmpFile := filepath.Join(tmpDir, "partial")
+
+	// the timeout covers the method's fetch, but not reading the local file it leaves behind
+	runCtx, cancel := ctx, context.CancelFunc(func() {})
+	if req.Timeout > 0 {
+		runCtx, cancel = context.WithTimeout(ctx, req.Timeout)
+	}
+	done, err := t.run(runCtx, req, tmpFile)
+	cancel()
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return nil, err
+	}
+	if done.notModified {
+		os.RemoveAll(tmpDir)
+		return &AcquireResponse{URI: req.URI, LastModified: done.lastModified, Size: done.size}, nil
+	}
+
+	local := *req
+	local.URI = &url.URL{Scheme: "file", Path: tmpFile}
+	local.LastModified = nil
+	resp, err := NewFileTransport().Acquire(ctx, &local)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		var acquireErr *AcquireError
+		if errors.As(err, &acquireErr) {
+			acquireErr.URI = req.URI
+		}
+		return nil, err
+	}
+	resp.URI = req.URI
+	resp.LastModified = done.lastModified
+	if req.Filename != "" {
+		os.RemoveAll(tmpDir)
+	} else {
+		resp.Content = &removeOnClose{ReadCloser: resp.Content, path: tmpDir}
+	}
+	return resp, nil
+}
+
+// methodResult holds what a method reported in its 201 URI Done message
+type methodResult struct {
+	size         int64
+	lastModified *time.Time
+	notModified  bool
+}
+
+// run starts the method, asks it to fetch req.URI into filename, and waits for the outcome
+func (t *ExecTransport) run(ctx context.Context, req *AcquireRequest, filename string) (*methodResult, error) {
+	cmd := exec.CommandContext(ctx, t.path)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, &AcquireError{URI: req.URI, Reason: "failed to start apt method", Err: err}
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, &AcquireError{URI: req.URI, Reason: "failed to start apt method", Err: err}
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, &AcquireError{URI: req.URI, Reason: "failed to start apt method", Err: err}
+	}
+	// closing stdin tells the method there are no more requests, so it exits
+	defer func() {
+		stdin.Close()
+		cmd.Wait()
+	}()
+
+	result, err := converse(bufio.NewReader(stdout), stdin, req, filename)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, &AcquireError{URI: req.URI, Reason: "context cancelled", Err: ctx.Err()}
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+// converse exchanges the messages of one acquisition with a method
+func converse(r *bufio.Reader, w io.Writer, req *AcquireRequest, filename string) (*methodResult, error) {
+	code, fields, err := readMethodMessage(r)
+	if err != nil {
+		return nil, &AcquireError{URI: req.URI, Reason: "failed to read apt method capabilities", Err: err}
+	}
+	if code != 100 {
+		return nil, &AcquireError{URI: req.URI, Reason: fmt.Sprintf("unexpected apt method message %d", code)}
+	}
+	if fields["Send-Config"] == "true" {
+		// nothing is configured, so the method uses its defaults
+		if err := writeMethodMessage(w, "601 Configuration", nil); err != nil {
+			return nil, &AcquireError{URI: req.URI, Reason: "failed to configure apt method", Err: err}
+		}
+	}
+
+	acquire := [][2]string{{"URI", req.URI.String()}, {"Filename", filename}}
+	if req.LastModified != nil {
+		acquire = append(acquire, [2]string{"Last-Modified", req.LastModified.UTC().Format(time.RFC1123)})
+	}
+	if err := writeMethodMessage(w, "600 URI Acquire", acquire); err != nil {
+		return nil, &AcquireError{URI: req.URI, Reason: "failed to send request to apt method", Err: err}
+	}
+
+	for {
+		code, fields, err := readMethodMessage(r)
+		if err != nil {
+			return nil, &AcquireError{URI: req.URI, Reason: "apt method exited without a result", Err: err}
+		}
+		switch code {
+		case 101, 102:
+			log.Debug().Str("uri", req.URI.String()).Msgf("apt method: %s", fields["Message"])
+		case 200:
+			// URI Start; the size is reported again when the fetch is done
+		case 201:
+			result := &methodResult{notModified: fields["IMS-Hit"] == "true"}
+			result.size, _ = strconv.ParseInt(fields["Size"], 10, 64)
+			if modified, err := time.Parse(time.RFC1123, fields["Last-Modified"]); err == nil {
+				result.lastModified = &modified
+			}
+			return result, nil
+		case 400, 401:
+			return nil, &AcquireError{URI: req.URI, Reason: methodFailureReason(fields)}
+		default:
+			// other messages, such as media changes, need a user at a terminal
+			return nil, &AcquireError{URI: req.URI, Reason: fmt.Sprintf("unsupported apt method message %d", code)}
+		}
+	}
+}
+
+// methodFailureReason describes a failure reported by a method, using the same reasons as the
+// native transports for missing files so callers can recognize them
+func methodFailureReason(fields map[string]string) string {
+	message := fields["Message"]
+	switch {
+	case fields["FailReason"] == "HttpError404":
+		return "HTTP 404"
+	case strings.Contains(strings.ToLower(message), "not found"):
+		return "file not found"
+	case message != "":
+		return message
+	default:
+		return "apt method failed"
+	}
+}
+
+// readMethodMessage reads a message: a line with a status code and description, then
+// "Field: value" lines up to a blank line
+func readMethodMessage(r *bufio.Reader) (int, map[string]string, error) {
+	var status string
+	fields := make(map[string]string)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return 0, nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if status == "" {
+				continue // blank lines between messages
+			}
+			break
+		}
+		if status == "" {
+			status = line
+			continue
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok {
+			fields[name] = strings.TrimSpace(value)
+		}
+	}
+
+	codeText, _, _ := strings.Cut(status, " ")
+	code, err := strconv.Atoi(codeText)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid apt method message %q", status)
+	}
+	return code, fields, nil
+}
+
+// writeMethodMessage writes a message with its fields in order
+func writeMethodMessage(w io.Writer, status string, fields [][2]string) error {
+	var sb strings.Builder
+	sb.WriteString(status + "\n")
+	for _, field := range fields {
+		sb.WriteString(field[0] + ": " + field[1] + "\n")
+	}
+	sb.WriteString("\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// removeOnClose deletes the temporary directory a method wrote to once its content has been read
+type removeOnClose struct {
+	io.ReadCloser
+	path string
+}
+
+func (r *removeOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	os.RemoveAll(r.path)
+	return err
+}
+
+// methodName matches the names of method binaries that are URI schemes, e.g. ftp or tor+http
+var methodName = regexp.MustCompile(`^[a-z][a-z0-9+.-]*$`)
+
+// RegisterAptMethods registers an ExecTransport for each method binary in dir whose scheme the
+// registry doesn't already handle, and returns the schemes it added. A missing directory, as on
+// systems without apt, isn't an error.
+func RegisterAptMethods(r *Registry, dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read apt methods directory: %w", err)
+	}
+
+	registered := r.Schemes()
+	var added []string
+	for _, entry := range entries {
+		scheme := entry.Name()
+		if !methodName.MatchString(scheme) || slices.Contains(internalAptMethods, scheme) || slices.Contains(registered, scheme) {
+			continue
+		}
+		// os.Stat follows symlinks, so methods that apt installs as links to others, e.g. https to
+		// http, are registered too; anything that isn't an executable file is skipped
+		info, err := os.Stat(filepath.Join(dir, scheme))
+		if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+			continue
+		}
+		r.Register(NewExecTransport(filepath.Join(dir, scheme), scheme))
+		added = append(added, scheme)
+	}
+	return added, nil
+}
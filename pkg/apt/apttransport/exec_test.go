@@ -0,0 +1,149 @@
+package apttransport
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMethod is an apt method that serves the files below $ROOT for fake:// URIs
+const fakeMethod = `#!/bin/sh
+printf '100 Capabilities\nVersion: 1.2\nSingle-Instance: true\nSend-Config: true\n\n'
+while IFS= read -r line; do
+	case "$line" in
+	"URI: "*) uri="${line#URI: }" ;;
+	"Filename: "*) file="${line#Filename: }" ;;
+	"")
+		[ -z "$uri" ] && continue
+		src="$ROOT/${uri#fake://}"
+		if [ -f "$src" ]; then
+			printf '102 Status\nURI: %s\nMessage: Fetching\n\n' "$uri"
+			cp "$src" "$file"
+			printf '201 URI Done\nURI: %s\nFilename: %s\nSize: %s\nLast-Modified: Sat, 27 Apr 2024 15:24:47 GMT\n\n' "$uri" "$file" "$(wc -c < "$file" | tr -d ' ')"
+		else
+			printf '400 URI Failure\nURI: %s\nMessage: File not found\n\n' "$uri"
+		fi
+		uri=""
+		;;
+	esac
+done
+`
+
+func newFakeMethod(t *testing.T) (*ExecTransport, string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("apt methods are shell scripts here")
+	}
+	root := t.TempDir()
+	method := filepath.Join(t.TempDir(), "fake")
+	require.NoError(t, os.WriteFile(method, []byte(fakeMethod), 0755))
+	t.Setenv("ROOT", root)
+	return NewExecTransport(method, "fake"), root
+}
+
+func TestExecTransport_Acquire(t *testing.T) {
+	transport, root := newFakeMethod(t)
+	content := "Package: alpha\n"
+	require.NoError(t, os.WriteFile(filepath.Join(root, "Packages"), []byte(content), 0644))
+	uri, err := url.Parse("fake://Packages")
+	require.NoError(t, err)
+	sum := fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+
+	t.Run("stream", func(t *testing.T) {
+		resp, err := transport.Acquire(context.Background(), &AcquireRequest{URI: uri, ExpectedHashes: map[string]string{"sha256": sum}})
+		require.NoError(t, err)
+		data, err := io.ReadAll(resp.Content)
+		require.NoError(t, err)
+		require.NoError(t, resp.Content.Close())
+		assert.Equal(t, content, string(data))
+		assert.Equal(t, uri, resp.URI)
+		require.NotNil(t, resp.LastModified)
+		assert.Equal(t, 2024, resp.LastModified.Year())
+	})
+
+	t.Run("stream with a timeout", func(t *testing.T) {
+		// the timeout covers the method's fetch, not reading the content afterwards
+		resp, err := transport.Acquire(context.Background(), &AcquireRequest{URI: uri, Timeout: time.Minute})
+		require.NoError(t, err)
+		data, err := io.ReadAll(resp.Content)
+		require.NoError(t, err)
+		require.NoError(t, resp.Content.Close())
+		assert.Equal(t, content, string(data))
+	})
+
+	t.Run("file", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "Packages")
+		resp, err := transport.Acquire(context.Background(), &AcquireRequest{URI: uri, Filename: dest})
+		require.NoError(t, err)
+		assert.Equal(t, dest, resp.Filename)
+		assert.Equal(t, int64(len(content)), resp.Size)
+		data, err := os.ReadFile(dest)
+		require.NoError(t, err)
+		assert.Equal(t, content, string(data))
+
+		// only the destination is left behind
+		entries, err := os.ReadDir(filepath.Dir(dest))
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+
+	t.Run("hash mismatch", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "Packages")
+		_, err := transport.Acquire(context.Background(), &AcquireRequest{URI: uri, Filename: dest,
+			ExpectedHashes: map[string]string{"sha256": "0000"}})
+		assert.ErrorIs(t, err, ErrHashMismatch)
+		assert.NoFileExists(t, dest)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		missing, err := url.Parse("fake://missing")
+		require.NoError(t, err)
+		_, err = transport.Acquire(context.Background(), &AcquireRequest{URI: missing})
+		var acquireErr *AcquireError
+		require.ErrorAs(t, err, &acquireErr)
+		assert.Equal(t, "file not found", acquireErr.Reason)
+		assert.Equal(t, missing, acquireErr.URI)
+	})
+}
+
+func TestReadMethodMessage(t *testing.T) {
+	code, fields, err := readMethodMessage(bufio.NewReader(strings.NewReader("\n201 URI Done\nURI: fake://x\nIMS-Hit: true\n\n")))
+	require.NoError(t, err)
+	assert.Equal(t, 201, code)
+	assert.Equal(t, map[string]string{"URI": "fake://x", "IMS-Hit": "true"}, fields)
+
+	_, _, err = readMethodMessage(bufio.NewReader(strings.NewReader("nonsense\n\n")))
+	assert.Error(t, err)
+}
+
+func TestRegisterAptMethods(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"ftp", "http", "gpgv", "tor+http"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), 0755))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README"), []byte("not a method"), 0644))
+	require.NoError(t, os.Symlink(filepath.Join(dir, "ftp"), filepath.Join(dir, "sftp")))
+
+	registry := NewRegistryWithConfig(RegistryConfig{Cache: CacheConfig{Disabled: true}})
+	added, err := RegisterAptMethods(registry, dir)
+	require.NoError(t, err)
+	// http is handled natively and gpgv isn't a URI scheme
+	assert.Equal(t, []string{"ftp", "sftp", "tor+http"}, added)
+	assert.Contains(t, registry.Schemes(), "ftp")
+
+	added, err = RegisterAptMethods(registry, filepath.Join(dir, "missing"))
+	assert.NoError(t, err)
+	assert.Empty(t, added)
+}
@@ -1,6 +1,7 @@
 package apttransport
 
 import (
+	"cmp"
 	"context"
 	"crypto/md5"
 	"crypto/sha1"
@@ -9,16 +10,42 @@ import (
 	"fmt"
 	"hash"
 	"io"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 )
 
-type FileTransport struct{}
+var _ HeadTransport = &FileTransport{}
+var _ ListTransport = &FileTransport{}
+
+type FileTransport struct {
+	// rateLimit caps how fast each file is read, in bytes per second; zero is unlimited
+	rateLimit int64
+}
+
+// FileOption is a functional option for configuring a FileTransport
+type FileOption func(*FileTransport)
+
+// WithFileRateLimit reads each file at no more than bytesPerSec, like WithRateLimit for HTTP
+func WithFileRateLimit(bytesPerSec int64) FileOption {
+	return func(t *FileTransport) {
+		t.rateLimit = bytesPerSec
+	}
+}
 
 //goland:noinspection GoUnusedExportedFunction
 func NewFileTransport() *FileTransport {
-	return &FileTransport{}
+	return NewFileTransportWithOptions()
+}
+
+// NewFileTransportWithOptions creates a FileTransport configured by the given options
+func NewFileTransportWithOptions(opts ...FileOption) *FileTransport {
+	t := &FileTransport{}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
 }
 
 func (t *FileTransport) Schemes() []string {
@@ -99,38 +126,96 @@ func (t *FileTransport) Acquire(ctx context.Context, req *AcquireRequest) (*Acqu
 	}
 
 	// If saving to a different file, handle that
+	// reading a local file doesn't watch the context, so check it between reads
+	body := limitRate(ctx, &contextReader{ctx: ctx, ReadCloser: file}, cmp.Or(req.RateLimit, t.rateLimit))
 	if req.Filename != "" && req.Filename != path {
-		return t.copyToFile(file, response, req)
+		return t.copyToFile(body, response, req)
+	}
+
+	// Otherwise stream the file's content
+	response.Content = newVerifyingReader(body, response, req, nil)
+	return response, nil
+}
+
+// Head stats the file without opening it
+func (t *FileTransport) Head(ctx context.Context, uri *url.URL) (*AcquireResponse, error) {
+	path := uri.Path
+	if uri.Host != "" {
+		path = filepath.Join(uri.Host, path)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, &AcquireError{
+			URI:    uri,
+			Reason: "context cancelled",
+			Err:    err,
+		}
 	}
 
-	// Otherwise return content directly
-	content, hashes, err := t.readAndHash(file, req.ExpectedHashes, req.ProgressCallback, response.Size)
+	fileInfo, err := os.Stat(path)
 	if err != nil {
-		file.Close()
+		reason := "failed to stat file"
+		if os.IsNotExist(err) {
+			reason = "file not found"
+		}
 		return nil, &AcquireError{
-			URI:    req.URI,
-			Reason: "failed to read file",
+			URI:    uri,
+			Reason: reason,
 			Err:    err,
 		}
 	}
+	if fileInfo.IsDir() {
+		return nil, &AcquireError{
+			URI:    uri,
+			Reason: "path is a directory",
+			Err:    nil,
+		}
+	}
 
-	response.Content = content
-	response.Hashes = hashes
+	modTime := fileInfo.ModTime()
+	return &AcquireResponse{
+		URI:          uri,
+		LastModified: &modTime,
+		Size:         fileInfo.Size(),
+	}, nil
+}
 
-	// Verify expected hashes
-	if err := t.verifyHashes(response.Hashes, req.ExpectedHashes); err != nil {
-		content.Close()
+// List reads the directory at uri
+func (t *FileTransport) List(ctx context.Context, uri *url.URL) ([]string, error) {
+	path := uri.Path
+	if uri.Host != "" {
+		path = filepath.Join(uri.Host, path)
+	}
+
+	if err := ctx.Err(); err != nil {
 		return nil, &AcquireError{
-			URI:    req.URI,
-			Reason: "hash verification failed",
+			URI:    uri,
+			Reason: "context cancelled",
 			Err:    err,
 		}
 	}
 
-	return response, nil
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		reason := "failed to read directory"
+		if os.IsNotExist(err) {
+			reason = "directory not found"
+		}
+		return nil, &AcquireError{
+			URI:    uri,
+			Reason: reason,
+			Err:    err,
+		}
+	}
+
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+	return names, nil
 }
 
-func (t *FileTransport) copyToFile(sourceFile *os.File, response *AcquireResponse, req *AcquireRequest) (*AcquireResponse, error) {
+func (t *FileTransport) copyToFile(sourceFile io.ReadCloser, response *AcquireResponse, req *AcquireRequest) (*AcquireResponse, error) {
 	defer sourceFile.Close()
 
 	// Create destination file
@@ -206,66 +291,6 @@ func (t *FileTransport) copyToFile(sourceFile *os.File, response *AcquireRespons
 	return response, nil
 }
 
-func (t *FileTransport) readAndHash(file *os.File, expectedHashes map[string]string, progressCallback func(int64, int64), totalSize int64) (io.ReadCloser, map[string]string, error) {
-	// Create hash writers if needed
-	hashers := make(map[string]hash.Hash)
-	if len(expectedHashes) > 0 {
-		for algo := range expectedHashes {
-			if hasher := t.createHasher(algo); hasher != nil {
-				hashers[algo] = hasher
-			}
-		}
-	}
-
-	// Read all content
-	var buf []byte
-	if len(hashers) > 0 || progressCallback != nil {
-		// Need to process content for hashing or progress
-		writers := make([]io.Writer, 0, len(hashers))
-		for _, hasher := range hashers {
-			writers = append(writers, hasher)
-		}
-
-		var reader io.Reader = file
-		if progressCallback != nil {
-			reader = &fileProgressReader{
-				reader:   file,
-				callback: progressCallback,
-				total:    totalSize,
-			}
-		}
-
-		var err error
-		if len(writers) > 0 {
-			multiWriter := io.MultiWriter(writers...)
-			buf, err = io.ReadAll(io.TeeReader(reader, multiWriter))
-		} else {
-			buf, err = io.ReadAll(reader)
-		}
-		if err != nil {
-			return nil, nil, err
-		}
-	} else {
-		// Simple read
-		var err error
-		buf, err = io.ReadAll(file)
-		if err != nil {
-			return nil, nil, err
-		}
-	}
-
-	// Close original file since we've read all content
-	file.Close()
-
-	// Collect hashes
-	hashes := make(map[string]string)
-	for algo, hasher := range hashers {
-		hashes[algo] = fmt.Sprintf("%x", hasher.Sum(nil))
-	}
-
-	return io.NopCloser(strings.NewReader(string(buf))), hashes, nil
-}
-
 func (t *FileTransport) createHasher(algorithm string) hash.Hash {
 	switch strings.ToLower(algorithm) {
 	case "md5":
@@ -285,7 +310,7 @@ func (t *FileTransport) verifyHashes(actual, expected map[string]string) error {
 	for algo, expectedHash := range expected {
 		if actualHash, ok := actual[algo]; ok {
 			if actualHash != expectedHash {
-				return fmt.Errorf("hash mismatch for %s: expected %s, got %s", algo, expectedHash, actualHash)
+				return fmt.Errorf("%w for %s: expected %s, got %s", ErrHashMismatch, algo, expectedHash, actualHash)
 			}
 		}
 	}
@@ -308,6 +333,7 @@ func (fpr *fileProgressReader) Read(p []byte) (n int, err error) {
 	return n, err
 }
 
+// Close does nothing, since every request opens and closes its own file
 func (t *FileTransport) Close() error {
 	return nil
 }
@@ -92,6 +92,8 @@ func TestFileTransport_AcquireWithHash(t *testing.T) {
 	require.NotNil(t, resp)
 
 	defer resp.Content.Close()
+	_, err = io.ReadAll(resp.Content)
+	require.NoError(t, err)
 
 	// Verify hash was calculated
 	assert.Contains(t, resp.Hashes, "md5")
@@ -120,8 +122,14 @@ func TestFileTransport_AcquireWithWrongHash(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	_, err = transport.Acquire(ctx, req)
+	resp, err := transport.Acquire(ctx, req)
+	require.NoError(t, err)
+	defer resp.Content.Close()
+
+	// The content is streamed, so the mismatch is reported once it has been read
+	_, err = io.ReadAll(resp.Content)
 	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrHashMismatch)
 
 	var acquireErr *AcquireError
 	assert.ErrorAs(t, err, &acquireErr)
@@ -164,6 +172,25 @@ func TestFileTransport_AcquireWithCopy(t *testing.T) {
 	assert.Equal(t, int64(len(testContent)), resp.Size)
 }
 
+func TestFileTransport_RateLimit(t *testing.T) {
+	tmpDir := t.TempDir()
+	source := filepath.Join(tmpDir, "large.deb")
+	require.NoError(t, os.WriteFile(source, make([]byte, 50_000), 0644))
+	fileURL, err := url.Parse("file://" + source)
+	require.NoError(t, err)
+
+	// the first tenth of a second is a burst, so 50kB at 100kB/s takes at least 0.4s
+	transport := NewFileTransportWithOptions(WithFileRateLimit(100_000))
+	start := time.Now()
+	resp, err := transport.Acquire(context.Background(), &AcquireRequest{URI: fileURL, Filename: filepath.Join(tmpDir, "copy.deb")})
+	require.NoError(t, err)
+	elapsed := time.Since(start)
+
+	assert.Equal(t, int64(50_000), resp.Size)
+	assert.GreaterOrEqual(t, elapsed, 400*time.Millisecond)
+	assert.Less(t, elapsed, 2*time.Second)
+}
+
 func TestFileTransport_AcquireWithProgress(t *testing.T) {
 	transport := NewFileTransport()
 
@@ -329,6 +356,37 @@ func TestFileTransport_AcquireWithCancelledContext(t *testing.T) {
 	assert.Contains(t, acquireErr.Reason, "context cancelled")
 }
 
+func TestFileTransport_AcquireCancelledDuringCopy(t *testing.T) {
+	transport := NewFileTransport()
+
+	// large enough to take several reads
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "source.deb")
+	require.NoError(t, os.WriteFile(testFile, make([]byte, 256*1024), 0644))
+	fileURL, err := url.Parse("file://" + testFile)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dest := filepath.Join(tmpDir, "dest.deb")
+	_, err = transport.Acquire(ctx, &AcquireRequest{
+		URI:              fileURL,
+		Filename:         dest,
+		ProgressCallback: func(downloaded, total int64) { cancel() },
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NoFileExists(t, dest, "the partial copy is removed")
+
+	// streamed content stops too
+	ctx, cancel = context.WithCancel(context.Background())
+	resp, err := transport.Acquire(ctx, &AcquireRequest{URI: fileURL})
+	require.NoError(t, err)
+	defer resp.Content.Close()
+	cancel()
+	_, err = io.ReadAll(resp.Content)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
 func TestFileTransport_AcquireWithCopyAndHash(t *testing.T) {
 	transport := NewFileTransport()
 
@@ -401,6 +459,8 @@ func TestFileTransport_AcquireMultipleHashes(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, resp)
 	defer resp.Content.Close()
+	_, err = io.ReadAll(resp.Content)
+	require.NoError(t, err)
 
 	// Verify both hashes were calculated
 	assert.Contains(t, resp.Hashes, "md5")
@@ -481,3 +541,62 @@ func TestFileRegistry_Integration(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, testContent, string(content))
 }
+
+func TestFileTransport_Head(t *testing.T) {
+	transport := NewFileTransport()
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "Packages")
+	require.NoError(t, os.WriteFile(testFile, []byte("Package: alpha\n"), 0644))
+
+	fileURL, err := url.Parse("file://" + testFile)
+	require.NoError(t, err)
+	resp, err := transport.Head(context.Background(), fileURL)
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), resp.Size)
+	assert.Nil(t, resp.Content)
+	assert.NotNil(t, resp.LastModified)
+
+	missingURL, err := url.Parse("file://" + filepath.Join(tmpDir, "missing"))
+	require.NoError(t, err)
+	_, err = transport.Head(context.Background(), missingURL)
+	var acquireErr *AcquireError
+	require.ErrorAs(t, err, &acquireErr)
+	assert.Contains(t, acquireErr.Reason, "file not found")
+}
+
+func TestRegistry_HeadNotSupported(t *testing.T) {
+	// embedding through the interface hides FileTransport.Head
+	registry := NewRegistry()
+	registry.Register(&struct{ Transport }{NewFileTransport()})
+
+	fileURL, err := url.Parse("file:///etc/hostname")
+	require.NoError(t, err)
+	_, err = registry.Head(context.Background(), fileURL)
+	assert.ErrorIs(t, err, ErrHeadNotSupported)
+
+	ftpURL, err := url.Parse("ftp://example.com/Release")
+	require.NoError(t, err)
+	_, err = registry.Head(context.Background(), ftpURL)
+	var unsupportedErr *UnsupportedSchemeError
+	assert.ErrorAs(t, err, &unsupportedErr)
+}
+
+func TestFileTransport_List(t *testing.T) {
+	transport := NewFileTransport()
+	tmpDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "dists", "stable"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "dists", "bookworm"), 0755))
+
+	dirURL, err := url.Parse("file://" + filepath.Join(tmpDir, "dists"))
+	require.NoError(t, err)
+	names, err := transport.List(context.Background(), dirURL)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bookworm", "stable"}, names)
+
+	missingURL, err := url.Parse("file://" + filepath.Join(tmpDir, "pool"))
+	require.NoError(t, err)
+	_, err = transport.List(context.Background(), missingURL)
+	var acquireErr *AcquireError
+	require.ErrorAs(t, err, &acquireErr)
+	assert.Contains(t, acquireErr.Reason, "directory not found")
+}
@@ -1,37 +1,190 @@
 package apttransport
 
 import (
+	"cmp"
 	"context"
 	"crypto/md5"
 	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
+	"errors"
 	"fmt"
 	"hash"
+	"html"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
+	"regexp"
+	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/net/http/httpproxy"
 )
 
 var _ Transport = &HTTPTransport{}
+var _ HeadTransport = &HTTPTransport{}
+var _ ListTransport = &HTTPTransport{}
 
 type HTTPTransport struct {
 	userAgent string
 	timeout   time.Duration
 	client    *http.Client
+
+	// retry configuration; maxRetries of zero means a single attempt
+	maxRetries int
+	baseDelay  time.Duration
+
+	// proxy overrides HTTP_PROXY and HTTPS_PROXY when set
+	proxy string
+
+	// rateLimit caps how fast each response body is read, in bytes per second; zero is unlimited
+	rateLimit int64
+
+	// maxRedirects is how many redirects a request follows before failing; zero follows none
+	maxRedirects int
+}
+
+// HTTPOption is a functional option for configuring an HTTPTransport
+type HTTPOption func(*HTTPTransport)
+
+// WithRetry retries failed requests up to maxRetries times with exponential backoff starting at baseDelay.
+// Only network errors and 500/502/503/504 responses are retried.
+func WithRetry(maxRetries int, baseDelay time.Duration) HTTPOption {
+	return func(t *HTTPTransport) {
+		t.maxRetries = maxRetries
+		t.baseDelay = baseDelay
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request
+func WithUserAgent(userAgent string) HTTPOption {
+	return func(t *HTTPTransport) {
+		t.userAgent = userAgent
+	}
+}
+
+// WithProxy sends requests through the given proxy URL instead of the one from the environment.
+// Hosts listed in NO_PROXY still bypass the proxy.
+func WithProxy(proxyURL string) HTTPOption {
+	return func(t *HTTPTransport) {
+		t.proxy = proxyURL
+	}
+}
+
+// WithRateLimit reads each response body at no more than bytesPerSec
+func WithRateLimit(bytesPerSec int64) HTTPOption {
+	return func(t *HTTPTransport) {
+		t.rateLimit = bytesPerSec
+	}
+}
+
+// WithMaxRedirects fails requests that are redirected more than maxRedirects times.
+// Zero refuses to follow any redirect.
+func WithMaxRedirects(maxRedirects int) HTTPOption {
+	return func(t *HTTPTransport) {
+		t.maxRedirects = maxRedirects
+	}
+}
+
+// Version is the apt-look version reported in the default User-Agent. Builds can set it with
+// -ldflags "-X github.com/nicwaller/apt-look/pkg/apt/apttransport.Version=1.2.3";
+// otherwise it comes from the module version recorded in the binary.
+var Version string
+
+const modulePath = "github.com/nicwaller/apt-look"
+
+// DefaultUserAgent identifies apt-look and where to find it, in the same way apt identifies itself,
+// so that mirror operators can tell who is fetching
+func DefaultUserAgent() string {
+	return fmt.Sprintf("apt-look/%s (+https://%s)", buildVersion(), modulePath)
+}
+
+// buildVersion returns Version, or else the version of this module in the build info
+func buildVersion() string {
+	if Version != "" {
+		return Version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "dev"
+	}
+	// apt-look may be built as a dependency of another program
+	modules := append([]*debug.Module{&info.Main}, info.Deps...)
+	for _, mod := range modules {
+		if mod.Path == modulePath && mod.Version != "" && mod.Version != "(devel)" {
+			return strings.TrimPrefix(mod.Version, "v")
+		}
+	}
+	return "dev"
 }
 
+// DefaultTimeout bounds HTTP requests that don't set AcquireRequest.Timeout
+const DefaultTimeout = 60 * time.Second
+
+// ErrTooManyRedirects is wrapped by the error of a request that was redirected more times than allowed
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+// DefaultMaxRedirects is how many redirects a request follows unless WithMaxRedirects says otherwise,
+// the same limit as net/http
+const DefaultMaxRedirects = 10
+
 func NewHTTPTransport() *HTTPTransport {
-	timeout := time.Second * 60
-	return &HTTPTransport{
-		userAgent: "apt-look/1.0",
-		timeout:   timeout,
-		client: &http.Client{
-			Timeout: timeout,
-		},
+	return NewHTTPTransportWithOptions()
+}
+
+// NewHTTPTransportWithOptions creates an HTTPTransport configured by the given options
+func NewHTTPTransportWithOptions(opts ...HTTPOption) *HTTPTransport {
+	// the timeout is applied to each request's context, so the client is shared without one
+	t := &HTTPTransport{
+		userAgent:    DefaultUserAgent(),
+		timeout:      DefaultTimeout,
+		client:       &http.Client{},
+		maxRedirects: DefaultMaxRedirects,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	t.client.CheckRedirect = t.checkRedirect
+
+	httpTransport := http.DefaultTransport.(*http.Transport).Clone()
+	httpTransport.Proxy = t.proxyFunc()
+	t.client.Transport = httpTransport
+	return t
+}
+
+// Close closes the idle connections kept for reuse; the transport can still be used afterwards
+func (t *HTTPTransport) Close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
+
+// checkRedirect limits how many redirects are followed, and logs each one, since mirrors commonly
+// redirect to https or to a server in another region
+func (t *HTTPTransport) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > t.maxRedirects {
+		return fmt.Errorf("%w: stopped after %d", ErrTooManyRedirects, t.maxRedirects)
+	}
+	log.Debug().Str("from", via[len(via)-1].URL.String()).Str("to", req.URL.String()).Msg("following redirect")
+	return nil
+}
+
+// proxyFunc resolves the proxy for each request from HTTP_PROXY, HTTPS_PROXY and NO_PROXY,
+// read once when the transport is created, with any explicit proxy taking precedence
+func (t *HTTPTransport) proxyFunc() func(*http.Request) (*url.URL, error) {
+	config := httpproxy.FromEnvironment()
+	if t.proxy != "" {
+		config.HTTPProxy = t.proxy
+		config.HTTPSProxy = t.proxy
+	}
+	proxy := config.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
 	}
 }
 
@@ -40,6 +193,18 @@ func (t *HTTPTransport) Schemes() []string {
 }
 
 func (t *HTTPTransport) Acquire(ctx context.Context, req *AcquireRequest) (*AcquireResponse, error) {
+	// The request timeout, or the transport's default, covers retries until a response arrives; the
+	// context then lives until the content is closed
+	ctx, cancel := context.WithCancel(ctx)
+	timer := startResponseTimer(t.timeoutFor(req.Timeout), cancel)
+	defer timer.stop()
+	streaming := false
+	defer func() {
+		if !streaming {
+			cancel()
+		}
+	}()
+
 	httpReq, err := http.NewRequestWithContext(ctx, "GET", req.URI.String(), nil)
 	if err != nil {
 		return nil, &AcquireError{
@@ -59,19 +224,20 @@ func (t *HTTPTransport) Acquire(ctx context.Context, req *AcquireRequest) (*Acqu
 	if req.LastModified != nil {
 		httpReq.Header.Set("If-Modified-Since", req.LastModified.UTC().Format(http.TimeFormat))
 	}
-
-	// Use request timeout if specified
-	client := t.client
-	if req.Timeout > 0 {
-		client.Timeout = req.Timeout
+	if req.ETag != "" {
+		httpReq.Header.Set("If-None-Match", req.ETag)
 	}
 
-	resp, err := client.Do(httpReq)
+	resp, err := t.doWithRetry(ctx, t.client, httpReq)
+	if err == nil && !timer.stop() {
+		resp.Body.Close()
+		err = ctx.Err()
+	}
 	if err != nil {
 		return nil, &AcquireError{
 			URI:    req.URI,
 			Reason: "request failed",
-			Err:    err,
+			Err:    timer.wrap(err),
 		}
 	}
 
@@ -95,7 +261,7 @@ func (t *HTTPTransport) Acquire(ctx context.Context, req *AcquireRequest) (*Acqu
 
 	// Prepare response
 	response := &AcquireResponse{
-		URI:          httpReq.URL, // May have changed due to redirects
+		URI:          resp.Request.URL, // the last request, after any redirects
 		Headers:      responseHeaders(resp),
 		LastModified: parseLastModified(resp.Header.Get("Last-Modified")),
 	}
@@ -107,41 +273,237 @@ func (t *HTTPTransport) Acquire(ctx context.Context, req *AcquireRequest) (*Acqu
 		}
 	}
 
+	body := limitRate(ctx, resp.Body, cmp.Or(req.RateLimit, t.rateLimit))
+
 	// If saving to file, handle that
 	if req.Filename != "" {
-		return t.saveToFile(resp, response, req)
+		return saveToFile(body, response, req)
 	}
 
-	// Otherwise return content directly
-	content, hashes, size, err := t.readAndHash(resp.Body, req.ExpectedHashes, req.ProgressCallback, response.Size)
+	// Otherwise stream the content, which keeps the request context alive until it is closed
+	streaming = true
+	response.Content = newVerifyingReader(body, response, req, cancel)
+	return response, nil
+}
+
+// Head issues a HEAD request and reports the Content-Length and Last-Modified headers.
+// Servers that reject the method with 405 or 501 yield ErrHeadNotSupported.
+func (t *HTTPTransport) Head(ctx context.Context, uri *url.URL) (*AcquireResponse, error) {
+	ctx, cancel := t.withTimeout(ctx)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodHead, uri.String(), nil)
 	if err != nil {
 		return nil, &AcquireError{
-			URI:    req.URI,
-			Reason: "failed to read content",
+			URI:    uri,
+			Reason: "failed to create request",
 			Err:    err,
 		}
 	}
+	httpReq.Header.Set("User-Agent", t.userAgent)
 
-	response.Content = content
-	response.Hashes = hashes
-	response.Size = size
-
-	// Verify expected hashes
-	if err := verifyHashes(response.Hashes, req.ExpectedHashes); err != nil {
-		content.Close()
+	resp, err := t.doWithRetry(ctx, t.client, httpReq)
+	if err != nil {
 		return nil, &AcquireError{
-			URI:    req.URI,
-			Reason: "hash verification failed",
+			URI:    uri,
+			Reason: "request failed",
 			Err:    err,
 		}
 	}
+	resp.Body.Close()
 
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return nil, &AcquireError{
+			URI:    uri,
+			Reason: fmt.Sprintf("HTTP %d", resp.StatusCode),
+			Err:    ErrHeadNotSupported,
+		}
+	default:
+		return nil, &AcquireError{
+			URI:    uri,
+			Reason: fmt.Sprintf("HTTP %d", resp.StatusCode),
+			Err:    nil,
+		}
+	}
+
+	response := &AcquireResponse{
+		URI:          resp.Request.URL,
+		Headers:      responseHeaders(resp),
+		LastModified: parseLastModified(resp.Header.Get("Last-Modified")),
+	}
+	if contentLength := resp.Header.Get("Content-Length"); contentLength != "" {
+		if size, err := strconv.ParseInt(contentLength, 10, 64); err == nil {
+			response.Size = size
+		}
+	}
 	return response, nil
 }
 
-func (t *HTTPTransport) saveToFile(resp *http.Response, response *AcquireResponse, req *AcquireRequest) (*AcquireResponse, error) {
+// List fetches the directory index page at uri and returns the entries it links to.
+// Responses that aren't HTML, such as S3 bucket listings, yield ErrListNotSupported.
+func (t *HTTPTransport) List(ctx context.Context, uri *url.URL) ([]string, error) {
+	ctx, cancel := t.withTimeout(ctx)
+	defer cancel()
+
+	// autoindex pages are served for the directory path with a trailing slash
+	dirURL := *uri
+	if !strings.HasSuffix(dirURL.Path, "/") {
+		dirURL.Path += "/"
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, dirURL.String(), nil)
+	if err != nil {
+		return nil, &AcquireError{
+			URI:    uri,
+			Reason: "failed to create request",
+			Err:    err,
+		}
+	}
+	httpReq.Header.Set("User-Agent", t.userAgent)
+
+	resp, err := t.doWithRetry(ctx, t.client, httpReq)
+	if err != nil {
+		return nil, &AcquireError{
+			URI:    uri,
+			Reason: "request failed",
+			Err:    err,
+		}
+	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, &AcquireError{
+			URI:    uri,
+			Reason: fmt.Sprintf("HTTP %d", resp.StatusCode),
+			Err:    nil,
+		}
+	}
+	if !strings.Contains(resp.Header.Get("Content-Type"), "text/html") {
+		return nil, &AcquireError{
+			URI:    uri,
+			Reason: "response is not a directory index",
+			Err:    ErrListNotSupported,
+		}
+	}
+
+	// index pages are small; cap the read in case the server sends something else
+	page, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, &AcquireError{
+			URI:    uri,
+			Reason: "failed to read content",
+			Err:    err,
+		}
+	}
+	return parseIndexLinks(resp.Request.URL, string(page)), nil
+}
+
+var hrefPattern = regexp.MustCompile(`(?i)<a\s[^>]*href\s*=\s*["']([^"']+)["']`)
+
+// parseIndexLinks returns the names of the direct children of dir linked from an index page,
+// skipping parent links, sort links and anything outside the directory
+func parseIndexLinks(dir *url.URL, page string) []string {
+	var names []string
+	for _, match := range hrefPattern.FindAllStringSubmatch(page, -1) {
+		ref, err := url.Parse(html.UnescapeString(match[1]))
+		if err != nil || ref.RawQuery != "" || ref.Fragment != "" {
+			continue
+		}
+		target := dir.ResolveReference(ref)
+		if target.Scheme != dir.Scheme || target.Host != dir.Host {
+			continue
+		}
+		child := strings.TrimSuffix(target.Path, "/")
+		name := path.Base(child)
+		if path.Dir(child) != path.Clean(dir.Path) || name == "." || name == ".." {
+			continue
+		}
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// withTimeout bounds ctx by the transport's default timeout
+func (t *HTTPTransport) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, t.timeout)
+}
+
+// timeoutFor returns timeout, or the transport's default timeout when it is zero
+func (t *HTTPTransport) timeoutFor(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return t.timeout
+	}
+	return timeout
+}
+
+// doWithRetry sends a request, retrying transient failures according to the retry configuration
+func (t *HTTPTransport) doWithRetry(ctx context.Context, client *http.Client, httpReq *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := client.Do(httpReq)
+		if ctx.Err() != nil {
+			return resp, err
+		}
+		if err == nil && !isRetryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		// following the same redirects again would only end the same way
+		if errors.Is(err, ErrTooManyRedirects) {
+			return resp, err
+		}
+		if attempt >= t.maxRetries {
+			return resp, err
+		}
+
+		delay := t.baseDelay << attempt
+		if resp != nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				delay = retryAfter
+			}
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// isRetryableStatus reports whether a response status indicates a transient server problem
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		return max(time.Until(when), 0), true
+	}
+	return 0, false
+}
+
+// saveToFile copies a response body to req.Filename, hashing it on the way
+func saveToFile(body io.ReadCloser, response *AcquireResponse, req *AcquireRequest) (*AcquireResponse, error) {
+	defer body.Close()
+
 	file, err := os.Create(req.Filename)
 	if err != nil {
 		return nil, &AcquireError{
@@ -173,13 +535,13 @@ func (t *HTTPTransport) saveToFile(resp *http.Response, response *AcquireRespons
 	var written int64
 	if req.ProgressCallback != nil {
 		progressReader := &progressReader{
-			reader:   resp.Body,
+			reader:   body,
 			callback: req.ProgressCallback,
 			total:    response.Size,
 		}
 		written, err = io.Copy(multiWriter, progressReader)
 	} else {
-		written, err = io.Copy(multiWriter, resp.Body)
+		written, err = io.Copy(multiWriter, body)
 	}
 
 	if err != nil {
@@ -214,68 +576,6 @@ func (t *HTTPTransport) saveToFile(resp *http.Response, response *AcquireRespons
 	return response, nil
 }
 
-func (t *HTTPTransport) readAndHash(reader io.ReadCloser, expectedHashes map[string]string, progressCallback func(int64, int64), totalSize int64) (io.ReadCloser, map[string]string, int64, error) {
-	defer reader.Close()
-
-	// Create hash writers if needed
-	hashers := make(map[string]hash.Hash)
-	if len(expectedHashes) > 0 {
-		for algo := range expectedHashes {
-			if hasher := createHasher(algo); hasher != nil {
-				hashers[algo] = hasher
-			}
-		}
-	}
-
-	// Read all content
-	var buf []byte
-	var written int64
-	if len(hashers) > 0 || progressCallback != nil {
-		// Need to process content for hashing or progress
-		writers := make([]io.Writer, 0, len(hashers))
-		for _, hasher := range hashers {
-			writers = append(writers, hasher)
-		}
-
-		var finalReader io.ReadCloser = reader
-		if progressCallback != nil {
-			finalReader = &progressReader{
-				reader:   reader,
-				callback: progressCallback,
-				total:    totalSize,
-			}
-		}
-
-		var err error
-		if len(writers) > 0 {
-			multiWriter := io.MultiWriter(writers...)
-			buf, err = io.ReadAll(io.TeeReader(finalReader, multiWriter))
-		} else {
-			buf, err = io.ReadAll(finalReader)
-		}
-		if err != nil {
-			return nil, nil, 0, err
-		}
-		written = int64(len(buf))
-	} else {
-		// Simple read
-		var err error
-		buf, err = io.ReadAll(reader)
-		if err != nil {
-			return nil, nil, 0, err
-		}
-		written = int64(len(buf))
-	}
-
-	// Collect hashes
-	hashes := make(map[string]string)
-	for algo, hasher := range hashers {
-		hashes[algo] = fmt.Sprintf("%x", hasher.Sum(nil))
-	}
-
-	return io.NopCloser(strings.NewReader(string(buf))), hashes, written, nil
-}
-
 func responseHeaders(resp *http.Response) map[string]string {
 	headers := make(map[string]string)
 	for k, v := range resp.Header {
@@ -283,6 +583,11 @@ func responseHeaders(resp *http.Response) map[string]string {
 			headers[k] = v[0]
 		}
 	}
+	// Go canonicalizes the header as "Etag"; it is reported as "ETag" like the S3 transport does
+	if etag, ok := headers["Etag"]; ok {
+		delete(headers, "Etag")
+		headers["ETag"] = etag
+	}
 	return headers
 }
 
@@ -315,7 +620,7 @@ func verifyHashes(actual, expected map[string]string) error {
 	for algo, expectedHash := range expected {
 		if actualHash, ok := actual[algo]; ok {
 			if actualHash != expectedHash {
-				return fmt.Errorf("hash mismatch for %s: expected %s, got %s", algo, expectedHash, actualHash)
+				return fmt.Errorf("%w for %s: expected %s, got %s", ErrHashMismatch, algo, expectedHash, actualHash)
 			}
 		}
 	}
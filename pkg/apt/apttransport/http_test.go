@@ -5,10 +5,15 @@ import (
 	"crypto/md5"
 	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -171,6 +176,8 @@ func TestHTTPTransport_AcquireWithHashVerification(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, resp2)
 	defer resp2.Content.Close()
+	_, err = io.ReadAll(resp2.Content)
+	require.NoError(t, err)
 
 	// Verify hash was calculated
 	assert.Contains(t, resp2.Hashes, "md5")
@@ -192,8 +199,14 @@ func TestHTTPTransport_AcquireWithWrongHash(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	_, err = transport.Acquire(ctx, req)
+	resp, err := transport.Acquire(ctx, req)
+	require.NoError(t, err)
+	defer resp.Content.Close()
+
+	// The content is streamed, so the mismatch is reported once it has been read
+	_, err = io.ReadAll(resp.Content)
 	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrHashMismatch)
 
 	var acquireErr *AcquireError
 	assert.ErrorAs(t, err, &acquireErr)
@@ -397,3 +410,445 @@ func TestRegistry_UnsupportedScheme(t *testing.T) {
 	assert.ErrorAs(t, err, &unsupportedErr)
 	assert.Equal(t, "ftp", unsupportedErr.Scheme)
 }
+
+// flakyServer fails the first failures requests with status, then serves content
+func flakyServer(t *testing.T, failures int, status int, header http.Header) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if int(hits.Add(1)) <= failures {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(status)
+			return
+		}
+		fmt.Fprint(w, "Package: test\n")
+	}))
+	t.Cleanup(server.Close)
+	return server, &hits
+}
+
+func TestHTTPTransport_RateLimit(t *testing.T) {
+	content := strings.Repeat("x", 50_000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, content)
+	}))
+	t.Cleanup(server.Close)
+	uri, err := url.Parse(server.URL + "/pool/large.deb")
+	require.NoError(t, err)
+
+	// the first tenth of a second is a burst, so 50kB at 100kB/s takes at least 0.4s
+	transport := NewHTTPTransportWithOptions(WithRateLimit(100_000))
+	start := time.Now()
+	resp, err := transport.Acquire(context.Background(), &AcquireRequest{URI: uri})
+	require.NoError(t, err)
+	data, err := io.ReadAll(resp.Content)
+	require.NoError(t, err)
+	require.NoError(t, resp.Content.Close())
+	elapsed := time.Since(start)
+
+	assert.Equal(t, content, string(data))
+	assert.GreaterOrEqual(t, elapsed, 400*time.Millisecond)
+	assert.Less(t, elapsed, 2*time.Second)
+}
+
+func TestHTTPTransport_RetrySucceedsAfterFailures(t *testing.T) {
+	for _, status := range []int{500, 502, 503, 504} {
+		t.Run(fmt.Sprint(status), func(t *testing.T) {
+			server, hits := flakyServer(t, 2, status, nil)
+			transport := NewHTTPTransportWithOptions(WithRetry(3, time.Millisecond))
+
+			uri, err := url.Parse(server.URL + "/dists/stable/main/binary-amd64/Packages")
+			require.NoError(t, err)
+			resp, err := transport.Acquire(context.Background(), &AcquireRequest{URI: uri})
+			require.NoError(t, err)
+			defer resp.Content.Close()
+
+			content, err := io.ReadAll(resp.Content)
+			require.NoError(t, err)
+			assert.Equal(t, "Package: test\n", string(content))
+			assert.Equal(t, int32(3), hits.Load())
+		})
+	}
+}
+
+func TestHTTPTransport_RetryGivesUp(t *testing.T) {
+	server, hits := flakyServer(t, 10, http.StatusServiceUnavailable, nil)
+	transport := NewHTTPTransportWithOptions(WithRetry(2, time.Millisecond))
+
+	uri, err := url.Parse(server.URL + "/Packages")
+	require.NoError(t, err)
+	_, err = transport.Acquire(context.Background(), &AcquireRequest{URI: uri})
+	require.Error(t, err)
+
+	var acquireErr *AcquireError
+	require.ErrorAs(t, err, &acquireErr)
+	assert.Equal(t, "HTTP 503", acquireErr.Reason)
+	assert.Equal(t, int32(3), hits.Load())
+}
+
+func TestHTTPTransport_NoRetryOnClientError(t *testing.T) {
+	for _, status := range []int{http.StatusNotFound, http.StatusForbidden, http.StatusTooManyRequests} {
+		t.Run(fmt.Sprint(status), func(t *testing.T) {
+			server, hits := flakyServer(t, 1, status, nil)
+			transport := NewHTTPTransportWithOptions(WithRetry(3, time.Millisecond))
+
+			uri, err := url.Parse(server.URL + "/Packages")
+			require.NoError(t, err)
+			_, err = transport.Acquire(context.Background(), &AcquireRequest{URI: uri})
+			require.Error(t, err)
+			assert.Equal(t, int32(1), hits.Load())
+		})
+	}
+}
+
+func TestHTTPTransport_RetryHonorsRetryAfter(t *testing.T) {
+	server, hits := flakyServer(t, 1, http.StatusServiceUnavailable, http.Header{"Retry-After": {"1"}})
+	transport := NewHTTPTransportWithOptions(WithRetry(1, time.Millisecond))
+
+	uri, err := url.Parse(server.URL + "/Packages")
+	require.NoError(t, err)
+	start := time.Now()
+	resp, err := transport.Acquire(context.Background(), &AcquireRequest{URI: uri})
+	require.NoError(t, err)
+	resp.Content.Close()
+
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+	assert.Equal(t, int32(2), hits.Load())
+}
+
+func TestHTTPTransport_RetryStopsOnCancel(t *testing.T) {
+	server, hits := flakyServer(t, 10, http.StatusBadGateway, nil)
+	transport := NewHTTPTransportWithOptions(WithRetry(5, time.Hour))
+
+	uri, err := url.Parse(server.URL + "/Packages")
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = transport.Acquire(ctx, &AcquireRequest{URI: uri})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 10*time.Second)
+	assert.Equal(t, int32(1), hits.Load())
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	d, ok := parseRetryAfter("120")
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Minute, d)
+
+	d, ok = parseRetryAfter(time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+	assert.True(t, ok)
+	assert.Equal(t, time.Duration(0), d)
+
+	_, ok = parseRetryAfter("")
+	assert.False(t, ok)
+	_, ok = parseRetryAfter("soon")
+	assert.False(t, ok)
+}
+
+func TestHTTPTransport_RetryOnNetworkError(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) == 1 {
+			// Drop the connection without a response
+			conn, _, err := w.(http.Hijacker).Hijack()
+			require.NoError(t, err)
+			conn.Close()
+			return
+		}
+		fmt.Fprint(w, "Package: test\n")
+	}))
+	defer server.Close()
+
+	transport := NewHTTPTransportWithOptions(WithRetry(1, time.Millisecond))
+	uri, err := url.Parse(server.URL + "/Packages")
+	require.NoError(t, err)
+	resp, err := transport.Acquire(context.Background(), &AcquireRequest{URI: uri})
+	require.NoError(t, err)
+	resp.Content.Close()
+	assert.Equal(t, int32(2), hits.Load())
+}
+
+// resolveProxy returns the proxy the transport would use for a request to target
+func resolveProxy(t *testing.T, transport *HTTPTransport, target string) *url.URL {
+	t.Helper()
+	req, err := http.NewRequest("GET", target, nil)
+	require.NoError(t, err)
+	proxy, err := transport.client.Transport.(*http.Transport).Proxy(req)
+	require.NoError(t, err)
+	return proxy
+}
+
+func TestHTTPTransport_ProxyFromEnvironment(t *testing.T) {
+	t.Setenv("HTTP_PROXY", "http://proxy.example.com:3128")
+	t.Setenv("HTTPS_PROXY", "http://proxy.example.com:3128")
+	t.Setenv("NO_PROXY", "mirror.internal,.corp.example.com")
+
+	transport := NewHTTPTransport()
+
+	proxy := resolveProxy(t, transport, "https://archive.ubuntu.com/ubuntu/dists/jammy/Release")
+	require.NotNil(t, proxy)
+	assert.Equal(t, "proxy.example.com:3128", proxy.Host)
+
+	proxy = resolveProxy(t, transport, "http://archive.ubuntu.com/ubuntu/dists/jammy/Release")
+	require.NotNil(t, proxy)
+	assert.Equal(t, "proxy.example.com:3128", proxy.Host)
+
+	// Internal mirrors bypass the proxy
+	assert.Nil(t, resolveProxy(t, transport, "http://mirror.internal/debian/dists/stable/Release"))
+	assert.Nil(t, resolveProxy(t, transport, "https://apt.corp.example.com/dists/stable/Release"))
+}
+
+func TestHTTPTransport_WithProxy(t *testing.T) {
+	t.Setenv("HTTP_PROXY", "http://proxy.example.com:3128")
+	t.Setenv("HTTPS_PROXY", "http://proxy.example.com:3128")
+	t.Setenv("NO_PROXY", "mirror.internal")
+
+	transport := NewHTTPTransportWithOptions(WithProxy("http://override.example.com:8080"))
+
+	proxy := resolveProxy(t, transport, "https://archive.ubuntu.com/ubuntu/dists/jammy/Release")
+	require.NotNil(t, proxy)
+	assert.Equal(t, "override.example.com:8080", proxy.Host)
+
+	assert.Nil(t, resolveProxy(t, transport, "http://mirror.internal/debian/dists/stable/Release"))
+}
+
+func TestHTTPTransport_NoProxyConfigured(t *testing.T) {
+	for _, name := range []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy"} {
+		t.Setenv(name, "")
+	}
+
+	transport := NewHTTPTransport()
+	assert.Nil(t, resolveProxy(t, transport, "https://archive.ubuntu.com/ubuntu/dists/jammy/Release"))
+}
+
+func TestHTTPTransport_Head(t *testing.T) {
+	var methods []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		switch r.URL.Path {
+		case "/Packages":
+			w.Header().Set("Content-Length", "1234")
+			w.Header().Set("Last-Modified", "Mon, 09 Jun 2025 12:00:00 GMT")
+		case "/nohead":
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	transport := NewHTTPTransport()
+	ctx := context.Background()
+
+	uri, err := url.Parse(server.URL + "/Packages")
+	require.NoError(t, err)
+	resp, err := transport.Head(ctx, uri)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1234), resp.Size)
+	assert.Nil(t, resp.Content)
+	require.NotNil(t, resp.LastModified)
+	assert.Equal(t, 2025, resp.LastModified.Year())
+
+	uri, err = url.Parse(server.URL + "/missing")
+	require.NoError(t, err)
+	_, err = transport.Head(ctx, uri)
+	var acquireErr *AcquireError
+	require.ErrorAs(t, err, &acquireErr)
+	assert.Contains(t, acquireErr.Reason, "HTTP 404")
+
+	uri, err = url.Parse(server.URL + "/nohead")
+	require.NoError(t, err)
+	_, err = transport.Head(ctx, uri)
+	assert.ErrorIs(t, err, ErrHeadNotSupported)
+
+	assert.Equal(t, []string{http.MethodHead, http.MethodHead, http.MethodHead}, methods)
+}
+
+func TestHTTPTransport_List(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/debian/dists/":
+			w.Header().Set("Content-Type", "text/html;charset=UTF-8")
+			fmt.Fprint(w, `<html><body><h1>Index of /debian/dists</h1>
+<a href="?C=N;O=D">Name</a>
+<a href="/debian/">Parent Directory</a>
+<a href="bookworm/">bookworm/</a>
+<a HREF='trixie/'>trixie/</a>
+<a href="/debian/dists/sid/">sid/</a>
+<a href="README">README</a>
+<a href="bookworm/Release">nested</a>
+<a href="https://example.com/elsewhere/">elsewhere</a>
+</body></html>`)
+		case "/s3/dists/":
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprint(w, `<ListBucketResult></ListBucketResult>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	transport := NewHTTPTransport()
+	ctx := context.Background()
+
+	uri, err := url.Parse(server.URL + "/debian/dists")
+	require.NoError(t, err)
+	names, err := transport.List(ctx, uri)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bookworm", "trixie", "sid", "README"}, names)
+
+	uri, err = url.Parse(server.URL + "/s3/dists")
+	require.NoError(t, err)
+	_, err = transport.List(ctx, uri)
+	assert.ErrorIs(t, err, ErrListNotSupported)
+
+	uri, err = url.Parse(server.URL + "/missing/dists")
+	require.NoError(t, err)
+	_, err = transport.List(ctx, uri)
+	var acquireErr *AcquireError
+	require.ErrorAs(t, err, &acquireErr)
+	assert.Contains(t, acquireErr.Reason, "HTTP 404")
+}
+
+func TestHTTPTransport_UserAgent(t *testing.T) {
+	var userAgents []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents = append(userAgents, r.Header.Get("User-Agent"))
+		fmt.Fprint(w, "Package: alpha\n")
+	}))
+	defer server.Close()
+
+	uri, err := url.Parse(server.URL + "/Packages")
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	for _, transport := range []*HTTPTransport{
+		NewHTTPTransport(),
+		NewHTTPTransportWithOptions(WithUserAgent("mirror-checker/2.0")),
+	} {
+		resp, err := transport.Acquire(ctx, &AcquireRequest{URI: uri})
+		require.NoError(t, err)
+		resp.Content.Close()
+	}
+
+	require.Len(t, userAgents, 2)
+	assert.Regexp(t, `^apt-look/\S+ \(\+https://github\.com/nicwaller/apt-look\)$`, userAgents[0])
+	assert.Equal(t, "mirror-checker/2.0", userAgents[1])
+}
+
+func TestHTTPTransport_ConcurrentTimeouts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		fmt.Fprint(w, "Package: alpha\n")
+	}))
+	defer server.Close()
+
+	uri, err := url.Parse(server.URL + "/Packages")
+	require.NoError(t, err)
+	transport := NewHTTPTransport()
+	ctx := context.Background()
+
+	// Run with -race: each request's timeout must not leak into the others
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		timeout := 10 * time.Second
+		if i%2 == 0 {
+			timeout = 20 * time.Millisecond
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := transport.Acquire(ctx, &AcquireRequest{URI: uri, Timeout: timeout})
+			if err == nil {
+				resp.Content.Close()
+			}
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if i%2 == 0 {
+			assert.ErrorIs(t, err, context.DeadlineExceeded, "request %d", i)
+		} else {
+			assert.NoError(t, err, "request %d", i)
+		}
+	}
+}
+
+func TestHTTPTransport_TimeoutSparesStreamedBody(t *testing.T) {
+	// the headers arrive at once, but the body takes longer than the timeout
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Package: alpha\n"))
+		w.(http.Flusher).Flush()
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("Version: 1.0\n"))
+	}))
+	defer server.Close()
+
+	uri, err := url.Parse(server.URL + "/Packages")
+	require.NoError(t, err)
+	transport := NewHTTPTransport()
+	resp, err := transport.Acquire(context.Background(), &AcquireRequest{URI: uri, Timeout: 20 * time.Millisecond})
+	require.NoError(t, err)
+	defer resp.Content.Close()
+
+	content, err := io.ReadAll(resp.Content)
+	require.NoError(t, err)
+	assert.Equal(t, "Package: alpha\nVersion: 1.0\n", string(content))
+}
+
+func TestHTTPTransport_Redirects(t *testing.T) {
+	// /hop/3 redirects to /hop/2 and so on, down to /hop/0 which serves the content
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/hop/"))
+		require.NoError(t, err)
+		if n > 0 {
+			http.Redirect(w, r, fmt.Sprintf("/hop/%d", n-1), http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, "Package: test\n")
+	}))
+	t.Cleanup(server.Close)
+
+	uri, err := url.Parse(server.URL + "/hop/3")
+	require.NoError(t, err)
+
+	t.Run("followed", func(t *testing.T) {
+		transport := NewHTTPTransportWithOptions(WithMaxRedirects(3))
+		resp, err := transport.Acquire(context.Background(), &AcquireRequest{URI: uri})
+		require.NoError(t, err)
+		defer resp.Content.Close()
+
+		content, err := io.ReadAll(resp.Content)
+		require.NoError(t, err)
+		assert.Equal(t, "Package: test\n", string(content))
+		assert.Equal(t, server.URL+"/hop/0", resp.URI.String(), "the response reports the final URL")
+
+		head, err := transport.Head(context.Background(), uri)
+		require.NoError(t, err)
+		assert.Equal(t, server.URL+"/hop/0", head.URI.String())
+	})
+
+	t.Run("too many", func(t *testing.T) {
+		hits.Store(0)
+		transport := NewHTTPTransportWithOptions(WithMaxRedirects(2), WithRetry(3, time.Millisecond))
+		_, err := transport.Acquire(context.Background(), &AcquireRequest{URI: uri})
+		assert.ErrorIs(t, err, ErrTooManyRedirects)
+		assert.Equal(t, int32(3), hits.Load(), "redirect loops aren't retried")
+	})
+
+	t.Run("refused", func(t *testing.T) {
+		transport := NewHTTPTransportWithOptions(WithMaxRedirects(0))
+		_, err := transport.Acquire(context.Background(), &AcquireRequest{URI: uri})
+		assert.ErrorIs(t, err, ErrTooManyRedirects)
+	})
+}
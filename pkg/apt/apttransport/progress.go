@@ -0,0 +1,148 @@
+package apttransport
+
+import (
+	"slices"
+	"sync"
+)
+
+// Progress sums the progress of many transfers, which may run concurrently, so that a command
+// fetching several files can show how far along it is overall. Transports report to it through
+// the ProgressCallback of each request, so it works with any transport.
+type Progress struct {
+	mu       sync.Mutex
+	render   func(ProgressState)
+	state    ProgressState
+	reserved int
+	active   []*Transfer
+}
+
+// ProgressState is a snapshot of the transfers tracked by a Progress
+type ProgressState struct {
+	// Files counts the transfers started or expected, and Completed those that are done
+	Files     int
+	Completed int
+
+	// Downloaded and Total are summed over all transfers; Total only includes sizes known so far
+	Downloaded int64
+	Total      int64
+
+	// Current is the name of the transfer that most recently made progress, if any is still running
+	Current           string
+	CurrentDownloaded int64
+	CurrentTotal      int64
+}
+
+// NewProgress creates a Progress that calls render with the new state after every change.
+// render is called with a lock held, so it must not call back into the Progress. It may be nil.
+func NewProgress(render func(ProgressState)) *Progress {
+	return &Progress{render: render}
+}
+
+// Expect announces transfers that are about to start, so the totals include them from the outset.
+// The next files transfers to start are counted against it rather than added again.
+func (p *Progress) Expect(files int, bytes int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reserved += files
+	p.state.Files += files
+	p.state.Total += bytes
+	p.update()
+}
+
+// Start begins tracking a transfer of size bytes, or of unknown size when it is zero.
+// Done must be called when the transfer finishes, whether or not it succeeded.
+func (p *Progress) Start(name string, size int64) *Transfer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.reserved > 0 {
+		p.reserved--
+	} else {
+		p.state.Files++
+		p.state.Total += size
+	}
+	t := &Transfer{progress: p, name: name, size: size}
+	p.active = append(p.active, t)
+	p.update()
+	return t
+}
+
+// State returns the current state
+func (p *Progress) State() ProgressState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state
+}
+
+// update refreshes the current transfer and renders the state; p.mu must be held
+func (p *Progress) update() {
+	p.state.Current, p.state.CurrentDownloaded, p.state.CurrentTotal = "", 0, 0
+	if len(p.active) > 0 {
+		current := p.active[len(p.active)-1]
+		p.state.Current, p.state.CurrentDownloaded, p.state.CurrentTotal = current.name, current.downloaded, current.size
+	}
+	if p.render != nil {
+		p.render(p.state)
+	}
+}
+
+// Transfer is one file tracked by a Progress
+type Transfer struct {
+	progress   *Progress
+	name       string
+	size       int64
+	downloaded int64
+	done       bool
+}
+
+// Callback returns a ProgressCallback that reports to the Progress, and to next as well when it
+// isn't nil, so per-file callbacks keep working alongside the overall progress
+func (t *Transfer) Callback(next func(downloaded, total int64)) func(downloaded, total int64) {
+	return func(downloaded, total int64) {
+		t.report(downloaded, total)
+		if next != nil {
+			next(downloaded, total)
+		}
+	}
+}
+
+func (t *Transfer) report(downloaded, total int64) {
+	p := t.progress
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t.done {
+		return
+	}
+	// the transport knows the size better than the caller, e.g. when it wasn't known in advance.
+	// A fetch that is retried elsewhere starts again from zero, so the counts can go down.
+	if total > 0 && total != t.size {
+		p.state.Total += total - t.size
+		t.size = total
+	}
+	p.state.Downloaded += downloaded - t.downloaded
+	t.downloaded = downloaded
+
+	// the most recently updated transfer is the one shown as current
+	if i := slices.Index(p.active, t); i >= 0 && i != len(p.active)-1 {
+		p.active = append(slices.Delete(p.active, i, i+1), t)
+	}
+	p.update()
+}
+
+// Done marks the transfer as finished. Its whole size counts as done, including files that
+// weren't downloaded at all, such as those served from a cache or already up to date.
+func (t *Transfer) Done() {
+	p := t.progress
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t.done {
+		return
+	}
+	t.done = true
+	if t.size > t.downloaded {
+		p.state.Downloaded += t.size - t.downloaded
+		t.downloaded = t.size
+	}
+	p.state.Completed++
+	p.active = slices.DeleteFunc(p.active, func(active *Transfer) bool { return active == t })
+	p.update()
+}
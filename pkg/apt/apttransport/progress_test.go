@@ -0,0 +1,88 @@
+package apttransport
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgress(t *testing.T) {
+	var states []ProgressState
+	progress := NewProgress(func(state ProgressState) {
+		states = append(states, state)
+	})
+
+	progress.Expect(2, 300)
+	a := progress.Start("a", 100)
+	b := progress.Start("b", 200)
+	// a third transfer wasn't expected, and its size is only known once it starts
+	c := progress.Start("c", 0)
+	assert.Equal(t, ProgressState{Files: 3, Total: 300, Current: "c"}, progress.State())
+
+	a.Callback(nil)(50, 100)
+	assert.Equal(t, ProgressState{Files: 3, Downloaded: 50, Total: 300, Current: "a", CurrentDownloaded: 50, CurrentTotal: 100}, progress.State())
+
+	c.Callback(nil)(10, 400)
+	assert.Equal(t, int64(700), progress.State().Total)
+	assert.Equal(t, "c", progress.State().Current)
+
+	// b was served from a cache without any progress, and still counts as fetched
+	b.Done()
+	c.Done()
+	c.Done()
+	state := progress.State()
+	assert.Equal(t, 2, state.Completed)
+	assert.Equal(t, int64(650), state.Downloaded)
+	assert.Equal(t, "a", state.Current)
+
+	a.Callback(nil)(100, 100)
+	a.Done()
+	assert.Equal(t, ProgressState{Files: 3, Completed: 3, Downloaded: 700, Total: 700}, progress.State())
+	assert.Equal(t, progress.State(), states[len(states)-1])
+}
+
+func TestProgress_Concurrent(t *testing.T) {
+	dir := t.TempDir()
+	content := make([]byte, 100_000)
+	var wg sync.WaitGroup
+	progress := NewProgress(nil)
+	progress.Expect(8, 8*int64(len(content)))
+
+	transport := NewFileTransport()
+	perFile := make([]int64, 8)
+	for i := range perFile {
+		path := filepath.Join(dir, string(rune('a'+i)))
+		require.NoError(t, os.WriteFile(path, content, 0644))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			transfer := progress.Start(path, int64(len(content)))
+			defer transfer.Done()
+			req := &AcquireRequest{
+				URI: &url.URL{Scheme: "file", Path: path},
+				// the per-file callback still sees the progress of its own file
+				ProgressCallback: transfer.Callback(func(downloaded, total int64) { perFile[i] = downloaded }),
+			}
+			resp, err := transport.Acquire(context.Background(), req)
+			if assert.NoError(t, err) {
+				_, err = io.Copy(io.Discard, resp.Content)
+				assert.NoError(t, err)
+				resp.Content.Close()
+			}
+		}()
+	}
+	wg.Wait()
+
+	state := progress.State()
+	assert.Equal(t, ProgressState{Files: 8, Completed: 8, Downloaded: 800_000, Total: 800_000}, state)
+	for _, downloaded := range perFile {
+		assert.Equal(t, int64(len(content)), downloaded)
+	}
+}
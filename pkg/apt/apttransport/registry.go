@@ -1,17 +1,48 @@
 package apttransport
 
 import (
+	"cmp"
 	"context"
 	"errors"
+	"net/url"
+	"slices"
 	"sync"
+	"time"
 )
 
-var DefaultRegistry = NewRegistryWithCache(CacheConfig{})
+var _ Transport = &Registry{}
+var _ HeadTransport = &Registry{}
+var _ ListTransport = &Registry{}
 
-func init() {
-	// TODO: do this better
-	DefaultRegistry.Register(NewHTTPTransport())
-	DefaultRegistry.Register(NewFileTransport())
+var DefaultRegistry = NewRegistryWithConfig(RegistryConfig{Cache: CacheConfig{TTL: DefaultCacheTTL}})
+
+// RegistryConfig configures the network behavior of a registry and the transports it creates
+type RegistryConfig struct {
+	Cache CacheConfig
+
+	// Timeout bounds each request that doesn't set AcquireRequest.Timeout itself.
+	// Zero leaves it to the transport, which is DefaultTimeout for HTTP.
+	Timeout time.Duration
+
+	// SchemeTimeouts overrides Timeout for particular schemes, e.g. a longer one for "s3"
+	SchemeTimeouts map[string]time.Duration
+
+	// Retries is how many times failed HTTP requests are retried, with backoff starting at one second
+	Retries int
+
+	// MaxRedirects is how many redirects an HTTP request follows. Zero leaves it at DefaultMaxRedirects,
+	// and a negative value follows none.
+	MaxRedirects int
+
+	// UserAgent replaces the default User-Agent of HTTP requests when set
+	UserAgent string
+
+	// Proxy overrides HTTP_PROXY and HTTPS_PROXY when set
+	Proxy string
+
+	// RateLimit caps how fast each request's content is read, in bytes per second, whatever
+	// transport fetches it. Zero is unlimited.
+	RateLimit int64
 }
 
 // Registry manages multiple transport implementations with optional caching
@@ -19,6 +50,9 @@ type Registry struct {
 	transports       map[string]Transport
 	cachedTransports map[string]*CacheTransport
 	cacheConfig      CacheConfig
+	timeout          time.Duration
+	schemeTimeouts   map[string]time.Duration
+	rateLimit        int64
 	mu               sync.RWMutex
 }
 
@@ -39,6 +73,30 @@ func NewRegistryWithCache(config CacheConfig) *Registry {
 	}
 }
 
+// NewRegistryWithConfig creates a registry with the HTTP, file and S3 transports registered,
+// configured from config
+func NewRegistryWithConfig(config RegistryConfig) *Registry {
+	r := NewRegistryWithCache(config.Cache)
+	r.timeout = config.Timeout
+	r.schemeTimeouts = config.SchemeTimeouts
+	r.rateLimit = config.RateLimit
+
+	httpOpts := []HTTPOption{WithRetry(config.Retries, time.Second)}
+	if config.UserAgent != "" {
+		httpOpts = append(httpOpts, WithUserAgent(config.UserAgent))
+	}
+	if config.Proxy != "" {
+		httpOpts = append(httpOpts, WithProxy(config.Proxy))
+	}
+	if config.MaxRedirects != 0 {
+		httpOpts = append(httpOpts, WithMaxRedirects(max(config.MaxRedirects, 0)))
+	}
+	r.Register(NewHTTPTransportWithOptions(httpOpts...))
+	r.Register(NewFileTransport())
+	r.Register(NewS3Transport())
+	return r
+}
+
 // Register adds a transport for a specific scheme
 func (r *Registry) Register(transport Transport) {
 	for _, scheme := range transport.Schemes() {
@@ -51,6 +109,19 @@ func (r *Registry) SetCacheConfig(config CacheConfig) {
 	r.cacheConfig = config
 }
 
+// Schemes returns all schemes handled by registered transports
+func (r *Registry) Schemes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	schemes := make([]string, 0, len(r.transports))
+	for scheme := range r.transports {
+		schemes = append(schemes, scheme)
+	}
+	slices.Sort(schemes)
+	return schemes
+}
+
 func (r *Registry) Select(scheme string) (Transport, error) {
 	t, ok := r.transports[scheme]
 	if !ok {
@@ -68,6 +139,14 @@ func (r *Registry) Acquire(ctx context.Context, req *AcquireRequest) (*AcquireRe
 		return nil, &UnsupportedSchemeError{Scheme: req.URI.Scheme}
 	}
 
+	timeout := r.timeoutFor(req.URI.Scheme)
+	if (req.Timeout == 0 && timeout > 0) || (req.RateLimit == 0 && r.rateLimit > 0) {
+		configured := *req
+		configured.Timeout = cmp.Or(req.Timeout, timeout)
+		configured.RateLimit = cmp.Or(req.RateLimit, r.rateLimit)
+		req = &configured
+	}
+
 	// Use cached transport if caching is enabled
 	if !r.cacheConfig.Disabled {
 		r.mu.Lock()
@@ -90,6 +169,85 @@ func (r *Registry) Acquire(ctx context.Context, req *AcquireRequest) (*AcquireRe
 	return transport.Acquire(ctx, req)
 }
 
+// Head forwards to the transport registered for the scheme, bypassing the cache so the
+// answer reflects the server. Transports without HEAD support yield ErrHeadNotSupported.
+func (r *Registry) Head(ctx context.Context, uri *url.URL) (*AcquireResponse, error) {
+	r.mu.RLock()
+	transport, exists := r.transports[uri.Scheme]
+	r.mu.RUnlock()
+
+	if !exists {
+		return nil, &UnsupportedSchemeError{Scheme: uri.Scheme}
+	}
+
+	headTransport, ok := transport.(HeadTransport)
+	if !ok {
+		return nil, ErrHeadNotSupported
+	}
+	if timeout := r.timeoutFor(uri.Scheme); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return headTransport.Head(ctx, uri)
+}
+
+// List forwards to the transport registered for the scheme. Transports that can't list
+// directories yield ErrListNotSupported.
+func (r *Registry) List(ctx context.Context, uri *url.URL) ([]string, error) {
+	r.mu.RLock()
+	transport, exists := r.transports[uri.Scheme]
+	r.mu.RUnlock()
+
+	if !exists {
+		return nil, &UnsupportedSchemeError{Scheme: uri.Scheme}
+	}
+
+	listTransport, ok := transport.(ListTransport)
+	if !ok {
+		return nil, ErrListNotSupported
+	}
+	if timeout := r.timeoutFor(uri.Scheme); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return listTransport.List(ctx, uri)
+}
+
+// timeoutFor returns the configured timeout for requests with the scheme, or zero if there is none
+func (r *Registry) timeoutFor(scheme string) time.Duration {
+	if timeout, ok := r.schemeTimeouts[scheme]; ok {
+		return timeout
+	}
+	return r.timeout
+}
+
+// Close closes every registered transport, including those that handle several schemes and
+// the caches wrapping them, exactly once. The cache's hits and misses are added to those of earlier runs.
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	errs := []error{r.saveCacheStats()}
+
+	closed := make(map[Transport]bool)
+	for _, cachedTransport := range r.cachedTransports {
+		if !closed[cachedTransport.wrapped] {
+			closed[cachedTransport.wrapped] = true
+			errs = append(errs, cachedTransport.Close())
+		}
+	}
+	for _, transport := range r.transports {
+		if !closed[transport] {
+			closed[transport] = true
+			errs = append(errs, transport.Close())
+		}
+	}
+	clear(r.cachedTransports)
+	return errors.Join(errs...)
+}
+
 // PurgeCache removes all cached files (if caching is enabled)
 func (r *Registry) PurgeCache() error {
 	if r.cacheConfig.Disabled {
@@ -106,6 +264,59 @@ func (r *Registry) PurgeCache() error {
 	return cacheTransport.PurgeCache()
 }
 
+// PurgeCacheEntries removes the cached files of the given URIs (if caching is enabled), and returns how many
+// were removed
+func (r *Registry) PurgeCacheEntries(uris []*url.URL) (int, error) {
+	if r.cacheConfig.Disabled {
+		return 0, nil
+	}
+
+	cacheTransport, err := NewCacheTransport(NewFileTransport(), r.cacheConfig)
+	if err != nil {
+		return 0, err
+	}
+
+	return cacheTransport.PurgeEntries(uris)
+}
+
+// Offline returns a transport that serves whatever the registry's cache holds, however old, and
+// fetches nothing. Requests for anything else yield ErrNotCached.
+func (r *Registry) Offline() Transport {
+	t := offlineTransport{registry: r}
+	if !r.cacheConfig.Disabled {
+		// the wrapped transport is never used, so any transport will do
+		t.cache, t.err = NewCacheTransport(NewFileTransport(), r.cacheConfig)
+	}
+	return t
+}
+
+// offlineTransport answers requests from a registry's cache directory
+type offlineTransport struct {
+	registry *Registry
+	// cache looks up the entries, or is nil when caching is disabled or err stopped it from being set up
+	cache *CacheTransport
+	err   error
+}
+
+func (t offlineTransport) Schemes() []string {
+	return t.registry.Schemes()
+}
+
+func (t offlineTransport) Acquire(ctx context.Context, req *AcquireRequest) (*AcquireResponse, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+	if t.cache == nil {
+		return nil, ErrNotCached
+	}
+	return t.cache.Lookup(req)
+}
+
+// Close does nothing, since the registry owns the transports
+func (t offlineTransport) Close() error {
+	return nil
+}
+
 // GetCacheStats returns aggregate cache statistics across all cached transports
 func (r *Registry) GetCacheStats() (hits, misses int64, hitRatio float64) {
 	if r.cacheConfig.Disabled {
@@ -0,0 +1,112 @@
+package apttransport
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// timeoutRecorder records the timeout and rate limit of each request it receives, and how often it was closed
+type timeoutRecorder struct {
+	schemes    []string
+	timeouts   []time.Duration
+	rateLimits []int64
+	closed     int
+}
+
+func (r *timeoutRecorder) Schemes() []string {
+	return r.schemes
+}
+
+func (r *timeoutRecorder) Acquire(ctx context.Context, req *AcquireRequest) (*AcquireResponse, error) {
+	r.timeouts = append(r.timeouts, req.Timeout)
+	r.rateLimits = append(r.rateLimits, req.RateLimit)
+	return &AcquireResponse{URI: req.URI}, nil
+}
+
+func (r *timeoutRecorder) Close() error {
+	r.closed++
+	return nil
+}
+
+func TestRegistry_Schemes(t *testing.T) {
+	registry := NewRegistryWithCache(CacheConfig{Disabled: true})
+	registry.Register(newMockTransport())
+	registry.Register(NewFileTransport())
+
+	assert.Equal(t, []string{"file", "mock"}, registry.Schemes())
+}
+
+func TestRegistry_Timeouts(t *testing.T) {
+	registry := NewRegistryWithConfig(RegistryConfig{
+		Cache:          CacheConfig{Disabled: true},
+		Timeout:        15 * time.Second,
+		SchemeTimeouts: map[string]time.Duration{"slow": time.Minute},
+	})
+	fast := &timeoutRecorder{schemes: []string{"fast"}}
+	slow := &timeoutRecorder{schemes: []string{"slow"}}
+	registry.Register(fast)
+	registry.Register(slow)
+	ctx := context.Background()
+
+	fastURI, err := url.Parse("fast://example.com/Packages")
+	require.NoError(t, err)
+	slowURI, err := url.Parse("slow://example.com/Packages")
+	require.NoError(t, err)
+
+	_, err = registry.Acquire(ctx, &AcquireRequest{URI: fastURI})
+	require.NoError(t, err)
+	_, err = registry.Acquire(ctx, &AcquireRequest{URI: fastURI, Timeout: time.Second})
+	require.NoError(t, err)
+	_, err = registry.Acquire(ctx, &AcquireRequest{URI: slowURI})
+	require.NoError(t, err)
+
+	assert.Equal(t, []time.Duration{15 * time.Second, time.Second}, fast.timeouts)
+	assert.Equal(t, []time.Duration{time.Minute}, slow.timeouts)
+}
+
+func TestRegistry_RateLimit(t *testing.T) {
+	registry := NewRegistryWithConfig(RegistryConfig{Cache: CacheConfig{Disabled: true}, RateLimit: 100_000})
+	recorder := &timeoutRecorder{schemes: []string{"ftp"}}
+	registry.Register(recorder)
+	ctx := context.Background()
+
+	uri, err := url.Parse("ftp://example.com/Packages")
+	require.NoError(t, err)
+	_, err = registry.Acquire(ctx, &AcquireRequest{URI: uri})
+	require.NoError(t, err)
+	_, err = registry.Acquire(ctx, &AcquireRequest{URI: uri, RateLimit: 5_000})
+	require.NoError(t, err)
+
+	// transports registered later, such as apt methods, get the limit too
+	assert.Equal(t, []int64{100_000, 5_000}, recorder.rateLimits)
+}
+
+func TestNewRegistryWithConfig_Schemes(t *testing.T) {
+	registry := NewRegistryWithConfig(RegistryConfig{Cache: CacheConfig{Disabled: true}})
+	assert.Equal(t, []string{"file", "http", "https", "s3"}, registry.Schemes())
+}
+
+func TestRegistry_Close(t *testing.T) {
+	registry := NewRegistryWithCache(CacheConfig{CacheDir: t.TempDir()})
+	both := &timeoutRecorder{schemes: []string{"one", "two"}}
+	other := &timeoutRecorder{schemes: []string{"three"}}
+	registry.Register(both)
+	registry.Register(other)
+
+	// each scheme gets its own cache, wrapping the same transport
+	for _, uri := range []string{"one://example.com/Packages", "two://example.com/Packages"} {
+		parsed, err := url.Parse(uri)
+		require.NoError(t, err)
+		_, err = registry.Acquire(context.Background(), &AcquireRequest{URI: parsed})
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, registry.Close())
+	assert.Equal(t, 1, both.closed)
+	assert.Equal(t, 1, other.closed)
+}
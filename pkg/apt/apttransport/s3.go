@@ -0,0 +1,413 @@
+package apttransport
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ Transport = &S3Transport{}
+
+// emptyPayloadHash is the SHA-256 of an empty body, which is what GET requests send
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3Transport fetches objects from s3://bucket/key URLs over HTTPS.
+// Requests are signed with Signature Version 4 using credentials from the environment
+// (AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN) or the shared credentials file;
+// when none are available the requests are sent anonymously, which works for public buckets.
+type S3Transport struct {
+	// region is used for every bucket when set; otherwise each bucket's region is looked up
+	region string
+	// endpoint replaces the AWS endpoint and switches to path-style addressing, for tests and
+	// S3-compatible services
+	endpoint string
+
+	client *http.Client
+
+	mu          sync.Mutex
+	credentials *s3Credentials // nil for anonymous requests
+	loaded      bool
+	regions     map[string]string // bucket -> region
+}
+
+// s3Credentials are the keys requests are signed with
+type s3Credentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// S3Option is a functional option for configuring an S3Transport
+type S3Option func(*S3Transport)
+
+// WithRegion sends all requests to the given region instead of looking up each bucket's region
+func WithRegion(region string) S3Option {
+	return func(t *S3Transport) {
+		t.region = region
+	}
+}
+
+// NewS3Transport creates an S3Transport configured by the given options
+func NewS3Transport(opts ...S3Option) *S3Transport {
+	t := &S3Transport{
+		client:  &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()},
+		regions: make(map[string]string),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+func (t *S3Transport) Schemes() []string {
+	return []string{"s3"}
+}
+
+// Close closes idle connections and forgets the credentials and bucket regions, so that any
+// later request looks them up again
+func (t *S3Transport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.client.CloseIdleConnections()
+	t.credentials = nil
+	t.loaded = false
+	clear(t.regions)
+	return nil
+}
+
+func (t *S3Transport) Acquire(ctx context.Context, req *AcquireRequest) (*AcquireResponse, error) {
+	bucket := req.URI.Host
+	key := strings.TrimPrefix(req.URI.Path, "/")
+	if bucket == "" || key == "" {
+		return nil, &AcquireError{
+			URI:    req.URI,
+			Reason: "S3 URL must name a bucket and key",
+			Err:    nil,
+		}
+	}
+
+	// the timeout covers the wait for a response; the context then lives until the content is closed
+	ctx, cancel := context.WithCancel(ctx)
+	var timer *responseTimer
+	if req.Timeout > 0 {
+		timer = startResponseTimer(req.Timeout, cancel)
+		defer timer.stop()
+	}
+	streaming := false
+	defer func() {
+		if !streaming {
+			cancel()
+		}
+	}()
+
+	credentials, region, err := t.configure(ctx, bucket)
+	if err != nil {
+		return nil, &AcquireError{
+			URI:    req.URI,
+			Reason: "failed to configure S3 client",
+			Err:    err,
+		}
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, t.objectURL(bucket, key, region), nil)
+	if err != nil {
+		return nil, &AcquireError{
+			URI:    req.URI,
+			Reason: "failed to create request",
+			Err:    err,
+		}
+	}
+	if req.LastModified != nil {
+		httpReq.Header.Set("If-Modified-Since", req.LastModified.UTC().Format(http.TimeFormat))
+	}
+	if req.ETag != "" {
+		httpReq.Header.Set("If-None-Match", req.ETag)
+	}
+	if credentials != nil {
+		signS3Request(httpReq, credentials, region, time.Now())
+	}
+
+	resp, err := t.client.Do(httpReq)
+	if err == nil && !timer.stop() {
+		resp.Body.Close()
+		err = ctx.Err()
+	}
+	if err != nil {
+		return nil, &AcquireError{
+			URI:    req.URI,
+			Reason: "request failed",
+			Err:    timer.wrap(err),
+		}
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		return &AcquireResponse{
+			URI:          req.URI,
+			Headers:      map[string]string{"ETag": resp.Header.Get("ETag")},
+			LastModified: req.LastModified,
+		}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &AcquireError{
+			URI:    req.URI,
+			Reason: fmt.Sprintf("HTTP %d", resp.StatusCode),
+			Err:    nil,
+		}
+	}
+
+	response := &AcquireResponse{
+		URI:          req.URI,
+		Size:         max(resp.ContentLength, 0),
+		LastModified: parseLastModified(resp.Header.Get("Last-Modified")),
+		Headers:      map[string]string{"ETag": resp.Header.Get("ETag")},
+	}
+
+	body := limitRate(ctx, resp.Body, req.RateLimit)
+	if req.Filename != "" {
+		return saveToFile(body, response, req)
+	}
+
+	streaming = true
+	response.Content = newVerifyingReader(body, response, req, cancel)
+	return response, nil
+}
+
+// objectURL is the HTTPS URL of an object. Buckets are addressed by host name, except behind a
+// custom endpoint or when the name has dots, which the wildcard certificate doesn't cover.
+func (t *S3Transport) objectURL(bucket, key, region string) string {
+	switch {
+	case t.endpoint != "":
+		return strings.TrimSuffix(t.endpoint, "/") + "/" + bucket + "/" + s3EscapePath(key)
+	case strings.Contains(bucket, "."):
+		return "https://s3." + region + ".amazonaws.com/" + bucket + "/" + s3EscapePath(key)
+	default:
+		return "https://" + bucket + ".s3." + region + ".amazonaws.com/" + s3EscapePath(key)
+	}
+}
+
+// configure returns the credentials to sign with and the region of the bucket, loading or
+// looking them up on first use
+func (t *S3Transport) configure(ctx context.Context, bucket string) (*s3Credentials, string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.loaded {
+		credentials, err := loadS3Credentials()
+		if err != nil {
+			return nil, "", err
+		}
+		t.credentials = credentials
+		t.loaded = true
+	}
+
+	region, ok := t.regions[bucket]
+	if !ok {
+		region = t.region
+		if region == "" && t.endpoint == "" {
+			var err error
+			if region, err = lookupBucketRegion(ctx, bucket); err != nil {
+				return nil, "", err
+			}
+		}
+		if region == "" {
+			region = "us-east-1"
+		}
+		t.regions[bucket] = region
+	}
+	return t.credentials, region, nil
+}
+
+// loadS3Credentials reads the keys from the environment, or else from the profile named by
+// AWS_PROFILE in the shared credentials file. It returns nil when there are none.
+func loadS3Credentials() (*s3Credentials, error) {
+	if id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); id != "" && secret != "" {
+		return &s3Credentials{accessKeyID: id, secretAccessKey: secret, sessionToken: os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil
+		}
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shared credentials file: %w", err)
+	}
+	defer f.Close()
+
+	var credentials s3Credentials
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok || section != profile {
+			continue
+		}
+		switch strings.TrimSpace(name) {
+		case "aws_access_key_id":
+			credentials.accessKeyID = strings.TrimSpace(value)
+		case "aws_secret_access_key":
+			credentials.secretAccessKey = strings.TrimSpace(value)
+		case "aws_session_token":
+			credentials.sessionToken = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read shared credentials file: %w", err)
+	}
+	if credentials.accessKeyID == "" || credentials.secretAccessKey == "" {
+		return nil, nil
+	}
+	return &credentials, nil
+}
+
+// signS3Request adds a Signature Version 4 Authorization header to a request without a body.
+// The host, any Range header and the x-amz-* headers are signed.
+func signS3Request(req *http.Request, credentials *s3Credentials, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	if credentials.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", credentials.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "range" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+
+	scope := day + "/" + region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex(canonicalRequest)}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+credentials.secretAccessKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		credentials.accessKeyID, scope, signedHeaders, signature))
+}
+
+// s3CanonicalQuery sorts and escapes query parameters the way Signature Version 4 expects
+func s3CanonicalQuery(query url.Values) string {
+	var params []string
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, s3Escape(name, false)+"="+s3Escape(value, false))
+		}
+	}
+	slices.Sort(params)
+	return strings.Join(params, "&")
+}
+
+// s3EscapePath escapes an object key for the URL path, keeping the slashes
+func s3EscapePath(key string) string {
+	return s3Escape(key, true)
+}
+
+// s3Escape percent-encodes everything but unreserved characters, and slashes when keepSlash is set
+func s3Escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// lookupBucketRegion asks S3 where a bucket lives. The x-amz-bucket-region header is sent
+// even when the request is redirected or denied, so no credentials are needed.
+func lookupBucketRegion(ctx context.Context, bucket string) (string, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodHead, "https://s3.amazonaws.com/"+bucket, nil)
+	if err != nil {
+		return "", err
+	}
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up region of bucket %s: %w", bucket, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("bucket %s does not exist", bucket)
+	}
+	return resp.Header.Get("X-Amz-Bucket-Region"), nil
+}
@@ -0,0 +1,223 @@
+package apttransport
+
+import (
+	"context"
+	"fmt"
+	"hash"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// verifyingReader streams a response body, hashing it on the way. When the body has been read
+// to EOF the hashes and size are recorded in the response, and any mismatch with the expected
+// hashes is returned from Read instead of io.EOF, so consumers see it as a read error.
+type verifyingReader struct {
+	body     io.ReadCloser
+	reader   io.Reader
+	hashers  map[string]hash.Hash
+	response *AcquireResponse
+	req      *AcquireRequest
+	read     int64
+	err      error
+
+	// onClose releases anything held for the duration of the read, such as a request context
+	onClose func()
+}
+
+// newVerifyingReader streams body as the content of response. onClose may be nil.
+func newVerifyingReader(body io.ReadCloser, response *AcquireResponse, req *AcquireRequest, onClose func()) *verifyingReader {
+	hashers := make(map[string]hash.Hash)
+	writers := make([]io.Writer, 0, len(req.ExpectedHashes))
+	for algo := range req.ExpectedHashes {
+		if hasher := createHasher(algo); hasher != nil {
+			hashers[algo] = hasher
+			writers = append(writers, hasher)
+		}
+	}
+
+	var reader io.Reader = body
+	if req.ProgressCallback != nil {
+		reader = &progressReader{
+			reader:   body,
+			callback: req.ProgressCallback,
+			total:    response.Size,
+		}
+	}
+	if len(writers) > 0 {
+		reader = io.TeeReader(reader, io.MultiWriter(writers...))
+	}
+
+	response.Hashes = make(map[string]string)
+	r := &verifyingReader{
+		body:     body,
+		reader:   reader,
+		hashers:  hashers,
+		response: response,
+		req:      req,
+		onClose:  onClose,
+	}
+	// content of another size can't have the expected hashes, so it fails before any of it is read
+	// rather than at EOF, after consumers have already used it
+	if len(hashers) > 0 && req.ExpectedSize > 0 && response.Size > 0 && response.Size != req.ExpectedSize {
+		r.err = &AcquireError{
+			URI:    req.URI,
+			Reason: "hash verification failed",
+			Err:    fmt.Errorf("%w: %d bytes, expected %d", ErrHashMismatch, response.Size, req.ExpectedSize),
+		}
+	}
+	return r
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+	if err == io.EOF {
+		err = r.verify()
+	}
+	if err != nil {
+		r.err = err
+	}
+	return n, err
+}
+
+// verify records the hashes and size of the complete body and checks them against the request
+func (r *verifyingReader) verify() error {
+	for algo, hasher := range r.hashers {
+		r.response.Hashes[algo] = fmt.Sprintf("%x", hasher.Sum(nil))
+	}
+	r.response.Size = r.read
+
+	if err := verifyHashes(r.response.Hashes, r.req.ExpectedHashes); err != nil {
+		return &AcquireError{
+			URI:    r.req.URI,
+			Reason: "hash verification failed",
+			Err:    err,
+		}
+	}
+	return io.EOF
+}
+
+func (r *verifyingReader) Close() error {
+	err := r.body.Close()
+	if r.onClose != nil {
+		r.onClose()
+	}
+	return err
+}
+
+// contextReader fails reads once ctx is done, for bodies such as local files that don't watch a context
+type contextReader struct {
+	ctx context.Context
+	io.ReadCloser
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.ReadCloser.Read(p)
+}
+
+// responseTimer cancels a request that gets no response within its timeout. It is stopped once the
+// response headers arrive, so that a streamed body is read at the consumer's pace rather than against
+// the clock, which a slow consumer of a large index would otherwise run out of. A nil timer never fires.
+type responseTimer struct {
+	timeout time.Duration
+	timer   *time.Timer
+	fired   atomic.Bool
+}
+
+// startResponseTimer calls cancel if the timer isn't stopped within timeout
+func startResponseTimer(timeout time.Duration, cancel context.CancelFunc) *responseTimer {
+	rt := &responseTimer{timeout: timeout}
+	rt.timer = time.AfterFunc(timeout, func() {
+		rt.fired.Store(true)
+		cancel()
+	})
+	return rt
+}
+
+// stop ends the timer once a response has arrived, reporting false if it had already fired
+func (rt *responseTimer) stop() bool {
+	if rt == nil {
+		return true
+	}
+	return rt.timer.Stop()
+}
+
+// wrap reports an error caused by the timer firing as a deadline error, as context.WithTimeout would
+func (rt *responseTimer) wrap(err error) error {
+	if rt != nil && rt.fired.Load() {
+		return fmt.Errorf("no response within %s: %w", rt.timeout, context.DeadlineExceeded)
+	}
+	return err
+}
+
+// rateLimitedReader throttles reads from a body to the rate of its bucket
+type rateLimitedReader struct {
+	ctx    context.Context
+	bucket *tokenBucket
+	io.ReadCloser
+}
+
+// limitRate wraps body so that it's read at no more than bytesPerSec, or returns it as is when
+// bytesPerSec is zero. Each body gets its own limit, so concurrent requests add up.
+func limitRate(ctx context.Context, body io.ReadCloser, bytesPerSec int64) io.ReadCloser {
+	if bytesPerSec <= 0 {
+		return body
+	}
+	// a burst of a tenth of a second keeps the rate smooth without making reads tiny
+	burst := max(bytesPerSec/10, 1)
+	return &rateLimitedReader{ctx: ctx, bucket: newTokenBucket(bytesPerSec, burst), ReadCloser: body}
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > r.bucket.burst {
+		p = p[:r.bucket.burst]
+	}
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		if waitErr := r.bucket.wait(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// tokenBucket holds up to burst tokens, refilled at rate tokens per second
+type tokenBucket struct {
+	rate   float64
+	burst  int64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a bucket that starts out full
+func newTokenBucket(rate, burst int64) *tokenBucket {
+	return &tokenBucket{rate: float64(rate), burst: burst, tokens: float64(burst), last: time.Now()}
+}
+
+// wait takes n tokens, sleeping until the bucket has refilled enough to cover them
+// or returning early with the context's error
+func (b *tokenBucket) wait(ctx context.Context, n int) error {
+	now := time.Now()
+	b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*b.rate, float64(b.burst))
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(time.Duration(-b.tokens / b.rate * float64(time.Second)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
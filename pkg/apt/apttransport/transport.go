@@ -2,6 +2,7 @@ package apttransport
 
 import (
 	"context"
+	"errors"
 	"io"
 	"net/url"
 	"time"
@@ -14,8 +15,33 @@ type Transport interface {
 
 	// Acquire fetches a resource from the given archiveRoot
 	Acquire(ctx context.Context, req *AcquireRequest) (*AcquireResponse, error)
+
+	// Close releases the resources held by the transport, such as idle connections.
+	// Transports that wrap another one close it too, unless they share it with others.
+	Close() error
+}
+
+// HeadTransport is implemented by transports that can report a resource's size and
+// modification time without downloading its content
+type HeadTransport interface {
+	// Head fetches the metadata of a resource; the response has no Content
+	Head(ctx context.Context, uri *url.URL) (*AcquireResponse, error)
 }
 
+// ListTransport is implemented by transports that can enumerate a directory, such as the file
+// transport or HTTP servers with directory index pages
+type ListTransport interface {
+	// List returns the names of the entries in the directory at uri, without any trailing slash
+	List(ctx context.Context, uri *url.URL) ([]string, error)
+}
+
+// ErrListNotSupported is returned by List when the transport or server can't enumerate directories
+var ErrListNotSupported = errors.New("directory listing not supported")
+
+// ErrHeadNotSupported is returned by Head when the transport or server can't answer a HEAD request;
+// callers should fall back to Acquire
+var ErrHeadNotSupported = errors.New("HEAD not supported")
+
 // AcquireRequest represents a request to fetch a resource
 type AcquireRequest struct {
 	// URI is the resource to fetch
@@ -27,6 +53,9 @@ type AcquireRequest struct {
 	// LastModified for conditional requests (optional)
 	LastModified *time.Time
 
+	// ETag of a previously fetched copy for conditional requests (optional)
+	ETag string
+
 	// ExpectedSize for validation (optional, 0 means unknown)
 	ExpectedSize int64
 
@@ -36,9 +65,12 @@ type AcquireRequest struct {
 	// Headers for additional request headers
 	Headers map[string]string
 
-	// Timeout for the request
+	// Timeout bounds the wait for a response; streamed content is then read at the consumer's pace
 	Timeout time.Duration
 
+	// RateLimit caps how fast the content is read, in bytes per second. Zero leaves it to the transport.
+	RateLimit int64
+
 	// ProgressCallback for reporting download progress (optional)
 	ProgressCallback func(downloaded, total int64)
 }
@@ -65,8 +97,14 @@ type AcquireResponse struct {
 
 	// Headers from the response
 	Headers map[string]string
+
+	// Cached reports whether the content was served from the cache rather than fetched
+	Cached bool
 }
 
+// ErrHashMismatch is wrapped by errors reporting content that doesn't match AcquireRequest.ExpectedHashes
+var ErrHashMismatch = errors.New("hash mismatch")
+
 type AcquireError struct {
 	URI    *url.URL
 	Reason string
@@ -81,6 +119,16 @@ func (e *AcquireError) Unwrap() error {
 	return e.Err
 }
 
+// IsNotFound reports whether an Acquire failed because the file doesn't exist, rather than because
+// fetching it failed
+func IsNotFound(err error) bool {
+	var acquireErr *AcquireError
+	if !errors.As(err, &acquireErr) {
+		return false
+	}
+	return acquireErr.Reason == "HTTP 404" || acquireErr.Reason == "file not found"
+}
+
 type UnsupportedSchemeError struct {
 	Scheme string
 }
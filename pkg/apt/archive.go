@@ -1,6 +1,8 @@
 package apt
 
 import (
+	"bytes"
+	"compress/bzip2"
 	"compress/gzip"
 	"context"
 	"errors"
@@ -8,12 +10,17 @@ import (
 	"io"
 	"iter"
 	"net/url"
+	"path"
 	"path/filepath"
-	"runtime"
 	"slices"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/klauspost/compress/zstd"
+	"github.com/rs/zerolog/log"
+	"github.com/ulikunitz/xz"
+
 	"github.com/nicwaller/apt-look/pkg/apt/apttransport"
 	"github.com/nicwaller/apt-look/pkg/apt/sources"
 	"github.com/nicwaller/apt-look/pkg/deb822"
@@ -24,6 +31,8 @@ type Repository struct {
 	transport   apttransport.Transport
 	archiveRoot *url.URL
 	distRoot    *url.URL
+	// deb or deb-src, which decides the indexes the repository is read for
+	sourceType sources.SourceType
 
 	// stuff we get from apt-get update
 	release  *deb822.Release // nil until Update
@@ -31,6 +40,17 @@ type Repository struct {
 	// file filtering
 	components    []string
 	architectures []string
+	// number of Packages indexes fetched in parallel
+	concurrency int
+	// overall progress of index fetches, if it is reported
+	progress *apttransport.Progress
+	// the files of each package by Contents architecture, built by the first PackageFiles call
+	packageFiles   map[string]map[string][]string
+	packageFilesMu sync.Mutex
+	// where uncompressed Packages indexes are kept for PDiff patching, if it is enabled
+	pdiffDir string
+	// where Packages indexes are kept for looking up packages by name, if it is enabled
+	indexCacheDir string
 }
 
 // curiously, a single source line with multiple components can yield
@@ -42,6 +62,25 @@ type MountOptions struct {
 	Components    []string
 	Transport     apttransport.Transport
 	Registry      *apttransport.Registry
+	Keyrings      []string
+	AllowUnsigned bool
+	Trusted       bool
+
+	StrictFreshness bool
+
+	Concurrency int
+
+	// Mirrors are alternative archive roots tried when the source's archive root fails
+	Mirrors []*url.URL
+
+	// Progress tracks the index files fetched by the repository
+	Progress *apttransport.Progress
+
+	// PDiffDir is where Packages indexes are kept to be patched with PDiff updates; empty disables PDiff
+	PDiffDir string
+
+	// IndexCacheDir is where Packages indexes are kept for looking up packages by name; empty disables it
+	IndexCacheDir string
 }
 
 // MountOption is a functional option for configuring Mount behavior
@@ -61,6 +100,31 @@ func WithTransport(transport apttransport.Transport) MountOption {
 	}
 }
 
+// WithStrictFreshness makes Mount fail when the Release file is past its Valid-Until date, instead of only warning
+func WithStrictFreshness() MountOption {
+	return func(opts *MountOptions) {
+		opts.StrictFreshness = true
+	}
+}
+
+// WithConcurrency sets how many Packages indexes are fetched in parallel.
+// Packages are still yielded in the same order as a sequential fetch. Unlike a sequential fetch, this
+// gives up streaming: each index is parsed in full, and held in memory until its packages are yielded,
+// so up to n whole indexes are held at once.
+func WithConcurrency(n int) MountOption {
+	return func(opts *MountOptions) {
+		opts.Concurrency = n
+	}
+}
+
+// WithProgress reports the fetches of index files to progress, which can be shared by several
+// repositories to show the overall progress of a command
+func WithProgress(progress *apttransport.Progress) MountOption {
+	return func(opts *MountOptions) {
+		opts.Progress = progress
+	}
+}
+
 // WithRegistry sets a specific transport registry to use for the repository
 func WithRegistry(registry *apttransport.Registry) MountOption {
 	return func(opts *MountOptions) {
@@ -68,20 +132,33 @@ func WithRegistry(registry *apttransport.Registry) MountOption {
 	}
 }
 
+// Mount opens the repository of a source entry and fetches its Release file, like MountContext without a deadline
 func Mount(source sources.Entry, optFns ...MountOption) (*Repository, error) {
+	return MountContext(context.Background(), source, optFns...)
+}
+
+// MountContext is like Mount, with a context that can cancel the fetches made while mounting
+func MountContext(ctx context.Context, source sources.Entry, optFns ...MountOption) (*Repository, error) {
 	opts := &MountOptions{}
 	for _, fn := range optFns {
 		fn(opts)
 	}
 
-	// Use provided architectures or detect from system
+	// Use provided architectures, or those of the source's arch option, or detect from system
 	architectures := opts.Architectures
 	if len(architectures) == 0 {
-		architectures = detectDebianArch()
+		architectures = source.Architectures()
+	}
+	if len(architectures) == 0 {
+		architectures = sources.DefaultArchitectures()
+	}
+
+	components, err := selectComponents(source.Components, opts.Components)
+	if err != nil {
+		return nil, err
 	}
 
 	// Use provided transport, or select from registry, or use default registry
-	var err error
 	var tpt apttransport.Transport
 
 	if opts.Transport != nil {
@@ -98,32 +175,38 @@ func Mount(source sources.Entry, optFns ...MountOption) (*Repository, error) {
 		}
 	}
 
-	var distRoot *url.URL
-	if slices.Contains([]string{".", "/"}, source.Distribution) {
-		// aha! this is a rare case called "Flat Repository Format" described here:
-		// https://wiki.debian.org/DebianRepository/Format
-		// I've only seen it once in the wild:
-		// deb https://pkgs.k8s.io/core:/stable:/v1.28/deb/ /
-		distRoot = source.ArchiveRoot.JoinPath(source.Distribution)
-	} else {
-		// this is the common case
-		distRoot = source.ArchiveRoot.JoinPath("dists", source.Distribution)
+	if len(opts.Mirrors) > 0 {
+		tpt = newMirrorTransport(tpt, source.ArchiveRoot, opts.Mirrors)
 	}
 
+	distRoot := distributionRoot(source.ArchiveRoot, source.Distribution)
+
 	// Fetch the Release file as part of mounting to validate the repository exists
-	ctx := context.Background()
-	resp, err := tpt.Acquire(ctx, &apttransport.AcquireRequest{
-		// TODO: add support for InRelease file
-		URI:     distRoot.JoinPath("Release"),
-		Timeout: 10 * time.Second,
-	})
+	releaseBytes, inRelease, err := fetchRelease(ctx, tpt, distRoot)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch Release file: %w", err)
 	}
 
+	// Verify the signature before trusting anything in the Release file
+	if opts.Trusted || source.Trusted() {
+		log.Debug().Str("uri", distRoot.String()).Msg("repository is trusted, skipping signature verification")
+	} else if paths := keyringPaths(opts, source); len(paths) > 0 {
+		keyring, err := loadKeyring(paths)
+		if err != nil {
+			return nil, err
+		}
+		if inRelease != nil {
+			err = verifyInRelease(inRelease, distRoot, keyring)
+		} else {
+			err = verifyRelease(ctx, tpt, distRoot, releaseBytes, keyring, opts.AllowUnsigned)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Parse the Release file
-	release, err := deb822.ParseRelease(resp.Content)
-	resp.Content.Close()
+	release, err := deb822.ParseRelease(bytes.NewReader(releaseBytes))
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse Release file: %w", err)
 	}
@@ -132,27 +215,182 @@ func Mount(source sources.Entry, optFns ...MountOption) (*Repository, error) {
 		transport:     tpt,
 		archiveRoot:   source.ArchiveRoot,
 		distRoot:      distRoot,
+		sourceType:    source.Type,
 		release:       release, // Now populated during mount
-		components:    slices.Clone(source.Components),
+		components:    components,
 		architectures: architectures,
+		concurrency:   opts.Concurrency,
+		progress:      opts.Progress,
+		pdiffDir:      opts.PDiffDir,
+		indexCacheDir: opts.IndexCacheDir,
+	}
+
+	// Like apt, refuse stale metadata; it can indicate a replay attack or an abandoned mirror
+	if err := r.CheckFreshness(time.Now()); err != nil {
+		if opts.StrictFreshness {
+			return nil, err
+		}
+		log.Warn().Msgf("%v", err)
 	}
+	r.warnUnhashedIndexes()
 
 	return r, nil
 }
 
+// isFlat reports whether a distribution names a directory of a flat repository rather than a suite in dists,
+// which is written with a trailing slash in sources.list, e.g. "/" or "subdir/", or as "."
+func isFlat(distribution string) bool {
+	return distribution == "." || strings.HasSuffix(distribution, "/")
+}
+
+// distributionRoot returns the directory holding the Release file of a distribution
+func distributionRoot(archiveRoot *url.URL, distribution string) *url.URL {
+	if isFlat(distribution) {
+		// aha! this is a rare case called "Flat Repository Format" described here:
+		// https://wiki.debian.org/DebianRepository/Format
+		// I've only seen it once in the wild:
+		// deb https://pkgs.k8s.io/core:/stable:/v1.28/deb/ /
+		return archiveRoot.JoinPath(distribution)
+	}
+	// this is the common case
+	return archiveRoot.JoinPath("dists", distribution)
+}
+
+// CheckFreshness returns an error if the Release file has a Valid-Until date before now
+func (r *Repository) CheckFreshness(now time.Time) error {
+	if r.release == nil || r.release.ValidUntil == nil {
+		return nil
+	}
+	if r.release.ValidUntil.Before(now) {
+		return fmt.Errorf("release file %s expired on %s", r.distRoot.JoinPath("Release"), r.release.ValidUntil.Format(time.RFC1123))
+	}
+	return nil
+}
+
+// UnhashedIndexes returns the Packages indexes that the Release file's Components and Architectures
+// promise for the selected components and architectures, but that its strongest hash section doesn't list,
+// e.g. universe/binary-amd64/Packages. Such an index is either never fetched or only checked against a
+// weaker hash, so it usually means the repository was published badly. For deb-src sources these are
+// the Sources indexes of the selected components instead, e.g. main/source/Sources.
+func (r *Repository) UnhashedIndexes() []string {
+	if r.release == nil {
+		return nil
+	}
+	entries := r.release.SHA256
+	if len(entries) == 0 {
+		entries = r.release.SHA1
+	}
+	if len(entries) == 0 {
+		entries = r.release.MD5Sum
+	}
+	hashed := make(map[string]bool)
+	for _, entry := range entries {
+		hashed[strings.TrimSuffix(entry.Path, path.Ext(entry.Path))] = true
+	}
+
+	var unhashed []string
+	for _, component := range r.components {
+		if !slices.Contains(r.release.Components, component) {
+			continue
+		}
+		if r.sourceType == sources.SourceTypeSrc {
+			if index := component + "/source/Sources"; !hashed[index] {
+				unhashed = append(unhashed, index)
+			}
+			continue
+		}
+		for _, arch := range r.architectures {
+			if !slices.Contains(r.release.Architectures, arch) {
+				continue
+			}
+			index := component + "/binary-" + arch + "/Packages"
+			if !hashed[index] {
+				unhashed = append(unhashed, index)
+			}
+		}
+	}
+	return unhashed
+}
+
+// warnUnhashedIndexes logs the indexes that UnhashedIndexes finds
+func (r *Repository) warnUnhashedIndexes() {
+	if unhashed := r.UnhashedIndexes(); len(unhashed) > 0 {
+		log.Warn().Strs("indexes", unhashed).Msgf("release file %s has no hashes for %s",
+			r.distRoot.JoinPath("Release"), strings.Join(unhashed, ", "))
+	}
+}
+
 // Release returns the Release metadata for the repository.
 // The Release file is fetched during mounting, so this should always return a valid result.
 func (r *Repository) Release() *deb822.Release {
 	return r.release
 }
 
-// WithComponents sets the components for MountURL (adds to MountOptions)
+// Architectures returns the architectures in the Release file that are selected for the repository,
+// or all of them if no architectures are selected. A Release file without an Architectures field, as
+// some flat repositories have, is taken to offer the architectures of its Packages indexes.
+func (r *Repository) Architectures() []string {
+	if r.release == nil {
+		return nil
+	}
+	available := r.release.Architectures
+	if len(available) == 0 {
+		available = r.GetAvailableArchitectures(r.components)
+	}
+	if len(r.architectures) == 0 {
+		return slices.Clone(available)
+	}
+	var archs []string
+	for _, arch := range available {
+		if slices.Contains(r.architectures, arch) {
+			archs = append(archs, arch)
+		}
+	}
+	return archs
+}
+
+// Components returns the components selected for the repository that its Release file lists.
+// A flat repository has no components.
+func (r *Repository) Components() []string {
+	if r.release == nil || len(r.release.Components) == 0 {
+		return slices.Clone(r.components)
+	}
+	var components []string
+	for _, component := range r.components {
+		if slices.Contains(r.release.Components, component) {
+			components = append(components, component)
+		}
+	}
+	return components
+}
+
+// WithComponents restricts Mount to the components of the source entry that are also in this list,
+// and sets the components for MountURL
 func WithComponents(components ...string) MountOption {
 	return func(opts *MountOptions) {
 		opts.Components = components
 	}
 }
 
+// selectComponents intersects the components named by a source entry with the requested ones.
+// A flat repository has no components, so there is nothing to restrict.
+func selectComponents(sourceComponents, requested []string) ([]string, error) {
+	if len(requested) == 0 || len(sourceComponents) == 0 {
+		return slices.Clone(sourceComponents), nil
+	}
+	var components []string
+	for _, component := range sourceComponents {
+		if slices.Contains(requested, component) {
+			components = append(components, component)
+		}
+	}
+	if len(components) == 0 {
+		return nil, fmt.Errorf("none of the requested components (%s) are in the source's components (%s)",
+			strings.Join(requested, ", "), strings.Join(sourceComponents, ", "))
+	}
+	return components, nil
+}
+
 // MountURL is a convenience function that creates a Repository from basic parameters.
 // It creates a "deb" type source entry with the specified options.
 func MountURL(archiveRoot *url.URL, distribution string, optFns ...MountOption) (*Repository, error) {
@@ -172,6 +410,7 @@ func MountURL(archiveRoot *url.URL, distribution string, optFns ...MountOption)
 		Distribution: distribution,
 		Components:   components,
 		Options:      make(map[string]string),
+		Enabled:      true,
 	}
 
 	return Mount(entry, optFns...)
@@ -184,8 +423,13 @@ func MountURL(archiveRoot *url.URL, distribution string, optFns ...MountOption)
 // The input can be either an archive root URL (e.g., "https://example.com/ubuntu")
 // or a distribution root URL (e.g., "https://example.com/ubuntu/dists/jammy").
 // If a distribution URL is detected, it will be used directly and the archive root
-// will be inferred.
-func Discover(archiveRoot string) ([]sources.Entry, error) {
+// will be inferred. Use DiscoverAll to probe an explicit list of suites without a cap.
+func Discover(archiveRoot string, optFns ...DiscoverOption) ([]sources.Entry, error) {
+	return DiscoverContext(context.Background(), archiveRoot, optFns...)
+}
+
+// DiscoverContext is like Discover, with a context that can cancel probing
+func DiscoverContext(ctx context.Context, archiveRoot string, optFns ...DiscoverOption) ([]sources.Entry, error) {
 	repoURL, err := url.Parse(archiveRoot)
 	if err != nil {
 		return nil, fmt.Errorf("invalid archive root URL: %w", err)
@@ -193,24 +437,38 @@ func Discover(archiveRoot string) ([]sources.Entry, error) {
 
 	// Check if this looks like a distribution root URL (contains /dists/)
 	if distEntry, actualArchiveRoot := tryParseDistRoot(repoURL); distEntry != nil {
-		// This is a distribution URL, try to mount it directly
-		repo, err := Mount(*distEntry)
-		if err != nil {
-			return nil, fmt.Errorf("failed to mount distribution URL: %w", err)
+		opts := &DiscoverOptions{}
+		for _, fn := range optFns {
+			fn(opts)
 		}
 
-		// Try to fetch the Release file to validate and get components
-		ctx := context.Background()
-		release, err := repo.Update(ctx)
+		// This is a distribution URL, try to mount it directly with the same transport as probing would use
+		var mountOpts []MountOption
+		if opts.Transport != nil {
+			mountOpts = append(mountOpts, WithTransport(opts.Transport))
+		} else if opts.Registry != nil {
+			mountOpts = append(mountOpts, WithTransport(opts.Registry))
+		}
+		repo, err := MountContext(ctx, *distEntry, mountOpts...)
 		if err != nil {
-			return nil, fmt.Errorf("failed to fetch Release file from distribution URL: %w", err)
+			return nil, fmt.Errorf("failed to mount distribution URL: %w", err)
 		}
 
+		// Mounting fetched the Release file, which lists the components
+		release := repo.Release()
+
 		// Use components from Release file if available, otherwise use defaults
 		components := distEntry.Components
 		if len(release.Components) > 0 {
 			components = release.Components
 		}
+		if len(opts.Architectures) > 0 && len(components) > 0 {
+			components = componentsForArchitectures(release, components, opts.Architectures)
+			if len(components) == 0 {
+				return nil, fmt.Errorf("distribution %s has no packages for %s",
+					distEntry.Distribution, strings.Join(opts.Architectures, ", "))
+			}
+		}
 
 		// Create the validated entry with the actual archive root
 		entry := sources.Entry{
@@ -219,75 +477,16 @@ func Discover(archiveRoot string) ([]sources.Entry, error) {
 			Distribution: distEntry.Distribution,
 			Components:   components,
 			Options:      make(map[string]string),
+			Enabled:      true,
 		}
 
 		return []sources.Entry{entry}, nil
 	}
 
-	// This appears to be an archive root URL, proceed with discovery
-	// Get transport for this URL scheme
-	tpt, err := apttransport.DefaultRegistry.Select(repoURL.Scheme)
-	if err != nil {
-		return nil, fmt.Errorf("unsupported transport %q: %w", repoURL.Scheme, err)
-	}
-
-	ctx := context.Background()
-	var foundEntries []sources.Entry
-
-	// Define candidate distributions to try, ordered by likelihood
-	candidates := getDistributionCandidates(archiveRoot)
-
-	for _, candidate := range candidates {
-		// Try to fetch Release file for this distribution
-		distURL := repoURL.JoinPath("dists", candidate.distribution)
-		releaseURL := distURL.JoinPath("Release")
-
-		resp, err := tpt.Acquire(ctx, &apttransport.AcquireRequest{
-			URI:     releaseURL,
-			Timeout: 5 * time.Second, // Add timeout to avoid hanging tests
-		})
-		if err != nil {
-			// Release file doesn't exist for this distribution, skip it
-			continue
-		}
-
-		// Parse the Release file to get actual components and architectures
-		release, err := deb822.ParseRelease(resp.Content)
-		resp.Content.Close()
-		if err != nil {
-			// Invalid Release file, skip this distribution
-			continue
-		}
-
-		// Create entries based on the Release file content
-		components := candidate.components
-		if len(release.Components) > 0 {
-			// Use actual components from Release file if available
-			components = release.Components
-		}
-
-		entry := sources.Entry{
-			Type:         sources.SourceTypeDeb,
-			ArchiveRoot:  repoURL,
-			Distribution: candidate.distribution,
-			Components:   components,
-			Options:      make(map[string]string),
-		}
-
-		foundEntries = append(foundEntries, entry)
-
-		// If we've found entries and this looks like a major distribution,
-		// we might want to stop here to avoid making too many requests
-		if len(foundEntries) >= 3 {
-			break
-		}
-	}
-
-	if len(foundEntries) == 0 {
-		return nil, fmt.Errorf("no valid distributions found in repository")
-	}
-
-	return foundEntries, nil
+	// This appears to be an archive root URL; a few hits are enough for a guess
+	return DiscoverAllContext(ctx, archiveRoot, append(slices.Clip(optFns), func(opts *DiscoverOptions) {
+		opts.maxResults = 3
+	})...)
 }
 
 // distributionCandidate represents a guess about what might be in a repository
@@ -431,25 +630,15 @@ func tryParseDistRoot(distURL *url.URL) (*sources.Entry, *url.URL) {
 		Distribution: distribution,
 		Components:   []string{"main"}, // Default, will be updated from Release file
 		Options:      make(map[string]string),
+		Enabled:      true,
 	}
 
 	return entry, archiveRoot
 }
 
-func detectDebianArch() []string {
-	switch runtime.GOARCH {
-	case "amd64":
-		return []string{"amd64", "i386"}
-	case "386":
-		return []string{"i386"}
-	case "arm64":
-		return []string{"arm64"}
-	case "arm":
-		return []string{"arm", "armhf"}
-	default:
-		// whatever, just use all of them
-		return nil
-	}
+// ArchiveRoot returns the base URL of the archive, which is the root for package Filename paths
+func (r *Repository) ArchiveRoot() *url.URL {
+	return r.archiveRoot
 }
 
 func (r *Repository) DistributionRoot() *url.URL {
@@ -461,44 +650,81 @@ func (r *Repository) Transport() apttransport.Transport {
 }
 
 func (r *Repository) Update(ctx context.Context) (*deb822.Release, error) {
-	resp, err := r.transport.Acquire(ctx, &apttransport.AcquireRequest{
-		// TODO: add support for InRelease file
-		URI: r.distRoot.JoinPath("Release"),
-	})
+	releaseBytes, _, err := fetchRelease(ctx, r.transport, r.distRoot)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch Release file: %w", err)
 	}
 
 	// TODO: protect this with a mutex?
-	r.release, err = deb822.ParseRelease(resp.Content)
+	r.release, err = deb822.ParseRelease(bytes.NewReader(releaseBytes))
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse Release file: %w", err)
 	}
+	r.warnUnhashedIndexes()
 
 	return r.release, nil
 }
 
+// probeTimeout bounds fetching a Release file or its signature whole. They are small, so a repository
+// that doesn't answer fails quickly, even when the transport allows its requests longer.
+const probeTimeout = 10 * time.Second
+
+// fetchSmall fetches and reads a small file such as a Release file within probeTimeout
+func fetchSmall(ctx context.Context, tpt apttransport.Transport, uri *url.URL) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	resp, err := tpt.Acquire(ctx, &apttransport.AcquireRequest{URI: uri})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Content.Close()
+	data, err := io.ReadAll(resp.Content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path.Base(uri.Path), err)
+	}
+	return data, nil
+}
+
 // THINK: should fetch happen at the Transport layer?
 func (r *Repository) Fetch(ctx context.Context, loc *url.URL) (io.Reader, *apttransport.AcquireResponse, error) {
 	if loc == nil {
 		return nil, nil, errors.New("invalid URL")
 	}
-	acr, err := r.transport.Acquire(ctx, &apttransport.AcquireRequest{
+	return r.fetch(ctx, &apttransport.AcquireRequest{
 		URI: loc,
-	})
+	}, filepath.Ext(loc.Path))
+}
+
+// fetch acquires a file and wraps it in a decompressor for the given compression extension.
+// Any ExpectedHashes in the request are verified against the compressed bytes.
+func (r *Repository) fetch(ctx context.Context, req *apttransport.AcquireRequest, compression string) (io.Reader, *apttransport.AcquireResponse, error) {
+	acr, err := r.transport.Acquire(ctx, req)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to fetch repository: %w", err)
 	}
-	rdr := acr.Content
+	var rdr io.Reader = acr.Content
 
 	// this is where we handle decompression
-	switch filepath.Ext(loc.Path) {
-	// TODO: support more compression types
+	switch compression {
 	case ".gz":
 		rdr, err = gzip.NewReader(acr.Content)
 		if err != nil {
 			return nil, nil, fmt.Errorf("failed to read gzipped file: %w", err)
 		}
+	case ".bz2":
+		rdr = bzip2.NewReader(acr.Content)
+	case ".xz":
+		rdr, err = xz.NewReader(acr.Content)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read xz file: %w", err)
+		}
+	case ".zst":
+		decoder, err := zstd.NewReader(acr.Content, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read zstd file: %w", err)
+		}
+		rdr = decoder
+		acr.Content = &zstdCloser{ReadCloser: acr.Content, decoder: decoder}
 	default:
 		// don't change the rdr
 	}
@@ -506,53 +732,626 @@ func (r *Repository) Fetch(ctx context.Context, loc *url.URL) (io.Reader, *apttr
 	return rdr, acr, err
 }
 
+// zstdCloser releases the zstd decoder of a file when its content is closed
+type zstdCloser struct {
+	io.ReadCloser
+	decoder *zstd.Decoder
+}
+
+func (c *zstdCloser) Close() error {
+	c.decoder.Close()
+	return c.ReadCloser.Close()
+}
+
+// Packages iterates over the packages in all selected Packages indexes
 func (r *Repository) Packages(ctx context.Context) iter.Seq2[*deb822.Package, error] {
 	return func(yield func(*deb822.Package, error) bool) {
+		for ref, err := range r.PackageRefs(ctx) {
+			if !yield(ref.Package, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// PackageRef is a package together with where it was listed
+type PackageRef struct {
+	Package   *deb822.Package
+	Component string
+	// Architecture is that of the Packages index, e.g. "all" for binary-all, which may differ from the package's own
+	Architecture string
+	Suite        string
+}
+
+// PackageRefs iterates over the packages in all selected Packages indexes, like Packages,
+// along with the component, architecture and suite of the index each package came from
+func (r *Repository) PackageRefs(ctx context.Context) iter.Seq2[PackageRef, error] {
+	return r.packageRefs(ctx, Filter{})
+}
+
+// packageRefs iterates over the packages that match filter in the selected Packages indexes that can hold them
+func (r *Repository) packageRefs(ctx context.Context, filter Filter) iter.Seq2[PackageRef, error] {
+	return func(yield func(PackageRef, error) bool) {
 		if r.release == nil {
 			_, err := r.Update(ctx)
 			if err != nil {
-				yield(nil, err)
+				yield(PackageRef{}, err)
 				return
 			}
 		}
 
-		for _, fi := range r.indexes() {
-			if fi.Type == "Packages" {
-				rdr, _, err := r.Fetch(ctx, r.distRoot.JoinPath(fi.Path))
-				if err != nil {
-					yield(nil, fmt.Errorf("failed to fetch Packages file %s: %w", fi.Path, err))
+		var indexes []deb822.FileInfo
+		for _, fi := range r.PackagesIndexes() {
+			if filter.selectsIndex(fi) {
+				indexes = append(indexes, fi)
+			}
+		}
+		if r.concurrency > 1 && len(indexes) > 1 {
+			r.packagesConcurrent(ctx, indexes, filter, yield)
+			return
+		}
+
+		for _, fi := range indexes {
+			for pkg, err := range r.packagesFrom(ctx, fi, filter) {
+				if err == nil && !r.selectsPackage(pkg, fi) {
+					continue
+				}
+				if !yield(r.packageRef(pkg, fi), err) || err != nil {
 					return
 				}
-				for pkg, err := range deb822.ParsePackages(rdr) {
+			}
+		}
+	}
+}
+
+// selectsPackage reports whether a package read from an index is wanted. The index of a flat repository
+// isn't architecture-specific and lists the packages of every architecture, so those are filtered one by one.
+func (r *Repository) selectsPackage(pkg *deb822.Package, fi deb822.FileInfo) bool {
+	return fi.Architecture != "" || r.selectsArchitecture(pkg.Architecture)
+}
+
+// packageRef records the index a package was read from
+func (r *Repository) packageRef(pkg *deb822.Package, fi deb822.FileInfo) PackageRef {
+	suite := r.release.Suite
+	if suite == "" {
+		suite = r.release.Codename
+	}
+	return PackageRef{
+		Package:      pkg,
+		Component:    fi.Component,
+		Architecture: fi.Architecture,
+		Suite:        suite,
+	}
+}
+
+// indexResult holds the fully parsed contents of one Packages index, or the error that stopped it
+type indexResult struct {
+	packages []*deb822.Package
+	err      error
+}
+
+// packagesConcurrent fetches indexes with up to r.concurrency workers and yields their packages in index order.
+// The number of indexes fetched but not yet yielded is bounded by r.concurrency. Each index is buffered until
+// it has been read to the end, where its hash is checked, so none of the packages of a corrupt index are yielded.
+func (r *Repository) packagesConcurrent(ctx context.Context, indexes []deb822.FileInfo, filter Filter, yield func(PackageRef, error) bool) {
+	// cancelling stops outstanding fetches once the caller stops iterating or an error is yielded
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// each worker sends exactly one result, so a buffer of one keeps workers from blocking
+	results := make([]chan indexResult, len(indexes))
+	for i := range results {
+		results[i] = make(chan indexResult, 1)
+	}
+
+	slots := make(chan struct{}, r.concurrency)
+	go func() {
+		for i, fi := range indexes {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			go func() {
+				var result indexResult
+				for pkg, err := range r.packagesFrom(ctx, fi, filter) {
 					if err != nil {
-						yield(nil, fmt.Errorf("failed to parse Packages file %s: %w", fi.Path, err))
+						result.err = err
+						break
+					}
+					result.packages = append(result.packages, pkg)
+				}
+				results[i] <- result
+			}()
+		}
+	}()
+
+	for i, fi := range indexes {
+		var result indexResult
+		select {
+		case result = <-results[i]:
+		case <-ctx.Done():
+			yield(PackageRef{}, ctx.Err())
+			return
+		}
+		<-slots // free the slot only once the result is consumed
+
+		if result.err != nil {
+			yield(PackageRef{}, result.err)
+			return
+		}
+		for _, pkg := range result.packages {
+			if !r.selectsPackage(pkg, fi) {
+				continue
+			}
+			if !yield(r.packageRef(pkg, fi), nil) {
+				return
+			}
+		}
+	}
+}
+
+// supportedCompressions lists the compression formats that Fetch knows how to decode
+var supportedCompressions = []string{"", ".gz", ".bz2", ".xz", ".zst"}
+
+// PackagesIndexes returns the Packages index files selected by the component and architecture filters.
+// When the Release file lists several compressed variants of the same index,
+// only the smallest variant in a supported format is returned.
+func (r *Repository) PackagesIndexes() []deb822.FileInfo {
+	return smallestVariants(r.indexes(), "Packages")
+}
+
+// SourcesIndexes returns the Sources index files for the selected components,
+// choosing the smallest supported compressed variant of each
+func (r *Repository) SourcesIndexes() []deb822.FileInfo {
+	if r.release == nil {
+		panic("release not initialized")
+	}
+
+	// indexes() filters on binary architectures, which never match "source"
+	var files []deb822.FileInfo
+	for _, fi := range r.release.GetAvailableFiles() {
+		if fi.Architecture != "source" {
+			continue
+		}
+		if len(r.components) > 0 && !slices.Contains(r.components, fi.Component) {
+			continue
+		}
+		files = append(files, fi)
+	}
+	return smallestVariants(files, "Sources")
+}
+
+// smallestVariants keeps index files of the given type, choosing the smallest supported
+// compressed variant of each, sorted by path
+func smallestVariants(indexes []deb822.FileInfo, fileType string) []deb822.FileInfo {
+	// group variants by their uncompressed path, e.g. main/binary-amd64/Packages
+	variants := make(map[string]deb822.FileInfo)
+	for _, fi := range indexes {
+		if fi.Type != fileType || !slices.Contains(supportedCompressions, fi.Compression) {
+			continue
+		}
+		key := strings.TrimSuffix(fi.Path, fi.Compression)
+		if existing, exists := variants[key]; !exists || fi.Size < existing.Size {
+			variants[key] = fi
+		}
+	}
+
+	files := make([]deb822.FileInfo, 0, len(variants))
+	for _, fi := range variants {
+		files = append(files, fi)
+	}
+	slices.SortFunc(files, func(a, b deb822.FileInfo) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return files
+}
+
+// PackagesFrom iterates over the packages in a single Packages index file.
+// The index is parsed as it downloads. An index whose size differs from the Release file fails before any
+// of its packages are yielded, but other hash mismatches are reported after the packages read before them.
+func (r *Repository) PackagesFrom(ctx context.Context, fi deb822.FileInfo) iter.Seq2[*deb822.Package, error] {
+	return r.packagesFrom(ctx, fi, Filter{})
+}
+
+// packagesFrom is PackagesFrom, skipping the records that don't match filter.
+// With the index cache enabled, a package looked up by name is read from the cached copy of the index when
+// there is one, and the copy is kept of each index that is read in full.
+func (r *Repository) packagesFrom(ctx context.Context, fi deb822.FileInfo, filter Filter) iter.Seq2[*deb822.Package, error] {
+	return func(yield func(*deb822.Package, error) bool) {
+		keep := filter.keep()
+		if r.indexCacheDir != "" && filter.Name != "" {
+			packages, err := r.lookupIndexCache(fi, filter.Name, keep)
+			if err == nil {
+				for _, pkg := range packages {
+					if !yield(pkg, nil) {
 						return
 					}
-					yield(pkg, nil)
 				}
+				return
+			}
+			if !errors.Is(err, errIndexNotCached) {
+				log.Debug().Str("index", fi.Path).Err(err).Msg("Index cache lookup failed, fetching the index")
+			}
+		}
+
+		rdr, acr, err := r.fetchIndex(ctx, fi)
+		if errors.Is(err, apttransport.ErrHashMismatch) {
+			yield(nil, fmt.Errorf("index hash mismatch for %s: %w", fi.Path, err))
+			return
+		}
+		if err != nil {
+			yield(nil, fmt.Errorf("failed to fetch Packages file %s: %w", fi.Path, err))
+			return
+		}
+		content := acr.Content
+		// the copy kept for PDiff serves as the index cache's too, and fetchIndex has already recorded it
+		if r.indexCacheDir != "" && !r.usesPDiff(fi) {
+			rdr, content = r.recordIndex(fi, rdr, content)
+		}
+		defer content.Close()
+
+		for pkg, err := range deb822.ParsePackagesFiltered(rdr, keep) {
+			if err != nil {
+				yield(nil, fmt.Errorf("failed to parse Packages file %s: %w", fi.Path, err))
+				return
+			}
+			if !yield(pkg, nil) {
+				return
 			}
 		}
 	}
 }
 
-func (r *Repository) indexes() []deb822.FileInfo {
+// fetchIndex fetches an index file listed in the Release file and verifies it against the recorded hash.
+// When the Release file sets Acquire-By-Hash, the immutable by-hash URL is tried first.
+func (r *Repository) fetchIndex(ctx context.Context, fi deb822.FileInfo) (io.Reader, *apttransport.AcquireResponse, error) {
+	req := &apttransport.AcquireRequest{
+		URI:          r.distRoot.JoinPath(fi.Path),
+		ExpectedSize: fi.Size,
+	}
+	// Release records the hash of the file as published, so this checks the compressed bytes.
+	// Legacy repositories may only record SHA1 or MD5.
+	if algo, hash := fi.BestHash(); algo != "" {
+		req.ExpectedHashes = map[string]string{algo: hash}
+	}
+	if r.progress == nil {
+		return r.fetchIndexWith(ctx, fi, req)
+	}
+
+	// the transfer is done once the index has been read, which is when its content is closed
+	transfer := r.progress.Start(fi.Path, fi.Size)
+	req.ProgressCallback = transfer.Callback(nil)
+	rdr, acr, err := r.fetchIndexWith(ctx, fi, req)
+	if err != nil {
+		transfer.Done()
+		return rdr, acr, err
+	}
+	acr.Content = &transferCloser{ReadCloser: acr.Content, transfer: transfer}
+	return rdr, acr, nil
+}
+
+// transferCloser marks a transfer as done when the content it tracks is closed
+type transferCloser struct {
+	io.ReadCloser
+	transfer *apttransport.Transfer
+}
+
+func (c *transferCloser) Close() error {
+	err := c.ReadCloser.Close()
+	c.transfer.Done()
+	return err
+}
+
+// fetchIndexWith fetches an index file for fetchIndex using req, which is for the canonical path.
+// With PDiff enabled, a Packages index is patched from the copy kept by an earlier fetch when possible,
+// and a copy is kept of each one that is downloaded whole.
+func (r *Repository) fetchIndexWith(ctx context.Context, fi deb822.FileInfo, req *apttransport.AcquireRequest) (io.Reader, *apttransport.AcquireResponse, error) {
+	if !r.usesPDiff(fi) {
+		return r.fetchIndexWhole(ctx, fi, req)
+	}
+	content, err := r.fetchPDiff(ctx, fi)
+	if err == nil {
+		rdr := bytes.NewReader(content)
+		return rdr, &apttransport.AcquireResponse{
+			URI:     req.URI,
+			Size:    int64(len(content)),
+			Content: io.NopCloser(rdr),
+		}, nil
+	}
+	if ctx.Err() != nil {
+		return nil, nil, ctx.Err()
+	}
+	if !errors.Is(err, errNoPDiff) {
+		log.Debug().Str("index", fi.Path).Err(err).Msg("PDiff update failed, downloading the whole index")
+	}
+
+	rdr, acr, err := r.fetchIndexWhole(ctx, fi, req)
+	if err != nil {
+		return rdr, acr, err
+	}
+	if r.indexCacheDir != "" {
+		rdr, acr.Content = r.recordIndex(fi, rdr, acr.Content)
+	} else {
+		rdr, acr.Content = r.recordBase(fi, rdr, acr.Content)
+	}
+	return rdr, acr, nil
+}
+
+// fetchIndexWhole downloads an index file, trying its by-hash location first when there is one
+func (r *Repository) fetchIndexWhole(ctx context.Context, fi deb822.FileInfo, req *apttransport.AcquireRequest) (io.Reader, *apttransport.AcquireResponse, error) {
+	if byHash := r.byHashURL(fi); byHash != nil {
+		byHashReq := *req
+		byHashReq.URI = byHash
+		rdr, acr, err := r.fetch(ctx, &byHashReq, fi.Compression)
+		if err == nil {
+			return &indexReader{decompressed: rdr, content: acr.Content, path: fi.Path}, acr, nil
+		}
+		if errors.Is(err, apttransport.ErrHashMismatch) || ctx.Err() != nil {
+			return rdr, acr, err
+		}
+		// mirrors don't always carry the by-hash directories even when the Release file says so
+		log.Debug().Str("uri", byHash.String()).Err(err).Msg("by-hash fetch failed, falling back to canonical path")
+	}
+
+	rdr, acr, err := r.fetch(ctx, req, fi.Compression)
+	if err != nil {
+		return rdr, acr, err
+	}
+	return &indexReader{decompressed: rdr, content: acr.Content, path: fi.Path}, acr, nil
+}
+
+// indexReader reads a decompressed index. Transports verify the hash once the compressed content
+// has been read to EOF, so when the decompressor stops the rest of the content is drained,
+// and a hash mismatch takes precedence over the decompression error it usually causes.
+type indexReader struct {
+	decompressed io.Reader
+	content      io.Reader
+	path         string
+}
+
+func (r *indexReader) Read(p []byte) (int, error) {
+	n, err := r.decompressed.Read(p)
+	if err != nil {
+		if _, drainErr := io.Copy(io.Discard, r.content); errors.Is(drainErr, apttransport.ErrHashMismatch) {
+			err = fmt.Errorf("index hash mismatch for %s: %w", r.path, drainErr)
+		}
+	}
+	return n, err
+}
+
+// IndexURLs returns where each index listed in the Release file is fetched from, including the by-hash
+// locations when the repository advertises Acquire-By-Hash. Unlike the indexes of PackagesIndexes, these
+// are not limited to the selected architectures and components.
+func (r *Repository) IndexURLs() []*url.URL {
+	if r.release == nil {
+		panic("release not initialized")
+	}
+
+	var urls []*url.URL
+	for _, fi := range r.release.GetAvailableFiles() {
+		urls = append(urls, r.distRoot.JoinPath(fi.Path))
+		if byHash := r.byHashURL(fi); byHash != nil {
+			urls = append(urls, byHash)
+		}
+	}
+	return urls
+}
+
+// byHashURL returns the by-hash location of an index, e.g. main/binary-amd64/by-hash/SHA256/<hash>,
+// or nil if the repository doesn't advertise Acquire-By-Hash
+func (r *Repository) byHashURL(fi deb822.FileInfo) *url.URL {
+	if r.release == nil || !r.release.AcquireByHash || fi.SHA256 == "" {
+		return nil
+	}
+	return r.distRoot.JoinPath(path.Dir(fi.Path), "by-hash", "SHA256", fi.SHA256)
+}
+
+// SourcePackages iterates over the source packages in all selected Sources indexes
+func (r *Repository) SourcePackages(ctx context.Context) iter.Seq2[*deb822.Source, error] {
+	return func(yield func(*deb822.Source, error) bool) {
+		if r.release == nil {
+			if _, err := r.Update(ctx); err != nil {
+				yield(nil, err)
+				return
+			}
+		}
+
+		for _, fi := range r.SourcesIndexes() {
+			rdr, acr, err := r.fetchIndex(ctx, fi)
+			if errors.Is(err, apttransport.ErrHashMismatch) {
+				yield(nil, fmt.Errorf("index hash mismatch for %s: %w", fi.Path, err))
+				return
+			}
+			if err != nil {
+				yield(nil, fmt.Errorf("failed to fetch Sources file %s: %w", fi.Path, err))
+				return
+			}
+
+			for src, err := range deb822.ParseSources(rdr) {
+				if err != nil {
+					acr.Content.Close()
+					yield(nil, fmt.Errorf("failed to parse Sources file %s: %w", fi.Path, err))
+					return
+				}
+				if !yield(src, nil) {
+					acr.Content.Close()
+					return
+				}
+			}
+			acr.Content.Close()
+		}
+	}
+}
+
+// ContentsIndexes returns the Contents index files for the selected architectures and components,
+// choosing the smallest supported compressed variant of each. Where an architecture has a Contents
+// index at the distribution root as well as ones under its components, only one of them is read,
+// since the root index lists the files of every component again.
+func (r *Repository) ContentsIndexes() []deb822.FileInfo {
 	if r.release == nil {
 		panic("release not initialized")
 	}
 
-	if len(r.components) == 0 {
-		return r.release.GetAvailableFiles()
+	// Contents files at the distribution root have no component, so only component-scoped ones are filtered
+	var files []deb822.FileInfo
+	for _, fi := range r.release.GetAvailableFiles() {
+		if !r.selectsArchitecture(fi.Architecture) {
+			continue
+		}
+		if fi.Component != "" && len(r.components) > 0 && !slices.Contains(r.components, fi.Component) {
+			continue
+		}
+		files = append(files, fi)
+	}
+	return withoutDuplicateContents(smallestVariants(files, "Contents"), r.Components())
+}
+
+// withoutDuplicateContents drops the root Contents index of an architecture when each of the components
+// has its own, and the component ones otherwise, because the root index might be the only one listing
+// some components
+func withoutDuplicateContents(files []deb822.FileInfo, components []string) []deb822.FileInfo {
+	byArch := make(map[string][]string)
+	hasRoot := make(map[string]bool)
+	for _, fi := range files {
+		if fi.Component == "" {
+			hasRoot[fi.Architecture] = true
+		} else {
+			byArch[fi.Architecture] = append(byArch[fi.Architecture], fi.Component)
+		}
 	}
+	componentsCoverArch := func(arch string) bool {
+		if len(components) == 0 {
+			return false
+		}
+		for _, component := range components {
+			if !slices.Contains(byArch[arch], component) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return slices.DeleteFunc(files, func(fi deb822.FileInfo) bool {
+		if !hasRoot[fi.Architecture] || len(byArch[fi.Architecture]) == 0 {
+			return false
+		}
+		if fi.Component == "" {
+			return componentsCoverArch(fi.Architecture)
+		}
+		return !componentsCoverArch(fi.Architecture)
+	})
+}
+
+// Contents iterates over the file-to-package mappings in all selected Contents indexes
+func (r *Repository) Contents(ctx context.Context) iter.Seq2[deb822.ContentEntry, error] {
+	return func(yield func(deb822.ContentEntry, error) bool) {
+		if r.release == nil {
+			if _, err := r.Update(ctx); err != nil {
+				yield(deb822.ContentEntry{}, err)
+				return
+			}
+		}
 
+		for _, fi := range r.ContentsIndexes() {
+			for entry, err := range r.ContentsFrom(ctx, fi) {
+				if !yield(entry, err) || err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// ContentsFrom iterates over the file-to-package mappings in one Contents index
+func (r *Repository) ContentsFrom(ctx context.Context, fi deb822.FileInfo) iter.Seq2[deb822.ContentEntry, error] {
+	return func(yield func(deb822.ContentEntry, error) bool) {
+		rdr, acr, err := r.fetchIndex(ctx, fi)
+		if errors.Is(err, apttransport.ErrHashMismatch) {
+			yield(deb822.ContentEntry{}, fmt.Errorf("index hash mismatch for %s: %w", fi.Path, err))
+			return
+		}
+		if err != nil {
+			yield(deb822.ContentEntry{}, fmt.Errorf("failed to fetch Contents file %s: %w", fi.Path, err))
+			return
+		}
+		defer acr.Content.Close()
+
+		for entry, err := range deb822.ParseContents(rdr) {
+			if err != nil {
+				yield(deb822.ContentEntry{}, fmt.Errorf("failed to parse Contents file %s: %w", fi.Path, err))
+				return
+			}
+			if !yield(entry, nil) {
+				return
+			}
+		}
+	}
+}
+
+// TranslationIndexes returns the i18n Translation files for a language (e.g. "en") in the selected components,
+// choosing the smallest supported compressed variant of each
+func (r *Repository) TranslationIndexes(lang string) []deb822.FileInfo {
+	if r.release == nil {
+		panic("release not initialized")
+	}
+
+	// Translation files aren't architecture-specific, so only the component filter applies
 	var files []deb822.FileInfo
 	for _, fi := range r.release.GetAvailableFiles() {
-		if !slices.Contains(r.components, fi.Component) {
+		if len(r.components) > 0 && !slices.Contains(r.components, fi.Component) {
 			continue
 		}
-		if r.architectures != nil && len(r.architectures) > 0 {
-			if !slices.Contains(r.architectures, fi.Architecture) {
-				continue
+		files = append(files, fi)
+	}
+	return smallestVariants(files, "Translation-"+lang)
+}
+
+// Descriptions returns the long descriptions in the given language, keyed by Description-md5.
+// Packages files often carry only the synopsis and a Description-md5 that refers to these.
+// The map is empty when the repository doesn't publish translations for the language.
+func (r *Repository) Descriptions(ctx context.Context, lang string) (map[string]string, error) {
+	if r.release == nil {
+		if _, err := r.Update(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	descriptions := make(map[string]string)
+	for _, fi := range r.TranslationIndexes(lang) {
+		rdr, acr, err := r.fetchIndex(ctx, fi)
+		if errors.Is(err, apttransport.ErrHashMismatch) {
+			return nil, fmt.Errorf("index hash mismatch for %s: %w", fi.Path, err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch Translation file %s: %w", fi.Path, err)
+		}
+
+		for tr, err := range deb822.ParseTranslations(rdr) {
+			if err != nil {
+				acr.Content.Close()
+				return nil, fmt.Errorf("failed to parse Translation file %s: %w", fi.Path, err)
 			}
+			descriptions[tr.DescriptionMd5] = tr.Description
+		}
+		acr.Content.Close()
+	}
+	return descriptions, nil
+}
+
+func (r *Repository) indexes() []deb822.FileInfo {
+	if r.release == nil {
+		panic("release not initialized")
+	}
+
+	var files []deb822.FileInfo
+	for _, fi := range r.release.GetAvailableFiles() {
+		if len(r.components) > 0 && !slices.Contains(r.components, fi.Component) {
+			continue
+		}
+		// Sources indexes and files that aren't architecture-specific, like flat repository indexes, always apply
+		if fi.Architecture != "" && fi.Architecture != "source" && !r.selectsArchitecture(fi.Architecture) {
+			continue
 		}
 		files = append(files, fi)
 	}
@@ -560,6 +1359,12 @@ func (r *Repository) indexes() []deb822.FileInfo {
 	return files
 }
 
+// selectsArchitecture reports whether the indexes of an architecture are wanted. Like apt,
+// architecture-independent packages in binary-all are always included with the requested architectures.
+func (r *Repository) selectsArchitecture(arch string) bool {
+	return len(r.architectures) == 0 || arch == "all" || slices.Contains(r.architectures, arch)
+}
+
 // GetAvailableArchitectures returns all architectures available for the specified components
 func (r *Repository) GetAvailableArchitectures(components []string) []string {
 	if r.release == nil {
@@ -575,7 +1380,14 @@ func (r *Repository) GetAvailableArchitectures(components []string) []string {
 					continue
 				}
 			}
-			archSet[fi.Architecture] = true
+			if fi.Architecture != "" {
+				archSet[fi.Architecture] = true
+				continue
+			}
+			// the index of a flat repository covers every architecture in the Release file
+			for _, arch := range r.release.Architectures {
+				archSet[arch] = true
+			}
 		}
 	}
 
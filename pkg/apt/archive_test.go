@@ -1,14 +1,25 @@
 package apt
 
 import (
+	"bytes"
 	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
 	"net/url"
+	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/nicwaller/apt-look/pkg/apt/apttransport"
 	"github.com/nicwaller/apt-look/pkg/apt/sources"
+	"github.com/nicwaller/apt-look/pkg/deb822"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -350,3 +361,901 @@ func TestMount_WithCustomTransport(t *testing.T) {
 	assert.Equal(t, "file", repo2.archiveRoot.Scheme)
 	assert.Equal(t, testRepoPath, repo2.archiveRoot.Path)
 }
+
+func TestMountContext_Cancelled(t *testing.T) {
+	testRepoPath, err := filepath.Abs("testdata/emptyrepo")
+	require.NoError(t, err)
+	entry, err := sources.ParseSourceLine("deb file://"+testRepoPath+" stable main", 1)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = MountContext(ctx, *entry)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	repo, err := MountContext(context.Background(), *entry)
+	require.NoError(t, err)
+	assert.NotNil(t, repo.Release())
+}
+
+func TestMount_WithComponents(t *testing.T) {
+	testRepoPath, err := filepath.Abs("testdata/multidistrepo")
+	require.NoError(t, err)
+	entry, err := sources.ParseSourceLine("deb file://"+testRepoPath+" noble main universe", 1)
+	require.NoError(t, err)
+
+	repo, err := Mount(*entry, WithComponents("universe", "restricted"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"universe"}, repo.components)
+
+	repo, err = Mount(*entry)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"main", "universe"}, repo.components)
+
+	_, err = Mount(*entry, WithComponents("restricted"))
+	assert.ErrorContains(t, err, "none of the requested components")
+}
+
+func TestMount_CompressedIndexes(t *testing.T) {
+	testRepoPath, err := filepath.Abs("testdata/compressedrepo")
+	require.NoError(t, err)
+
+	tests := []struct {
+		arch     string
+		expected string // compression format of the only index for this architecture
+	}{
+		{"amd64", ".bz2"},
+		{"arm64", ".xz"},
+		{"armhf", ".zst"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arch, func(t *testing.T) {
+			entry, err := sources.ParseSourceLine("deb file://"+testRepoPath+" stable main", 1)
+			require.NoError(t, err)
+
+			repo, err := Mount(*entry, WithArchitectures(tt.arch))
+			require.NoError(t, err)
+
+			indexes := repo.PackagesIndexes()
+			require.Len(t, indexes, 1)
+			assert.Equal(t, tt.expected, indexes[0].Compression)
+
+			var names []string
+			for pkg, err := range repo.Packages(context.Background()) {
+				require.NoError(t, err)
+				names = append(names, pkg.Package)
+			}
+			assert.Equal(t, []string{"alpha", "bravo"}, names)
+		})
+	}
+}
+
+func TestFetch_ClosesZstdDecoder(t *testing.T) {
+	testRepoPath, err := filepath.Abs("testdata/compressedrepo")
+	require.NoError(t, err)
+	entry, err := sources.ParseSourceLine("deb file://"+testRepoPath+" stable main", 1)
+	require.NoError(t, err)
+	repo, err := Mount(*entry, WithArchitectures("armhf"))
+	require.NoError(t, err)
+
+	rdr, acr, err := repo.Fetch(context.Background(), repo.DistributionRoot().JoinPath("main/binary-armhf/Packages.zst"))
+	require.NoError(t, err)
+	_, err = io.ReadAll(rdr)
+	require.NoError(t, err)
+
+	// closing the content releases the decoder as well
+	require.NoError(t, acr.Content.Close())
+	_, err = rdr.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, zstd.ErrDecoderClosed)
+}
+
+func TestMount_FlatRepository(t *testing.T) {
+	testRepoPath, err := filepath.Abs("testdata/flatrepo")
+	require.NoError(t, err)
+
+	// the k8s repository uses "/", while "." and a directory with a trailing slash are also flat
+	for _, line := range []string{
+		"deb file://" + testRepoPath + "/ /",
+		"deb file://" + testRepoPath + " .",
+		"deb file://" + filepath.Dir(testRepoPath) + " flatrepo/",
+	} {
+		t.Run(line, func(t *testing.T) {
+			entry, err := sources.ParseSourceLine(line, 1)
+			require.NoError(t, err)
+			assert.Empty(t, entry.Components)
+
+			repo, err := Mount(*entry, WithArchitectures("amd64"))
+			require.NoError(t, err)
+			assert.Equal(t, testRepoPath, strings.TrimSuffix(repo.DistributionRoot().Path, "/"))
+			assert.Empty(t, repo.Release().Components)
+
+			var types []string
+			for _, fi := range repo.Release().GetAvailableFiles() {
+				assert.Empty(t, fi.Component)
+				assert.Empty(t, fi.Architecture)
+				types = append(types, fi.Type)
+			}
+			assert.Equal(t, []string{"Packages", "Packages"}, types)
+
+			indexes := repo.PackagesIndexes()
+			require.Len(t, indexes, 1)
+			assert.Equal(t, "Packages.gz", indexes[0].Path)
+			assert.Equal(t, []string{"amd64", "arm64"}, repo.GetAvailableArchitectures(entry.Components))
+
+			// the one index lists every architecture, so packages are filtered by their own
+			var packages []string
+			for pkg, err := range repo.Packages(context.Background()) {
+				require.NoError(t, err)
+				packages = append(packages, pkg.Package+":"+pkg.Architecture)
+			}
+			assert.Equal(t, []string{"kubeadm:amd64", "kubectl:amd64"}, packages)
+		})
+	}
+}
+
+func TestPackagesIndexes_IncludesArchitectureAll(t *testing.T) {
+	testRepoPath, err := filepath.Abs("testdata/allarchrepo")
+	require.NoError(t, err)
+	entry, err := sources.ParseSourceLine("deb file://"+testRepoPath+" stable main", 1)
+	require.NoError(t, err)
+
+	repo, err := Mount(*entry, WithArchitectures("arm64"))
+	require.NoError(t, err)
+
+	var paths []string
+	for _, fi := range repo.PackagesIndexes() {
+		paths = append(paths, fi.Path)
+	}
+	assert.Equal(t, []string{"main/binary-all/Packages", "main/binary-arm64/Packages"}, paths)
+
+	var packages []string
+	for pkg, err := range repo.Packages(context.Background()) {
+		require.NoError(t, err)
+		packages = append(packages, pkg.Package+":"+pkg.Architecture)
+	}
+	assert.ElementsMatch(t, []string{"alpha:arm64", "alpha-doc:all"}, packages)
+
+	// the sources.list arch option applies when no architectures are passed to Mount
+	entry, err = sources.ParseSourceLine("deb [arch-=arm64 arch+=amd64] file://"+testRepoPath+" stable main", 1)
+	require.NoError(t, err)
+	repo, err = Mount(*entry)
+	require.NoError(t, err)
+	assert.NotContains(t, repo.architectures, "arm64")
+	assert.Contains(t, repo.architectures, "amd64")
+}
+
+func TestRepository_PackageRefs(t *testing.T) {
+	testRepoPath, err := filepath.Abs("testdata/allarchrepo")
+	require.NoError(t, err)
+	entry, err := sources.ParseSourceLine("deb file://"+testRepoPath+" stable main", 1)
+	require.NoError(t, err)
+
+	for _, concurrency := range []int{1, 4} {
+		repo, err := Mount(*entry, WithArchitectures("amd64", "arm64"), WithConcurrency(concurrency))
+		require.NoError(t, err)
+
+		var refs []string
+		for ref, err := range repo.PackageRefs(context.Background()) {
+			require.NoError(t, err)
+			refs = append(refs, strings.Join([]string{ref.Package.Package, ref.Component, ref.Architecture, ref.Suite}, " "))
+		}
+		assert.Equal(t, []string{
+			"alpha-doc main all stable",
+			"alpha main amd64 stable",
+			"alpha main arm64 stable",
+		}, refs)
+	}
+}
+
+func TestPackagesIndexes_PrefersSmallestVariant(t *testing.T) {
+	repo := &Repository{
+		components:    []string{"main"},
+		architectures: []string{"amd64"},
+		release: &deb822.Release{
+			SHA256: []deb822.HashEntry{
+				{Hash: "a", Size: 8400, Path: "main/binary-amd64/Packages"},
+				{Hash: "b", Size: 2100, Path: "main/binary-amd64/Packages.gz"},
+				{Hash: "c", Size: 1200, Path: "main/binary-amd64/Packages.xz"},
+				{Hash: "d", Size: 900, Path: "main/binary-amd64/Packages.lzma"}, // unsupported
+				{Hash: "e", Size: 5000, Path: "main/binary-arm64/Packages.gz"},  // filtered by architecture
+				{Hash: "f", Size: 3000, Path: "main/i18n/Translation-en.bz2"},   // not a Packages index
+			},
+		},
+	}
+
+	indexes := repo.PackagesIndexes()
+	require.Len(t, indexes, 1)
+	assert.Equal(t, "main/binary-amd64/Packages.xz", indexes[0].Path)
+}
+
+func TestPackages_IndexHashMismatch(t *testing.T) {
+	testRepoPath := t.TempDir()
+	require.NoError(t, os.CopyFS(testRepoPath, os.DirFS("testdata/compressedrepo")))
+
+	// Corrupt the index after the Release file has recorded its hash
+	indexPath := filepath.Join(testRepoPath, "dists/stable/main/binary-amd64/Packages.bz2")
+	f, err := os.OpenFile(indexPath, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("garbage"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	entry, err := sources.ParseSourceLine("deb file://"+testRepoPath+" stable main", 1)
+	require.NoError(t, err)
+
+	repo, err := Mount(*entry, WithArchitectures("amd64"))
+	require.NoError(t, err)
+
+	var errs []error
+	for pkg, err := range repo.Packages(context.Background()) {
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		t.Errorf("unexpected package %s from corrupted index", pkg.Package)
+	}
+	require.Len(t, errs, 1)
+	assert.ErrorIs(t, errs[0], apttransport.ErrHashMismatch)
+	assert.Contains(t, errs[0].Error(), "index hash mismatch for main/binary-amd64/Packages.bz2")
+}
+
+func TestPackages_MD5OnlyRelease(t *testing.T) {
+	packages := "Package: alpha\nVersion: 1.0\nFilename: pool/alpha_1.0.deb\nSize: 1\n"
+	newRepo := func(t *testing.T, published string) string {
+		repoPath := t.TempDir()
+		distPath := filepath.Join(repoPath, "dists", "stable")
+		require.NoError(t, os.MkdirAll(filepath.Join(distPath, "main", "binary-amd64"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(distPath, "main", "binary-amd64", "Packages"), []byte(published), 0644))
+		// legacy repositories only record MD5 sums
+		release := fmt.Sprintf(`Suite: stable
+Architectures: amd64
+Components: main
+Date: Mon, 09 Jun 2025 12:00:00 UTC
+MD5Sum:
+ %x %d main/binary-amd64/Packages
+`, md5.Sum([]byte(packages)), len(packages))
+		require.NoError(t, os.WriteFile(filepath.Join(distPath, "Release"), []byte(release), 0644))
+		return repoPath
+	}
+	readPackages := func(t *testing.T, repoPath string) ([]string, error) {
+		entry, err := sources.ParseSourceLine("deb file://"+repoPath+" stable main", 1)
+		require.NoError(t, err)
+		repo, err := Mount(*entry, WithArchitectures("amd64"), WithTransport(apttransport.NewFileTransport()))
+		require.NoError(t, err)
+		var names []string
+		for pkg, err := range repo.Packages(context.Background()) {
+			if err != nil {
+				return names, err
+			}
+			names = append(names, pkg.Package)
+		}
+		return names, nil
+	}
+
+	t.Run("verified", func(t *testing.T) {
+		names, err := readPackages(t, newRepo(t, packages))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"alpha"}, names)
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		_, err := readPackages(t, newRepo(t, strings.Replace(packages, "1.0", "6.6", 2)))
+		require.Error(t, err)
+		assert.ErrorIs(t, err, apttransport.ErrHashMismatch)
+	})
+}
+
+func TestRepository_CheckFreshness(t *testing.T) {
+	now := time.Date(2025, 6, 9, 12, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+	distRoot, err := url.Parse("file:///repo/dists/stable")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		validUntil *time.Time
+		wantErr    bool
+	}{
+		{"no Valid-Until", nil, false},
+		{"still valid", &future, false},
+		{"expired", &past, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &Repository{
+				distRoot: distRoot,
+				release:  &deb822.Release{ValidUntil: tt.validUntil},
+			}
+			err := repo.CheckFreshness(now)
+			if tt.wantErr {
+				assert.ErrorContains(t, err, "expired")
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRepository_UnhashedIndexes(t *testing.T) {
+	entry := func(path string) []deb822.HashEntry {
+		return []deb822.HashEntry{{Hash: "0123", Size: 1, Path: path}}
+	}
+	release := func(sha256, md5 []deb822.HashEntry) *deb822.Release {
+		return &deb822.Release{
+			Components:    []string{"main", "universe"},
+			Architectures: []string{"amd64", "arm64"},
+			SHA256:        append(entry("main/binary-amd64/Packages.xz"), sha256...),
+			MD5Sum:        append(entry("main/binary-amd64/Packages.xz"), md5...),
+		}
+	}
+
+	tests := []struct {
+		name          string
+		release       *deb822.Release
+		components    []string
+		architectures []string
+		expected      []string
+	}{
+		{"all hashed", release(entry("universe/binary-amd64/Packages.gz"), nil), []string{"main", "universe"}, []string{"amd64"}, nil},
+		{"missing component", release(nil, nil), []string{"main", "universe"}, []string{"amd64"}, []string{"universe/binary-amd64/Packages"}},
+		{"only a weaker hash", release(nil, entry("universe/binary-amd64/Packages")), []string{"main", "universe"}, []string{"amd64"}, []string{"universe/binary-amd64/Packages"}},
+		{"component not selected", release(nil, nil), []string{"main"}, []string{"amd64"}, nil},
+		{"missing architecture", release(nil, nil), []string{"main"}, []string{"amd64", "arm64"}, []string{"main/binary-arm64/Packages"}},
+		{"architecture not in release", release(nil, nil), []string{"main"}, []string{"amd64", "riscv64"}, nil},
+		{"component not in release", release(nil, nil), []string{"main", "restricted"}, []string{"amd64"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &Repository{release: tt.release, components: tt.components, architectures: tt.architectures}
+			assert.Equal(t, tt.expected, repo.UnhashedIndexes())
+		})
+	}
+
+	// deb-src sources need the Sources indexes, whatever the architectures
+	sourcesRelease := release(entry("main/source/Sources.xz"), nil)
+	srcRepo := &Repository{release: sourcesRelease, sourceType: sources.SourceTypeSrc, components: []string{"main", "universe"}, architectures: []string{"amd64"}}
+	assert.Equal(t, []string{"universe/source/Sources"}, srcRepo.UnhashedIndexes())
+
+	// the test repositories are all consistent
+	testRepoPath, err := filepath.Abs("testdata/compressedrepo")
+	require.NoError(t, err)
+	source, err := sources.ParseSourceLine("deb file://"+testRepoPath+" stable main", 1)
+	require.NoError(t, err)
+	repo, err := Mount(*source, WithArchitectures("amd64"))
+	require.NoError(t, err)
+	assert.Empty(t, repo.UnhashedIndexes())
+}
+
+func TestRepository_ArchitecturesAndComponents(t *testing.T) {
+	release := &deb822.Release{
+		Components:    []string{"main", "universe"},
+		Architectures: []string{"amd64", "arm64", "i386"},
+	}
+
+	tests := []struct {
+		name                  string
+		components            []string
+		architectures         []string
+		expectedComponents    []string
+		expectedArchitectures []string
+	}{
+		{"everything selected", []string{"main", "universe"}, nil, []string{"main", "universe"}, []string{"amd64", "arm64", "i386"}},
+		{"selection is intersected", []string{"main", "restricted"}, []string{"arm64", "riscv64"}, []string{"main"}, []string{"arm64"}},
+		{"nothing offered", []string{"restricted"}, []string{"riscv64"}, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &Repository{release: release, components: tt.components, architectures: tt.architectures}
+			assert.Equal(t, tt.expectedComponents, repo.Components())
+			assert.Equal(t, tt.expectedArchitectures, repo.Architectures())
+		})
+	}
+
+	testRepoPath, err := filepath.Abs("testdata/compressedrepo")
+	require.NoError(t, err)
+	source, err := sources.ParseSourceLine("deb file://"+testRepoPath+" stable main", 1)
+	require.NoError(t, err)
+	repo, err := Mount(*source, WithArchitectures("arm64", "armhf", "i386"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"main"}, repo.Components())
+	assert.Equal(t, []string{"arm64", "armhf"}, repo.Architectures())
+
+	// a flat repository has no components, and its Release file lists the architectures
+	flatRepoPath, err := filepath.Abs("testdata/flatrepo")
+	require.NoError(t, err)
+	source, err = sources.ParseSourceLine("deb file://"+flatRepoPath+" ./", 1)
+	require.NoError(t, err)
+	repo, err = Mount(*source, WithArchitectures("amd64"))
+	require.NoError(t, err)
+	assert.Empty(t, repo.Components())
+	assert.Equal(t, []string{"amd64"}, repo.Architectures())
+}
+
+func TestMount_StrictFreshness(t *testing.T) {
+	tests := []struct {
+		name       string
+		validUntil time.Time
+		strict     bool
+		wantErr    bool
+	}{
+		{"expired lenient", time.Now().Add(-24 * time.Hour), false, false},
+		{"expired strict", time.Now().Add(-24 * time.Hour), true, true},
+		{"valid strict", time.Now().Add(24 * time.Hour), true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testRepoPath := t.TempDir()
+			require.NoError(t, os.CopyFS(testRepoPath, os.DirFS("testdata/emptyrepo")))
+			releasePath := filepath.Join(testRepoPath, "dists", "stable", "Release")
+			release, err := os.ReadFile(releasePath)
+			require.NoError(t, err)
+			release = append([]byte("Valid-Until: "+tt.validUntil.UTC().Format(time.RFC1123)+"\n"), release...)
+			require.NoError(t, os.WriteFile(releasePath, release, 0644))
+
+			entry, err := sources.ParseSourceLine("deb file://"+testRepoPath+" stable main", 1)
+			require.NoError(t, err)
+
+			var opts []MountOption
+			if tt.strict {
+				opts = append(opts, WithStrictFreshness())
+			}
+			repo, err := Mount(*entry, opts...)
+			if tt.wantErr {
+				assert.ErrorContains(t, err, "expired")
+				return
+			}
+			require.NoError(t, err)
+			assert.NotNil(t, repo.Release().ValidUntil)
+		})
+	}
+}
+
+// slowTransport delays each acquire and records the peak number of concurrent calls
+type slowTransport struct {
+	apttransport.Transport
+	delay   time.Duration
+	active  atomic.Int32
+	maxSeen atomic.Int32
+}
+
+func (s *slowTransport) Acquire(ctx context.Context, req *apttransport.AcquireRequest) (*apttransport.AcquireResponse, error) {
+	n := s.active.Add(1)
+	defer s.active.Add(-1)
+	for {
+		seen := s.maxSeen.Load()
+		if n <= seen || s.maxSeen.CompareAndSwap(seen, n) {
+			break
+		}
+	}
+	time.Sleep(s.delay)
+	return s.Transport.Acquire(ctx, req)
+}
+
+func TestPackages_Concurrent(t *testing.T) {
+	testRepoPath, err := filepath.Abs("testdata/compressedrepo")
+	require.NoError(t, err)
+	entry, err := sources.ParseSourceLine("deb file://"+testRepoPath+" stable main", 1)
+	require.NoError(t, err)
+	archs := WithArchitectures("amd64", "arm64", "armhf")
+
+	collect := func(repo *Repository) []string {
+		var got []string
+		for pkg, err := range repo.Packages(context.Background()) {
+			require.NoError(t, err)
+			got = append(got, pkg.Package+"/"+pkg.Architecture)
+		}
+		return got
+	}
+
+	sequential, err := Mount(*entry, archs)
+	require.NoError(t, err)
+	expected := collect(sequential)
+	require.Len(t, expected, 6)
+
+	tpt := &slowTransport{Transport: apttransport.NewFileTransport(), delay: 20 * time.Millisecond}
+	concurrent, err := Mount(*entry, archs, WithTransport(tpt), WithConcurrency(3))
+	require.NoError(t, err)
+	assert.Equal(t, expected, collect(concurrent), "concurrent fetching must preserve order")
+	assert.Greater(t, tpt.maxSeen.Load(), int32(1))
+	assert.LessOrEqual(t, tpt.maxSeen.Load(), int32(3))
+}
+
+func TestPackages_Progress(t *testing.T) {
+	testRepoPath, err := filepath.Abs("testdata/compressedrepo")
+	require.NoError(t, err)
+	entry, err := sources.ParseSourceLine("deb file://"+testRepoPath+" stable main", 1)
+	require.NoError(t, err)
+
+	progress := apttransport.NewProgress(nil)
+	repo, err := Mount(*entry, WithArchitectures("amd64", "arm64", "armhf"), WithConcurrency(3),
+		WithTransport(apttransport.NewFileTransport()), WithProgress(progress))
+	require.NoError(t, err)
+	for _, err := range repo.Packages(context.Background()) {
+		require.NoError(t, err)
+	}
+
+	var total int64
+	for _, fi := range repo.PackagesIndexes() {
+		total += fi.Size
+	}
+	state := progress.State()
+	assert.Equal(t, apttransport.ProgressState{Files: 3, Completed: 3, Downloaded: total, Total: total}, state)
+}
+
+func TestPackages_ConcurrentStopsOnError(t *testing.T) {
+	testRepoPath := t.TempDir()
+	require.NoError(t, os.CopyFS(testRepoPath, os.DirFS("testdata/compressedrepo")))
+	require.NoError(t, os.Remove(filepath.Join(testRepoPath, "dists/stable/main/binary-arm64/Packages.xz")))
+
+	entry, err := sources.ParseSourceLine("deb file://"+testRepoPath+" stable main", 1)
+	require.NoError(t, err)
+	repo, err := Mount(*entry, WithArchitectures("amd64", "arm64", "armhf"), WithConcurrency(3))
+	require.NoError(t, err)
+
+	var got []string
+	var errs []error
+	for pkg, err := range repo.Packages(context.Background()) {
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		got = append(got, pkg.Package+"/"+pkg.Architecture)
+	}
+	// amd64 is yielded before the missing arm64 index, and armhf never is
+	assert.Equal(t, []string{"alpha/amd64", "bravo/all"}, got)
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "main/binary-arm64/Packages.xz")
+}
+
+func TestPackages_ConcurrentHashMismatch(t *testing.T) {
+	testRepoPath := t.TempDir()
+	require.NoError(t, os.CopyFS(testRepoPath, os.DirFS("testdata/compressedrepo")))
+
+	// the arm64 index keeps its size, so the mismatch is only found at the end of it
+	releasePath := filepath.Join(testRepoPath, "dists/stable/Release")
+	release, err := os.ReadFile(releasePath)
+	require.NoError(t, err)
+	tampered := strings.Replace(string(release), "3f1d9fcd9c05472b9be08dd9816d4122e8ef70b91fdb34061f258169950bef93",
+		strings.Repeat("0", 64), 1)
+	require.NotEqual(t, string(release), tampered)
+	require.NoError(t, os.WriteFile(releasePath, []byte(tampered), 0644))
+
+	entry, err := sources.ParseSourceLine("deb file://"+testRepoPath+" stable main", 1)
+	require.NoError(t, err)
+	repo, err := Mount(*entry, WithArchitectures("amd64", "arm64", "armhf"), WithConcurrency(3))
+	require.NoError(t, err)
+
+	var got []string
+	var errs []error
+	for pkg, err := range repo.Packages(context.Background()) {
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		got = append(got, pkg.Package+"/"+pkg.Architecture)
+	}
+	// none of the packages of the corrupt arm64 index are yielded
+	assert.Equal(t, []string{"alpha/amd64", "bravo/all"}, got)
+	require.Len(t, errs, 1)
+	assert.ErrorIs(t, errs[0], apttransport.ErrHashMismatch)
+}
+
+func TestPackages_ConcurrentEarlyBreak(t *testing.T) {
+	testRepoPath, err := filepath.Abs("testdata/compressedrepo")
+	require.NoError(t, err)
+	entry, err := sources.ParseSourceLine("deb file://"+testRepoPath+" stable main", 1)
+	require.NoError(t, err)
+	repo, err := Mount(*entry, WithArchitectures("amd64", "arm64", "armhf"), WithConcurrency(2))
+	require.NoError(t, err)
+
+	for pkg, err := range repo.Packages(context.Background()) {
+		require.NoError(t, err)
+		assert.Equal(t, "alpha", pkg.Package)
+		break
+	}
+}
+
+// recordingTransport records the URIs of every acquire
+type recordingTransport struct {
+	apttransport.Transport
+	mu   sync.Mutex
+	uris []string
+}
+
+func (r *recordingTransport) Acquire(ctx context.Context, req *apttransport.AcquireRequest) (*apttransport.AcquireResponse, error) {
+	r.mu.Lock()
+	r.uris = append(r.uris, req.URI.Path)
+	r.mu.Unlock()
+	return r.Transport.Acquire(ctx, req)
+}
+
+// deadlineRecorder records how long each request's context allows
+type deadlineRecorder struct {
+	apttransport.Transport
+	mu        sync.Mutex
+	remaining map[string]time.Duration
+}
+
+func (d *deadlineRecorder) Acquire(ctx context.Context, req *apttransport.AcquireRequest) (*apttransport.AcquireResponse, error) {
+	d.mu.Lock()
+	if d.remaining == nil {
+		d.remaining = make(map[string]time.Duration)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		d.remaining[path.Base(req.URI.Path)] = time.Until(deadline)
+	}
+	d.mu.Unlock()
+	return d.Transport.Acquire(ctx, req)
+}
+
+func TestMount_ProbeTimeout(t *testing.T) {
+	testRepoPath, err := filepath.Abs("testdata/compressedrepo")
+	require.NoError(t, err)
+	entry, err := sources.ParseSourceLine("deb file://"+testRepoPath+" stable main", 1)
+	require.NoError(t, err)
+
+	// the Release file is fetched within a short timeout of its own
+	tpt := &deadlineRecorder{Transport: apttransport.NewFileTransport()}
+	_, err = Mount(*entry, WithTransport(tpt))
+	require.NoError(t, err)
+	require.Contains(t, tpt.remaining, "Release")
+	assert.LessOrEqual(t, tpt.remaining["Release"], probeTimeout)
+
+	_, err = DiscoverAll("file://"+testRepoPath, WithDiscoveryTransport(tpt), WithSuites("stable"))
+	require.NoError(t, err)
+	assert.LessOrEqual(t, tpt.remaining["Release"], discoveryProbeTimeout)
+}
+
+// newByHashRepo copies the compressed test repository and enables Acquire-By-Hash in its Release file.
+// When publish is true the amd64 index is also published at its by-hash location.
+func newByHashRepo(t *testing.T, publish bool) (string, string) {
+	t.Helper()
+	testRepoPath := t.TempDir()
+	require.NoError(t, os.CopyFS(testRepoPath, os.DirFS("testdata/compressedrepo")))
+
+	distPath := filepath.Join(testRepoPath, "dists", "stable")
+	releasePath := filepath.Join(distPath, "Release")
+	release, err := os.ReadFile(releasePath)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(releasePath, append([]byte("Acquire-By-Hash: yes\n"), release...), 0644))
+
+	parsed, err := deb822.ParseRelease(bytes.NewReader(release))
+	require.NoError(t, err)
+	var hash string
+	for _, fi := range parsed.GetAvailableFiles() {
+		if fi.Path == "main/binary-amd64/Packages.bz2" {
+			hash = fi.SHA256
+		}
+	}
+	require.NotEmpty(t, hash)
+
+	if publish {
+		content, err := os.ReadFile(filepath.Join(distPath, "main/binary-amd64/Packages.bz2"))
+		require.NoError(t, err)
+		byHashDir := filepath.Join(distPath, "main/binary-amd64/by-hash/SHA256")
+		require.NoError(t, os.MkdirAll(byHashDir, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(byHashDir, hash), content, 0644))
+	}
+	return testRepoPath, hash
+}
+
+func TestPackages_AcquireByHash(t *testing.T) {
+	tests := []struct {
+		name    string
+		publish bool
+	}{
+		{"by-hash available", true},
+		{"fallback to canonical path", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testRepoPath, hash := newByHashRepo(t, tt.publish)
+			entry, err := sources.ParseSourceLine("deb file://"+testRepoPath+" stable main", 1)
+			require.NoError(t, err)
+
+			tpt := &recordingTransport{Transport: apttransport.NewFileTransport()}
+			repo, err := Mount(*entry, WithArchitectures("amd64"), WithTransport(tpt))
+			require.NoError(t, err)
+
+			var names []string
+			for pkg, err := range repo.Packages(context.Background()) {
+				require.NoError(t, err)
+				names = append(names, pkg.Package)
+			}
+			assert.Equal(t, []string{"alpha", "bravo"}, names)
+
+			distPath := filepath.Join(testRepoPath, "dists", "stable")
+			expected := []string{
+				filepath.Join(distPath, "Release"),
+				filepath.Join(distPath, "main/binary-amd64/by-hash/SHA256", hash),
+			}
+			if !tt.publish {
+				expected = append(expected, filepath.Join(distPath, "main/binary-amd64/Packages.bz2"))
+			}
+			assert.Equal(t, expected, tpt.uris)
+		})
+	}
+}
+
+func TestRepository_IndexURLs(t *testing.T) {
+	testRepoPath, hash := newByHashRepo(t, false)
+	entry, err := sources.ParseSourceLine("deb file://"+testRepoPath+" stable main", 1)
+	require.NoError(t, err)
+	repo, err := Mount(*entry, WithArchitectures("amd64"))
+	require.NoError(t, err)
+
+	var urls []string
+	for _, u := range repo.IndexURLs() {
+		urls = append(urls, u.String())
+	}
+	// every index is listed, whichever architectures are selected
+	distURL := "file://" + filepath.Join(testRepoPath, "dists", "stable")
+	assert.Contains(t, urls, distURL+"/main/binary-amd64/Packages.bz2")
+	assert.Contains(t, urls, distURL+"/main/binary-amd64/by-hash/SHA256/"+hash)
+	assert.Contains(t, urls, distURL+"/main/binary-arm64/Packages.xz")
+	assert.Len(t, urls, 2*len(repo.Release().GetAvailableFiles()))
+}
+
+func TestRepository_SourcePackages(t *testing.T) {
+	testRepoPath, err := filepath.Abs("testdata/compressedrepo")
+	require.NoError(t, err)
+	entry, err := sources.ParseSourceLine("deb-src file://"+testRepoPath+" stable main", 1)
+	require.NoError(t, err)
+
+	// Binary architectures don't filter out source indexes
+	repo, err := Mount(*entry, WithArchitectures("amd64"))
+	require.NoError(t, err)
+
+	indexes := repo.SourcesIndexes()
+	require.Len(t, indexes, 1)
+	assert.Equal(t, "main/source/Sources.gz", indexes[0].Path)
+
+	var names []string
+	for src, err := range repo.SourcePackages(context.Background()) {
+		require.NoError(t, err)
+		names = append(names, src.Package+"="+src.Version)
+	}
+	assert.Equal(t, []string{"alpha=1.0-1", "bravo=2.0-1"}, names)
+}
+
+func TestRepository_Contents(t *testing.T) {
+	testRepoPath, err := filepath.Abs("testdata/compressedrepo")
+	require.NoError(t, err)
+	entry, err := sources.ParseSourceLine("deb file://"+testRepoPath+" stable main", 1)
+	require.NoError(t, err)
+
+	repo, err := Mount(*entry, WithArchitectures("amd64"))
+	require.NoError(t, err)
+
+	indexes := repo.ContentsIndexes()
+	require.Len(t, indexes, 1)
+	assert.Equal(t, "Contents-amd64.gz", indexes[0].Path)
+
+	var entries []deb822.ContentEntry
+	for entry, err := range repo.Contents(context.Background()) {
+		require.NoError(t, err)
+		entries = append(entries, entry)
+	}
+	assert.Equal(t, []deb822.ContentEntry{
+		{Path: "usr/bin/alpha", Packages: []string{"alpha"}},
+		{Path: "usr/share/doc/alpha/copyright", Packages: []string{"alpha", "alpha-doc"}},
+	}, entries)
+}
+
+func TestRepository_ContentsRootAndComponents(t *testing.T) {
+	// the root index repeats what's in the component ones, and the udeb index lists installer packages
+	contents := map[string]string{
+		"Contents-amd64":           "usr/bin/alpha main/alpha\nusr/bin/bravo contrib/bravo\n",
+		"main/Contents-amd64":      "usr/bin/alpha main/alpha\n",
+		"contrib/Contents-amd64":   "usr/bin/bravo contrib/bravo\n",
+		"main/Contents-udeb-amd64": "usr/lib/installer main/installer-udeb\n",
+	}
+	mount := func(t *testing.T, published ...string) *Repository {
+		repoPath := t.TempDir()
+		distPath := filepath.Join(repoPath, "dists", "stable")
+		release := "Suite: stable\nArchitectures: amd64\nComponents: main contrib\nDate: Mon, 09 Jun 2025 12:00:00 UTC\nSHA256:\n"
+		for _, name := range published {
+			require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(distPath, name)), 0755))
+			require.NoError(t, os.WriteFile(filepath.Join(distPath, name), []byte(contents[name]), 0644))
+			release += fmt.Sprintf(" %s %d %s\n", sha256Hex([]byte(contents[name])), len(contents[name]), name)
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(distPath, "Release"), []byte(release), 0644))
+
+		entry, err := sources.ParseSourceLine("deb file://"+repoPath+" stable main contrib", 1)
+		require.NoError(t, err)
+		repo, err := Mount(*entry, WithArchitectures("amd64"))
+		require.NoError(t, err)
+		return repo
+	}
+	paths := func(repo *Repository) []string {
+		var paths []string
+		for _, fi := range repo.ContentsIndexes() {
+			paths = append(paths, fi.Path)
+		}
+		return paths
+	}
+
+	// every component has its own index, so the root one isn't read as well
+	repo := mount(t, "Contents-amd64", "main/Contents-amd64", "contrib/Contents-amd64", "main/Contents-udeb-amd64")
+	assert.Equal(t, []string{"contrib/Contents-amd64", "main/Contents-amd64"}, paths(repo))
+	var entries []string
+	for entry, err := range repo.Contents(context.Background()) {
+		require.NoError(t, err)
+		entries = append(entries, entry.Path)
+	}
+	assert.Equal(t, []string{"usr/bin/bravo", "usr/bin/alpha"}, entries)
+
+	// contrib is only in the root index, which lists main again
+	repo = mount(t, "Contents-amd64", "main/Contents-amd64")
+	assert.Equal(t, []string{"Contents-amd64"}, paths(repo))
+
+	udeb := mount(t, "main/Contents-udeb-amd64").Release().GetAvailableFiles()
+	require.Len(t, udeb, 1)
+	assert.Equal(t, "Contents-udeb", udeb[0].Type)
+	assert.Equal(t, "amd64", udeb[0].Architecture)
+}
+
+func TestRepository_PackageFiles(t *testing.T) {
+	testRepoPath, err := filepath.Abs("testdata/compressedrepo")
+	require.NoError(t, err)
+	entry, err := sources.ParseSourceLine("deb file://"+testRepoPath+" stable main", 1)
+	require.NoError(t, err)
+
+	tpt := &recordingTransport{Transport: apttransport.NewFileTransport()}
+	repo, err := Mount(*entry, WithArchitectures("amd64", "arm64"), WithTransport(tpt))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	files, err := repo.PackageFiles(ctx, "alpha", "amd64")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"usr/bin/alpha", "usr/share/doc/alpha/copyright"}, files)
+	fetched := len(tpt.uris)
+
+	// later lookups are answered without scanning the Contents indexes again
+	files, err = repo.PackageFiles(ctx, "alpha-arm", "arm64")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"usr/bin/alpha"}, files)
+	files, err = repo.PackageFiles(ctx, "alpha-arm", "amd64")
+	require.NoError(t, err)
+	assert.Empty(t, files)
+	files, err = repo.PackageFiles(ctx, "alpha-doc", "all")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"usr/share/doc/alpha/copyright"}, files)
+	assert.Len(t, tpt.uris, fetched)
+
+	flat, err := filepath.Abs("testdata/flatrepo")
+	require.NoError(t, err)
+	entry, err = sources.ParseSourceLine("deb file://"+flat+"/ /", 1)
+	require.NoError(t, err)
+	repo, err = Mount(*entry, WithArchitectures("amd64"))
+	require.NoError(t, err)
+	_, err = repo.PackageFiles(ctx, "kubeadm", "amd64")
+	assert.ErrorIs(t, err, ErrNoContentsIndex)
+}
+
+func TestRepository_Descriptions(t *testing.T) {
+	testRepoPath, err := filepath.Abs("testdata/compressedrepo")
+	require.NoError(t, err)
+	entry, err := sources.ParseSourceLine("deb file://"+testRepoPath+" stable main", 1)
+	require.NoError(t, err)
+
+	repo, err := Mount(*entry, WithArchitectures("amd64"))
+	require.NoError(t, err)
+
+	descriptions, err := repo.Descriptions(context.Background(), "en")
+	require.NoError(t, err)
+	require.Len(t, descriptions, 1)
+	assert.Contains(t, descriptions["c4af5798d94b2ffc84c5cf2c4c3736f4"], "Alpha is the first of the packages")
+
+	// A language without a Translation file yields no descriptions rather than an error
+	descriptions, err = repo.Descriptions(context.Background(), "fr")
+	require.NoError(t, err)
+	assert.Empty(t, descriptions)
+}
@@ -0,0 +1,306 @@
+package apt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/nicwaller/apt-look/pkg/apt/apttransport"
+	"github.com/nicwaller/apt-look/pkg/apt/sources"
+	"github.com/nicwaller/apt-look/pkg/deb822"
+)
+
+// DiscoverOptions contains configuration options for discovering distributions
+type DiscoverOptions struct {
+	// Suites to probe, in order. Defaults to the contents of dists/ when the transport can list
+	// directories, and to guesses based on the archive root URL otherwise.
+	Suites    []string
+	Transport apttransport.Transport
+	Registry  *apttransport.Registry
+
+	// Architectures limits the components of each distribution found to those with a Packages
+	// index for one of them, or for "all". Distributions left without components are skipped.
+	Architectures []string
+
+	// Depth also looks for archives nested up to this many directories below the archive root,
+	// e.g. ubuntu/22.04/prod, where the transport can list directories. Zero only probes the root.
+	Depth int
+
+	// maxResults stops probing an archive once this many of its distributions are found; zero means no limit
+	maxResults int
+}
+
+// DiscoverOption is a functional option for configuring DiscoverAll behavior
+type DiscoverOption func(*DiscoverOptions)
+
+// WithSuites probes exactly these suites instead of listing dists/ or guessing from the URL.
+// Use "/" for a flat repository.
+func WithSuites(suites ...string) DiscoverOption {
+	return func(opts *DiscoverOptions) {
+		opts.Suites = suites
+	}
+}
+
+// WithDiscoveryTransport sets a specific transport to fetch Release files with
+func WithDiscoveryTransport(transport apttransport.Transport) DiscoverOption {
+	return func(opts *DiscoverOptions) {
+		opts.Transport = transport
+	}
+}
+
+// WithDiscoveryRegistry probes through the registry, with its cache and timeouts, instead of DefaultRegistry's transports
+func WithDiscoveryRegistry(registry *apttransport.Registry) DiscoverOption {
+	return func(opts *DiscoverOptions) {
+		opts.Registry = registry
+	}
+}
+
+// WithDiscoveryArchitectures only returns components with packages for these architectures
+func WithDiscoveryArchitectures(architectures ...string) DiscoverOption {
+	return func(opts *DiscoverOptions) {
+		opts.Architectures = architectures
+	}
+}
+
+// WithDiscoveryDepth also looks for archives in the directories up to depth levels below the archive root
+func WithDiscoveryDepth(depth int) DiscoverOption {
+	return func(opts *DiscoverOptions) {
+		opts.Depth = depth
+	}
+}
+
+// DiscoverAll probes every candidate suite below an archive root and returns an entry for each one
+// that has a readable Release file, with the components it lists
+func DiscoverAll(archiveRoot string, optFns ...DiscoverOption) ([]sources.Entry, error) {
+	return DiscoverAllContext(context.Background(), archiveRoot, optFns...)
+}
+
+// DiscoverAllContext is like DiscoverAll, with a context that can cancel probing
+func DiscoverAllContext(ctx context.Context, archiveRoot string, optFns ...DiscoverOption) ([]sources.Entry, error) {
+	opts := &DiscoverOptions{}
+	for _, fn := range optFns {
+		fn(opts)
+	}
+
+	repoURL, err := url.Parse(archiveRoot)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive root URL: %w", err)
+	}
+
+	tpt := opts.Transport
+	if tpt == nil {
+		registry := opts.Registry
+		if registry == nil {
+			registry = apttransport.DefaultRegistry
+		}
+		tpt, err = registry.Select(repoURL.Scheme)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported transport %q: %w", repoURL.Scheme, err)
+		}
+		// a registry given explicitly is probed through, so its cache and timeouts apply
+		if opts.Registry != nil {
+			tpt = opts.Registry
+		}
+	}
+
+	foundEntries, err := discoverArchive(ctx, tpt, repoURL, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Depth > 0 {
+		nested, err := discoverNested(ctx, tpt, repoURL, opts, opts.Depth)
+		if err != nil {
+			return nil, err
+		}
+		foundEntries = append(foundEntries, nested...)
+	}
+
+	if len(foundEntries) == 0 {
+		return nil, fmt.Errorf("no valid distributions found in repository")
+	}
+
+	return foundEntries, nil
+}
+
+// discoverArchive probes the candidate suites of the archive at repoURL
+func discoverArchive(ctx context.Context, tpt apttransport.Transport, repoURL *url.URL, opts *DiscoverOptions) ([]sources.Entry, error) {
+	// Probe the requested suites, or the ones in dists/ if the transport can list it,
+	// or else guesses ordered by likelihood
+	suites := opts.Suites
+	if len(suites) == 0 {
+		suites = listSuites(ctx, tpt, repoURL)
+	}
+	var candidates []distributionCandidate
+	if len(suites) > 0 {
+		for _, suite := range suites {
+			candidates = append(candidates, distributionCandidate{distribution: suite, components: []string{"main"}})
+		}
+	} else {
+		candidates = getDistributionCandidates(repoURL.String())
+	}
+
+	var foundEntries []sources.Entry
+	var probed []string
+	for _, candidate := range candidates {
+		// the heuristics can suggest a suite more than once with different components, and
+		// flat repositories under more than one name, like "/" and "."
+		distRoot := strings.TrimSuffix(distributionRoot(repoURL, candidate.distribution).String(), "/")
+		if slices.Contains(probed, distRoot) {
+			continue
+		}
+		probed = append(probed, distRoot)
+
+		release, err := probeRelease(ctx, tpt, repoURL, candidate.distribution)
+		if ctx.Err() != nil {
+			// a cancelled probe says nothing about whether the suite exists
+			return nil, fmt.Errorf("discovery cancelled: %w", ctx.Err())
+		}
+		if err != nil {
+			// Release file doesn't exist or is invalid for this distribution, skip it
+			continue
+		}
+
+		// Use actual components from Release file if available
+		components := candidate.components
+		if len(release.Components) > 0 {
+			components = release.Components
+		}
+		if len(opts.Architectures) > 0 && len(components) > 0 {
+			components = componentsForArchitectures(release, components, opts.Architectures)
+			if len(components) == 0 {
+				log.Debug().Str("distribution", candidate.distribution).Strs("architectures", opts.Architectures).
+					Msg("Skipping distribution without packages for the architectures")
+				continue
+			}
+		}
+
+		foundEntries = append(foundEntries, sources.Entry{
+			Type:         sources.SourceTypeDeb,
+			ArchiveRoot:  repoURL,
+			Distribution: candidate.distribution,
+			Components:   components,
+			Options:      make(map[string]string),
+			Enabled:      true,
+		})
+
+		if opts.maxResults > 0 && len(foundEntries) >= opts.maxResults {
+			break
+		}
+	}
+
+	return foundEntries, nil
+}
+
+// discoverNested looks for archives in the directories below root, down to depth levels. Only directories
+// with a dists/ directory of their own are probed, so nothing is found where the transport can't list.
+func discoverNested(ctx context.Context, tpt apttransport.Transport, root *url.URL, opts *DiscoverOptions, depth int) ([]sources.Entry, error) {
+	listTransport, ok := tpt.(apttransport.ListTransport)
+	if !ok {
+		return nil, nil
+	}
+	names, err := listTransport.List(ctx, root)
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("discovery cancelled: %w", ctx.Err())
+	}
+	if err != nil {
+		log.Debug().Err(err).Str("uri", root.String()).Msg("Can't list directory, not looking for nested archives")
+		return nil, nil
+	}
+
+	var foundEntries []sources.Entry
+	for _, name := range names {
+		// these belong to the archive at root itself
+		if name == "dists" || name == "pool" {
+			continue
+		}
+		dir := root.JoinPath(name)
+		// files and unreadable directories can't be listed, and are skipped
+		entries, err := listTransport.List(ctx, dir)
+		if err != nil {
+			continue
+		}
+		if slices.Contains(entries, "dists") {
+			log.Debug().Str("uri", dir.String()).Msg("Found nested archive")
+			found, err := discoverArchive(ctx, tpt, dir, opts)
+			if err != nil {
+				return nil, err
+			}
+			foundEntries = append(foundEntries, found...)
+		}
+		if depth > 1 {
+			found, err := discoverNested(ctx, tpt, dir, opts, depth-1)
+			if err != nil {
+				return nil, err
+			}
+			foundEntries = append(foundEntries, found...)
+		}
+	}
+	return foundEntries, nil
+}
+
+// componentsForArchitectures keeps the components that the Release lists a binary Packages index for,
+// for one of the architectures or "all". A Release that lists no Packages indexes at all can't be
+// judged, so its components are all kept.
+func componentsForArchitectures(release *deb822.Release, components, architectures []string) []string {
+	var indexes []string
+	for _, fi := range release.GetAvailableFiles() {
+		if fi.Type == "Packages" {
+			indexes = append(indexes, fi.Path)
+		}
+	}
+	if len(indexes) == 0 {
+		return components
+	}
+
+	// paths are matched rather than FileInfo.Component, which is only the first path segment
+	// of components like updates/main
+	var kept []string
+	for _, component := range components {
+		if slices.ContainsFunc(indexes, func(index string) bool {
+			dir, ok := strings.CutPrefix(index, component+"/binary-")
+			if !ok {
+				return false
+			}
+			arch, _, _ := strings.Cut(dir, "/")
+			return arch == "all" || slices.Contains(architectures, arch)
+		}) {
+			kept = append(kept, component)
+		}
+	}
+	return kept
+}
+
+// listSuites returns the directory names under dists/, or nil if the transport can't list them
+func listSuites(ctx context.Context, tpt apttransport.Transport, archiveRoot *url.URL) []string {
+	listTransport, ok := tpt.(apttransport.ListTransport)
+	if !ok {
+		return nil
+	}
+	suites, err := listTransport.List(ctx, archiveRoot.JoinPath("dists"))
+	if err != nil {
+		log.Debug().Err(err).Msg("Can't list distributions, guessing suite names instead")
+		return nil
+	}
+	return suites
+}
+
+// discoveryProbeTimeout bounds each probe of a candidate suite, shorter than Mount's probeTimeout since
+// many of the guesses don't exist
+const discoveryProbeTimeout = 5 * time.Second
+
+// probeRelease fetches and parses the Release file of a distribution, using the same layout as Mount
+func probeRelease(ctx context.Context, tpt apttransport.Transport, archiveRoot *url.URL, distribution string) (*deb822.Release, error) {
+	ctx, cancel := context.WithTimeout(ctx, discoveryProbeTimeout)
+	defer cancel()
+	release, _, err := fetchRelease(ctx, tpt, distributionRoot(archiveRoot, distribution))
+	if err != nil {
+		return nil, err
+	}
+	return deb822.ParseRelease(bytes.NewReader(release))
+}
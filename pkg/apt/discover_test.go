@@ -0,0 +1,191 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nicwaller/apt-look/pkg/apt/apttransport"
+	"github.com/nicwaller/apt-look/pkg/apt/sources"
+)
+
+func distributions(entries []sources.Entry) []string {
+	var dists []string
+	for _, entry := range entries {
+		dists = append(dists, entry.Distribution)
+	}
+	return dists
+}
+
+func TestDiscoverAll_Suites(t *testing.T) {
+	testRepoPath, err := filepath.Abs("testdata/multidistrepo")
+	require.NoError(t, err)
+
+	entries, err := DiscoverAll("file://"+testRepoPath,
+		WithSuites("stable", "testing", "missing", "unstable", "noble", "/"))
+	require.NoError(t, err)
+
+	// every suite with a Release file is found, in the order probed
+	assert.Equal(t, []string{"stable", "testing", "unstable", "noble", "/"}, distributions(entries))
+	assert.Equal(t, []string{"main", "universe"}, entries[3].Components)
+	assert.Equal(t, []string{"main"}, entries[4].Components)
+	for _, entry := range entries {
+		assert.True(t, entry.Enabled)
+		assert.Equal(t, testRepoPath, entry.ArchiveRoot.Path)
+	}
+}
+
+func TestDiscoverAll_Listing(t *testing.T) {
+	testRepoPath, err := filepath.Abs("testdata/multidistrepo")
+	require.NoError(t, err)
+
+	// the file transport lists dists/, so every suite is found; Discover stops after three
+	entries, err := DiscoverAll("file://" + testRepoPath)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"current", "noble", "stable", "testing", "unstable"}, distributions(entries))
+
+	entries, err = Discover("file://" + testRepoPath)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"current", "noble", "stable"}, distributions(entries))
+}
+
+func TestDiscoverAll_Heuristics(t *testing.T) {
+	testRepoPath, err := filepath.Abs("testdata/multidistrepo")
+	require.NoError(t, err)
+
+	// embedding through the interface hides FileTransport.List, forcing the guessed suite names;
+	// testing, unstable and noble aren't guessed for a URL without distribution hints, and the flat
+	// repository at the root is found once though it is guessed as both "/" and "."
+	getOnly := &struct{ apttransport.Transport }{apttransport.NewFileTransport()}
+	entries, err := DiscoverAll("file://"+testRepoPath, WithDiscoveryTransport(getOnly))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"stable", "current", "/"}, distributions(entries))
+}
+
+func TestDiscoverAll_Registry(t *testing.T) {
+	testRepoPath, err := filepath.Abs("testdata/multidistrepo")
+	require.NoError(t, err)
+
+	// a registry without the file transport can't reach the repository
+	_, err = DiscoverAll("file://"+testRepoPath, WithDiscoveryRegistry(apttransport.NewRegistry()))
+	assert.ErrorContains(t, err, "unsupported transport")
+
+	entries, err := DiscoverAll("file://"+testRepoPath,
+		WithDiscoveryTransport(apttransport.NewFileTransport()), WithSuites("testing"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"testing"}, distributions(entries))
+
+	// probes go through the registry itself, so the Release files land in its cache
+	registry := apttransport.NewRegistryWithCache(apttransport.CacheConfig{CacheDir: t.TempDir()})
+	registry.Register(apttransport.NewFileTransport())
+	entries, err = DiscoverAll("file://"+testRepoPath, WithDiscoveryRegistry(registry), WithSuites("testing"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"testing"}, distributions(entries))
+	info, err := registry.CacheInfo()
+	require.NoError(t, err)
+	assert.Equal(t, 1, info.Entries)
+}
+
+func TestDiscover_DistRootTransport(t *testing.T) {
+	testRepoPath, err := filepath.Abs("testdata/multidistrepo")
+	require.NoError(t, err)
+	distRoot := "file://" + testRepoPath + "/dists/noble"
+
+	// a distribution URL is mounted with the given transport or registry too
+	tpt := &recordingTransport{Transport: apttransport.NewFileTransport()}
+	entries, err := Discover(distRoot, WithDiscoveryTransport(tpt))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"noble"}, distributions(entries))
+	assert.Equal(t, []string{filepath.Join(testRepoPath, "dists", "noble", "Release")}, tpt.uris)
+
+	_, err = Discover(distRoot, WithDiscoveryRegistry(apttransport.NewRegistry()))
+	assert.ErrorContains(t, err, "failed to mount distribution URL")
+}
+
+func TestDiscoverAll_Depth(t *testing.T) {
+	vendor := t.TempDir()
+	for _, dir := range []string{"debian", "ubuntu/22.04", "old/ubuntu/20.04"} {
+		require.NoError(t, os.CopyFS(filepath.Join(vendor, dir), os.DirFS("testdata/compressedrepo")))
+	}
+	archiveRoots := func(entries []sources.Entry) []string {
+		var roots []string
+		for _, entry := range entries {
+			rel, err := filepath.Rel(vendor, entry.ArchiveRoot.Path)
+			require.NoError(t, err)
+			roots = append(roots, filepath.ToSlash(rel)+" "+entry.Distribution)
+		}
+		return roots
+	}
+
+	// the vendor root isn't an archive itself
+	_, err := DiscoverAll("file://" + vendor)
+	assert.ErrorContains(t, err, "no valid distributions found")
+
+	entries, err := DiscoverAll("file://"+vendor, WithDiscoveryDepth(2))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"debian stable", "ubuntu/22.04 stable"}, archiveRoots(entries))
+
+	entries, err = Discover("file://"+vendor, WithDiscoveryDepth(3))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"debian stable", "old/ubuntu/20.04 stable", "ubuntu/22.04 stable"}, archiveRoots(entries))
+
+	// nested archives are only found where the transport can list directories
+	getOnly := &struct{ apttransport.Transport }{apttransport.NewFileTransport()}
+	_, err = DiscoverAll("file://"+vendor, WithDiscoveryDepth(3), WithDiscoveryTransport(getOnly))
+	assert.ErrorContains(t, err, "no valid distributions found")
+}
+
+func TestDiscoverAllContext_Cancelled(t *testing.T) {
+	testRepoPath, err := filepath.Abs("testdata/multidistrepo")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// a cancelled probe is reported as such, not as a repository without distributions
+	_, err = DiscoverAllContext(ctx, "file://"+testRepoPath, WithSuites("stable"))
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = DiscoverContext(ctx, "file://"+testRepoPath+"/dists/stable")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestDiscoverAll_Architectures(t *testing.T) {
+	repoPath := t.TempDir()
+	writeRelease := func(suite, components string, indexes ...string) {
+		var release strings.Builder
+		fmt.Fprintf(&release, "Suite: %s\nArchitectures: amd64 arm64 i386\nComponents: %s\nDate: Mon, 09 Jun 2025 12:00:00 UTC\nSHA256:\n", suite, components)
+		for _, index := range indexes {
+			fmt.Fprintf(&release, " %064d 0 %s\n", 0, index)
+		}
+		distPath := filepath.Join(repoPath, "dists", suite)
+		require.NoError(t, os.MkdirAll(distPath, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(distPath, "Release"), []byte(release.String()), 0644))
+	}
+	writeRelease("stable", "main restricted contrib updates/main",
+		"main/binary-amd64/Packages", "main/binary-arm64/Packages.gz", "main/source/Sources.gz",
+		"restricted/binary-amd64/Packages", "contrib/binary-all/Packages", "updates/main/binary-arm64/Packages")
+	writeRelease("legacy", "main", "main/binary-i386/Packages")
+	// without any Packages indexes listed there's nothing to judge the components by
+	writeRelease("unlisted", "main")
+
+	entries, err := DiscoverAll("file://"+repoPath, WithSuites("stable", "legacy", "unlisted"),
+		WithDiscoveryArchitectures("arm64"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"stable", "unlisted"}, distributions(entries))
+	assert.Equal(t, []string{"main", "contrib", "updates/main"}, entries[0].Components)
+	assert.Equal(t, []string{"main"}, entries[1].Components)
+
+	entries, err = Discover("file://"+repoPath+"/dists/stable", WithDiscoveryArchitectures("amd64"))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, []string{"main", "restricted", "contrib"}, entries[0].Components)
+
+	_, err = Discover("file://"+repoPath+"/dists/legacy", WithDiscoveryArchitectures("amd64"))
+	assert.ErrorContains(t, err, "has no packages for amd64")
+}
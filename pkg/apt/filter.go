@@ -0,0 +1,66 @@
+package apt
+
+import (
+	"context"
+	"iter"
+	"strings"
+
+	"github.com/nicwaller/apt-look/pkg/deb822"
+	"github.com/nicwaller/apt-look/pkg/rfc822"
+)
+
+// Filter narrows down the packages of PackagesFiltered. Empty fields match everything.
+type Filter struct {
+	// Name is the exact name of the package
+	Name string
+	// Arch is the architecture of the package; packages built for "all" always match
+	Arch string
+	// Component is the component whose indexes are read, e.g. "main"
+	Component string
+	// SectionPrefix matches the start of the package's section, e.g. "libs" or "universe/"
+	SectionPrefix string
+}
+
+// PackagesFiltered iterates over the selected packages that match filter, like Packages.
+// Only the indexes of the filter's component and architecture are fetched, and records that
+// don't match are skipped before their fields are parsed.
+func (r *Repository) PackagesFiltered(ctx context.Context, filter Filter) iter.Seq2[*deb822.Package, error] {
+	return func(yield func(*deb822.Package, error) bool) {
+		for ref, err := range r.packageRefs(ctx, filter) {
+			if !yield(ref.Package, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// selectsIndex reports whether a Packages index can hold packages that match the filter.
+// The index of a flat repository has no component or architecture, so it is always read.
+// Components are matched by path, since nested ones such as updates/main span several segments.
+func (f Filter) selectsIndex(fi deb822.FileInfo) bool {
+	if f.Component != "" && fi.Component != "" && !strings.HasPrefix(fi.Path, f.Component+"/") {
+		return false
+	}
+	if f.Arch != "" && fi.Architecture != "" && fi.Architecture != f.Arch && fi.Architecture != "all" {
+		return false
+	}
+	return true
+}
+
+// keep returns the test of a Packages record against the filter, or nil if the filter accepts every record
+func (f Filter) keep() func(rfc822.Header) bool {
+	if f.Name == "" && f.Arch == "" && f.SectionPrefix == "" {
+		return nil
+	}
+	return func(header rfc822.Header) bool {
+		if f.Name != "" && header.Get("Package") != f.Name {
+			return false
+		}
+		if f.Arch != "" {
+			if arch := header.Get("Architecture"); arch != f.Arch && arch != "all" {
+				return false
+			}
+		}
+		return strings.HasPrefix(header.Get("Section"), f.SectionPrefix)
+	}
+}
@@ -0,0 +1,88 @@
+package apt
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nicwaller/apt-look/pkg/apt/apttransport"
+	"github.com/nicwaller/apt-look/pkg/apt/sources"
+)
+
+func TestRepository_PackagesFiltered(t *testing.T) {
+	testRepoPath, err := filepath.Abs("testdata/compressedrepo")
+	require.NoError(t, err)
+	entry, err := sources.ParseSourceLine("deb file://"+testRepoPath+" stable main", 1)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		packages []string
+		fetched  []string
+	}{
+		{"no filter", Filter{}, []string{"alpha:amd64", "bravo:all", "alpha:arm64", "bravo:all"}, []string{"main/binary-amd64/Packages.bz2", "main/binary-arm64/Packages.xz"}},
+		{"name", Filter{Name: "bravo"}, []string{"bravo:all", "bravo:all"}, []string{"main/binary-amd64/Packages.bz2", "main/binary-arm64/Packages.xz"}},
+		{"arch", Filter{Arch: "arm64"}, []string{"alpha:arm64", "bravo:all"}, []string{"main/binary-arm64/Packages.xz"}},
+		{"name and arch", Filter{Name: "alpha", Arch: "amd64"}, []string{"alpha:amd64"}, []string{"main/binary-amd64/Packages.bz2"}},
+		{"section", Filter{SectionPrefix: "ut"}, []string{"alpha:amd64", "alpha:arm64"}, []string{"main/binary-amd64/Packages.bz2", "main/binary-arm64/Packages.xz"}},
+		{"component", Filter{Component: "universe"}, nil, nil},
+		{"unselected arch", Filter{Arch: "armhf"}, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tpt := &recordingTransport{Transport: apttransport.NewFileTransport()}
+			repo, err := Mount(*entry, WithArchitectures("amd64", "arm64"), WithTransport(tpt))
+			require.NoError(t, err)
+
+			var packages []string
+			for pkg, err := range repo.PackagesFiltered(context.Background(), tt.filter) {
+				require.NoError(t, err)
+				packages = append(packages, pkg.Package+":"+pkg.Architecture)
+			}
+			assert.Equal(t, tt.packages, packages)
+
+			distPath := filepath.Join(testRepoPath, "dists", "stable") + "/"
+			var fetched []string
+			for _, uri := range tpt.uris[1:] {
+				fetched = append(fetched, strings.TrimPrefix(uri, distPath))
+			}
+			assert.Equal(t, tt.fetched, fetched)
+		})
+	}
+}
+
+func TestRepository_PackagesFilteredNestedComponent(t *testing.T) {
+	repoPath := t.TempDir()
+	distPath := filepath.Join(repoPath, "dists", "stable")
+	var release strings.Builder
+	release.WriteString("Suite: stable\nArchitectures: amd64\nComponents: updates/main updates/contrib\nDate: Mon, 09 Jun 2025 12:00:00 UTC\nSHA256:\n")
+	for _, index := range []struct{ component, pkg string }{{"updates/main", "alpha"}, {"updates/contrib", "bravo"}} {
+		packages := "Package: " + index.pkg + "\nVersion: 1.0\nArchitecture: amd64\nFilename: pool/" + index.pkg + "_1.0_amd64.deb\nSize: 1\nSHA256: 0000\n"
+		indexPath := index.component + "/binary-amd64/Packages"
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(distPath, indexPath)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(distPath, indexPath), []byte(packages), 0644))
+		fmt.Fprintf(&release, " %x %d %s\n", sha256.Sum256([]byte(packages)), len(packages), indexPath)
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(distPath, "Release"), []byte(release.String()), 0644))
+
+	entry, err := sources.ParseSourceLine("deb file://"+repoPath+" stable updates/main updates/contrib", 1)
+	require.NoError(t, err)
+	repo, err := Mount(*entry, WithArchitectures("amd64"))
+	require.NoError(t, err)
+
+	var packages []string
+	for pkg, err := range repo.PackagesFiltered(context.Background(), Filter{Component: "updates/main"}) {
+		require.NoError(t, err)
+		packages = append(packages, pkg.Package)
+	}
+	assert.Equal(t, []string{"alpha"}, packages)
+}
@@ -0,0 +1,104 @@
+package apt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/nicwaller/apt-look/pkg/deb822"
+)
+
+// ErrPackageNotFound is returned when no index in the repository lists the requested package
+var ErrPackageNotFound = errors.New("package not found")
+
+// ErrNoContentsIndex is returned when the repository has no Contents index for the selected architectures
+var ErrNoContentsIndex = errors.New("no Contents index")
+
+// PackageFiles returns the paths, without a leading slash, that the named package installs on arch
+// according to the Contents indexes. A package built for "all" is looked up in every index.
+// The first call scans all selected Contents indexes, and later calls are answered from memory.
+func (r *Repository) PackageFiles(ctx context.Context, name, arch string) ([]string, error) {
+	if len(r.ContentsIndexes()) == 0 {
+		return nil, ErrNoContentsIndex
+	}
+
+	r.packageFilesMu.Lock()
+	defer r.packageFilesMu.Unlock()
+	if r.packageFiles == nil {
+		index := make(map[string]map[string][]string)
+		for _, fi := range r.ContentsIndexes() {
+			files := index[fi.Architecture]
+			if files == nil {
+				files = make(map[string][]string)
+				index[fi.Architecture] = files
+			}
+			for entry, err := range r.ContentsFrom(ctx, fi) {
+				if err != nil {
+					return nil, err
+				}
+				for _, pkg := range entry.Packages {
+					files[pkg] = append(files[pkg], entry.Path)
+				}
+			}
+		}
+		r.packageFiles = index
+	}
+
+	// files of packages for all are listed in every architecture's Contents, and in Contents-all
+	var paths []string
+	for contentsArch, files := range r.packageFiles {
+		if arch == "all" || contentsArch == arch || contentsArch == "all" {
+			paths = append(paths, files[name]...)
+		}
+	}
+	slices.Sort(paths)
+	return slices.Compact(paths), nil
+}
+
+// FindPackage returns every entry for the named package across the selected components and architectures.
+// The result is empty if the package isn't listed; fetch and parse errors are returned as-is.
+func (r *Repository) FindPackage(ctx context.Context, name string) ([]*deb822.Package, error) {
+	var matches []*deb822.Package
+	for pkg, err := range r.PackagesFiltered(ctx, Filter{Name: name}) {
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, pkg)
+	}
+	return matches, nil
+}
+
+// FindSource returns every entry for the named source package in the selected components' Sources indexes.
+// The result is empty if the source package isn't listed; fetch and parse errors are returned as-is.
+func (r *Repository) FindSource(ctx context.Context, name string) ([]*deb822.Source, error) {
+	var matches []*deb822.Source
+	for src, err := range r.SourcePackages(ctx) {
+		if err != nil {
+			return nil, err
+		}
+		if src.Package == name {
+			matches = append(matches, src)
+		}
+	}
+	return matches, nil
+}
+
+// FindLatest returns the highest version of the named package according to dpkg version ordering.
+// When arch is set, only packages built for that architecture or "all" are considered.
+func (r *Repository) FindLatest(ctx context.Context, name, arch string) (*deb822.Package, error) {
+	var latest *deb822.Package
+	for pkg, err := range r.PackagesFiltered(ctx, Filter{Name: name, Arch: arch}) {
+		if err != nil {
+			return nil, err
+		}
+		if latest == nil || deb822.CompareVersions(pkg.Version, latest.Version) > 0 {
+			latest = pkg
+		}
+	}
+
+	if latest == nil {
+		return nil, fmt.Errorf("%w: %s", ErrPackageNotFound, name)
+	}
+	return latest, nil
+}
@@ -0,0 +1,136 @@
+package apt
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nicwaller/apt-look/pkg/apt/sources"
+)
+
+// newPackagesRepo writes a single-index amd64 repository holding the given Packages content
+func newPackagesRepo(t *testing.T, packages string) string {
+	t.Helper()
+	repoPath := t.TempDir()
+	distPath := filepath.Join(repoPath, "dists", "stable")
+	require.NoError(t, os.MkdirAll(filepath.Join(distPath, "main", "binary-amd64"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(distPath, "main", "binary-amd64", "Packages"), []byte(packages), 0644))
+
+	sum := sha256.Sum256([]byte(packages))
+	release := fmt.Sprintf(`Suite: stable
+Codename: stable
+Architectures: amd64
+Components: main
+Date: Mon, 09 Jun 2025 12:00:00 UTC
+SHA256:
+ %s %d main/binary-amd64/Packages
+`, hex.EncodeToString(sum[:]), len(packages))
+	require.NoError(t, os.WriteFile(filepath.Join(distPath, "Release"), []byte(release), 0644))
+	return repoPath
+}
+
+func TestRepository_FindPackage(t *testing.T) {
+	testRepoPath, err := filepath.Abs("testdata/compressedrepo")
+	require.NoError(t, err)
+	entry, err := sources.ParseSourceLine("deb file://"+testRepoPath+" stable main", 1)
+	require.NoError(t, err)
+
+	repo, err := Mount(*entry, WithArchitectures("amd64", "arm64", "armhf"))
+	require.NoError(t, err)
+
+	matches, err := repo.FindPackage(context.Background(), "alpha")
+	require.NoError(t, err)
+	var archs []string
+	for _, pkg := range matches {
+		archs = append(archs, pkg.Architecture)
+	}
+	assert.ElementsMatch(t, []string{"amd64", "arm64", "armhf"}, archs)
+
+	matches, err = repo.FindPackage(context.Background(), "missing")
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+
+	latest, err := repo.FindLatest(context.Background(), "alpha", "arm64")
+	require.NoError(t, err)
+	assert.Equal(t, "arm64", latest.Architecture)
+
+	// Architecture-independent packages satisfy any architecture
+	latest, err = repo.FindLatest(context.Background(), "bravo", "armhf")
+	require.NoError(t, err)
+	assert.Equal(t, "all", latest.Architecture)
+
+	_, err = repo.FindLatest(context.Background(), "alpha", "riscv64")
+	assert.ErrorIs(t, err, ErrPackageNotFound)
+}
+
+func TestRepository_FindLatestVersionOrder(t *testing.T) {
+	repoPath := newPackagesRepo(t, `Package: alpha
+Version: 1.0-9
+Architecture: amd64
+Filename: pool/alpha_1.0-9_amd64.deb
+Size: 1
+
+Package: alpha
+Version: 1:0.5-1
+Architecture: amd64
+Filename: pool/alpha_0.5-1_amd64.deb
+Size: 1
+
+Package: alpha
+Version: 1.0-10
+Architecture: amd64
+Filename: pool/alpha_1.0-10_amd64.deb
+Size: 1
+`)
+	entry, err := sources.ParseSourceLine("deb file://"+repoPath+" stable main", 1)
+	require.NoError(t, err)
+	repo, err := Mount(*entry, WithArchitectures("amd64"))
+	require.NoError(t, err)
+
+	// the epoch outranks any upstream version
+	latest, err := repo.FindLatest(context.Background(), "alpha", "")
+	require.NoError(t, err)
+	assert.Equal(t, "1:0.5-1", latest.Version)
+}
+
+func TestRepository_FindPackageSurfacesErrors(t *testing.T) {
+	repoPath := newPackagesRepo(t, "Package: alpha\nVersion: 1.0\n")
+	entry, err := sources.ParseSourceLine("deb file://"+repoPath+" stable main", 1)
+	require.NoError(t, err)
+	repo, err := Mount(*entry, WithArchitectures("amd64"))
+	require.NoError(t, err)
+
+	_, err = repo.FindPackage(context.Background(), "alpha")
+	assert.ErrorContains(t, err, "failed to parse Packages file")
+	_, err = repo.FindLatest(context.Background(), "alpha", "")
+	assert.ErrorContains(t, err, "failed to parse Packages file")
+	assert.NotErrorIs(t, err, ErrPackageNotFound)
+}
+
+func TestRepository_FindSource(t *testing.T) {
+	testRepoPath, err := filepath.Abs("testdata/compressedrepo")
+	require.NoError(t, err)
+	entry, err := sources.ParseSourceLine("deb-src file://"+testRepoPath+" stable main", 1)
+	require.NoError(t, err)
+	repo, err := Mount(*entry, WithArchitectures("amd64"))
+	require.NoError(t, err)
+
+	matches, err := repo.FindSource(context.Background(), "alpha")
+	require.NoError(t, err)
+	require.Len(t, matches, 1)
+	assert.Equal(t, "pool/main/a/alpha", matches[0].Directory)
+	files := matches[0].SourceFiles()
+	require.NotEmpty(t, files)
+	assert.Equal(t, "alpha_1.0-1.dsc", files[0].Name)
+
+	matches, err = repo.FindSource(context.Background(), "missing")
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+}
@@ -0,0 +1,152 @@
+package apt
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+)
+
+// graphFields are the relationship fields drawn as edges of a dependency graph
+var graphFields = []string{"Pre-Depends", "Depends", "Recommends"}
+
+// DependencyGraph holds the packages of a repository and the relationships between them
+type DependencyGraph struct {
+	// Packages are the names of real packages, including dependencies missing from the repository
+	Packages []string `json:"packages"`
+	// Virtual are names that no package has, but that packages Provides
+	Virtual []string         `json:"virtual,omitempty"`
+	Edges   []DependencyEdge `json:"edges"`
+}
+
+// DependencyEdge is a relationship from one package, or virtual package, to another
+type DependencyEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Field is the relationship field declaring the edge, e.g. "Depends", or "Provides" for an edge
+	// from a virtual package to a package providing it
+	Field string `json:"field"`
+}
+
+// DependencyGraph builds the graph of Pre-Depends, Depends and Recommends relationships between packages.
+// Every alternative of a dependency is an edge. A relationship on a virtual package is an edge to the
+// virtual package, which has a Provides edge to each package providing it.
+//
+// With an empty root the whole repository is graphed. Otherwise the graph holds what is reachable from
+// root within depth relationships, or without limit when depth is zero; following Provides costs nothing.
+func (r *Repository) DependencyGraph(ctx context.Context, root string, depth int) (*DependencyGraph, error) {
+	known := make(map[string]bool)
+	providers := make(map[string][]string)
+	edges := make(map[string][]DependencyEdge)
+	seen := make(map[DependencyEdge]bool)
+
+	for pkg, err := range r.Packages(ctx) {
+		if err != nil {
+			return nil, err
+		}
+		known[pkg.Package] = true
+
+		provides, err := pkg.Relations("Provides")
+		if err != nil {
+			return nil, err
+		}
+		for _, dep := range provides {
+			for _, rel := range dep.Alternatives {
+				if !slices.Contains(providers[rel.Name], pkg.Package) {
+					providers[rel.Name] = append(providers[rel.Name], pkg.Package)
+				}
+			}
+		}
+
+		for _, field := range graphFields {
+			deps, err := pkg.Relations(field)
+			if err != nil {
+				return nil, err
+			}
+			for _, dep := range deps {
+				for _, rel := range dep.Alternatives {
+					// builds for several architectures usually declare the same relations
+					edge := DependencyEdge{From: pkg.Package, To: rel.Name, Field: field}
+					if !seen[edge] {
+						seen[edge] = true
+						edges[edge.From] = append(edges[edge.From], edge)
+					}
+				}
+			}
+		}
+	}
+
+	// a name is virtual only if no package has it, since real packages can be provided too
+	for name, names := range providers {
+		if known[name] {
+			continue
+		}
+		for _, provider := range names {
+			edges[name] = append(edges[name], DependencyEdge{From: name, To: provider, Field: "Provides"})
+		}
+	}
+
+	graph := &DependencyGraph{}
+	addNode := func(name string) {
+		if _, ok := providers[name]; ok && !known[name] {
+			graph.Virtual = append(graph.Virtual, name)
+		} else {
+			graph.Packages = append(graph.Packages, name)
+		}
+	}
+
+	if root == "" {
+		nodes := make(map[string]bool)
+		for name := range known {
+			nodes[name] = true
+		}
+		for _, fromEdges := range edges {
+			for _, edge := range fromEdges {
+				nodes[edge.From] = true
+				nodes[edge.To] = true
+				graph.Edges = append(graph.Edges, edge)
+			}
+		}
+		for name := range nodes {
+			addNode(name)
+		}
+	} else {
+		if _, ok := providers[root]; !ok && !known[root] {
+			return nil, fmt.Errorf("package %q not found in repository", root)
+		}
+		// breadth-first, with providers ahead of the queue since Provides costs nothing,
+		// so each node is reached at its smallest depth
+		levels := map[string]int{root: 0}
+		queue := []string{root}
+		for len(queue) > 0 {
+			name := queue[0]
+			queue = queue[1:]
+			addNode(name)
+			for _, edge := range edges[name] {
+				level := levels[name]
+				if edge.Field != "Provides" {
+					level++
+				}
+				if depth > 0 && level > depth {
+					continue
+				}
+				graph.Edges = append(graph.Edges, edge)
+				if _, ok := levels[edge.To]; !ok {
+					levels[edge.To] = level
+					if edge.Field == "Provides" {
+						queue = append([]string{edge.To}, queue...)
+					} else {
+						queue = append(queue, edge.To)
+					}
+				}
+			}
+		}
+	}
+
+	slices.Sort(graph.Packages)
+	slices.Sort(graph.Virtual)
+	slices.SortFunc(graph.Edges, func(a, b DependencyEdge) int {
+		return cmp.Or(cmp.Compare(a.From, b.From), cmp.Compare(a.To, b.To), cmp.Compare(a.Field, b.Field))
+	})
+	return graph, nil
+}
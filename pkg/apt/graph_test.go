@@ -0,0 +1,85 @@
+package apt
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nicwaller/apt-look/pkg/apt/sources"
+)
+
+func TestRepository_DependencyGraph(t *testing.T) {
+	repoPath := newPackagesRepo(t, `Package: alpha
+Version: 1.0
+Architecture: amd64
+Depends: bravo, mail-transport-agent
+Recommends: charlie
+Filename: pool/alpha_1.0_amd64.deb
+Size: 1
+
+Package: bravo
+Version: 1.0
+Architecture: amd64
+Pre-Depends: libc6
+Filename: pool/bravo_1.0_amd64.deb
+Size: 1
+
+Package: charlie
+Version: 1.0
+Architecture: amd64
+Depends: delta
+Filename: pool/charlie_1.0_amd64.deb
+Size: 1
+
+Package: delta
+Version: 1.0
+Architecture: amd64
+Filename: pool/delta_1.0_amd64.deb
+Size: 1
+
+Package: postfix
+Version: 1.0
+Architecture: amd64
+Provides: mail-transport-agent
+Depends: delta
+Filename: pool/postfix_1.0_amd64.deb
+Size: 1
+`)
+	entry, err := sources.ParseSourceLine("deb file://"+repoPath+" stable main", 1)
+	require.NoError(t, err)
+	repo, err := Mount(*entry, WithArchitectures("amd64"))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	graph, err := repo.DependencyGraph(ctx, "", 0)
+	require.NoError(t, err)
+	// libc6 isn't in the repository but is still drawn as a package
+	assert.Equal(t, []string{"alpha", "bravo", "charlie", "delta", "libc6", "postfix"}, graph.Packages)
+	assert.Equal(t, []string{"mail-transport-agent"}, graph.Virtual)
+	assert.Equal(t, []DependencyEdge{
+		{From: "alpha", To: "bravo", Field: "Depends"},
+		{From: "alpha", To: "charlie", Field: "Recommends"},
+		{From: "alpha", To: "mail-transport-agent", Field: "Depends"},
+		{From: "bravo", To: "libc6", Field: "Pre-Depends"},
+		{From: "charlie", To: "delta", Field: "Depends"},
+		{From: "mail-transport-agent", To: "postfix", Field: "Provides"},
+		{From: "postfix", To: "delta", Field: "Depends"},
+	}, graph.Edges)
+
+	// one relationship away from alpha reaches the provider of the virtual package, but not delta
+	graph, err = repo.DependencyGraph(ctx, "alpha", 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alpha", "bravo", "charlie", "postfix"}, graph.Packages)
+	assert.Equal(t, []string{"mail-transport-agent"}, graph.Virtual)
+	assert.Len(t, graph.Edges, 4)
+
+	graph, err = repo.DependencyGraph(ctx, "charlie", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"charlie", "delta"}, graph.Packages)
+	assert.Equal(t, []DependencyEdge{{From: "charlie", To: "delta", Field: "Depends"}}, graph.Edges)
+
+	_, err = repo.DependencyGraph(ctx, "zulu", 0)
+	assert.ErrorContains(t, err, "not found")
+}
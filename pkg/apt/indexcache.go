@@ -0,0 +1,245 @@
+package apt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/nicwaller/apt-look/pkg/deb822"
+	"github.com/nicwaller/apt-look/pkg/rfc822"
+)
+
+// WithIndexCache keeps a decompressed copy of each Packages index that is read in full in dir, along with
+// where the records of each package are in it. Looking up packages by name, as FindPackage and FindLatest
+// do, then only parses those records instead of fetching and parsing the whole index again.
+// A copy is used for as long as the Release file lists the same hash for its index. With WithPDiff too,
+// the copies in dir are the ones the patches are applied to.
+func WithIndexCache(dir string) MountOption {
+	return func(opts *MountOptions) {
+		opts.IndexCacheDir = dir
+	}
+}
+
+// indexNames locates the records of each package in the cached copy of an index
+type indexNames struct {
+	// Hash is the hash of the index in the Release file it was cached from, as "algorithm:hash"
+	Hash string
+	// Size of the copy, which must match for the records to be found in it
+	Size    int64
+	Records map[string][]indexSpan
+}
+
+// indexSpan is where a record is in a cached index
+type indexSpan struct {
+	Offset int64
+	Length int64
+}
+
+// indexCachePath returns where the copy of an index is kept; its names are kept next to it with a .names suffix
+func (r *Repository) indexCachePath(fi deb822.FileInfo) string {
+	return filepath.Join(r.indexCacheDir, r.indexCopyName(fi))
+}
+
+// indexCopyName is the file name of the uncompressed copy of an index, whichever compression it was fetched with
+func (r *Repository) indexCopyName(fi deb822.FileInfo) string {
+	uri := r.distRoot.JoinPath(strings.TrimSuffix(fi.Path, fi.Compression))
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(uri.String())))
+}
+
+// PurgeIndexCopies removes the copies of the indexes in the Release file that WithIndexCache and WithPDiff keep,
+// and returns how many there were
+func (r *Repository) PurgeIndexCopies() (int, error) {
+	if r.release == nil {
+		panic("release not initialized")
+	}
+
+	var removed int
+	for _, fi := range r.release.GetAvailableFiles() {
+		name := r.indexCopyName(fi)
+		var paths []string
+		if r.indexCacheDir != "" {
+			paths = append(paths, filepath.Join(r.indexCacheDir, name), filepath.Join(r.indexCacheDir, name+".names"))
+		}
+		if r.pdiffDir != "" {
+			paths = append(paths, filepath.Join(r.pdiffDir, name))
+		}
+		for _, path := range paths {
+			// the compressions of an index share a copy, which is only there the first time
+			err := os.Remove(path)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return removed, fmt.Errorf("failed to remove copy of %s: %w", fi.Path, err)
+			}
+			if !strings.HasSuffix(path, ".names") {
+				removed++
+			}
+		}
+	}
+	return removed, nil
+}
+
+// indexHash identifies the published content of an index, or is empty if the Release file has no hash for it
+func indexHash(fi deb822.FileInfo) string {
+	algo, hash := fi.BestHash()
+	if algo == "" {
+		return ""
+	}
+	return algo + ":" + hash
+}
+
+// errIndexNotCached is returned by lookupIndexCache when there is no current copy of the index
+var errIndexNotCached = errors.New("index not cached")
+
+// lookupIndexCache returns the packages named name that keep accepts from the cached copy of fi
+func (r *Repository) lookupIndexCache(fi deb822.FileInfo, name string, keep func(rfc822.Header) bool) ([]*deb822.Package, error) {
+	hash := indexHash(fi)
+	if hash == "" {
+		return nil, errIndexNotCached
+	}
+	cachePath := r.indexCachePath(fi)
+	names, err := readIndexNames(cachePath + ".names")
+	if err != nil {
+		return nil, errIndexNotCached
+	}
+	// a copy of an index that has been republished since is stale
+	if names.Hash != hash {
+		return nil, errIndexNotCached
+	}
+
+	file, err := os.Open(cachePath)
+	if err != nil {
+		return nil, errIndexNotCached
+	}
+	defer file.Close()
+	if info, err := file.Stat(); err != nil || info.Size() != names.Size {
+		return nil, errIndexNotCached
+	}
+
+	var packages []*deb822.Package
+	for _, span := range names.Records[name] {
+		for pkg, err := range deb822.ParsePackagesFiltered(io.NewSectionReader(file, span.Offset, span.Length), keep) {
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse cached Packages file %s: %w", fi.Path, err)
+			}
+			packages = append(packages, pkg)
+		}
+	}
+	log.Debug().Str("index", fi.Path).Str("package", name).Int("records", len(names.Records[name])).Msg("Found package in index cache")
+	return packages, nil
+}
+
+func readIndexNames(path string) (*indexNames, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var names indexNames
+	if err := gob.NewDecoder(bufio.NewReader(file)).Decode(&names); err != nil {
+		return nil, err
+	}
+	return &names, nil
+}
+
+// recordIndex returns a reader that keeps a copy of what is read from rdr in the index cache, along with
+// its names, and a Close for the index's content that abandons the copy if it wasn't read to the end
+func (r *Repository) recordIndex(fi deb822.FileInfo, rdr io.Reader, content io.ReadCloser) (io.Reader, io.ReadCloser) {
+	hash := indexHash(fi)
+	if hash == "" {
+		return rdr, content
+	}
+	cachePath := r.indexCachePath(fi)
+	return recordCopy(cachePath, rdr, content, func(tmpPath string) error {
+		names, err := scanIndexNames(tmpPath)
+		if err != nil {
+			return err
+		}
+		names.Hash = hash
+		if err := os.Rename(tmpPath, cachePath); err != nil {
+			return err
+		}
+		return writeIndexNames(cachePath+".names", names)
+	})
+}
+
+// writeIndexCacheNames stores the names of the copy of fi at cachePath, once PDiff has patched it in place
+func (r *Repository) writeIndexCacheNames(fi deb822.FileInfo, cachePath string) error {
+	hash := indexHash(fi)
+	if hash == "" {
+		return nil
+	}
+	names, err := scanIndexNames(cachePath)
+	if err != nil {
+		return err
+	}
+	names.Hash = hash
+	return writeIndexNames(cachePath+".names", names)
+}
+
+// scanIndexNames finds the records of each package in a Packages index, without parsing their fields
+func scanIndexNames(path string) (*indexNames, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	names := &indexNames{Records: make(map[string][]indexSpan)}
+	rdr := bufio.NewReader(file)
+	var offset, start int64
+	var name string
+	inRecord := false
+	endRecord := func() {
+		if inRecord && name != "" {
+			names.Records[name] = append(names.Records[name], indexSpan{Offset: start, Length: offset - start})
+		}
+		inRecord = false
+		name = ""
+	}
+	for {
+		line, err := rdr.ReadString('\n')
+		if len(line) > 0 {
+			if strings.TrimSpace(line) == "" {
+				endRecord()
+			} else {
+				if !inRecord {
+					inRecord = true
+					start = offset
+				}
+				if value, ok := strings.CutPrefix(line, "Package:"); ok {
+					name = strings.TrimSpace(value)
+				}
+			}
+			offset += int64(len(line))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	endRecord()
+	names.Size = offset
+	return names, nil
+}
+
+// writeIndexNames stores the names of a cached index
+func writeIndexNames(path string, names *indexNames) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(names); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, buf.Bytes())
+}
@@ -0,0 +1,121 @@
+package apt
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nicwaller/apt-look/pkg/apt/apttransport"
+	"github.com/nicwaller/apt-look/pkg/apt/sources"
+)
+
+func TestRepository_IndexCache(t *testing.T) {
+	packages := `Package: alpha
+Version: 1.0
+Architecture: amd64
+Filename: pool/alpha_1.0_amd64.deb
+Size: 100
+
+Package: bravo
+Version: 1.0
+Architecture: amd64
+Filename: pool/bravo_1.0_amd64.deb
+Size: 100
+
+Package: bravo
+Version: 1.1
+Architecture: amd64
+Filename: pool/bravo_1.1_amd64.deb
+Size: 100
+`
+	repoPath := newPackagesRepo(t, packages)
+	entry, err := sources.ParseSourceLine("deb file://"+repoPath+" stable main", 1)
+	require.NoError(t, err)
+	cacheDir := t.TempDir()
+	indexPath := filepath.Join(repoPath, "dists", "stable", "main", "binary-amd64", "Packages")
+
+	// mount returns a repository using the index cache, along with the paths it fetched
+	mount := func() (*Repository, *recordingTransport) {
+		tpt := &recordingTransport{Transport: apttransport.NewFileTransport()}
+		repo, err := Mount(*entry, WithArchitectures("amd64"), WithTransport(tpt), WithIndexCache(cacheDir))
+		require.NoError(t, err)
+		return repo, tpt
+	}
+	versions := func(repo *Repository, name string) []string {
+		matches, err := repo.FindPackage(context.Background(), name)
+		require.NoError(t, err)
+		var versions []string
+		for _, pkg := range matches {
+			versions = append(versions, pkg.Version)
+		}
+		return versions
+	}
+
+	// the first lookup reads the whole index and caches it
+	repo, tpt := mount()
+	assert.Equal(t, []string{"1.0", "1.1"}, versions(repo, "bravo"))
+	assert.Contains(t, tpt.uris, indexPath)
+
+	// later lookups are answered from the cache
+	repo, tpt = mount()
+	assert.Equal(t, []string{"1.0", "1.1"}, versions(repo, "bravo"))
+	assert.Equal(t, []string{"1.0"}, versions(repo, "alpha"))
+	assert.Empty(t, versions(repo, "charlie"))
+	latest, err := repo.FindLatest(context.Background(), "bravo", "amd64")
+	require.NoError(t, err)
+	assert.Equal(t, "1.1", latest.Version)
+	assert.NotContains(t, tpt.uris, indexPath)
+
+	// a republished index has a new hash in the Release file, so the cached copy is stale
+	republished := packages + `
+Package: charlie
+Version: 2.0
+Architecture: amd64
+Filename: pool/charlie_2.0_amd64.deb
+Size: 100
+`
+	require.NoError(t, os.WriteFile(indexPath, []byte(republished), 0644))
+	sum := sha256.Sum256([]byte(republished))
+	release := fmt.Sprintf(`Suite: stable
+Codename: stable
+Architectures: amd64
+Components: main
+Date: Mon, 09 Jun 2025 12:00:00 UTC
+SHA256:
+ %s %d main/binary-amd64/Packages
+`, hex.EncodeToString(sum[:]), len(republished))
+	require.NoError(t, os.WriteFile(filepath.Join(repoPath, "dists", "stable", "Release"), []byte(release), 0644))
+
+	repo, tpt = mount()
+	assert.Equal(t, []string{"2.0"}, versions(repo, "charlie"))
+	assert.Contains(t, tpt.uris, indexPath)
+
+	repo, tpt = mount()
+	assert.Equal(t, []string{"2.0"}, versions(repo, "charlie"))
+	assert.NotContains(t, tpt.uris, indexPath)
+}
+
+func TestScanIndexNames(t *testing.T) {
+	content := "Package: alpha\nVersion: 1.0\nDescription: first\n more\n\n\nPackage: bravo\nVersion: 2.0\n\nPackage: alpha\nVersion: 1.1"
+	path := filepath.Join(t.TempDir(), "Packages")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	names, err := scanIndexNames(path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), names.Size)
+	record := func(span indexSpan) string {
+		return content[span.Offset : span.Offset+span.Length]
+	}
+	require.Len(t, names.Records["alpha"], 2)
+	assert.Equal(t, "Package: alpha\nVersion: 1.0\nDescription: first\n more\n", record(names.Records["alpha"][0]))
+	assert.Equal(t, "Package: alpha\nVersion: 1.1", record(names.Records["alpha"][1]))
+	require.Len(t, names.Records["bravo"], 1)
+	assert.Equal(t, "Package: bravo\nVersion: 2.0\n", record(names.Records["bravo"][0]))
+}
@@ -0,0 +1,120 @@
+package apt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/nicwaller/apt-look/pkg/apt/apttransport"
+)
+
+// WithMirrors adds archive roots that serve the same repository as the source entry.
+// When a request fails with a network error or a 5xx response, the same relative path is tried
+// against the next mirror, and the mirror that answered is preferred for later requests.
+// Mirrors are fetched with the repository's transport, so they should use a scheme it handles.
+func WithMirrors(mirrors ...*url.URL) MountOption {
+	return func(opts *MountOptions) {
+		opts.Mirrors = mirrors
+	}
+}
+
+var _ apttransport.Transport = &mirrorTransport{}
+var _ apttransport.HeadTransport = &mirrorTransport{}
+
+// mirrorTransport rewrites requests for the primary archive root onto whichever mirror is working
+type mirrorTransport struct {
+	wrapped apttransport.Transport
+	// roots holds the primary archive root followed by its mirrors
+	roots []*url.URL
+	// preferred is the index in roots of the mirror that last answered
+	preferred atomic.Int32
+}
+
+func newMirrorTransport(wrapped apttransport.Transport, primary *url.URL, mirrors []*url.URL) *mirrorTransport {
+	return &mirrorTransport{
+		wrapped: wrapped,
+		roots:   append([]*url.URL{primary}, mirrors...),
+	}
+}
+
+func (t *mirrorTransport) Schemes() []string {
+	return t.wrapped.Schemes()
+}
+
+// Close does nothing, since the wrapped transport is shared with the rest of the repository
+func (t *mirrorTransport) Close() error {
+	return nil
+}
+
+func (t *mirrorTransport) Acquire(ctx context.Context, req *apttransport.AcquireRequest) (*apttransport.AcquireResponse, error) {
+	return t.try(ctx, req.URI, func(uri *url.URL) (*apttransport.AcquireResponse, error) {
+		mirrorReq := *req
+		mirrorReq.URI = uri
+		return t.wrapped.Acquire(ctx, &mirrorReq)
+	})
+}
+
+func (t *mirrorTransport) Head(ctx context.Context, uri *url.URL) (*apttransport.AcquireResponse, error) {
+	headTransport, ok := t.wrapped.(apttransport.HeadTransport)
+	if !ok {
+		return nil, apttransport.ErrHeadNotSupported
+	}
+	return t.try(ctx, uri, func(uri *url.URL) (*apttransport.AcquireResponse, error) {
+		return headTransport.Head(ctx, uri)
+	})
+}
+
+// try sends the request to each mirror in turn, starting with the preferred one
+func (t *mirrorTransport) try(ctx context.Context, uri *url.URL, send func(*url.URL) (*apttransport.AcquireResponse, error)) (*apttransport.AcquireResponse, error) {
+	rel, ok := t.relativePath(uri)
+	if !ok {
+		return send(uri)
+	}
+
+	start := int(t.preferred.Load())
+	var err error
+	for i := range t.roots {
+		n := (start + i) % len(t.roots)
+		var resp *apttransport.AcquireResponse
+		resp, err = send(t.roots[n].JoinPath(rel))
+		if err == nil {
+			t.preferred.Store(int32(n))
+			return resp, nil
+		}
+		if ctx.Err() != nil || !isMirrorFailure(err) {
+			return nil, err
+		}
+		if i < len(t.roots)-1 {
+			log.Warn().Err(err).Msgf("Mirror %s failed, trying %s", t.roots[n], t.roots[(n+1)%len(t.roots)])
+		}
+	}
+	return nil, err
+}
+
+// relativePath returns the path of uri below the primary archive root, which may be the root of its host
+func (t *mirrorTransport) relativePath(uri *url.URL) (string, bool) {
+	primary := t.roots[0]
+	if uri.Scheme != primary.Scheme || uri.Host != primary.Host {
+		return "", false
+	}
+	rel := strings.TrimPrefix(uri.Path, "/")
+	if root := strings.Trim(primary.Path, "/"); root != "" {
+		return strings.CutPrefix(rel, root+"/")
+	}
+	return rel, true
+}
+
+// isMirrorFailure reports whether err means the mirror is unavailable rather than the file missing or corrupt
+func isMirrorFailure(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var acquireErr *apttransport.AcquireError
+	return errors.As(err, &acquireErr) && strings.HasPrefix(acquireErr.Reason, "HTTP 5")
+}
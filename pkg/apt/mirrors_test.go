@@ -0,0 +1,75 @@
+package apt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nicwaller/apt-look/pkg/apt/apttransport"
+	"github.com/nicwaller/apt-look/pkg/apt/sources"
+)
+
+func TestMount_WithMirrors(t *testing.T) {
+	var brokenHits, mirrorHits atomic.Int32
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		brokenHits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+	files := http.FileServer(http.Dir("testdata/compressedrepo"))
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mirrorHits.Add(1)
+		files.ServeHTTP(w, r)
+	}))
+	defer mirror.Close()
+
+	entry, err := sources.ParseSourceLine("deb "+broken.URL+"/debian stable main", 1)
+	require.NoError(t, err)
+	mirrorURL, err := url.Parse(mirror.URL)
+	require.NoError(t, err)
+
+	repo, err := Mount(*entry,
+		WithTransport(apttransport.NewHTTPTransport()),
+		WithArchitectures("amd64"),
+		WithMirrors(mirrorURL))
+	require.NoError(t, err)
+	assert.Equal(t, "stable", repo.Release().Suite)
+
+	var names []string
+	for pkg, err := range repo.Packages(context.Background()) {
+		require.NoError(t, err)
+		names = append(names, pkg.Package)
+	}
+	assert.NotEmpty(t, names)
+
+	// only the Release request went to the broken archive; the working mirror was preferred afterwards
+	assert.Equal(t, int32(1), brokenHits.Load())
+	assert.GreaterOrEqual(t, mirrorHits.Load(), int32(2))
+}
+
+func TestMount_WithMirrorsMissingFile(t *testing.T) {
+	var mirrorHits atomic.Int32
+	primary := httptest.NewServer(http.NotFoundHandler())
+	defer primary.Close()
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mirrorHits.Add(1)
+		http.NotFound(w, r)
+	}))
+	defer mirror.Close()
+
+	entry, err := sources.ParseSourceLine("deb "+primary.URL+" stable main", 1)
+	require.NoError(t, err)
+	mirrorURL, err := url.Parse(mirror.URL)
+	require.NoError(t, err)
+
+	// a 404 means the file doesn't exist, not that the mirror is down
+	_, err = Mount(*entry, WithTransport(apttransport.NewHTTPTransport()), WithMirrors(mirrorURL))
+	assert.ErrorContains(t, err, "HTTP 404")
+	assert.Equal(t, int32(0), mirrorHits.Load())
+}
@@ -0,0 +1,110 @@
+package apt
+
+import (
+	"bytes"
+	"context"
+	"iter"
+	"net/url"
+	"slices"
+
+	"github.com/nicwaller/apt-look/pkg/apt/apttransport"
+	"github.com/nicwaller/apt-look/pkg/apt/sources"
+	"github.com/nicwaller/apt-look/pkg/deb822"
+)
+
+// UnverifiedPackages iterates over the packages of whichever of a source's Packages indexes tpt can serve,
+// without verifying anything. When tpt serves the Release file, its indexes for the source's components and
+// the architectures are read, from their by-hash location first like Mount does. Otherwise each compressed
+// variant is tried at the usual path of the index, e.g. main/binary-amd64/Packages.xz. Indexes that can't
+// be fetched or parsed are skipped.
+//
+// Nothing is verified, so this is only meant for transports that answer from a local cache, such as
+// Registry.Offline, when something quick but approximate is wanted, like shell completion.
+func UnverifiedPackages(ctx context.Context, tpt apttransport.Transport, source sources.Entry, architectures []string) iter.Seq[*deb822.Package] {
+	return func(yield func(*deb822.Package) bool) {
+		if len(architectures) == 0 {
+			architectures = source.Architectures()
+		}
+		if len(architectures) == 0 {
+			architectures = sources.DefaultArchitectures()
+		}
+		r := &Repository{transport: tpt, distRoot: distributionRoot(source.ArchiveRoot, source.Distribution)}
+
+		for locations := range r.unverifiedIndexes(ctx, source, architectures) {
+			for _, location := range locations {
+				rdr, acr, err := r.fetch(ctx, &apttransport.AcquireRequest{URI: location.uri}, location.compression)
+				if err != nil {
+					continue
+				}
+				for pkg, err := range deb822.ParsePackages(rdr) {
+					if err != nil {
+						break
+					}
+					if !yield(pkg) {
+						acr.Content.Close()
+						return
+					}
+				}
+				acr.Content.Close()
+				break
+			}
+		}
+	}
+}
+
+// indexLocation is somewhere an index may be fetched from
+type indexLocation struct {
+	uri         *url.URL
+	compression string
+}
+
+// unverifiedIndexes yields the locations to try in turn for each Packages index of the source. The indexes are
+// taken from the Release file when tpt serves it, and guessed otherwise.
+func (r *Repository) unverifiedIndexes(ctx context.Context, source sources.Entry, architectures []string) iter.Seq[[]indexLocation] {
+	return func(yield func([]indexLocation) bool) {
+		if release, err := r.fetchUnverifiedRelease(ctx); err == nil {
+			r.release = release
+			r.components = source.Components
+			r.architectures = architectures
+			for _, fi := range r.PackagesIndexes() {
+				locations := []indexLocation{{r.distRoot.JoinPath(fi.Path), fi.Compression}}
+				if byHash := r.byHashURL(fi); byHash != nil {
+					locations = append([]indexLocation{{byHash, fi.Compression}}, locations...)
+				}
+				if !yield(locations) {
+					return
+				}
+			}
+			return
+		}
+
+		// like Mount, the source's components only apply to repositories in dists
+		indexes := []string{"Packages"}
+		if !isFlat(source.Distribution) {
+			indexes = nil
+			for _, component := range source.Components {
+				for _, arch := range append(slices.Clip(architectures), "all") {
+					indexes = append(indexes, component+"/binary-"+arch+"/Packages")
+				}
+			}
+		}
+		for _, index := range indexes {
+			var locations []indexLocation
+			for _, compression := range supportedCompressions {
+				locations = append(locations, indexLocation{r.distRoot.JoinPath(index + compression), compression})
+			}
+			if !yield(locations) {
+				return
+			}
+		}
+	}
+}
+
+// fetchUnverifiedRelease reads the Release or InRelease file of the repository from tpt, without checking its signature
+func (r *Repository) fetchUnverifiedRelease(ctx context.Context) (*deb822.Release, error) {
+	release, _, err := fetchRelease(ctx, r.transport, r.distRoot)
+	if err != nil {
+		return nil, err
+	}
+	return deb822.ParseRelease(bytes.NewReader(release))
+}
@@ -0,0 +1,369 @@
+package apt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/nicwaller/apt-look/pkg/apt/apttransport"
+	"github.com/nicwaller/apt-look/pkg/deb822"
+)
+
+// errNoPDiff is returned by fetchPDiff when the Release file doesn't list a PDiff Index for the index
+var errNoPDiff = errors.New("no PDiff index")
+
+// WithPDiff keeps an uncompressed copy of each Packages index in dir, and brings it up to date with the
+// PDiff patches that the repository publishes in Packages.diff, instead of downloading the index whole.
+// The whole index is still downloaded when there is no copy yet, or it is too old to be patched.
+func WithPDiff(dir string) MountOption {
+	return func(opts *MountOptions) {
+		opts.PDiffDir = dir
+	}
+}
+
+// usesPDiff reports whether fi is fetched with PDiff patches when the repository publishes them
+func (r *Repository) usesPDiff(fi deb822.FileInfo) bool {
+	return r.pdiffDir != "" && fi.Type == "Packages"
+}
+
+// pdiffBasePath returns where the uncompressed copy of an index is kept. With the index cache enabled
+// that is the index cache's copy, so the index isn't kept twice.
+func (r *Repository) pdiffBasePath(fi deb822.FileInfo) string {
+	if r.indexCacheDir != "" {
+		return r.indexCachePath(fi)
+	}
+	return filepath.Join(r.pdiffDir, r.indexCopyName(fi))
+}
+
+// fetchPDiff returns the current content of an index by patching the copy kept from an earlier fetch.
+// It fails if the repository has no PDiff Index for it, there is no copy, or the patches can't be applied.
+func (r *Repository) fetchPDiff(ctx context.Context, fi deb822.FileInfo) ([]byte, error) {
+	canonical := strings.TrimSuffix(fi.Path, fi.Compression)
+	var indexFI *deb822.FileInfo
+	for _, available := range r.release.GetAvailableFiles() {
+		if available.Path == canonical+".diff/Index" {
+			indexFI = &available
+			break
+		}
+	}
+	if indexFI == nil {
+		return nil, errNoPDiff
+	}
+	algo, hash := indexFI.BestHash()
+	if algo == "" {
+		return nil, errNoPDiff
+	}
+
+	basePath := r.pdiffBasePath(fi)
+	content, err := os.ReadFile(basePath)
+	if err != nil {
+		return nil, fmt.Errorf("no earlier copy to patch: %w", err)
+	}
+
+	indexData, err := r.fetchAll(ctx, &apttransport.AcquireRequest{
+		URI:            r.distRoot.JoinPath(indexFI.Path),
+		ExpectedSize:   indexFI.Size,
+		ExpectedHashes: map[string]string{algo: hash},
+	}, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", indexFI.Path, err)
+	}
+	index, err := deb822.ParsePDiffIndex(bytes.NewReader(indexData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", indexFI.Path, err)
+	}
+
+	// the copy is already current when the index hasn't changed since it was kept
+	hash = fmt.Sprintf("%x", sha256.Sum256(content))
+	if hash == index.Current.Hash {
+		return content, nil
+	}
+
+	start := -1
+	for i, entry := range index.History {
+		if entry.Hash == hash && entry.Size == int64(len(content)) {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return nil, fmt.Errorf("the earlier copy is older than the patches in %s", indexFI.Path)
+	}
+	// merged patches each go straight to the current index; otherwise every later patch is applied in turn
+	patches := index.History[start:]
+	if index.Merged {
+		patches = patches[:1]
+	}
+
+	patchDir := path.Dir(indexFI.Path)
+	for _, patch := range patches {
+		download, ok := findHashEntry(index.Download, patch.Path+".gz")
+		if !ok {
+			return nil, fmt.Errorf("%s doesn't list a download for patch %s", indexFI.Path, patch.Path)
+		}
+		diff, err := r.fetchAll(ctx, &apttransport.AcquireRequest{
+			URI:            r.distRoot.JoinPath(patchDir, download.Path),
+			ExpectedSize:   download.Size,
+			ExpectedHashes: map[string]string{"sha256": download.Hash},
+		}, ".gz")
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch patch %s: %w", patch.Path, err)
+		}
+		if content, err = applyEdPatch(content, diff); err != nil {
+			return nil, fmt.Errorf("failed to apply patch %s: %w", patch.Path, err)
+		}
+	}
+
+	if hash := fmt.Sprintf("%x", sha256.Sum256(content)); hash != index.Current.Hash || int64(len(content)) != index.Current.Size {
+		return nil, fmt.Errorf("patched %s doesn't match %s", canonical, indexFI.Path)
+	}
+	if err := writeFileAtomic(basePath, content); err != nil {
+		log.Debug().Err(err).Str("path", basePath).Msg("Failed to keep patched index")
+	} else if r.indexCacheDir != "" {
+		if err := r.writeIndexCacheNames(fi, basePath); err != nil {
+			log.Debug().Err(err).Str("path", basePath).Msg("Failed to index patched index")
+		}
+	}
+	log.Debug().Str("index", fi.Path).Int("patches", len(patches)).Msg("Updated index with PDiff patches")
+	return content, nil
+}
+
+// fetchAll fetches a small file whole, decompressing it, and fails if it doesn't match its expected hash
+func (r *Repository) fetchAll(ctx context.Context, req *apttransport.AcquireRequest, compression string) ([]byte, error) {
+	rdr, acr, err := r.fetch(ctx, req, compression)
+	if err != nil {
+		return nil, err
+	}
+	defer acr.Content.Close()
+	return io.ReadAll(&indexReader{decompressed: rdr, content: acr.Content, path: req.URI.Path})
+}
+
+// findHashEntry returns the entry for the file name
+func findHashEntry(entries []deb822.HashEntry, name string) (deb822.HashEntry, bool) {
+	for _, entry := range entries {
+		if entry.Path == name {
+			return entry, true
+		}
+	}
+	return deb822.HashEntry{}, false
+}
+
+// edCommand is one command of an ed script: lines first to last are replaced by text.
+// Appending after line n is first n+1 to last n, and deleting has no text.
+type edCommand struct {
+	first, last int
+	text        [][]byte
+}
+
+// applyEdPatch applies a PDiff patch, which is an ed script as written by diff --ed, to content.
+// Its commands address lines of the original content from the end to the start, so that each
+// command's line numbers are unaffected by the commands before it.
+func applyEdPatch(content, patch []byte) ([]byte, error) {
+	commands, err := parseEdScript(patch)
+	if err != nil {
+		return nil, err
+	}
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+
+	// applying the commands from the start builds the result in a single pass
+	var out bytes.Buffer
+	next := 1 // the first line of content not yet copied
+	for i := len(commands) - 1; i >= 0; i-- {
+		cmd := commands[i]
+		if cmd.first < next || cmd.last > len(lines) {
+			return nil, fmt.Errorf("ed command for lines %d-%d is out of order or past the end", cmd.first, cmd.last)
+		}
+		for _, line := range lines[next-1 : cmd.first-1] {
+			out.Write(line)
+		}
+		for _, line := range cmd.text {
+			out.Write(line)
+		}
+		next = cmd.last + 1
+	}
+	for _, line := range lines[next-1:] {
+		out.Write(line)
+	}
+	return out.Bytes(), nil
+}
+
+// parseEdScript reads the a, c and d commands of an ed script, which must address lines in descending order
+func parseEdScript(patch []byte) ([]edCommand, error) {
+	var commands []edCommand
+	scanner := bufio.NewScanner(bytes.NewReader(patch))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		op := line[len(line)-1]
+		first, last, err := parseEdRange(line[:len(line)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid ed command %q: %w", line, err)
+		}
+
+		var cmd edCommand
+		switch op {
+		case 'a':
+			cmd = edCommand{first: first + 1, last: first}
+		case 'c', 'd':
+			cmd = edCommand{first: first, last: last}
+		default:
+			return nil, fmt.Errorf("unsupported ed command %q", line)
+		}
+		if op != 'd' {
+			// the text runs until a line with a single dot
+			for {
+				if !scanner.Scan() {
+					return nil, fmt.Errorf("unterminated text for ed command %q", line)
+				}
+				if scanner.Text() == "." {
+					break
+				}
+				cmd.text = append(cmd.text, append(scanner.Bytes()[:len(scanner.Bytes()):len(scanner.Bytes())], '\n'))
+			}
+		}
+		if len(commands) > 0 && cmd.last >= commands[len(commands)-1].first {
+			return nil, fmt.Errorf("ed command %q isn't before the previous command", line)
+		}
+		commands = append(commands, cmd)
+	}
+	return commands, scanner.Err()
+}
+
+// parseEdRange parses an ed line address, either n or n,m
+func parseEdRange(addr string) (first, last int, err error) {
+	firstField, lastField, isRange := strings.Cut(addr, ",")
+	if first, err = strconv.Atoi(firstField); err != nil || first < 0 {
+		return 0, 0, fmt.Errorf("invalid line number %q", firstField)
+	}
+	last = first
+	if isRange {
+		if last, err = strconv.Atoi(lastField); err != nil || last < first {
+			return 0, 0, fmt.Errorf("invalid line number %q", lastField)
+		}
+	}
+	return first, last, nil
+}
+
+// baseRecorder copies a decompressed index to a temporary file as it is read, e.g. into the PDiff directory
+// so a later fetch can patch it. The copy is only kept once the index has been read to the end without error.
+type baseRecorder struct {
+	rdr  io.Reader
+	file *os.File
+	path string
+	// store moves the completed copy from its temporary file into place
+	store func(tmpPath string) error
+}
+
+// recordBase returns a reader that records what is read from rdr as the copy of fi to patch later,
+// and a Close for the index's content that abandons the copy if it wasn't read to the end
+func (r *Repository) recordBase(fi deb822.FileInfo, rdr io.Reader, content io.ReadCloser) (io.Reader, io.ReadCloser) {
+	basePath := r.pdiffBasePath(fi)
+	return recordCopy(basePath, rdr, content, func(tmpPath string) error {
+		return os.Rename(tmpPath, basePath)
+	})
+}
+
+// recordCopy returns a reader that copies what is read from rdr next to path, handing the copy to store
+// once it is complete, and a Close for the content that abandons the copy if it wasn't read to the end
+func recordCopy(path string, rdr io.Reader, content io.ReadCloser, store func(tmpPath string) error) (io.Reader, io.ReadCloser) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Debug().Err(err).Str("path", path).Msg("Can't keep copy of index")
+		return rdr, content
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		log.Debug().Err(err).Str("path", path).Msg("Can't keep copy of index")
+		return rdr, content
+	}
+	recorder := &baseRecorder{rdr: rdr, file: file, path: path, store: store}
+	return recorder, &baseCloser{ReadCloser: content, recorder: recorder}
+}
+
+func (b *baseRecorder) Read(p []byte) (int, error) {
+	n, err := b.rdr.Read(p)
+	if b.file == nil {
+		return n, err
+	}
+	if n > 0 {
+		if _, writeErr := b.file.Write(p[:n]); writeErr != nil {
+			b.abandon()
+			return n, err
+		}
+	}
+	if err == io.EOF {
+		b.keep()
+	} else if err != nil {
+		b.abandon()
+	}
+	return n, err
+}
+
+// keep moves the completed copy into place
+func (b *baseRecorder) keep() {
+	tmpPath := b.file.Name()
+	err := b.file.Close()
+	b.file = nil
+	if err == nil {
+		err = b.store(tmpPath)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		log.Debug().Err(err).Str("path", b.path).Msg("Failed to keep copy of index")
+	}
+}
+
+// abandon removes an incomplete copy, leaving any earlier one in place
+func (b *baseRecorder) abandon() {
+	if b.file != nil {
+		b.file.Close()
+		os.Remove(b.file.Name())
+		b.file = nil
+	}
+}
+
+// baseCloser abandons the copy of an index that is closed before it was read to the end
+type baseCloser struct {
+	io.ReadCloser
+	recorder *baseRecorder
+}
+
+func (c *baseCloser) Close() error {
+	c.recorder.abandon()
+	return c.ReadCloser.Close()
+}
+
+// writeFileAtomic replaces the file at path with data, so readers never see a partial file
+func writeFileAtomic(path string, data []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
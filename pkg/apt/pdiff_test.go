@@ -0,0 +1,261 @@
+package apt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nicwaller/apt-look/pkg/apt/apttransport"
+	"github.com/nicwaller/apt-look/pkg/apt/sources"
+)
+
+func TestApplyEdPatch(t *testing.T) {
+	base := "one\ntwo\nthree\nfour\n"
+	tests := []struct {
+		name     string
+		patch    string
+		expected string
+		err      string
+	}{
+		{"change", "2c\nTWO\n.\n", "one\nTWO\nthree\nfour\n", ""},
+		{"change range", "2,3c\nmiddle\n.\n", "one\nmiddle\nfour\n", ""},
+		{"delete", "3,4d\n1d\n", "two\n", ""},
+		{"append", "4a\nfive\n.\n0a\nzero\n.\n", "zero\none\ntwo\nthree\nfour\nfive\n", ""},
+		{"mixed", "4d\n2a\ntwo and a half\n.\n1c\nONE\n.\n", "ONE\ntwo\ntwo and a half\nthree\n", ""},
+		{"empty", "", base, ""},
+		{"ascending", "1d\n3d\n", "", "isn't before the previous command"},
+		{"past the end", "5d\n", "", "past the end"},
+		{"unterminated", "1c\none\n", "", "unterminated"},
+		{"unsupported", "s/.//\n", "", "invalid ed command"},
+		{"unknown", "1x\n", "", "unsupported ed command"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patched, err := applyEdPatch([]byte(base), []byte(tt.patch))
+			if tt.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(patched))
+		})
+	}
+}
+
+// pdiffPatch is a published PDiff patch: the ed script that brings base up to date
+type pdiffPatch struct {
+	name   string
+	base   string
+	script string
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// publishPDiffRepo writes a single-index amd64 repository holding packages, with a Packages.diff
+// directory publishing the given patches
+func publishPDiffRepo(t *testing.T, repoPath, packages string, patches ...pdiffPatch) {
+	t.Helper()
+	distPath := filepath.Join(repoPath, "dists", "stable")
+	diffPath := filepath.Join(distPath, "main", "binary-amd64", "Packages.diff")
+	require.NoError(t, os.MkdirAll(diffPath, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(distPath, "main", "binary-amd64", "Packages"), []byte(packages), 0644))
+
+	var history, patchList, download strings.Builder
+	for _, patch := range patches {
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		_, err := gz.Write([]byte(patch.script))
+		require.NoError(t, err)
+		require.NoError(t, gz.Close())
+		require.NoError(t, os.WriteFile(filepath.Join(diffPath, patch.name+".gz"), compressed.Bytes(), 0644))
+
+		fmt.Fprintf(&history, " %s %d %s\n", sha256Hex([]byte(patch.base)), len(patch.base), patch.name)
+		fmt.Fprintf(&patchList, " %s %d %s\n", sha256Hex([]byte(patch.script)), len(patch.script), patch.name)
+		fmt.Fprintf(&download, " %s %d %s.gz\n", sha256Hex(compressed.Bytes()), compressed.Len(), patch.name)
+	}
+	index := fmt.Sprintf("SHA256-Current: %s %d\nSHA256-History:\n%sSHA256-Patches:\n%sSHA256-Download:\n%s",
+		sha256Hex([]byte(packages)), len(packages), history.String(), patchList.String(), download.String())
+	require.NoError(t, os.WriteFile(filepath.Join(diffPath, "Index"), []byte(index), 0644))
+
+	release := fmt.Sprintf(`Suite: stable
+Codename: stable
+Architectures: amd64
+Components: main
+Date: Mon, 09 Jun 2025 12:00:00 UTC
+SHA256:
+ %s %d main/binary-amd64/Packages
+ %s %d main/binary-amd64/Packages.diff/Index
+`, sha256Hex([]byte(packages)), len(packages), sha256Hex([]byte(index)), len(index))
+	require.NoError(t, os.WriteFile(filepath.Join(distPath, "Release"), []byte(release), 0644))
+}
+
+// readPDiffRepo mounts the repository with PDiff enabled and returns its package versions and the files fetched
+func readPDiffRepo(t *testing.T, repoPath, pdiffDir string) ([]string, []string) {
+	t.Helper()
+	entry, err := sources.ParseSourceLine("deb file://"+repoPath+" stable main", 1)
+	require.NoError(t, err)
+	tpt := &recordingTransport{Transport: apttransport.NewFileTransport()}
+	repo, err := Mount(*entry, WithArchitectures("amd64"), WithTransport(tpt), WithPDiff(pdiffDir))
+	require.NoError(t, err)
+
+	var versions []string
+	for pkg, err := range repo.Packages(context.Background()) {
+		require.NoError(t, err)
+		versions = append(versions, pkg.Package+"="+pkg.Version)
+	}
+
+	distPath := filepath.Join(repoPath, "dists", "stable") + "/"
+	var fetched []string
+	for _, uri := range tpt.uris {
+		fetched = append(fetched, strings.TrimPrefix(uri, distPath))
+	}
+	return versions, fetched
+}
+
+func TestPackages_PDiff(t *testing.T) {
+	record := func(name, version string) string {
+		return fmt.Sprintf("Package: %s\nVersion: %s\nFilename: pool/%s_%s.deb\nSize: 1\n", name, version, name, version)
+	}
+	v1 := record("alpha", "1.0") + "\n" + record("bravo", "1.0")
+	v2 := record("alpha", "1.0") + "\n" + record("bravo", "2.0")
+	v3 := v2 + "\n" + record("charlie", "1.0")
+	patch1 := pdiffPatch{name: "patch1", base: v1, script: "7,8c\nVersion: 2.0\nFilename: pool/bravo_2.0.deb\n.\n"}
+	patch2 := pdiffPatch{name: "patch2", base: v2, script: "9a\n\n" + record("charlie", "1.0") + ".\n"}
+
+	repoPath := t.TempDir()
+	pdiffDir := t.TempDir()
+	basePath := func() string {
+		entries, err := os.ReadDir(pdiffDir)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		return filepath.Join(pdiffDir, entries[0].Name())
+	}
+
+	t.Run("first fetch keeps the whole index", func(t *testing.T) {
+		publishPDiffRepo(t, repoPath, v1)
+		versions, fetched := readPDiffRepo(t, repoPath, pdiffDir)
+		assert.Equal(t, []string{"alpha=1.0", "bravo=1.0"}, versions)
+		assert.Equal(t, []string{"Release", "main/binary-amd64/Packages"}, fetched)
+
+		base, err := os.ReadFile(basePath())
+		require.NoError(t, err)
+		assert.Equal(t, v1, string(base))
+	})
+
+	t.Run("patches instead of downloading", func(t *testing.T) {
+		publishPDiffRepo(t, repoPath, v2, patch1)
+		versions, fetched := readPDiffRepo(t, repoPath, pdiffDir)
+		assert.Equal(t, []string{"alpha=1.0", "bravo=2.0"}, versions)
+		assert.Equal(t, []string{"Release", "main/binary-amd64/Packages.diff/Index", "main/binary-amd64/Packages.diff/patch1.gz"}, fetched)
+
+		base, err := os.ReadFile(basePath())
+		require.NoError(t, err)
+		assert.Equal(t, v2, string(base))
+	})
+
+	t.Run("applies every later patch", func(t *testing.T) {
+		publishPDiffRepo(t, repoPath, v3, patch1, patch2)
+		require.NoError(t, os.WriteFile(basePath(), []byte(v1), 0644))
+		versions, fetched := readPDiffRepo(t, repoPath, pdiffDir)
+		assert.Equal(t, []string{"alpha=1.0", "bravo=2.0", "charlie=1.0"}, versions)
+		assert.Equal(t, []string{
+			"Release",
+			"main/binary-amd64/Packages.diff/Index",
+			"main/binary-amd64/Packages.diff/patch1.gz",
+			"main/binary-amd64/Packages.diff/patch2.gz",
+		}, fetched)
+	})
+
+	t.Run("current copy needs no patches", func(t *testing.T) {
+		versions, fetched := readPDiffRepo(t, repoPath, pdiffDir)
+		assert.Equal(t, []string{"alpha=1.0", "bravo=2.0", "charlie=1.0"}, versions)
+		assert.Equal(t, []string{"Release", "main/binary-amd64/Packages.diff/Index"}, fetched)
+	})
+
+	t.Run("falls back when the copy can't be patched", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(basePath(), []byte("corrupt\n"), 0644))
+		versions, fetched := readPDiffRepo(t, repoPath, pdiffDir)
+		assert.Equal(t, []string{"alpha=1.0", "bravo=2.0", "charlie=1.0"}, versions)
+		assert.Equal(t, []string{"Release", "main/binary-amd64/Packages.diff/Index", "main/binary-amd64/Packages"}, fetched)
+
+		base, err := os.ReadFile(basePath())
+		require.NoError(t, err)
+		assert.Equal(t, v3, string(base))
+	})
+
+	t.Run("falls back when a patch doesn't apply", func(t *testing.T) {
+		publishPDiffRepo(t, repoPath, v3, pdiffPatch{name: "patch2", base: v2, script: "20d\n"})
+		require.NoError(t, os.WriteFile(basePath(), []byte(v2), 0644))
+		versions, fetched := readPDiffRepo(t, repoPath, pdiffDir)
+		assert.Equal(t, []string{"alpha=1.0", "bravo=2.0", "charlie=1.0"}, versions)
+		assert.Equal(t, "main/binary-amd64/Packages", fetched[len(fetched)-1])
+	})
+}
+
+func TestPackages_PDiffWithIndexCache(t *testing.T) {
+	record := func(name, version string) string {
+		return fmt.Sprintf("Package: %s\nVersion: %s\nFilename: pool/%s_%s.deb\nSize: 1\n", name, version, name, version)
+	}
+	v1 := record("alpha", "1.0") + "\n" + record("bravo", "1.0")
+	v2 := record("alpha", "1.0") + "\n" + record("bravo", "2.0")
+	patch1 := pdiffPatch{name: "patch1", base: v1, script: "7,8c\nVersion: 2.0\nFilename: pool/bravo_2.0.deb\n.\n"}
+
+	repoPath := t.TempDir()
+	pdiffDir, indexDir := t.TempDir(), t.TempDir()
+	entry, err := sources.ParseSourceLine("deb file://"+repoPath+" stable main", 1)
+	require.NoError(t, err)
+	distPath := filepath.Join(repoPath, "dists", "stable") + "/"
+	// find looks up bravo, returning its versions and the paths fetched
+	find := func() ([]string, []string) {
+		tpt := &recordingTransport{Transport: apttransport.NewFileTransport()}
+		repo, err := Mount(*entry, WithArchitectures("amd64"), WithTransport(tpt), WithPDiff(pdiffDir), WithIndexCache(indexDir))
+		require.NoError(t, err)
+		matches, err := repo.FindPackage(context.Background(), "bravo")
+		require.NoError(t, err)
+		var versions, fetched []string
+		for _, pkg := range matches {
+			versions = append(versions, pkg.Version)
+		}
+		for _, uri := range tpt.uris {
+			fetched = append(fetched, strings.TrimPrefix(uri, distPath))
+		}
+		return versions, fetched
+	}
+
+	// the index is kept once, in the index cache, and PDiff patches that copy
+	publishPDiffRepo(t, repoPath, v1)
+	versions, fetched := find()
+	assert.Equal(t, []string{"1.0"}, versions)
+	assert.Equal(t, []string{"Release", "main/binary-amd64/Packages"}, fetched)
+	entries, err := os.ReadDir(pdiffDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	entries, err = os.ReadDir(indexDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	publishPDiffRepo(t, repoPath, v2, patch1)
+	versions, fetched = find()
+	assert.Equal(t, []string{"2.0"}, versions)
+	assert.Equal(t, []string{"Release", "main/binary-amd64/Packages.diff/Index", "main/binary-amd64/Packages.diff/patch1.gz"}, fetched)
+
+	// the patched copy is indexed, so the next lookup doesn't fetch anything
+	versions, fetched = find()
+	assert.Equal(t, []string{"2.0"}, versions)
+	assert.Equal(t, []string{"Release"}, fetched)
+}
@@ -0,0 +1,88 @@
+package apt
+
+import (
+	"cmp"
+	"context"
+	"slices"
+)
+
+// reverseDependencyFields are the relationship fields that make one package need another
+var reverseDependencyFields = []string{"Pre-Depends", "Depends", "Recommends"}
+
+// ReverseDependency is a package that declares a relationship on the queried package
+type ReverseDependency struct {
+	// Package is the name of the dependent package
+	Package string `json:"package"`
+	// Field is the relationship field declaring the dependency, e.g. "Depends"
+	Field string `json:"field"`
+	// Relation is the alternative that is satisfied by the queried package, e.g. "alpha (>= 1.0)"
+	Relation string `json:"relation"`
+	// Via is the virtual package name when the dependency is satisfied through Provides
+	Via string `json:"via,omitempty"`
+}
+
+// ReverseDependencies returns the packages whose Pre-Depends, Depends or Recommends fields name the package,
+// directly or through a virtual package it provides. Each dependent is listed once per relation, sorted by name.
+func (r *Repository) ReverseDependencies(ctx context.Context, name string) ([]ReverseDependency, error) {
+	targets, err := r.FindPackage(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// virtual names satisfied by any build of the package
+	provided := make(map[string]bool)
+	for _, pkg := range targets {
+		provides, err := pkg.Relations("Provides")
+		if err != nil {
+			return nil, err
+		}
+		for _, dep := range provides {
+			for _, rel := range dep.Alternatives {
+				provided[rel.Name] = true
+			}
+		}
+	}
+
+	var rdeps []ReverseDependency
+	seen := make(map[ReverseDependency]bool)
+	for pkg, err := range r.Packages(ctx) {
+		if err != nil {
+			return nil, err
+		}
+		if pkg.Package == name {
+			continue
+		}
+		for _, field := range reverseDependencyFields {
+			deps, err := pkg.Relations(field)
+			if err != nil {
+				return nil, err
+			}
+			for _, dep := range deps {
+				for _, rel := range dep.Alternatives {
+					rdep := ReverseDependency{Package: pkg.Package, Field: field, Relation: rel.String()}
+					switch {
+					case rel.Name == name:
+					case provided[rel.Name]:
+						rdep.Via = rel.Name
+					default:
+						continue
+					}
+					// builds for several architectures usually declare the same relations
+					if !seen[rdep] {
+						seen[rdep] = true
+						rdeps = append(rdeps, rdep)
+					}
+				}
+			}
+		}
+	}
+
+	slices.SortFunc(rdeps, func(a, b ReverseDependency) int {
+		return cmp.Or(
+			cmp.Compare(a.Package, b.Package),
+			cmp.Compare(slices.Index(reverseDependencyFields, a.Field), slices.Index(reverseDependencyFields, b.Field)),
+			cmp.Compare(a.Relation, b.Relation),
+		)
+	})
+	return rdeps, nil
+}
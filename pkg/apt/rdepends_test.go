@@ -0,0 +1,62 @@
+package apt
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nicwaller/apt-look/pkg/apt/sources"
+)
+
+func TestRepository_ReverseDependencies(t *testing.T) {
+	repoPath := newPackagesRepo(t, `Package: alpha
+Version: 1.0
+Architecture: amd64
+Provides: alpha-api (= 1), mail-transport-agent
+Filename: pool/alpha_1.0_amd64.deb
+Size: 1
+
+Package: bravo
+Version: 1.0
+Architecture: amd64
+Depends: libc6, alpha (>= 0.9) | charlie
+Recommends: alpha-doc
+Filename: pool/bravo_1.0_amd64.deb
+Size: 1
+
+Package: charlie
+Version: 1.0
+Architecture: amd64
+Pre-Depends: alpha-api
+Recommends: mail-transport-agent
+Suggests: alpha
+Filename: pool/charlie_1.0_amd64.deb
+Size: 1
+
+Package: delta
+Version: 1.0
+Architecture: amd64
+Depends: alphabet
+Filename: pool/delta_1.0_amd64.deb
+Size: 1
+`)
+	entry, err := sources.ParseSourceLine("deb file://"+repoPath+" stable main", 1)
+	require.NoError(t, err)
+	repo, err := Mount(*entry, WithArchitectures("amd64"))
+	require.NoError(t, err)
+
+	rdeps, err := repo.ReverseDependencies(context.Background(), "alpha")
+	require.NoError(t, err)
+	// Suggests isn't a dependency and delta only shares a name prefix
+	assert.Equal(t, []ReverseDependency{
+		{Package: "bravo", Field: "Depends", Relation: "alpha (>= 0.9)"},
+		{Package: "charlie", Field: "Pre-Depends", Relation: "alpha-api", Via: "alpha-api"},
+		{Package: "charlie", Field: "Recommends", Relation: "mail-transport-agent", Via: "mail-transport-agent"},
+	}, rdeps)
+
+	rdeps, err = repo.ReverseDependencies(context.Background(), "delta")
+	require.NoError(t, err)
+	assert.Empty(t, rdeps)
+}
@@ -0,0 +1,183 @@
+package apt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	"github.com/rs/zerolog/log"
+
+	"github.com/nicwaller/apt-look/pkg/apt/apttransport"
+	"github.com/nicwaller/apt-look/pkg/apt/sources"
+)
+
+// WithKeyring enables signature verification of the Release file using the given keyring files.
+// Both binary (.gpg) and ASCII-armored (.asc) keyrings are accepted.
+// This takes precedence over any signed-by option in the source entry.
+func WithKeyring(paths ...string) MountOption {
+	return func(opts *MountOptions) {
+		opts.Keyrings = paths
+	}
+}
+
+// WithAllowUnsigned lets repositories without a Release.gpg signature mount when a keyring is configured
+func WithAllowUnsigned() MountOption {
+	return func(opts *MountOptions) {
+		opts.AllowUnsigned = true
+	}
+}
+
+// WithTrusted mounts every source as if it had the trusted=yes option, without verifying its Release signature
+func WithTrusted() MountOption {
+	return func(opts *MountOptions) {
+		opts.Trusted = true
+	}
+}
+
+// keyringPaths returns the keyrings to verify a source with, or nil if verification is not configured.
+// The signed-by option may hold a comma-separated list of keyring files. Relative ones are found next to
+// the file the source was read from, if any.
+func keyringPaths(opts *MountOptions, source sources.Entry) []string {
+	if len(opts.Keyrings) > 0 {
+		return opts.Keyrings
+	}
+	var paths []string
+	for _, path := range strings.Split(source.Options["signed-by"], ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		if !filepath.IsAbs(path) && source.File != "" && !isKeyFingerprint(path) {
+			path = filepath.Join(filepath.Dir(source.File), path)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// isKeyFingerprint reports whether a signed-by value is a key ID or fingerprint rather than a file,
+// e.g. DEADBEEFDEADBEEF or one ending in ! for that exact subkey
+func isKeyFingerprint(value string) bool {
+	value = strings.TrimSuffix(value, "!")
+	if len(value) < 8 {
+		return false
+	}
+	for _, c := range value {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// loadKeyring reads and combines the public keys from several keyring files. Relative paths are
+// relative to the working directory.
+func loadKeyring(paths []string) (openpgp.EntityList, error) {
+	var keyring openpgp.EntityList
+	for _, path := range paths {
+		if isKeyFingerprint(path) {
+			// apt also accepts key fingerprints, which would need a system keyring
+			return nil, fmt.Errorf("unsupported keyring %q: only keyring file paths are supported", path)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read keyring: %w", err)
+		}
+
+		var entities openpgp.EntityList
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN PGP")) {
+			entities, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+		} else {
+			entities, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse keyring %s: %w", path, err)
+		}
+		keyring = append(keyring, entities...)
+	}
+	return keyring, nil
+}
+
+// fetchRelease fetches the Release file of the distribution at distRoot. Repositories that only publish
+// the clearsigned InRelease file are read from that instead, and its signed block is returned too, for
+// verifyInRelease.
+func fetchRelease(ctx context.Context, tpt apttransport.Transport, distRoot *url.URL) ([]byte, *clearsign.Block, error) {
+	release, err := fetchSmall(ctx, tpt, distRoot.JoinPath("Release"))
+	if !apttransport.IsNotFound(err) {
+		return release, nil, err
+	}
+	block, inErr := fetchInRelease(ctx, tpt, distRoot)
+	if apttransport.IsNotFound(inErr) {
+		// the Release file is what most repositories are missing
+		return nil, nil, err
+	}
+	if inErr != nil {
+		return nil, nil, inErr
+	}
+	return block.Plaintext, block, nil
+}
+
+// fetchInRelease fetches and decodes the clearsigned InRelease file of the distribution at distRoot
+func fetchInRelease(ctx context.Context, tpt apttransport.Transport, distRoot *url.URL) (*clearsign.Block, error) {
+	data, err := fetchSmall(ctx, tpt, distRoot.JoinPath("InRelease"))
+	if err != nil {
+		return nil, err
+	}
+	block, _ := clearsign.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not clearsigned", distRoot.JoinPath("InRelease"))
+	}
+	return block, nil
+}
+
+// verifyInRelease checks the signature of a clearsigned InRelease file
+func verifyInRelease(block *clearsign.Block, distRoot *url.URL, keyring openpgp.EntityList) error {
+	if _, err := block.VerifySignature(keyring, nil); err != nil {
+		return fmt.Errorf("failed to verify signature %s: %w", distRoot.JoinPath("InRelease"), err)
+	}
+	return nil
+}
+
+// verifyRelease checks the detached Release.gpg signature over the raw Release bytes. Without one, an
+// InRelease file whose signed content is the same Release file will do.
+func verifyRelease(ctx context.Context, tpt apttransport.Transport, distRoot *url.URL, release []byte, keyring openpgp.EntityList, allowUnsigned bool) error {
+	sigURL := distRoot.JoinPath("Release.gpg")
+	signature, err := fetchSmall(ctx, tpt, sigURL)
+	// only a missing signature makes a repository unsigned; a failed fetch says nothing about it
+	if err != nil && !apttransport.IsNotFound(err) {
+		return fmt.Errorf("failed to fetch Release.gpg: %w", err)
+	}
+	if err != nil {
+		block, inErr := fetchInRelease(ctx, tpt, distRoot)
+		if inErr != nil && !apttransport.IsNotFound(inErr) {
+			return fmt.Errorf("failed to fetch InRelease: %w", inErr)
+		}
+		if inErr == nil {
+			if !bytes.Equal(bytes.TrimSpace(block.Plaintext), bytes.TrimSpace(release)) {
+				return fmt.Errorf("InRelease at %s doesn't match the Release file", distRoot)
+			}
+			return verifyInRelease(block, distRoot, keyring)
+		}
+		if allowUnsigned {
+			log.Warn().Msgf("No signature found at %s; continuing without verification", sigURL)
+			return nil
+		}
+		return fmt.Errorf("repository is not signed, no Release.gpg or InRelease found: %w", err)
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(signature), []byte("-----BEGIN PGP")) {
+		_, err = openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(release), bytes.NewReader(signature), nil)
+	} else {
+		_, err = openpgp.CheckDetachedSignature(keyring, bytes.NewReader(release), bytes.NewReader(signature), nil)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to verify signature %s: %w", sigURL, err)
+	}
+	return nil
+}
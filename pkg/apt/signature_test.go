@@ -0,0 +1,280 @@
+package apt
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nicwaller/apt-look/pkg/apt/apttransport"
+	"github.com/nicwaller/apt-look/pkg/apt/sources"
+)
+
+// newSigningKey generates a key pair and writes its public half to an armored keyring file
+func newSigningKey(t *testing.T, dir, name string) (*openpgp.Entity, string) {
+	t.Helper()
+	entity, err := openpgp.NewEntity(name, "", name+"@example.com", nil)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.Serialize(w))
+	require.NoError(t, w.Close())
+
+	path := filepath.Join(dir, name+".asc")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+	return entity, path
+}
+
+// newSignedRepo copies the compressed test repository and signs its Release file
+func newSignedRepo(t *testing.T, signer *openpgp.Entity) string {
+	t.Helper()
+	repoPath := t.TempDir()
+	require.NoError(t, os.CopyFS(repoPath, os.DirFS("testdata/compressedrepo")))
+
+	if signer != nil {
+		distPath := filepath.Join(repoPath, "dists", "stable")
+		release, err := os.ReadFile(filepath.Join(distPath, "Release"))
+		require.NoError(t, err)
+
+		var sig bytes.Buffer
+		require.NoError(t, openpgp.ArmoredDetachSign(&sig, signer, bytes.NewReader(release), nil))
+		require.NoError(t, os.WriteFile(filepath.Join(distPath, "Release.gpg"), sig.Bytes(), 0644))
+	}
+	return repoPath
+}
+
+func TestMount_VerifiesSignature(t *testing.T) {
+	keyDir := t.TempDir()
+	trusted, trustedKeyring := newSigningKey(t, keyDir, "trusted")
+	untrusted, _ := newSigningKey(t, keyDir, "untrusted")
+
+	tests := []struct {
+		name    string
+		signer  *openpgp.Entity
+		tamper  bool
+		opts    []MountOption
+		wantErr string
+	}{
+		{name: "valid signature", signer: trusted},
+		{name: "unknown signer", signer: untrusted, wantErr: "failed to verify signature"},
+		{name: "tampered release", signer: trusted, tamper: true, wantErr: "failed to verify signature"},
+		{name: "unsigned", wantErr: "repository is not signed"},
+		{name: "unsigned allowed", opts: []MountOption{WithAllowUnsigned()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repoPath := newSignedRepo(t, tt.signer)
+			if tt.tamper {
+				releasePath := filepath.Join(repoPath, "dists", "stable", "Release")
+				f, err := os.OpenFile(releasePath, os.O_APPEND|os.O_WRONLY, 0644)
+				require.NoError(t, err)
+				_, err = f.WriteString("Label: Tampered\n")
+				require.NoError(t, err)
+				require.NoError(t, f.Close())
+			}
+
+			entry, err := sources.ParseSourceLine("deb file://"+repoPath+" stable main", 1)
+			require.NoError(t, err)
+
+			opts := append([]MountOption{WithKeyring(trustedKeyring)}, tt.opts...)
+			_, err = Mount(*entry, opts...)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestMount_SignatureFetchFails(t *testing.T) {
+	keyDir := t.TempDir()
+	trusted, trustedKeyring := newSigningKey(t, keyDir, "trusted")
+	repoPath := newSignedRepo(t, trusted)
+	files := http.FileServer(http.Dir(repoPath))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dists/stable/Release.gpg" {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		files.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	entry, err := sources.ParseSourceLine("deb "+server.URL+" stable main", 1)
+	require.NoError(t, err)
+
+	// a signature that couldn't be fetched doesn't make the repository unsigned, even when that is allowed
+	for _, opts := range [][]MountOption{nil, {WithAllowUnsigned()}} {
+		opts = append(opts, WithKeyring(trustedKeyring), WithTransport(apttransport.NewHTTPTransport()))
+		_, err = Mount(*entry, opts...)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to fetch Release.gpg")
+		assert.NotContains(t, err.Error(), "not signed")
+	}
+}
+
+func TestMount_SignedByOption(t *testing.T) {
+	keyDir := t.TempDir()
+	trusted, trustedKeyring := newSigningKey(t, keyDir, "trusted")
+	_, otherKeyring := newSigningKey(t, keyDir, "other")
+	repoPath := newSignedRepo(t, trusted)
+
+	entry, err := sources.ParseSourceLine("deb [signed-by="+trustedKeyring+"] file://"+repoPath+" stable main", 1)
+	require.NoError(t, err)
+	_, err = Mount(*entry)
+	require.NoError(t, err)
+
+	// An explicit keyring overrides signed-by
+	_, err = Mount(*entry, WithKeyring(otherKeyring))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to verify signature")
+}
+
+func TestLoadKeyring_Errors(t *testing.T) {
+	_, err := loadKeyring([]string{"DEADBEEFDEADBEEF"})
+	assert.ErrorContains(t, err, "only keyring file paths are supported")
+
+	_, err = loadKeyring([]string{filepath.Join(t.TempDir(), "missing.gpg")})
+	assert.ErrorContains(t, err, "failed to read keyring")
+
+	garbage := filepath.Join(t.TempDir(), "garbage.gpg")
+	require.NoError(t, os.WriteFile(garbage, []byte("not a keyring"), 0644))
+	_, err = loadKeyring([]string{garbage})
+	assert.ErrorContains(t, err, "failed to parse keyring")
+}
+
+func TestMount_Trusted(t *testing.T) {
+	keyDir := t.TempDir()
+	_, keyring := newSigningKey(t, keyDir, "trusted")
+	untrusted, _ := newSigningKey(t, keyDir, "untrusted")
+
+	tests := []struct {
+		name    string
+		signer  *openpgp.Entity
+		options string
+		opts    []MountOption
+		wantErr string
+	}{
+		{name: "untrusted unsigned", wantErr: "repository is not signed"},
+		{name: "untrusted unknown signer", signer: untrusted, wantErr: "failed to verify signature"},
+		{name: "trusted unsigned", options: "[trusted=yes] "},
+		{name: "trusted unknown signer", signer: untrusted, options: "[trusted=yes] "},
+		{name: "trusted=no", options: "[trusted=no] ", wantErr: "repository is not signed"},
+		{name: "trusted by option", signer: untrusted, opts: []MountOption{WithTrusted()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repoPath := newSignedRepo(t, tt.signer)
+			entry, err := sources.ParseSourceLine("deb "+tt.options+"file://"+repoPath+" stable main", 1)
+			require.NoError(t, err)
+
+			opts := append([]MountOption{WithKeyring(keyring)}, tt.opts...)
+			_, err = Mount(*entry, opts...)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+// clearsignRepo replaces the Release file of a copy of the compressed test repository with an InRelease
+// file signed by signer, or adds one next to the Release file when keepRelease is set
+func clearsignRepo(t *testing.T, signer *openpgp.Entity, keepRelease bool) string {
+	t.Helper()
+	repoPath := newSignedRepo(t, nil)
+	distPath := filepath.Join(repoPath, "dists", "stable")
+	release, err := os.ReadFile(filepath.Join(distPath, "Release"))
+	require.NoError(t, err)
+
+	var signed bytes.Buffer
+	w, err := clearsign.Encode(&signed, signer.PrivateKey, nil)
+	require.NoError(t, err)
+	_, err = w.Write(release)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, os.WriteFile(filepath.Join(distPath, "InRelease"), signed.Bytes(), 0644))
+	if !keepRelease {
+		require.NoError(t, os.Remove(filepath.Join(distPath, "Release")))
+	}
+	return repoPath
+}
+
+func TestMount_InRelease(t *testing.T) {
+	keyDir := t.TempDir()
+	trusted, trustedKeyring := newSigningKey(t, keyDir, "trusted")
+	_, otherKeyring := newSigningKey(t, keyDir, "other")
+
+	// a repository that only publishes InRelease is read from it, and verified by its inline signature
+	repoPath := clearsignRepo(t, trusted, false)
+	entry, err := sources.ParseSourceLine("deb file://"+repoPath+" stable main", 1)
+	require.NoError(t, err)
+	repo, err := Mount(*entry, WithKeyring(trustedKeyring), WithArchitectures("amd64"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"main"}, repo.Release().Components)
+	var names []string
+	for pkg, err := range repo.Packages(context.Background()) {
+		require.NoError(t, err)
+		names = append(names, pkg.Package)
+	}
+	assert.Equal(t, []string{"alpha", "bravo"}, names)
+
+	_, err = Mount(*entry, WithKeyring(otherKeyring))
+	assert.ErrorContains(t, err, "failed to verify signature")
+	_, err = Mount(*entry)
+	require.NoError(t, err)
+
+	// without Release.gpg, the InRelease file next to a Release file signs it
+	repoPath = clearsignRepo(t, trusted, true)
+	entry, err = sources.ParseSourceLine("deb file://"+repoPath+" stable main", 1)
+	require.NoError(t, err)
+	_, err = Mount(*entry, WithKeyring(trustedKeyring))
+	require.NoError(t, err)
+	_, err = Mount(*entry, WithKeyring(otherKeyring))
+	assert.ErrorContains(t, err, "failed to verify signature")
+
+	releasePath := filepath.Join(repoPath, "dists", "stable", "Release")
+	f, err := os.OpenFile(releasePath, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString("Label: Tampered\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	_, err = Mount(*entry, WithKeyring(trustedKeyring))
+	assert.ErrorContains(t, err, "doesn't match the Release file")
+}
+
+func TestMount_RelativeSignedBy(t *testing.T) {
+	keyDir := t.TempDir()
+	trusted, _ := newSigningKey(t, keyDir, "trusted")
+	repoPath := newSignedRepo(t, trusted)
+
+	// a relative signed-by path is found next to the sources file
+	entry, err := sources.ParseSourceLine("deb [signed-by=trusted.asc] file://"+repoPath+" stable main", 1)
+	require.NoError(t, err)
+	entry.File = filepath.Join(keyDir, "vendor.list")
+	_, err = Mount(*entry)
+	require.NoError(t, err)
+
+	// and in the working directory otherwise
+	t.Chdir(keyDir)
+	entry.File = ""
+	_, err = Mount(*entry)
+	require.NoError(t, err)
+}
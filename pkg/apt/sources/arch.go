@@ -0,0 +1,69 @@
+package sources
+
+import (
+	"fmt"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// DefaultArchitectures returns the Debian architectures apt would use on this system,
+// or nil when the Go architecture has no obvious Debian equivalent
+func DefaultArchitectures() []string {
+	switch runtime.GOARCH {
+	case "amd64":
+		return []string{"amd64", "i386"}
+	case "386":
+		return []string{"i386"}
+	case "arm64":
+		return []string{"arm64"}
+	case "arm":
+		return []string{"arm", "armhf"}
+	default:
+		// whatever, just use all of them
+		return nil
+	}
+}
+
+// Architectures returns the architectures selected by the entry's arch option, or nil if it has none
+func (e *Entry) Architectures() []string {
+	if e.Options["arch"] == "" {
+		return nil
+	}
+	return strings.Split(e.Options["arch"], ",")
+}
+
+// applyArchOption resolves arch=, arch+= and arch-= into the effective arch option.
+// The additive and subtractive forms modify the architectures set so far, which start
+// out as the system's default architectures. Removing every architecture is an error,
+// since an empty arch option would otherwise select all of them.
+func applyArchOption(options map[string]string, op, value string) error {
+	values := strings.Split(value, ",")
+	if op == "=" {
+		options["arch"] = strings.Join(values, ",")
+		return nil
+	}
+
+	archs := DefaultArchitectures()
+	if current, ok := options["arch"]; ok {
+		archs = strings.Split(current, ",")
+	}
+	archs = slices.Clone(archs)
+	switch op {
+	case "+=":
+		for _, arch := range values {
+			if !slices.Contains(archs, arch) {
+				archs = append(archs, arch)
+			}
+		}
+	case "-=":
+		archs = slices.DeleteFunc(archs, func(arch string) bool {
+			return slices.Contains(values, arch)
+		})
+		if len(archs) == 0 {
+			return fmt.Errorf("removing %s leaves no architectures", value)
+		}
+	}
+	options["arch"] = strings.Join(archs, ",")
+	return nil
+}
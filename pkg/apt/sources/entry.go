@@ -1,7 +1,9 @@
 package sources
 
 import (
+	"maps"
 	"net/url"
+	"slices"
 	"strings"
 )
 
@@ -23,7 +25,7 @@ type Entry struct {
 	ArchiveRoot *url.URL `json:"archiveroot"`
 
 	// Distribution/Suite (e.g., "stable", "jammy", "bookworm")
-	// This may be "/" or "." if the archive uses a flat repository format
+	// This may be "/", "." or another directory ending in "/" if the archive uses a flat repository format
 	// A flat repository does not use the dists hierarchy of directories,
 	// and instead places meta index and indices directly into the archive root (or some part below it)
 	// In sources.list syntax, a flat repository is specified like this:
@@ -36,11 +38,66 @@ type Entry struct {
 	// Options in square brackets (e.g., arch=amd64, trusted=yes)
 	Options map[string]string `json:"options,omitempty"`
 
+	// Enabled is false for source lines that are commented out and for deb822 stanzas with Enabled: no
+	Enabled bool `json:"enabled"`
+
 	// Original line text for reference
 	originalLine string
 
 	// Line number in the source file
 	LineNumber int `json:"line_number,omitempty"`
+
+	// File the entry was read from, empty for entries parsed from a string or stream
+	File string `json:"file,omitempty"`
+}
+
+// String renders the entry as a one-line sources.list entry, commented out if it is disabled.
+// Options are written in sorted order so the output is stable.
+func (e *Entry) String() string {
+	var sb strings.Builder
+	if !e.Enabled {
+		sb.WriteString("# ")
+	}
+	sb.WriteString(string(e.Type))
+
+	// the comment marker stands in for a deb822 Enabled field
+	options := slices.DeleteFunc(slices.Sorted(maps.Keys(e.Options)), func(key string) bool {
+		return key == "enabled"
+	})
+	if len(options) > 0 {
+		sb.WriteString(" [")
+		for i, key := range options {
+			if i > 0 {
+				sb.WriteRune(' ')
+			}
+			sb.WriteString(key + "=" + e.Options[key])
+		}
+		sb.WriteRune(']')
+	}
+
+	sb.WriteRune(' ')
+	if e.ArchiveRoot != nil {
+		sb.WriteString(e.ArchiveRoot.String())
+	}
+	sb.WriteRune(' ')
+	sb.WriteString(e.Distribution)
+
+	// flat repositories have no components
+	for _, component := range e.Components {
+		sb.WriteRune(' ')
+		sb.WriteString(component)
+	}
+	return sb.String()
+}
+
+// Trusted reports whether the entry's trusted option is set, which tells apt to use the repository
+// without verifying its Release signature
+func (e *Entry) Trusted() bool {
+	switch strings.ToLower(e.Options["trusted"]) {
+	case "yes", "true":
+		return true
+	}
+	return false
 }
 
 // isSourceLine checks if a line looks like a source line (starts with deb or deb-src)
@@ -0,0 +1,25 @@
+package sources
+
+import (
+	"slices"
+	"strings"
+)
+
+// EnabledEntries returns the entries that are enabled, in their original order
+func EnabledEntries(entries []Entry) []Entry {
+	var enabled []Entry
+	for _, entry := range entries {
+		if entry.Enabled {
+			enabled = append(enabled, entry)
+		}
+	}
+	return enabled
+}
+
+// EntriesByURI returns the entries whose archive root is uri, ignoring a trailing slash on either
+func EntriesByURI(entries []Entry, uri string) []Entry {
+	uri = strings.TrimSuffix(uri, "/")
+	return slices.DeleteFunc(slices.Clone(entries), func(entry Entry) bool {
+		return entry.ArchiveRoot == nil || strings.TrimSuffix(entry.ArchiveRoot.String(), "/") != uri
+	})
+}
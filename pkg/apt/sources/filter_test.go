@@ -0,0 +1,56 @@
+package sources
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+const filterSourcesList = `deb http://deb.debian.org/debian bookworm main
+# deb http://deb.debian.org/debian bookworm-backports main
+deb-src http://deb.debian.org/debian/ bookworm main
+deb https://packages.example.com/apt stable main
+`
+
+func TestEnabledEntries(t *testing.T) {
+	entries, err := ParseSourcesList(strings.NewReader(filterSourcesList))
+	if err != nil {
+		t.Fatalf("ParseSourcesList() error = %v", err)
+	}
+
+	enabled := EnabledEntries(entries)
+	if len(enabled) != 3 {
+		t.Fatalf("EnabledEntries() returned %d entries, want 3", len(enabled))
+	}
+	for _, entry := range enabled {
+		if !entry.Enabled {
+			t.Errorf("EnabledEntries() returned disabled entry %s", entry.String())
+		}
+	}
+	if len(entries) != 4 {
+		t.Errorf("EnabledEntries() changed its argument to %d entries", len(entries))
+	}
+}
+
+func TestEntriesByURI(t *testing.T) {
+	entries, err := ParseSourcesList(strings.NewReader(filterSourcesList))
+	if err != nil {
+		t.Fatalf("ParseSourcesList() error = %v", err)
+	}
+
+	debian := EntriesByURI(entries, "http://deb.debian.org/debian/")
+	var lines []int
+	for _, entry := range debian {
+		lines = append(lines, entry.LineNumber)
+	}
+	if got, want := lines, []int{1, 2, 3}; !slices.Equal(got, want) {
+		t.Errorf("EntriesByURI() lines = %v, want %v", got, want)
+	}
+
+	if got := EntriesByURI(entries, "https://missing.example.com"); len(got) != 0 {
+		t.Errorf("EntriesByURI() = %v, want none", got)
+	}
+	if entries[3].ArchiveRoot.Host != "packages.example.com" {
+		t.Errorf("EntriesByURI() reordered its argument")
+	}
+}
@@ -0,0 +1,49 @@
+package sources
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ParseSources parses sources in either the one-line sources.list format or the deb822 format,
+// which is recognized by a Types field on the first line that isn't blank or a comment
+func ParseSources(r io.Reader) ([]Entry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sources: %w", err)
+	}
+	if isDeb822Sources(data) {
+		return parseDeb822Stanzas(bytes.NewReader(data))
+	}
+	return ParseSourcesList(bytes.NewReader(data))
+}
+
+// isDeb822Sources reports whether the first significant line of data is a Types field
+func isDeb822Sources(data []byte) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, _, found := strings.Cut(line, ":")
+		return found && strings.EqualFold(strings.TrimSpace(name), "Types")
+	}
+	return false
+}
+
+// parseDeb822Stanzas is ParseDeb822SourcesList, but rejects input that holds no stanzas at all
+func parseDeb822Stanzas(r io.Reader) ([]Entry, error) {
+	entries, err := ParseDeb822SourcesList(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("no source stanzas found; each stanza needs Types, URIs and Suites fields")
+	}
+	return entries, nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"net/url"
+	"slices"
 	"strings"
 
 	"github.com/nicwaller/apt-look/pkg/deb822"
@@ -50,6 +51,7 @@ func ParseDeb822SourcesList(r io.Reader) ([]Entry, error) {
 		options := make(map[string]string)
 		for _, field := range header {
 			fieldName := strings.ToLower(field.Name)
+			var err error
 			switch fieldName {
 			case "types", "uris", "suites", "components":
 				// Skip the main fields we've already processed
@@ -61,13 +63,33 @@ func ParseDeb822SourcesList(r io.Reader) ([]Entry, error) {
 			case "trusted":
 				options["trusted"] = field.Value.Unfold()
 			case "arch":
-				options["arch"] = field.Value.Unfold()
+				err = applyArchOption(options, "=", field.Value.Unfold())
+			case "architectures-add":
+				err = applyArchOption(options, "+=", strings.Join(strings.Fields(field.Value.Unfold()), ","))
+			case "architectures-remove":
+				err = applyArchOption(options, "-=", strings.Join(strings.Fields(field.Value.Unfold()), ","))
 			case "lang":
 				options["lang"] = field.Value.Unfold()
+			case "architectures", "languages", "targets", "pdiffs":
+				// Store under the one-line option name, e.g. Architectures: amd64 arm64 becomes arch=amd64,arm64
+				option := deb822OptionName(fieldName)
+				options[option] = field.Value.Unfold()
+				if slices.Contains(deb822ListOptions, option) {
+					options[option] = strings.Join(strings.Fields(options[option]), ",")
+				}
 			default:
 				// Include any other fields as options
 				options[fieldName] = field.Value.Unfold()
 			}
+			if err != nil {
+				return nil, fmt.Errorf("record %d: %w", recordNumber, err)
+			}
+		}
+
+		enabled := true
+		switch strings.ToLower(options["enabled"]) {
+		case "no", "false", "off":
+			enabled = false
 		}
 
 		// Generate entries for each combination of type, archiveRoot, and suite
@@ -90,6 +112,7 @@ func ParseDeb822SourcesList(r io.Reader) ([]Entry, error) {
 						Distribution: suite,
 						Components:   components,
 						Options:      options,
+						Enabled:      enabled,
 						LineNumber:   recordNumber,
 					}
 
@@ -101,3 +124,13 @@ func ParseDeb822SourcesList(r io.Reader) ([]Entry, error) {
 
 	return entries, nil
 }
+
+// deb822OptionName returns the one-line option name for a lower-cased deb822 field
+func deb822OptionName(field string) string {
+	for option, name := range deb822OptionFields {
+		if strings.ToLower(name) == field {
+			return option
+		}
+	}
+	return field
+}
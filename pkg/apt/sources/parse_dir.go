@@ -0,0 +1,65 @@
+package sources
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// validSourceFileName matches the file names apt reads from sources.list.d; others such as
+// docker.list.save or ubuntu.sources.bak are ignored, as apt does
+var validSourceFileName = regexp.MustCompile(`^[A-Za-z0-9_.-]+\.(list|sources)$`)
+
+// ParseSourcesFile parses a single sources file, using the deb822 parser for *.sources files
+// and detecting the format from the content otherwise. Each entry records the file it was read from.
+func ParseSourcesFile(path string) ([]Entry, error) {
+	parse := ParseSources
+	if strings.HasSuffix(path, ".sources") {
+		parse = parseDeb822Stanzas
+	}
+	return parseFile(path, parse)
+}
+
+// ParseSourcesDir parses every *.list and *.sources file in a directory such as /etc/apt/sources.list.d,
+// in lexical order like apt, and returns the combined entries
+func ParseSourcesDir(dir string) ([]Entry, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sources directory: %w", err)
+	}
+
+	// os.ReadDir returns entries sorted by file name
+	var entries []Entry
+	for _, file := range files {
+		if file.IsDir() || !validSourceFileName.MatchString(file.Name()) {
+			continue
+		}
+		fileEntries, err := ParseSourcesFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, fileEntries...)
+	}
+	return entries, nil
+}
+
+// parseFile opens path, parses it and stamps the entries with their source file
+func parseFile(path string, parse func(io.Reader) ([]Entry, error)) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sources file: %w", err)
+	}
+	defer file.Close()
+
+	entries, err := parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i := range entries {
+		entries[i].File = path
+	}
+	return entries, nil
+}
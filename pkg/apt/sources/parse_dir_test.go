@@ -0,0 +1,82 @@
+package sources
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeSourcesFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestParseSourcesDir(t *testing.T) {
+	dir := writeSourcesFiles(t, map[string]string{
+		"docker.list": "deb https://download.docker.com/linux/ubuntu jammy stable\n",
+		"debian.sources": `Types: deb
+URIs: https://deb.debian.org/debian
+Suites: bookworm
+Components: main
+`,
+		"old.list.save": "deb http://example.com/old stable main\n",
+		"README":        "not a sources file\n",
+	})
+	if err := os.Mkdir(filepath.Join(dir, "nested.list"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ParseSourcesDir(dir)
+	if err != nil {
+		t.Fatalf("ParseSourcesDir() error = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("ParseSourcesDir() got %d entries, want 2", len(entries))
+	}
+
+	// files are read in lexical order
+	expected := []struct {
+		uri  string
+		file string
+	}{
+		{"https://deb.debian.org/debian", "debian.sources"},
+		{"https://download.docker.com/linux/ubuntu", "docker.list"},
+	}
+	for i, exp := range expected {
+		if got := entries[i].ArchiveRoot.String(); got != exp.uri {
+			t.Errorf("Entry[%d] ArchiveRoot = %v, want %v", i, got, exp.uri)
+		}
+		if want := filepath.Join(dir, exp.file); entries[i].File != want {
+			t.Errorf("Entry[%d] File = %v, want %v", i, entries[i].File, want)
+		}
+	}
+}
+
+func TestParseSourcesDirErrorNamesFile(t *testing.T) {
+	dir := writeSourcesFiles(t, map[string]string{
+		"good.list": "deb http://example.com/debian stable main\n",
+		"bad.list":  "deb http://example.com/debian stable main\nnot a source line\n",
+	})
+
+	_, err := ParseSourcesDir(dir)
+	if err == nil {
+		t.Fatal("ParseSourcesDir() expected error for invalid line, got nil")
+	}
+	if want := filepath.Join(dir, "bad.list") + ": line 2"; !strings.Contains(err.Error(), want) {
+		t.Errorf("ParseSourcesDir() error = %v, want it to contain %q", err, want)
+	}
+}
+
+func TestParseSourcesDirMissing(t *testing.T) {
+	_, err := ParseSourcesDir(filepath.Join(t.TempDir(), "missing"))
+	if err == nil {
+		t.Error("ParseSourcesDir() expected error for missing directory, got nil")
+	}
+}
@@ -26,8 +26,17 @@ func ParseSourcesList(r io.Reader) ([]Entry, error) {
 			continue
 		}
 
-		// Skip commented lines
+		// Commented-out source lines become disabled entries; other comments are skipped
 		if strings.HasPrefix(line, "#") {
+			if !isSourceLine(strings.TrimLeft(line, "# \t")) {
+				continue
+			}
+			entry, err := ParseSourceLine(line, lineNumber)
+			if err != nil {
+				// a malformed line that apt ignores anyway isn't worth failing over
+				continue
+			}
+			entries = append(entries, *entry)
 			continue
 		}
 
@@ -46,7 +55,8 @@ func ParseSourcesList(r io.Reader) ([]Entry, error) {
 	return entries, nil
 }
 
-// ParseSourceLine parses a single line from sources.list
+// ParseSourceLine parses a single line from sources.list. A commented-out source line such as
+// "# deb http://example.com/ stable main" yields an entry with Enabled set to false.
 func ParseSourceLine(line string, lineNumber int) (*Entry, error) {
 	originalLine := line
 	line = strings.TrimSpace(line)
@@ -55,8 +65,14 @@ func ParseSourceLine(line string, lineNumber int) (*Entry, error) {
 		return nil, errors.New("empty line")
 	}
 
+	// A commented-out source line parses as a disabled entry
+	enabled := true
 	if strings.HasPrefix(line, "#") {
-		return nil, errors.New("commented line")
+		line = strings.TrimLeft(line, "# \t")
+		if !isSourceLine(line) {
+			return nil, errors.New("commented line")
+		}
+		enabled = false
 	}
 
 	// Parse options in square brackets (they come after the source type)
@@ -71,7 +87,20 @@ func ParseSourceLine(line string, lineNumber int) (*Entry, error) {
 
 		for _, opt := range strings.Fields(optionsStr) {
 			if parts := strings.SplitN(opt, "=", 2); len(parts) == 2 {
-				options[parts[0]] = parts[1]
+				var err error
+				switch parts[0] {
+				case "arch":
+					err = applyArchOption(options, "=", parts[1])
+				case "arch+":
+					err = applyArchOption(options, "+=", parts[1])
+				case "arch-":
+					err = applyArchOption(options, "-=", parts[1])
+				default:
+					options[parts[0]] = parts[1]
+				}
+				if err != nil {
+					return nil, err
+				}
 			} else {
 				options[opt] = "true" // Options without values are treated as boolean true
 			}
@@ -118,6 +147,7 @@ func ParseSourceLine(line string, lineNumber int) (*Entry, error) {
 		Distribution: distribution,
 		Components:   components,
 		Options:      options,
+		Enabled:      enabled,
 		originalLine: originalLine,
 		LineNumber:   lineNumber,
 	}, nil
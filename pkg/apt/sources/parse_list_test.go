@@ -1,6 +1,7 @@
 package sources
 
 import (
+	"slices"
 	"strings"
 	"testing"
 )
@@ -22,6 +23,7 @@ func TestParseSourceLine(t *testing.T) {
 				Distribution: "jammy",
 				Components:   []string{"main"},
 				Options:      map[string]string{},
+				Enabled:      true,
 				LineNumber:   1,
 			},
 			wantErr: false,
@@ -35,6 +37,7 @@ func TestParseSourceLine(t *testing.T) {
 				Distribution: "bookworm",
 				Components:   []string{"main", "contrib", "non-free"},
 				Options:      map[string]string{},
+				Enabled:      true,
 				LineNumber:   2,
 			},
 			wantErr: false,
@@ -51,6 +54,7 @@ func TestParseSourceLine(t *testing.T) {
 					"arch":    "amd64",
 					"trusted": "yes",
 				},
+				Enabled:    true,
 				LineNumber: 3,
 			},
 			wantErr: false,
@@ -66,6 +70,7 @@ func TestParseSourceLine(t *testing.T) {
 				Options: map[string]string{
 					"signed-by": "/usr/share/keyrings/test.gpg",
 				},
+				Enabled:    true,
 				LineNumber: 4,
 			},
 			wantErr: false,
@@ -78,9 +83,23 @@ func TestParseSourceLine(t *testing.T) {
 			wantErr:    true,
 		},
 		{
-			name:       "commented line",
+			name:       "commented source line",
 			line:       "# deb http://archive.ubuntu.com/ubuntu jammy main",
 			lineNumber: 6,
+			expected: &Entry{
+				Type:         SourceTypeDeb,
+				Distribution: "jammy",
+				Components:   []string{"main"},
+				Options:      map[string]string{},
+				Enabled:      false,
+				LineNumber:   6,
+			},
+			wantErr: false,
+		},
+		{
+			name:       "comment",
+			line:       "# See sources.list(5) for more information",
+			lineNumber: 6,
 			expected:   nil,
 			wantErr:    true,
 		},
@@ -138,6 +157,9 @@ func TestParseSourceLine(t *testing.T) {
 					}
 				}
 			}
+			if got.Enabled != tt.expected.Enabled {
+				t.Errorf("ParseSourceLine() Enabled = %v, want %v", got.Enabled, tt.expected.Enabled)
+			}
 			if got.LineNumber != tt.expected.LineNumber {
 				t.Errorf("ParseSourceLine() LineNumber = %v, want %v", got.LineNumber, tt.expected.LineNumber)
 			}
@@ -145,6 +167,53 @@ func TestParseSourceLine(t *testing.T) {
 	}
 }
 
+func TestParseSourceLineArchOptions(t *testing.T) {
+	defaults := DefaultArchitectures()
+	withArm64 := slices.Clone(defaults)
+	if !slices.Contains(withArm64, "arm64") {
+		withArm64 = append(withArm64, "arm64")
+	}
+	withoutI386 := slices.DeleteFunc(slices.Clone(defaults), func(arch string) bool { return arch == "i386" })
+
+	tests := []struct {
+		name     string
+		options  string
+		expected []string
+	}{
+		{"plain arch replaces the defaults", "arch=amd64,arm64", []string{"amd64", "arm64"}},
+		{"arch+= adds to the defaults", "arch+=arm64", withArm64},
+		{"arch-= removes from the defaults", "arch-=i386", withoutI386},
+		{"arch+= adds to an earlier arch=", "arch=amd64 arch+=arm64,amd64", []string{"amd64", "arm64"}},
+		{"arch-= removes from an earlier arch=", "arch=amd64,i386,armhf arch-=i386,armhf", []string{"amd64"}},
+		{"arch= replaces earlier changes", "arch+=s390x arch=riscv64", []string{"riscv64"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := ParseSourceLine("deb ["+tt.options+"] http://example.com/debian stable main", 1)
+			if err != nil {
+				t.Fatalf("ParseSourceLine() error = %v", err)
+			}
+			if got := entry.Architectures(); !slices.Equal(got, tt.expected) {
+				t.Errorf("Architectures() = %v, want %v", got, tt.expected)
+			}
+			if _, ok := entry.Options["arch+"]; ok {
+				t.Errorf("Options has a literal arch+ key: %v", entry.Options)
+			}
+			if _, ok := entry.Options["arch-"]; ok {
+				t.Errorf("Options has a literal arch- key: %v", entry.Options)
+			}
+		})
+	}
+}
+
+func TestParseSourceLineArchOptionsRemoveAll(t *testing.T) {
+	_, err := ParseSourceLine("deb [arch=amd64,i386 arch-=amd64,i386] http://example.com/debian stable main", 1)
+	if err == nil || !strings.Contains(err.Error(), "leaves no architectures") {
+		t.Errorf("ParseSourceLine() error = %v, want error containing %q", err, "leaves no architectures")
+	}
+}
+
 func TestParseSourcesList(t *testing.T) {
 	input := `# This is a comment
 deb http://archive.ubuntu.com/ubuntu jammy main restricted
@@ -152,7 +221,9 @@ deb-src http://archive.ubuntu.com/ubuntu jammy main restricted
 
 deb [arch=amd64] http://archive.ubuntu.com/ubuntu jammy universe multiverse
 # Another comment
-deb https://deb.debian.org/debian bookworm main`
+deb https://deb.debian.org/debian bookworm main
+#deb http://archive.ubuntu.com/ubuntu jammy-backports main
+# deb http://archive.ubuntu.com/ubuntu`
 
 	expected := []Entry{
 		{
@@ -185,6 +256,14 @@ deb https://deb.debian.org/debian bookworm main`
 			Options:      map[string]string{},
 			LineNumber:   7,
 		},
+		// commented-out lines are kept as disabled entries, unless they don't parse
+		{
+			Type:         SourceTypeDeb,
+			Distribution: "jammy-backports",
+			Components:   []string{"main"},
+			Options:      map[string]string{},
+			LineNumber:   8,
+		},
 	}
 
 	got, err := ParseSourcesList(strings.NewReader(input))
@@ -211,6 +290,9 @@ deb https://deb.debian.org/debian bookworm main`
 		if entry.LineNumber != exp.LineNumber {
 			t.Errorf("Entry[%d] LineNumber = %v, want %v", i, entry.LineNumber, exp.LineNumber)
 		}
+		if wantEnabled := exp.LineNumber != 8; entry.Enabled != wantEnabled {
+			t.Errorf("Entry[%d] Enabled = %v, want %v", i, entry.Enabled, wantEnabled)
+		}
 	}
 }
 
@@ -407,6 +489,15 @@ URIs: https://example.com/repo
 Suites: stable`,
 			wantErr: "unknown source type: rpm",
 		},
+		{
+			name: "Architectures-Remove removes every architecture",
+			input: `Types: deb
+URIs: https://example.com/repo
+Suites: stable
+Architectures: amd64
+Architectures-Remove: amd64`,
+			wantErr: "removing amd64 leaves no architectures",
+		},
 	}
 
 	for _, tt := range tests {
@@ -422,3 +513,29 @@ Suites: stable`,
 		})
 	}
 }
+
+func TestEntryTrusted(t *testing.T) {
+	tests := []struct {
+		options string
+		want    bool
+	}{
+		{"", false},
+		{"[trusted=yes] ", true},
+		{"[trusted=Yes] ", true},
+		{"[trusted=true] ", true},
+		{"[trusted=no] ", false},
+		{"[arch=amd64] ", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.options, func(t *testing.T) {
+			entry, err := ParseSourceLine("deb "+tt.options+"http://example.com/debian stable main", 1)
+			if err != nil {
+				t.Fatalf("ParseSourceLine() error = %v", err)
+			}
+			if got := entry.Trusted(); got != tt.want {
+				t.Errorf("Trusted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
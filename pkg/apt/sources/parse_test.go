@@ -0,0 +1,73 @@
+package sources
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSourcesDetectsFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:  "one-line format",
+			input: "# main archive\ndeb http://deb.debian.org/debian bookworm main\n",
+			want:  []string{"http://deb.debian.org/debian bookworm"},
+		},
+		{
+			name: "deb822 format",
+			input: `# Modernized from /etc/apt/sources.list
+Types: deb
+URIs: http://deb.debian.org/debian
+Suites: bookworm bookworm-updates
+Components: main
+`,
+			want: []string{"http://deb.debian.org/debian bookworm", "http://deb.debian.org/debian bookworm-updates"},
+		},
+		{
+			name:    "deb822 missing field",
+			input:   "Types: deb\nSuites: bookworm\n",
+			wantErr: "missing required field 'URIs'",
+		},
+		{
+			name:  "empty input",
+			input: "# nothing here\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := ParseSources(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseSources() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSources() error = %v", err)
+			}
+			var got []string
+			for _, entry := range entries {
+				got = append(got, entry.ArchiveRoot.String()+" "+entry.Distribution)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ParseSources() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSourcesFileRequiresStanzas(t *testing.T) {
+	dir := writeSourcesFiles(t, map[string]string{
+		"empty.sources": "# all stanzas removed\n",
+	})
+
+	_, err := ParseSourcesFile(dir + "/empty.sources")
+	if err == nil || !strings.Contains(err.Error(), "no source stanzas found") {
+		t.Errorf("ParseSourcesFile() error = %v, want no source stanzas error", err)
+	}
+}
@@ -0,0 +1,137 @@
+package sources
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// deb822OptionFields maps one-line option names to the deb822 fields that carry them where the names differ
+var deb822OptionFields = map[string]string{
+	"arch":   "Architectures",
+	"lang":   "Languages",
+	"target": "Targets",
+	"pdiffs": "PDiffs",
+}
+
+// deb822ListOptions hold comma-separated lists in one-line format and space-separated lists in deb822
+var deb822ListOptions = []string{"arch", "lang", "target"}
+
+// deb822Stanza is one group of entries that only differ by type and suite
+type deb822Stanza struct {
+	types   []SourceType
+	uri     string
+	suites  []string
+	entries []Entry
+}
+
+// WriteDeb822SourcesList writes the entries as deb822 stanzas suitable for a *.sources file.
+// Entries that share a URI, components and options are grouped into one stanza with several
+// Types and Suites, the reverse of the expansion done by ParseDeb822SourcesList.
+func WriteDeb822SourcesList(w io.Writer, entries []Entry) error {
+	for i, stanza := range groupDeb822Stanzas(entries) {
+		if i > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return fmt.Errorf("failed to write source stanza: %w", err)
+			}
+		}
+		if err := writeDeb822Stanza(w, stanza); err != nil {
+			return fmt.Errorf("failed to write source stanza: %w", err)
+		}
+	}
+	return nil
+}
+
+// groupDeb822Stanzas first collects the types used by each URI and suite, then merges suites that
+// ended up with the same types, keeping the order in which entries first appear
+func groupDeb822Stanzas(entries []Entry) []deb822Stanza {
+	var bySuite []deb822Stanza
+	for _, entry := range entries {
+		uri := ""
+		if entry.ArchiveRoot != nil {
+			uri = entry.ArchiveRoot.String()
+		}
+		i := slices.IndexFunc(bySuite, func(s deb822Stanza) bool {
+			return s.uri == uri && s.suites[0] == entry.Distribution && sameStanzaFields(s.entries[0], entry)
+		})
+		if i < 0 {
+			bySuite = append(bySuite, deb822Stanza{uri: uri, suites: []string{entry.Distribution}})
+			i = len(bySuite) - 1
+		}
+		if !slices.Contains(bySuite[i].types, entry.Type) {
+			bySuite[i].types = append(bySuite[i].types, entry.Type)
+		}
+		bySuite[i].entries = append(bySuite[i].entries, entry)
+	}
+
+	var stanzas []deb822Stanza
+	for _, group := range bySuite {
+		i := slices.IndexFunc(stanzas, func(s deb822Stanza) bool {
+			return s.uri == group.uri && slices.Equal(s.types, group.types) && sameStanzaFields(s.entries[0], group.entries[0])
+		})
+		if i < 0 {
+			stanzas = append(stanzas, group)
+			continue
+		}
+		stanzas[i].suites = append(stanzas[i].suites, group.suites...)
+		stanzas[i].entries = append(stanzas[i].entries, group.entries...)
+	}
+	return stanzas
+}
+
+// sameStanzaFields reports whether two entries have the same components, options and enabled state
+func sameStanzaFields(a, b Entry) bool {
+	return a.Enabled == b.Enabled && slices.Equal(a.Components, b.Components) && maps.Equal(a.Options, b.Options)
+}
+
+func writeDeb822Stanza(w io.Writer, stanza deb822Stanza) error {
+	types := make([]string, len(stanza.types))
+	for i, t := range stanza.types {
+		types[i] = string(t)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Types: %s\n", strings.Join(types, " "))
+	fmt.Fprintf(&sb, "URIs: %s\n", stanza.uri)
+	fmt.Fprintf(&sb, "Suites: %s\n", strings.Join(stanza.suites, " "))
+	// flat repositories have no components
+	if components := stanza.entries[0].Components; len(components) > 0 {
+		fmt.Fprintf(&sb, "Components: %s\n", strings.Join(components, " "))
+	}
+
+	options := stanza.entries[0].Options
+	if !stanza.entries[0].Enabled && options["enabled"] == "" {
+		// commented-out one-line entries carry no enabled option
+		options = maps.Clone(options)
+		if options == nil {
+			options = make(map[string]string)
+		}
+		options["enabled"] = "no"
+	}
+	for _, key := range slices.Sorted(maps.Keys(options)) {
+		value := options[key]
+		if slices.Contains(deb822ListOptions, key) {
+			value = strings.ReplaceAll(value, ",", " ")
+		}
+		fmt.Fprintf(&sb, "%s: %s\n", deb822FieldName(key), value)
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// deb822FieldName returns the deb822 field for an option, e.g. "signed-by" becomes "Signed-By"
+func deb822FieldName(option string) string {
+	if field, ok := deb822OptionFields[option]; ok {
+		return field
+	}
+	parts := strings.Split(option, "-")
+	for i, part := range parts {
+		if part != "" {
+			parts[i] = strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return strings.Join(parts, "-")
+}
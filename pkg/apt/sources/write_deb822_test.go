@@ -0,0 +1,131 @@
+package sources
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWriteDeb822SourcesListRoundTrip(t *testing.T) {
+	input := `Types: deb deb-src
+URIs: https://deb.debian.org/debian
+Suites: bookworm bookworm-updates
+Components: main non-free-firmware
+Enabled: yes
+Signed-By: /usr/share/keyrings/debian-archive-keyring.gpg
+
+Types: deb
+URIs: https://download.docker.com/linux/debian
+Suites: bookworm
+Components: stable
+Architectures: amd64 arm64
+
+Types: deb
+URIs: file:///srv/repo
+Suites: ./
+`
+	entries, err := ParseDeb822SourcesList(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseDeb822SourcesList() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteDeb822SourcesList(&buf, entries); err != nil {
+		t.Fatalf("WriteDeb822SourcesList() error = %v", err)
+	}
+
+	// stanzas are regrouped the way they were written, with options in sorted order
+	want := `Types: deb deb-src
+URIs: https://deb.debian.org/debian
+Suites: bookworm bookworm-updates
+Components: main non-free-firmware
+Enabled: yes
+Signed-By: /usr/share/keyrings/debian-archive-keyring.gpg
+
+Types: deb
+URIs: https://download.docker.com/linux/debian
+Suites: bookworm
+Components: stable
+Architectures: amd64 arm64
+
+Types: deb
+URIs: file:///srv/repo
+Suites: ./
+`
+	if got := buf.String(); got != want {
+		t.Errorf("WriteDeb822SourcesList() =\n%s\nwant\n%s", got, want)
+	}
+
+	reparsed, err := ParseDeb822SourcesList(&buf)
+	if err != nil {
+		t.Fatalf("ParseDeb822SourcesList() of output error = %v", err)
+	}
+	if got, want := entryStrings(reparsed), entryStrings(entries); !slices.Equal(got, want) {
+		t.Errorf("round trip entries = %v, want %v", got, want)
+	}
+}
+
+func TestWriteDeb822SourcesListFromOneLine(t *testing.T) {
+	input := `deb [arch=amd64,arm64 signed-by=/etc/apt/keyrings/docker.gpg] https://download.docker.com/linux/ubuntu jammy stable
+deb http://archive.ubuntu.com/ubuntu jammy main universe
+deb-src http://archive.ubuntu.com/ubuntu jammy main universe
+deb http://archive.ubuntu.com/ubuntu jammy-updates main universe
+# deb http://archive.ubuntu.com/ubuntu jammy-backports main universe
+`
+	entries, err := ParseSourcesList(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseSourcesList() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteDeb822SourcesList(&buf, entries); err != nil {
+		t.Fatalf("WriteDeb822SourcesList() error = %v", err)
+	}
+
+	// jammy-updates has no deb-src entry, so it can't share the jammy stanza
+	want := `Types: deb
+URIs: https://download.docker.com/linux/ubuntu
+Suites: jammy
+Components: stable
+Architectures: amd64 arm64
+Signed-By: /etc/apt/keyrings/docker.gpg
+
+Types: deb deb-src
+URIs: http://archive.ubuntu.com/ubuntu
+Suites: jammy
+Components: main universe
+
+Types: deb
+URIs: http://archive.ubuntu.com/ubuntu
+Suites: jammy-updates
+Components: main universe
+
+Types: deb
+URIs: http://archive.ubuntu.com/ubuntu
+Suites: jammy-backports
+Components: main universe
+Enabled: no
+`
+	if got := buf.String(); got != want {
+		t.Errorf("WriteDeb822SourcesList() =\n%s\nwant\n%s", got, want)
+	}
+
+	reparsed, err := ParseDeb822SourcesList(&buf)
+	if err != nil {
+		t.Fatalf("ParseDeb822SourcesList() of output error = %v", err)
+	}
+	if got, want := entryStrings(reparsed), entryStrings(entries); !slices.Equal(got, want) {
+		t.Errorf("converted entries = %v, want %v", got, want)
+	}
+}
+
+// entryStrings renders entries in one-line format, sorted so that grouping order doesn't matter
+func entryStrings(entries []Entry) []string {
+	var lines []string
+	for _, entry := range entries {
+		lines = append(lines, entry.String())
+	}
+	slices.Sort(lines)
+	return lines
+}
@@ -0,0 +1,16 @@
+package sources
+
+import (
+	"fmt"
+	"io"
+)
+
+// WriteSourcesList writes the entries in one-line sources.list format, one per line
+func WriteSourcesList(w io.Writer, entries []Entry) error {
+	for _, entry := range entries {
+		if _, err := fmt.Fprintln(w, entry.String()); err != nil {
+			return fmt.Errorf("failed to write source entry: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package sources
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEntryString(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{
+			name: "plain entry",
+			line: "deb http://archive.ubuntu.com/ubuntu jammy main restricted",
+			want: "deb http://archive.ubuntu.com/ubuntu jammy main restricted",
+		},
+		{
+			name: "options are sorted",
+			line: "deb [signed-by=/usr/share/keyrings/docker.gpg arch=amd64,arm64] https://download.docker.com/linux/ubuntu jammy stable",
+			want: "deb [arch=amd64,arm64 signed-by=/usr/share/keyrings/docker.gpg] https://download.docker.com/linux/ubuntu jammy stable",
+		},
+		{
+			name: "flat repository",
+			line: "deb https://example.com/repo /",
+			want: "deb https://example.com/repo /",
+		},
+		{
+			name: "disabled entry",
+			line: "#deb http://archive.ubuntu.com/ubuntu jammy-backports main",
+			want: "# deb http://archive.ubuntu.com/ubuntu jammy-backports main",
+		},
+		{
+			name: "source entry",
+			line: "deb-src   http://deb.debian.org/debian   bookworm   main",
+			want: "deb-src http://deb.debian.org/debian bookworm main",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := ParseSourceLine(tt.line, 1)
+			if err != nil {
+				t.Fatalf("ParseSourceLine() error = %v", err)
+			}
+			if got := entry.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+
+			// the rendered line parses back to the same entry
+			reparsed, err := ParseSourceLine(entry.String(), 1)
+			if err != nil {
+				t.Fatalf("ParseSourceLine(String()) error = %v", err)
+			}
+			if reparsed.Type != entry.Type || reparsed.Enabled != entry.Enabled || reparsed.ArchiveRoot.String() != entry.ArchiveRoot.String() ||
+				reparsed.Distribution != entry.Distribution || !reflect.DeepEqual(reparsed.Components, entry.Components) ||
+				!reflect.DeepEqual(reparsed.Options, entry.Options) {
+				t.Errorf("round trip changed entry: got %+v, want %+v", reparsed, entry)
+			}
+		})
+	}
+}
+
+func TestWriteSourcesList(t *testing.T) {
+	input := `# Ubuntu
+deb http://archive.ubuntu.com/ubuntu jammy main
+deb [trusted=yes] file:///srv/repo ./
+`
+	entries, err := ParseSourcesList(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseSourcesList() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSourcesList(&buf, entries); err != nil {
+		t.Fatalf("WriteSourcesList() error = %v", err)
+	}
+
+	want := "deb http://archive.ubuntu.com/ubuntu jammy main\ndeb [trusted=yes] file:///srv/repo ./\n"
+	if got := buf.String(); got != want {
+		t.Errorf("WriteSourcesList() = %q, want %q", got, want)
+	}
+}
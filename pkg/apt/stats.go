@@ -0,0 +1,106 @@
+package apt
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RepositoryStats holds statistics about a repository
+type RepositoryStats struct {
+	Repository struct {
+		Origin        string    `json:"origin,omitempty"`
+		Label         string    `json:"label,omitempty"`
+		Suite         string    `json:"suite,omitempty"`
+		Codename      string    `json:"codename,omitempty"`
+		Date          time.Time `json:"date"`
+		Architectures []string  `json:"architectures"`
+		Components    []string  `json:"components"`
+	} `json:"repository"`
+
+	Packages struct {
+		Total          int            `json:"total"`
+		TotalSize      int64          `json:"total_size_bytes"`
+		TotalSizeMB    int64          `json:"total_size_mb"`
+		ByArchitecture map[string]int `json:"by_architecture"`
+		ByComponent    map[string]int `json:"by_component"`
+		BySection      map[string]int `json:"by_section"`
+		ByPriority     map[string]int `json:"by_priority"`
+
+		// TotalInstalledSize is the disk space the packages take up once installed
+		TotalInstalledSize int64 `json:"total_installed_size_bytes"`
+
+		// Download sizes in bytes, broken down like the counts
+		SizeByArchitecture map[string]int64 `json:"size_by_architecture"`
+		SizeByComponent    map[string]int64 `json:"size_by_component"`
+		SizeBySection      map[string]int64 `json:"size_by_section"`
+	} `json:"packages"`
+}
+
+// Stats aggregates package counts and sizes over the selected Packages indexes
+func (r *Repository) Stats(ctx context.Context) (*RepositoryStats, error) {
+	if r.release == nil {
+		if _, err := r.Update(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	stats := &RepositoryStats{}
+	release := r.release
+	stats.Repository.Origin = release.Origin
+	stats.Repository.Label = release.Label
+	stats.Repository.Suite = release.Suite
+	stats.Repository.Codename = release.Codename
+	stats.Repository.Date = release.Date
+	stats.Repository.Architectures = release.Architectures
+	stats.Repository.Components = release.Components
+
+	stats.Packages.ByArchitecture = make(map[string]int)
+	stats.Packages.ByComponent = make(map[string]int)
+	stats.Packages.BySection = make(map[string]int)
+	stats.Packages.ByPriority = make(map[string]int)
+	stats.Packages.SizeByArchitecture = make(map[string]int64)
+	stats.Packages.SizeByComponent = make(map[string]int64)
+	stats.Packages.SizeBySection = make(map[string]int64)
+
+	// Architecture "all" packages are listed in every binary-* index, so count each build once
+	type packageBuild struct {
+		name, version, arch string
+	}
+	seen := make(map[packageBuild]bool)
+
+	for ref, err := range r.PackageRefs(ctx) {
+		if err != nil {
+			return nil, fmt.Errorf("failed to list packages: %w", err)
+		}
+		pkg := ref.Package
+
+		build := packageBuild{pkg.Package, pkg.Version, pkg.Architecture}
+		if seen[build] {
+			continue
+		}
+		seen[build] = true
+
+		stats.Packages.Total++
+		stats.Packages.TotalSize += pkg.Size
+		// Installed-Size is given in KiB
+		stats.Packages.TotalInstalledSize += pkg.InstalledSize * 1024
+		stats.Packages.ByArchitecture[pkg.Architecture]++
+		stats.Packages.SizeByArchitecture[pkg.Architecture] += pkg.Size
+		// flat repositories have no components
+		if ref.Component != "" {
+			stats.Packages.ByComponent[ref.Component]++
+			stats.Packages.SizeByComponent[ref.Component] += pkg.Size
+		}
+		if pkg.Section != "" {
+			stats.Packages.BySection[pkg.Section]++
+			stats.Packages.SizeBySection[pkg.Section] += pkg.Size
+		}
+		if pkg.Priority != "" {
+			stats.Packages.ByPriority[pkg.Priority]++
+		}
+	}
+	stats.Packages.TotalSizeMB = stats.Packages.TotalSize / (1024 * 1024)
+
+	return stats, nil
+}
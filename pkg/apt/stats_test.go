@@ -0,0 +1,70 @@
+package apt
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nicwaller/apt-look/pkg/apt/sources"
+)
+
+func TestRepository_Stats(t *testing.T) {
+	testRepoPath, err := filepath.Abs("testdata/compressedrepo")
+	require.NoError(t, err)
+	entry, err := sources.ParseSourceLine("deb file://"+testRepoPath+" stable main", 1)
+	require.NoError(t, err)
+
+	repo, err := Mount(*entry, WithArchitectures("amd64", "arm64", "armhf"))
+	require.NoError(t, err)
+
+	stats, err := repo.Stats(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, "Test Repository", stats.Repository.Origin)
+	assert.Equal(t, []string{"main"}, stats.Repository.Components)
+
+	// alpha is built for each architecture, while bravo (arch all) appears in every index but counts once
+	assert.Equal(t, 4, stats.Packages.Total)
+	assert.Equal(t, int64(3*1024+2048), stats.Packages.TotalSize)
+	assert.Equal(t, map[string]int{"amd64": 1, "arm64": 1, "armhf": 1, "all": 1}, stats.Packages.ByArchitecture)
+	assert.Equal(t, map[string]int{"main": 4}, stats.Packages.ByComponent)
+	assert.Equal(t, map[string]int{"utils": 3, "doc": 1}, stats.Packages.BySection)
+	assert.Equal(t, map[string]int64{"amd64": 1024, "arm64": 1024, "armhf": 1024, "all": 2048}, stats.Packages.SizeByArchitecture)
+	assert.Equal(t, map[string]int64{"main": 3*1024 + 2048}, stats.Packages.SizeByComponent)
+	assert.Equal(t, map[string]int64{"utils": 3 * 1024, "doc": 2048}, stats.Packages.SizeBySection)
+}
+
+func TestRepository_StatsInstalledSize(t *testing.T) {
+	repoPath := newPackagesRepo(t, `Package: alpha
+Version: 1.0
+Architecture: amd64
+Filename: pool/alpha_1.0_amd64.deb
+Size: 1000
+Installed-Size: 40
+
+Package: bravo
+Version: 1.0
+Architecture: amd64
+Filename: pool/bravo_1.0_amd64.deb
+Size: 500
+Installed-Size: 2
+
+Package: charlie
+Version: 1.0
+Architecture: amd64
+Filename: pool/charlie_1.0_amd64.deb
+Size: 100
+`)
+	entry, err := sources.ParseSourceLine("deb file://"+repoPath+" stable main", 1)
+	require.NoError(t, err)
+	repo, err := Mount(*entry, WithArchitectures("amd64"))
+	require.NoError(t, err)
+
+	stats, err := repo.Stats(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1600), stats.Packages.TotalSize)
+	assert.Equal(t, int64(42*1024), stats.Packages.TotalInstalledSize)
+}
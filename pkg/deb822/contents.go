@@ -0,0 +1,68 @@
+package deb822
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"iter"
+	"strings"
+)
+
+// ContentEntry maps a file path to the packages that ship it, from an APT Contents file
+type ContentEntry struct {
+	// Path is relative to the filesystem root, without a leading slash (e.g. "usr/bin/hello")
+	Path string `json:"path"`
+	// Packages are the bare package names, with the section qualifier removed
+	Packages []string `json:"packages"`
+}
+
+// ParseContents parses an APT Contents file and returns an iterator over its entries.
+// Each line holds a path followed by a comma-separated list of [[area/]section/]package locations.
+func ParseContents(r io.Reader) iter.Seq2[ContentEntry, error] {
+	return func(yield func(ContentEntry, error) bool) {
+		scanner := bufio.NewScanner(r)
+		// Contents files can contain very long lines for heavily shared paths
+		scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+
+		lineNum := 0
+		for scanner.Scan() {
+			lineNum++
+			line := strings.TrimRight(scanner.Text(), " \t")
+			if line == "" {
+				continue
+			}
+
+			// paths may contain spaces, so the location list is whatever follows the last run of whitespace
+			sep := strings.LastIndexAny(line, " \t")
+			if sep < 0 {
+				yield(ContentEntry{}, fmt.Errorf("line %d: missing package list", lineNum))
+				return
+			}
+			path := strings.TrimRight(line[:sep], " \t")
+			locations := line[sep+1:]
+
+			// older Contents files start with a "FILE  LOCATION" column header
+			if path == "FILE" && locations == "LOCATION" {
+				continue
+			}
+
+			entry := ContentEntry{Path: path}
+			for _, location := range strings.Split(locations, ",") {
+				name := location[strings.LastIndex(location, "/")+1:]
+				if name == "" {
+					yield(ContentEntry{}, fmt.Errorf("line %d: invalid package location %q", lineNum, location))
+					return
+				}
+				entry.Packages = append(entry.Packages, name)
+			}
+
+			if !yield(entry, nil) {
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			yield(ContentEntry{}, fmt.Errorf("scanner error: %w", err))
+		}
+	}
+}
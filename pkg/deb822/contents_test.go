@@ -0,0 +1,67 @@
+package deb822
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseContents(t *testing.T) {
+	contents := `usr/bin/hello                                           devel/hello
+usr/share/doc/hello/copyright                           devel/hello,devel/hello-traditional
+usr/share/fonts/My Font.ttf                             non-free/fonts/fonts-mine
+
+usr/lib/x86_64-linux-gnu/libc.so.6	libs/libc6
+`
+
+	var entries []ContentEntry
+	for entry, err := range ParseContents(strings.NewReader(contents)) {
+		require.NoError(t, err)
+		entries = append(entries, entry)
+	}
+
+	assert.Equal(t, []ContentEntry{
+		{Path: "usr/bin/hello", Packages: []string{"hello"}},
+		{Path: "usr/share/doc/hello/copyright", Packages: []string{"hello", "hello-traditional"}},
+		{Path: "usr/share/fonts/My Font.ttf", Packages: []string{"fonts-mine"}},
+		{Path: "usr/lib/x86_64-linux-gnu/libc.so.6", Packages: []string{"libc6"}},
+	}, entries)
+}
+
+func TestParseContentsLegacyHeader(t *testing.T) {
+	contents := `FILE                                                    LOCATION
+bin/bash                                                shells/bash
+`
+
+	var entries []ContentEntry
+	for entry, err := range ParseContents(strings.NewReader(contents)) {
+		require.NoError(t, err)
+		entries = append(entries, entry)
+	}
+
+	require.Len(t, entries, 1)
+	assert.Equal(t, "bin/bash", entries[0].Path)
+}
+
+func TestParseContentsInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		wantErr  string
+	}{
+		{name: "missing package list", contents: "usr/bin/hello\n", wantErr: "line 1: missing package list"},
+		{name: "empty location", contents: "usr/bin/hello devel/hello,\n", wantErr: "invalid package location"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lastErr error
+			for _, err := range ParseContents(strings.NewReader(tt.contents)) {
+				lastErr = err
+			}
+			assert.ErrorContains(t, lastErr, tt.wantErr)
+		})
+	}
+}
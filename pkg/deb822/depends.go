@@ -0,0 +1,168 @@
+package deb822
+
+import (
+	"fmt"
+	"strings"
+)
+
+// versionRelations lists the version operators allowed in relationship fields.
+// "<" and ">" are deprecated spellings of "<=" and ">=" that still appear in old packages.
+var versionRelations = []string{"<<", "<=", "=", ">=", ">>", "<", ">"}
+
+// Relation is a single package reference within a relationship field, e.g. "libc6:amd64 (>= 2.34) [amd64] <!nocheck>"
+type Relation struct {
+	Name string `json:"name"`
+
+	// ArchQualifier is the multi-arch qualifier after the colon, e.g. "amd64" or "any"
+	ArchQualifier string `json:"arch_qualifier,omitempty"`
+
+	// Operator and Version constrain the acceptable versions; both are empty when unversioned
+	Operator string `json:"operator,omitempty"`
+	Version  string `json:"version,omitempty"`
+
+	// Architectures restricts the relation to (or, with a "!" prefix, away from) these architectures
+	Architectures []string `json:"architectures,omitempty"`
+
+	// Profiles holds the build profile restriction formula: the relation applies if any
+	// group matches, and a group matches if all of its terms (optionally "!"-negated) do
+	Profiles [][]string `json:"profiles,omitempty"`
+}
+
+// Dependency is one comma-separated element of a relationship field.
+// It is satisfied by any one of its "|"-separated alternatives.
+type Dependency struct {
+	Alternatives []Relation `json:"alternatives"`
+}
+
+// ParseDependencies parses a relationship field such as Depends or Build-Depends
+func ParseDependencies(field string) ([]Dependency, error) {
+	var deps []Dependency
+	for _, part := range strings.Split(field, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			// trailing commas are common in hand-written control files
+			continue
+		}
+
+		var dep Dependency
+		for _, alt := range strings.Split(part, "|") {
+			rel, err := parseRelation(strings.TrimSpace(alt))
+			if err != nil {
+				return nil, fmt.Errorf("invalid relation %q: %w", part, err)
+			}
+			dep.Alternatives = append(dep.Alternatives, rel)
+		}
+		deps = append(deps, dep)
+	}
+	return deps, nil
+}
+
+// parseRelation parses a single alternative: name[:arch] [(op version)] [[arch ...]] [<profile ...> ...]
+func parseRelation(s string) (Relation, error) {
+	var rel Relation
+
+	end := strings.IndexAny(s, " \t(:[<")
+	if end < 0 {
+		end = len(s)
+	}
+	rel.Name = s[:end]
+	if rel.Name == "" {
+		return rel, fmt.Errorf("missing package name")
+	}
+	s = s[end:]
+
+	if rest, ok := strings.CutPrefix(s, ":"); ok {
+		end := strings.IndexAny(rest, " \t([<")
+		if end < 0 {
+			end = len(rest)
+		}
+		rel.ArchQualifier = rest[:end]
+		if rel.ArchQualifier == "" {
+			return rel, fmt.Errorf("empty architecture qualifier")
+		}
+		s = rest[end:]
+	}
+	s = strings.TrimSpace(s)
+
+	if rest, ok := strings.CutPrefix(s, "("); ok {
+		inner, after, found := strings.Cut(rest, ")")
+		if !found {
+			return rel, fmt.Errorf("unterminated version constraint")
+		}
+		inner = strings.TrimSpace(inner)
+		// try two-character operators first so "<<" isn't read as "<"
+		for _, op := range versionRelations {
+			if v, ok := strings.CutPrefix(inner, op); ok {
+				rel.Operator = op
+				rel.Version = strings.TrimSpace(v)
+				break
+			}
+		}
+		if rel.Operator == "" {
+			return rel, fmt.Errorf("unknown version relation in (%s)", inner)
+		}
+		if rel.Version == "" {
+			return rel, fmt.Errorf("missing version after %s", rel.Operator)
+		}
+		s = strings.TrimSpace(after)
+	}
+
+	if rest, ok := strings.CutPrefix(s, "["); ok {
+		inner, after, found := strings.Cut(rest, "]")
+		if !found {
+			return rel, fmt.Errorf("unterminated architecture restriction")
+		}
+		rel.Architectures = strings.Fields(inner)
+		if len(rel.Architectures) == 0 {
+			return rel, fmt.Errorf("empty architecture restriction")
+		}
+		s = strings.TrimSpace(after)
+	}
+
+	for s != "" {
+		rest, ok := strings.CutPrefix(s, "<")
+		if !ok {
+			return rel, fmt.Errorf("unexpected %q", s)
+		}
+		inner, after, found := strings.Cut(rest, ">")
+		if !found {
+			return rel, fmt.Errorf("unterminated build profile restriction")
+		}
+		terms := strings.Fields(inner)
+		if len(terms) == 0 {
+			return rel, fmt.Errorf("empty build profile restriction")
+		}
+		rel.Profiles = append(rel.Profiles, terms)
+		s = strings.TrimSpace(after)
+	}
+
+	return rel, nil
+}
+
+// String renders the relation in control file syntax
+func (r Relation) String() string {
+	var b strings.Builder
+	b.WriteString(r.Name)
+	if r.ArchQualifier != "" {
+		b.WriteString(":" + r.ArchQualifier)
+	}
+	if r.Operator != "" {
+		fmt.Fprintf(&b, " (%s %s)", r.Operator, r.Version)
+	}
+	if len(r.Architectures) > 0 {
+		fmt.Fprintf(&b, " [%s]", strings.Join(r.Architectures, " "))
+	}
+	for _, group := range r.Profiles {
+		fmt.Fprintf(&b, " <%s>", strings.Join(group, " "))
+	}
+	return b.String()
+}
+
+// String renders the dependency with its alternatives separated by " | "
+func (d Dependency) String() string {
+	alts := make([]string, len(d.Alternatives))
+	for i, rel := range d.Alternatives {
+		alts[i] = rel.String()
+	}
+	return strings.Join(alts, " | ")
+}
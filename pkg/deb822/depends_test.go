@@ -0,0 +1,144 @@
+package deb822
+
+import (
+	"compress/gzip"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDependencies(t *testing.T) {
+	tests := []struct {
+		name  string
+		field string
+		want  []Dependency
+	}{
+		{
+			name:  "simple list",
+			field: "libc6, zlib1g",
+			want: []Dependency{
+				{Alternatives: []Relation{{Name: "libc6"}}},
+				{Alternatives: []Relation{{Name: "zlib1g"}}},
+			},
+		},
+		{
+			name:  "version constraints",
+			field: "libc6 (>= 2.34), adduser (<<3.0~), foo (=1:2.0-1)",
+			want: []Dependency{
+				{Alternatives: []Relation{{Name: "libc6", Operator: ">=", Version: "2.34"}}},
+				{Alternatives: []Relation{{Name: "adduser", Operator: "<<", Version: "3.0~"}}},
+				{Alternatives: []Relation{{Name: "foo", Operator: "=", Version: "1:2.0-1"}}},
+			},
+		},
+		{
+			name:  "alternatives",
+			field: "default-mta | mail-transport-agent, debconf (>= 0.5) | debconf-2.0",
+			want: []Dependency{
+				{Alternatives: []Relation{{Name: "default-mta"}, {Name: "mail-transport-agent"}}},
+				{Alternatives: []Relation{
+					{Name: "debconf", Operator: ">=", Version: "0.5"},
+					{Name: "debconf-2.0"},
+				}},
+			},
+		},
+		{
+			name:  "arch qualifier",
+			field: "python3:any (>= 3.9~), libfoo:amd64",
+			want: []Dependency{
+				{Alternatives: []Relation{{Name: "python3", ArchQualifier: "any", Operator: ">=", Version: "3.9~"}}},
+				{Alternatives: []Relation{{Name: "libfoo", ArchQualifier: "amd64"}}},
+			},
+		},
+		{
+			name:  "architecture restrictions and build profiles",
+			field: "libseccomp-dev [amd64 arm64] <!nocheck>, dh-sequence-python3 <!nopython> <stage1 cross>",
+			want: []Dependency{
+				{Alternatives: []Relation{{
+					Name:          "libseccomp-dev",
+					Architectures: []string{"amd64", "arm64"},
+					Profiles:      [][]string{{"!nocheck"}},
+				}}},
+				{Alternatives: []Relation{{
+					Name:     "dh-sequence-python3",
+					Profiles: [][]string{{"!nopython"}, {"stage1", "cross"}},
+				}}},
+			},
+		},
+		{
+			name:  "empty and trailing commas",
+			field: " libc6 ,, ",
+			want:  []Dependency{{Alternatives: []Relation{{Name: "libc6"}}}},
+		},
+		{
+			name:  "empty field",
+			field: "",
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deps, err := ParseDependencies(tt.field)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, deps)
+		})
+	}
+}
+
+func TestParseDependenciesInvalid(t *testing.T) {
+	tests := []struct {
+		field   string
+		wantErr string
+	}{
+		{field: "libc6 (>= 2.34", wantErr: "unterminated version constraint"},
+		{field: "libc6 (~= 2.34)", wantErr: "unknown version relation"},
+		{field: "libc6 (>=)", wantErr: "missing version"},
+		{field: "libc6 | ", wantErr: "missing package name"},
+		{field: "libc6 [amd64", wantErr: "unterminated architecture restriction"},
+		{field: "libc6 <!nocheck", wantErr: "unterminated build profile restriction"},
+		{field: "libc6 extra", wantErr: "unexpected"},
+		{field: "libc6:", wantErr: "empty architecture qualifier"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			_, err := ParseDependencies(tt.field)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestRelationString(t *testing.T) {
+	field := "python3:any (>= 3.9~) [amd64 !i386] <!nocheck> <stage1 cross> | python3-minimal"
+	deps, err := ParseDependencies(field)
+	require.NoError(t, err)
+	require.Len(t, deps, 1)
+	assert.Equal(t, field, deps[0].String())
+}
+
+func TestPackageRelations(t *testing.T) {
+	// Every relationship field in real-world Packages files should parse
+	packagesFile, err := os.Open("testdata/docker-packages.gz")
+	require.NoError(t, err)
+	defer packagesFile.Close()
+
+	gz, err := gzip.NewReader(packagesFile)
+	require.NoError(t, err)
+	defer gz.Close()
+
+	for pkg, err := range ParsePackages(gz) {
+		require.NoError(t, err)
+		for _, field := range []string{"Depends", "Pre-Depends", "Recommends", "Suggests", "Conflicts", "Breaks", "Provides", "Replaces"} {
+			_, err := pkg.Relations(field)
+			require.NoError(t, err, "%s %s", pkg.Package, field)
+		}
+
+		deps, err := pkg.ParsedDepends()
+		require.NoError(t, err)
+		if pkg.Depends != "" {
+			assert.NotEmpty(t, deps)
+		}
+	}
+}
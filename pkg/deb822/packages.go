@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"iter"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -76,12 +77,21 @@ type Package struct {
 
 // ParsePackages parses an APT Packages file and returns an iterator over Package entries
 func ParsePackages(r io.Reader) iter.Seq2[*Package, error] {
+	return ParsePackagesFiltered(r, nil)
+}
+
+// ParsePackagesFiltered is like ParsePackages, but skips the records that keep rejects before their
+// fields are parsed and validated. A nil keep accepts every record.
+func ParsePackagesFiltered(r io.Reader, keep func(rfc822.Header) bool) iter.Seq2[*Package, error] {
 	return func(yield func(*Package, error) bool) {
 		for header, err := range ParseRecords(r) {
 			if err != nil {
 				yield(nil, fmt.Errorf("parsing packages file: %w", err))
 				return
 			}
+			if keep != nil && !keep(header) {
+				continue
+			}
 
 			pkg := &Package{header: header}
 			if err := pkg.parseFields(); err != nil {
@@ -195,6 +205,37 @@ func (p *Package) GetField(name string) string {
 	return p.header.Get(name)
 }
 
+// GetFieldLines returns the raw field value as separate lines, without unfolding
+func (p *Package) GetFieldLines(name string) []string {
+	return p.header.GetLines(name)
+}
+
+// Synopsis returns the one-line summary that starts the Description field
+func (p *Package) Synopsis() string {
+	// Description is unfolded into a single line, so read the raw lines instead
+	lines := p.header.GetLines("Description")
+	if len(lines) == 0 {
+		return ""
+	}
+	return lines[0]
+}
+
+// LongDescription returns the extended description that follows the synopsis, one line per continuation line.
+// The lines holding only "." that separate paragraphs are returned as empty lines.
+func (p *Package) LongDescription() string {
+	lines := p.header.GetLines("Description")
+	if len(lines) < 2 {
+		return ""
+	}
+	long := make([]string, len(lines)-1)
+	for i, line := range lines[1:] {
+		if line != "." {
+			long[i] = line
+		}
+	}
+	return strings.Join(long, "\n")
+}
+
 // HasField checks if a field exists in the underlying RFC822 header
 func (p *Package) HasField(name string) bool {
 	return p.header.Has(name)
@@ -205,6 +246,111 @@ func (p *Package) Fields() []string {
 	return p.header.Fields()
 }
 
+// Write re-emits the package record as it was parsed, with every field in its original order.
+// A Description replaced since, such as by a translation, is written in place of the parsed one.
+// A Package that wasn't parsed is written from its struct fields in the usual order of Packages indexes.
+// No blank line is written after the record.
+func (p *Package) Write(w io.Writer) error {
+	header := p.header
+	if len(header) == 0 {
+		header = p.structHeader()
+	} else if p.Description != header.Get("Description") {
+		header = slices.Clone(header)
+		for i, field := range header {
+			if strings.EqualFold(field.Name, "Description") {
+				header[i].Value = rfc822.FieldValues{p.Description}
+			}
+		}
+	}
+	_, err := header.Write(w)
+	return err
+}
+
+// structHeader renders the fields of the struct that have a value, in the order apt-ftparchive writes them
+func (p *Package) structHeader() rfc822.Header {
+	var header rfc822.Header
+	add := func(name, value string) {
+		if value != "" {
+			header = append(header, rfc822.Field{Name: name, Value: rfc822.FieldValues{value}})
+		}
+	}
+	formatInt := func(n int64) string {
+		if n <= 0 {
+			return ""
+		}
+		return strconv.FormatInt(n, 10)
+	}
+
+	add("Package", p.Package)
+	add("Architecture", p.Architecture)
+	add("Version", p.Version)
+	add("Multi-Arch", p.MultiArch)
+	add("Priority", p.Priority)
+	if p.Essential {
+		add("Essential", "yes")
+	}
+	add("Section", p.Section)
+	add("Source", p.Source)
+	add("Maintainer", p.Maintainer)
+	add("Installed-Size", formatInt(p.InstalledSize))
+	add("Provides", p.Provides)
+	add("Pre-Depends", p.PreDepends)
+	add("Depends", p.Depends)
+	add("Recommends", p.Recommends)
+	add("Suggests", p.Suggests)
+	add("Enhances", p.Enhances)
+	add("Conflicts", p.Conflicts)
+	add("Breaks", p.Breaks)
+	add("Replaces", p.Replaces)
+	add("Build-Depends", p.BuildDepends)
+	add("Build-Depends-Indep", p.BuildDependsIndep)
+	add("Build-Conflicts", p.BuildConflicts)
+	add("Filename", p.Filename)
+	add("Size", strconv.FormatInt(p.Size, 10))
+	add("MD5sum", p.MD5sum)
+	add("SHA1", p.SHA1)
+	add("SHA256", p.SHA256)
+	add("SHA512", p.SHA512)
+	add("Homepage", p.Homepage)
+	add("Description", p.Description)
+	add("Description-md5", p.DescriptionMd5)
+	add("Tag", p.Tag)
+	add("Task", p.Task)
+	add("Phased-Update-Percentage", formatInt(int64(p.PhasedUpdatePercentage)))
+	add("License", p.License)
+	add("Vendor", p.Vendor)
+	return header
+}
+
+// WritePackages writes a Packages index with a record for each package, stopping at the first error
+// from the iterator. Every package must have the fields ParsePackages requires, so the index can be
+// read back.
+func WritePackages(w io.Writer, packages iter.Seq2[*Package, error]) error {
+	first := true
+	for pkg, err := range packages {
+		if err != nil {
+			return err
+		}
+		switch {
+		case pkg.Package == "":
+			return fmt.Errorf("package record must have Package field")
+		case pkg.Filename == "":
+			return fmt.Errorf("package %s must have Filename field", pkg.Package)
+		}
+
+		if !first {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+		first = false
+		if err := pkg.Write(w); err != nil {
+			return fmt.Errorf("writing package %s: %w", pkg.Package, err)
+		}
+	}
+	return nil
+}
+
 // GetDependencies parses and returns dependency relationships as structured data
 func (p *Package) GetDependencies() map[string][]string {
 	deps := make(map[string][]string)
@@ -240,6 +386,21 @@ func (p *Package) GetDependencies() map[string][]string {
 	return deps
 }
 
+// ParsedDepends returns the Depends field as structured relations with their alternatives
+func (p *Package) ParsedDepends() ([]Dependency, error) {
+	return p.Relations("Depends")
+}
+
+// Relations parses any relationship field, e.g. "Pre-Depends" or "Breaks", into structured relations.
+// A missing field yields no dependencies.
+func (p *Package) Relations(field string) ([]Dependency, error) {
+	deps, err := ParseDependencies(p.header.Get(field))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s field: %w", field, err)
+	}
+	return deps, nil
+}
+
 // parseDependencyList parses APT dependency strings into individual package references
 func parseDependencyList(depString string) []string {
 	// Basic parsing - split on commas and clean up
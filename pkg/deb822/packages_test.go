@@ -1,8 +1,10 @@
 package deb822
 
 import (
+	"bytes"
 	"compress/gzip"
 	"encoding/json"
+	"iter"
 	"os"
 	"path/filepath"
 	"strings"
@@ -10,6 +12,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/nicwaller/apt-look/pkg/rfc822"
 )
 
 func TestParsePackagesBasic(t *testing.T) {
@@ -140,6 +144,29 @@ func TestParsePackagesMicrosoft(t *testing.T) {
 	}
 }
 
+func TestParsePackagesFiltered(t *testing.T) {
+	// the rejected record is invalid, which doesn't matter because its fields are never parsed
+	input := `Package: alpha
+Filename: pool/alpha.deb
+Size: 1
+
+Package: bravo
+Size: invalid
+
+Package: alpha
+Filename: pool/alpha-2.deb
+Size: 2
+`
+	var filenames []string
+	for pkg, err := range ParsePackagesFiltered(strings.NewReader(input), func(header rfc822.Header) bool {
+		return header.Get("Package") == "alpha"
+	}) {
+		require.NoError(t, err)
+		filenames = append(filenames, pkg.Filename)
+	}
+	assert.Equal(t, []string{"pool/alpha.deb", "pool/alpha-2.deb"}, filenames)
+}
+
 func TestPackageFieldValidation(t *testing.T) {
 	testCases := []struct {
 		name      string
@@ -321,6 +348,46 @@ func TestPackageJSONSerialization(t *testing.T) {
 	t.Logf("JSON output: %s", string(jsonData))
 }
 
+func TestPackageDescription(t *testing.T) {
+	packagesFile, err := os.Open("testdata/postgresql-packages.gz")
+	require.NoError(t, err)
+	defer packagesFile.Close()
+
+	gz, err := gzip.NewReader(packagesFile)
+	require.NoError(t, err)
+	defer gz.Close()
+
+	var pkg *Package
+	for p, err := range ParsePackages(gz) {
+		require.NoError(t, err)
+		if p.Package == "architecture-properties" {
+			pkg = p
+			break
+		}
+	}
+	require.NotNil(t, pkg)
+
+	assert.Equal(t, "Declarative architecture constraints", pkg.Synopsis())
+	assert.Equal(t, `This is a meta package that provide declarative architecture
+constraints like "architecture-is-64-bit" or
+"architecture-is-little-endian" for cases where architecture
+wildcard support in the Architecture field is insufficient.
+
+Example usage: "Build-Depends: architecture-is-64-bit".
+
+This package is provided solely for the purpose of being used
+in build-dependencies to simplify management of architecture
+support.`, pkg.LongDescription())
+	assert.True(t, strings.HasPrefix(pkg.Description, pkg.Synopsis()+" This is a meta package"))
+
+	// a synopsis alone has no long description
+	for p, err := range ParsePackages(strings.NewReader("Package: a\nFilename: a.deb\nSize: 1\nDescription: just a synopsis\n")) {
+		require.NoError(t, err)
+		assert.Equal(t, "just a synopsis", p.Synopsis())
+		assert.Empty(t, p.LongDescription())
+	}
+}
+
 func TestPackageFieldAccess(t *testing.T) {
 	// Test field access methods
 	packagesFile, err := os.Open("testdata/spotify-packages.gz")
@@ -344,6 +411,10 @@ func TestPackageFieldAccess(t *testing.T) {
 	assert.Equal(t, "spotify-client", pkg.GetField("Package"))
 	assert.Equal(t, "", pkg.GetField("NonExistentField"))
 
+	// Test GetFieldLines
+	assert.Equal(t, []string{"spotify-client"}, pkg.GetFieldLines("Package"))
+	assert.Empty(t, pkg.GetFieldLines("NonExistentField"))
+
 	// Test HasField
 	assert.True(t, pkg.HasField("Package"))
 	assert.True(t, pkg.HasField("package")) // case-insensitive
@@ -393,3 +464,126 @@ func TestAllPackagesFiles(t *testing.T) {
 		})
 	}
 }
+
+func TestPackageWrite(t *testing.T) {
+	input := `Package: alpha
+Version: 1.0-1
+Architecture: amd64
+Pre-Depends: dpkg (>= 1.15)
+Breaks: alpha-old (<< 1.0)
+Filename: pool/main/a/alpha/alpha_1.0-1_amd64.deb
+Size: 1024
+Tag: role::program, interface::commandline
+X-Custom-Field: kept
+Description: the first letter
+ A longer description.
+ .
+ With a second paragraph.
+
+Package: beta
+Filename: pool/main/b/beta/beta_2.0_all.deb
+Size: 2048
+`
+	var out strings.Builder
+	for pkg, err := range ParsePackages(strings.NewReader(input)) {
+		require.NoError(t, err)
+		if out.Len() > 0 {
+			out.WriteString("\n")
+		}
+		require.NoError(t, pkg.Write(&out))
+	}
+	assert.Equal(t, input, out.String())
+
+	// records from a real index survive a round trip with every field and its order
+	packagesFile, err := os.Open("testdata/spotify-packages.gz")
+	require.NoError(t, err)
+	defer packagesFile.Close()
+	gz, err := gzip.NewReader(packagesFile)
+	require.NoError(t, err)
+	defer gz.Close()
+
+	for pkg, err := range ParsePackages(gz) {
+		require.NoError(t, err)
+		var buf strings.Builder
+		require.NoError(t, pkg.Write(&buf))
+		for written, err := range ParsePackages(strings.NewReader(buf.String())) {
+			require.NoError(t, err)
+			assert.Equal(t, pkg.Fields(), written.Fields())
+			assert.Equal(t, pkg, written)
+		}
+	}
+}
+
+func TestPackageWriteTranslatedDescription(t *testing.T) {
+	input := "Package: alpha\nDescription: the first letter\nDescription-md5: 6aa7a5b2e11e8ec8b8ab5e5c8e4a3bf5\nFilename: pool/alpha.deb\nSize: 1024\n"
+	for pkg, err := range ParsePackages(strings.NewReader(input)) {
+		require.NoError(t, err)
+		pkg.Description = "the first letter A longer description."
+		var out strings.Builder
+		require.NoError(t, pkg.Write(&out))
+		assert.Equal(t, "Package: alpha\nDescription: the first letter A longer description.\nDescription-md5: 6aa7a5b2e11e8ec8b8ab5e5c8e4a3bf5\nFilename: pool/alpha.deb\nSize: 1024\n", out.String())
+		assert.Equal(t, "the first letter", pkg.GetField("Description"))
+	}
+}
+
+func TestWritePackages(t *testing.T) {
+	// merge two indexes into one
+	var packages []*Package
+	for _, name := range []string{"spotify-packages.gz", "docker-packages.gz"} {
+		packagesFile, err := os.Open(filepath.Join("testdata", name))
+		require.NoError(t, err)
+		gz, err := gzip.NewReader(packagesFile)
+		require.NoError(t, err)
+		for pkg, err := range ParsePackages(gz) {
+			require.NoError(t, err)
+			packages = append(packages, pkg)
+		}
+		gz.Close()
+		packagesFile.Close()
+	}
+
+	// programmatically built packages have no parsed record to copy
+	packages = append(packages, &Package{
+		Package:      "built",
+		Version:      "1.0",
+		Architecture: "all",
+		Essential:    true,
+		Depends:      "libc6",
+		Filename:     "pool/main/b/built/built_1.0_all.deb",
+		Size:         512,
+		Description:  "built by a test",
+	})
+
+	var buf bytes.Buffer
+	require.NoError(t, WritePackages(&buf, slicePackages(packages)))
+
+	var written []*Package
+	for pkg, err := range ParsePackages(&buf) {
+		require.NoError(t, err)
+		written = append(written, pkg)
+	}
+	require.Len(t, written, len(packages))
+	for i, pkg := range packages[:len(packages)-1] {
+		assert.Equal(t, pkg, written[i])
+	}
+
+	built := written[len(written)-1]
+	assert.Equal(t, []string{"Package", "Architecture", "Version", "Essential", "Depends", "Filename", "Size", "Description"},
+		built.Fields())
+	assert.True(t, built.Essential)
+	assert.Equal(t, int64(512), built.Size)
+
+	err := WritePackages(&buf, slicePackages([]*Package{{Package: "broken"}}))
+	assert.ErrorContains(t, err, "Filename")
+}
+
+// slicePackages iterates over a slice the way ParsePackages iterates over an index
+func slicePackages(packages []*Package) iter.Seq2[*Package, error] {
+	return func(yield func(*Package, error) bool) {
+		for _, pkg := range packages {
+			if !yield(pkg, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package deb822
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/nicwaller/apt-look/pkg/rfc822"
+)
+
+// PDiffIndex represents the Index file of a PDiff directory, e.g. main/binary-amd64/Packages.diff/Index,
+// which lists the patches that bring an older copy of an index up to date. Only the SHA256 fields are read.
+type PDiffIndex struct {
+	// Current is the hash and size of the index as currently published; its Path is empty
+	Current HashEntry `json:"current"`
+
+	// History holds, for each patch, the hash and size of the index that the patch applies to
+	History []HashEntry `json:"history"`
+
+	// Patches holds the hash and size of each uncompressed patch
+	Patches []HashEntry `json:"patches"`
+
+	// Download holds the hash and size of each patch as published, e.g. with a .gz suffix
+	Download []HashEntry `json:"download"`
+
+	// Merged is set when each patch brings its base straight to the current index (X-Patch-Precedence: merged),
+	// rather than to the base of the next patch
+	Merged bool `json:"merged,omitempty"`
+
+	// Raw RFC822 header for access to non-standard fields
+	header rfc822.Header `json:"-"`
+}
+
+// ParsePDiffIndex parses the Index file of a PDiff directory
+func ParsePDiffIndex(r io.Reader) (*PDiffIndex, error) {
+	header, err := rfc822.ParseHeader(r)
+	if err != nil {
+		return nil, fmt.Errorf("parsing pdiff index: %w", err)
+	}
+
+	index := &PDiffIndex{header: header}
+	if err := index.parseFields(); err != nil {
+		return nil, fmt.Errorf("parsing pdiff index fields: %w", err)
+	}
+	return index, nil
+}
+
+// parseFields extracts and validates all fields from the RFC822 header
+func (p *PDiffIndex) parseFields() error {
+	// SHA256-Current is a hash and size, without the path of the other entries
+	current := strings.Fields(p.header.Get("SHA256-Current"))
+	if len(current) != 2 {
+		return fmt.Errorf("pdiff index must have a SHA256-Current field with a hash and size")
+	}
+	size, err := strconv.ParseInt(current[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid size in SHA256-Current: %w", err)
+	}
+	p.Current = HashEntry{Hash: current[0], Size: size}
+
+	for field, entries := range map[string]*[]HashEntry{
+		"SHA256-History":  &p.History,
+		"SHA256-Patches":  &p.Patches,
+		"SHA256-Download": &p.Download,
+	} {
+		parsed, err := parseHashEntries(p.header.GetLines(field))
+		if err != nil {
+			return fmt.Errorf("invalid %s field: %w", field, err)
+		}
+		*entries = parsed
+	}
+
+	p.Merged = p.header.Get("X-Patch-Precedence") == "merged"
+	return nil
+}
+
+// GetField returns the value of any field in the index
+func (p *PDiffIndex) GetField(name string) string {
+	return p.header.Get(name)
+}
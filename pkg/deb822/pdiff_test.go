@@ -0,0 +1,38 @@
+package deb822
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePDiffIndex(t *testing.T) {
+	index := `SHA256-Current: 2e1c7e4d3b0a8bb6bd9e20e6f3b7cf8d4f0a1c0b9b86de8a1a5a43f7b2d3e4f5 33530863
+SHA256-History:
+ 1b2d9a07c53068e1445c6f3e1fdb0bcc8e7e5ec0a65c3bb9c3df4a6e8ebd3b3a 33516009 T-2025-06-09-0803.48-F-2025-06-08-2010.16
+ 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08 33524411 T-2025-06-09-0803.48-F-2025-06-09-0203.57
+SHA256-Patches:
+ 5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8 1561 T-2025-06-09-0803.48-F-2025-06-08-2010.16
+ 6b86b273ff34fce19d6b804eff5a3f5747ada4eaa22f1d49c01e52ddb7875b4b 846 T-2025-06-09-0803.48-F-2025-06-09-0203.57
+SHA256-Download:
+ d4735e3a265e16eee03f59718b9b5d03019c07d8b6c51f90da3a666eec13ab35 598 T-2025-06-09-0803.48-F-2025-06-08-2010.16.gz
+ 4e07408562bedb8b60ce05c1decfe3ad16b72230967de01f640b7e4729b49fce 353 T-2025-06-09-0803.48-F-2025-06-09-0203.57.gz
+X-Patch-Precedence: merged
+`
+	pdiff, err := ParsePDiffIndex(strings.NewReader(index))
+	require.NoError(t, err)
+	assert.Equal(t, HashEntry{Hash: "2e1c7e4d3b0a8bb6bd9e20e6f3b7cf8d4f0a1c0b9b86de8a1a5a43f7b2d3e4f5", Size: 33530863}, pdiff.Current)
+	require.Len(t, pdiff.History, 2)
+	assert.Equal(t, int64(33516009), pdiff.History[0].Size)
+	assert.Equal(t, "T-2025-06-09-0803.48-F-2025-06-08-2010.16", pdiff.History[0].Path)
+	require.Len(t, pdiff.Patches, 2)
+	require.Len(t, pdiff.Download, 2)
+	assert.Equal(t, "T-2025-06-09-0803.48-F-2025-06-09-0203.57.gz", pdiff.Download[1].Path)
+	assert.True(t, pdiff.Merged)
+	assert.Equal(t, "merged", pdiff.GetField("X-Patch-Precedence"))
+
+	_, err = ParsePDiffIndex(strings.NewReader("SHA256-History:\n abc 1 patch\n"))
+	assert.ErrorContains(t, err, "SHA256-Current")
+}
@@ -3,9 +3,11 @@ package deb822
 import (
 	"fmt"
 	"io"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/nicwaller/apt-look/pkg/rfc822"
 )
@@ -19,12 +21,13 @@ type HashEntry struct {
 
 // FileInfo represents metadata about a file referenced in the Release file
 type FileInfo struct {
-	Path         string `json:"path"`         // File path relative to dists/distribution/
-	Size         int64  `json:"size"`         // File size in bytes
-	Type         string `json:"type"`         // "Packages", "Release", "Contents", etc.
-	Component    string `json:"component"`    // e.g., "main", "universe"
-	Architecture string `json:"architecture"` // e.g., "amd64", "all"
-	Compressed   bool   `json:"compressed"`   // true if file is gzipped
+	Path         string `json:"path"`                  // File path relative to dists/distribution/
+	Size         int64  `json:"size"`                  // File size in bytes
+	Type         string `json:"type"`                  // "Packages", "Release", "Contents", "Contents-udeb", etc.
+	Component    string `json:"component"`             // e.g., "main", "universe"
+	Architecture string `json:"architecture"`          // e.g., "amd64", "all"
+	Compressed   bool   `json:"compressed"`            // true if file is compressed
+	Compression  string `json:"compression,omitempty"` // file extension of the compression format, e.g. ".xz"
 
 	// Hash entries - all available hashes for this file
 	MD5    string `json:"md5,omitempty"`    // MD5 hash (legacy)
@@ -32,6 +35,21 @@ type FileInfo struct {
 	SHA256 string `json:"sha256,omitempty"` // SHA256 hash (preferred)
 }
 
+// BestHash returns the strongest hash recorded for the file, SHA256 over SHA1 over MD5, with its algorithm
+// named as AcquireRequest.ExpectedHashes expects it ("sha256", "sha1" or "md5"). Both are empty if there is none.
+func (fi FileInfo) BestHash() (algo, hash string) {
+	switch {
+	case fi.SHA256 != "":
+		return "sha256", fi.SHA256
+	case fi.SHA1 != "":
+		return "sha1", fi.SHA1
+	case fi.MD5 != "":
+		return "md5", fi.MD5
+	default:
+		return "", ""
+	}
+}
+
 // Release represents an APT Release file with all standardized fields
 type Release struct {
 	// Mandatory fields
@@ -192,26 +210,38 @@ func parseHashEntries(lines []string) ([]HashEntry, error) {
 			continue
 		}
 
-		parts := strings.Fields(line)
-		if len(parts) != 3 {
-			return nil, fmt.Errorf("invalid hash entry format: %q (expected 3 fields)", line)
+		// fields may be separated by any run of spaces or tabs, and the path is
+		// everything after the size, since paths may legally contain spaces
+		hash, rest := cutField(line)
+		sizeField, path := cutField(rest)
+		if path == "" {
+			return nil, fmt.Errorf("invalid hash entry format: %q (expected hash, size and path)", line)
 		}
 
-		size, err := strconv.ParseInt(parts[1], 10, 64)
+		size, err := strconv.ParseInt(sizeField, 10, 64)
 		if err != nil {
 			return nil, fmt.Errorf("invalid size in hash entry %q: %w", line, err)
 		}
 
 		entries = append(entries, HashEntry{
-			Hash: parts[0],
+			Hash: hash,
 			Size: size,
-			Path: parts[2],
+			Path: path,
 		})
 	}
 
 	return entries, nil
 }
 
+// cutField splits s at its first run of whitespace, returning the field before it and the rest after it
+func cutField(s string) (field, rest string) {
+	i := strings.IndexFunc(s, unicode.IsSpace)
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], strings.TrimLeftFunc(s[i:], unicode.IsSpace)
+}
+
 // parseRFC1123 parses APT date format (RFC 1123 with variations)
 func parseRFC1123(dateStr string) (time.Time, error) {
 	// Try standard RFC 1123 format first: "Mon, 02 Jan 2006 15:04:05 MST"
@@ -272,6 +302,139 @@ func (r *Release) Fields() []string {
 	return r.header.Fields()
 }
 
+// releaseFieldOrder lists the fields Write renders from the Release struct, in the order
+// fields the parsed file didn't have are placed
+var releaseFieldOrder = []string{
+	"Origin", "Label", "Suite", "Version", "Codename", "Changelogs", "Snapshots", "Date", "Valid-Until",
+	"NotAutomatic", "ButAutomaticUpgrades", "Acquire-By-Hash", "No-Support-for-Architecture-all",
+	"Signed-By", "Packages-Require-Authorization", "Architectures", "Components", "MD5Sum", "SHA1", "SHA256",
+}
+
+// Write serializes the Release file. Fields are rendered from the struct, so changes to it are written,
+// while fields the struct doesn't model are copied from the parsed file. Fields keep their original order,
+// and ones the parsed file didn't have go before the first field that comes after them in releaseFieldOrder.
+func (r *Release) Write(w io.Writer) error {
+	values := r.fieldValues()
+	present := make(map[string]bool)
+	for _, field := range r.header {
+		if name := releaseFieldName(field.Name); name != "" {
+			present[name] = true
+		}
+	}
+	var missing []string
+	for _, name := range releaseFieldOrder {
+		if _, ok := values[name]; ok && !present[name] {
+			missing = append(missing, name)
+		}
+	}
+
+	var header rfc822.Header
+	// addMissing adds the missing fields that come before position in releaseFieldOrder
+	addMissing := func(position int) {
+		for len(missing) > 0 && slices.Index(releaseFieldOrder, missing[0]) < position {
+			header = append(header, rfc822.Field{Name: missing[0], Value: values[missing[0]]})
+			missing = missing[1:]
+		}
+	}
+	for _, field := range r.header {
+		name := releaseFieldName(field.Name)
+		if name == "" {
+			header = append(header, field)
+			continue
+		}
+		addMissing(slices.Index(releaseFieldOrder, name))
+		if value, ok := values[name]; ok {
+			header = append(header, rfc822.Field{Name: field.Name, Value: value})
+		}
+	}
+	addMissing(len(releaseFieldOrder))
+
+	_, err := header.Write(w)
+	return err
+}
+
+// releaseFieldName returns the name in releaseFieldOrder matching a field name case-insensitively,
+// or "" if the field isn't rendered from the struct
+func releaseFieldName(name string) string {
+	for _, known := range releaseFieldOrder {
+		if strings.EqualFold(name, known) {
+			return known
+		}
+	}
+	return ""
+}
+
+// fieldValues renders the fields of the struct that have a value
+func (r *Release) fieldValues() map[string]rfc822.FieldValues {
+	values := make(map[string]rfc822.FieldValues)
+	text := map[string]string{
+		"Origin":                         r.Origin,
+		"Label":                          r.Label,
+		"Suite":                          r.Suite,
+		"Version":                        r.Version,
+		"Codename":                       r.Codename,
+		"Changelogs":                     r.Changelogs,
+		"Snapshots":                      r.Snapshots,
+		"Packages-Require-Authorization": r.PackagesRequireAuthorization,
+		"Architectures":                  strings.Join(r.Architectures, " "),
+		"Components":                     strings.Join(r.Components, " "),
+		"Signed-By":                      strings.Join(r.SignedBy, ", "),
+	}
+	for name, value := range text {
+		if value != "" {
+			values[name] = rfc822.FieldValues{value}
+		}
+	}
+
+	if !r.Date.IsZero() {
+		values["Date"] = rfc822.FieldValues{r.formatDate("Date", r.Date)}
+	}
+	if r.ValidUntil != nil {
+		values["Valid-Until"] = rfc822.FieldValues{r.formatDate("Valid-Until", *r.ValidUntil)}
+	}
+
+	flags := map[string]bool{
+		"NotAutomatic":                    r.NotAutomatic,
+		"ButAutomaticUpgrades":            r.ButAutomaticUpgrades,
+		"Acquire-By-Hash":                 r.AcquireByHash,
+		"No-Support-for-Architecture-all": r.NoSupportForArchitectureAll,
+	}
+	for name, set := range flags {
+		switch {
+		case set:
+			values[name] = rfc822.FieldValues{"yes"}
+		case r.header.Has(name):
+			// keep an explicit "no" rather than dropping the field
+			values[name] = rfc822.FieldValues{"no"}
+		}
+	}
+
+	hashes := map[string][]HashEntry{"MD5Sum": r.MD5Sum, "SHA1": r.SHA1, "SHA256": r.SHA256}
+	for name, entries := range hashes {
+		if len(entries) == 0 {
+			continue
+		}
+		// the entries start on the line after the field name, with sizes aligned like apt-ftparchive does
+		lines := rfc822.FieldValues{""}
+		for _, entry := range entries {
+			lines = append(lines, fmt.Sprintf("%s %16d %s", entry.Hash, entry.Size, entry.Path))
+		}
+		values[name] = lines
+	}
+
+	return values
+}
+
+// formatDate writes a date the way the parsed file did when it hasn't changed, and in UTC otherwise
+func (r *Release) formatDate(field string, t time.Time) string {
+	if original := r.header.Get(field); original != "" {
+		if parsed, err := parseRFC1123(original); err == nil && parsed.Equal(t) {
+			return original
+		}
+	}
+	return t.UTC().Format("Mon, 02 Jan 2006 15:04:05 UTC")
+}
+
 // GetAvailableFiles returns a categorized list of files referenced in the Release file
 // Each FileInfo contains all available hash types for that file path
 func (r *Release) GetAvailableFiles() []FileInfo {
@@ -332,12 +495,60 @@ func (r *Release) GetPackagesFiles(component, architecture string) []FileInfo {
 	return packagesFiles
 }
 
+// GetSourcesFiles returns only the Sources files for the specified component
+func (r *Release) GetSourcesFiles(component string) []FileInfo {
+	var sourcesFiles []FileInfo
+
+	for _, file := range r.GetAvailableFiles() {
+		if file.Type == "Sources" && file.Component == component {
+			sourcesFiles = append(sourcesFiles, file)
+		}
+	}
+
+	return sourcesFiles
+}
+
+// GetContentsFiles returns only the Contents files for the specified architecture
+func (r *Release) GetContentsFiles(architecture string) []FileInfo {
+	var contentsFiles []FileInfo
+
+	for _, file := range r.GetAvailableFiles() {
+		if file.Type == "Contents" && file.Architecture == architecture {
+			contentsFiles = append(contentsFiles, file)
+		}
+	}
+
+	return contentsFiles
+}
+
+// GetTranslationFiles returns only the Translation files for the specified component and language (e.g. "en")
+func (r *Release) GetTranslationFiles(component, lang string) []FileInfo {
+	var translationFiles []FileInfo
+
+	for _, file := range r.GetAvailableFiles() {
+		if file.Type == "Translation-"+lang && file.Component == component {
+			translationFiles = append(translationFiles, file)
+		}
+	}
+
+	return translationFiles
+}
+
+// compressionExtensions lists the file extensions used for compressed index files
+var compressionExtensions = []string{".gz", ".bz2", ".xz", ".lzma", ".zst"}
+
 // parseFileInfo extracts file metadata from a hash entry path
 func parseFileInfo(entry HashEntry) *FileInfo {
 	info := &FileInfo{
-		Path:       entry.Path,
-		Size:       entry.Size,
-		Compressed: strings.HasSuffix(entry.Path, ".gz"),
+		Path: entry.Path,
+		Size: entry.Size,
+	}
+	for _, ext := range compressionExtensions {
+		if strings.HasSuffix(entry.Path, ext) {
+			info.Compressed = true
+			info.Compression = ext
+			break
+		}
 	}
 
 	// Parse path components
@@ -345,40 +556,40 @@ func parseFileInfo(entry HashEntry) *FileInfo {
 	// main/binary-amd64/Packages.gz -> component="main", arch="amd64", type="Packages"
 	// main/source/Sources.gz -> component="main", arch="source", type="Sources"
 	// Contents-amd64.gz -> component="", arch="amd64", type="Contents"
+	// main/Contents-amd64.gz -> component="main", arch="amd64", type="Contents"
+	// main/Contents-udeb-amd64.gz -> component="main", arch="amd64", type="Contents-udeb"
+	// updates/main/binary-amd64/Packages.gz -> component="updates/main", arch="amd64", type="Packages"
 
 	pathParts := strings.Split(entry.Path, "/")
+	filename := strings.TrimSuffix(pathParts[len(pathParts)-1], info.Compression)
 
-	if strings.HasPrefix(entry.Path, "Contents-") {
-		// Handle Contents files: Contents-amd64.gz
+	if strings.HasPrefix(filename, "Contents-") {
+		// Handle Contents files, at the root or under a component: Contents-amd64.gz, main/Contents-amd64.gz.
+		// The installer's udeb packages have Contents of their own, which aren't mixed in with the others.
 		info.Type = "Contents"
-		filename := pathParts[len(pathParts)-1]
-		if info.Compressed {
-			filename = strings.TrimSuffix(filename, ".gz")
+		info.Architecture = strings.TrimPrefix(filename, "Contents-")
+		if arch, ok := strings.CutPrefix(info.Architecture, "udeb-"); ok {
+			info.Type = "Contents-udeb"
+			info.Architecture = arch
 		}
-		if strings.HasPrefix(filename, "Contents-") {
-			info.Architecture = strings.TrimPrefix(filename, "Contents-")
+		if len(pathParts) > 1 {
+			info.Component = strings.Join(pathParts[:len(pathParts)-1], "/")
 		}
 	} else if len(pathParts) >= 3 {
-		// Handle component-based files: main/binary-amd64/Packages.gz
-		info.Component = pathParts[0]
-
-		if strings.HasPrefix(pathParts[1], "binary-") {
-			info.Architecture = strings.TrimPrefix(pathParts[1], "binary-")
-		} else if pathParts[1] == "source" {
+		// Handle component-based files: main/binary-amd64/Packages.gz. Components can be nested,
+		// so the component is everything above the index directory.
+		dir := pathParts[len(pathParts)-2]
+		info.Component = strings.Join(pathParts[:len(pathParts)-2], "/")
+
+		if strings.HasPrefix(dir, "binary-") {
+			info.Architecture = strings.TrimPrefix(dir, "binary-")
+		} else if dir == "source" {
 			info.Architecture = "source"
 		}
 
-		filename := pathParts[len(pathParts)-1]
-		if info.Compressed {
-			filename = strings.TrimSuffix(filename, ".gz")
-		}
 		info.Type = filename
 	} else {
 		// Handle other files at root level
-		filename := pathParts[len(pathParts)-1]
-		if info.Compressed {
-			filename = strings.TrimSuffix(filename, ".gz")
-		}
 		info.Type = filename
 	}
 
@@ -1,10 +1,13 @@
 package deb822
 
 import (
+	"bytes"
 	"compress/gzip"
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -123,6 +126,28 @@ func TestHashEntryParsing(t *testing.T) {
 				{Hash: "8d5b8cd9009767eb059099f617762d8e", Size: 1645, Path: "non-free/binary-amd64/Packages.gz"},
 			},
 		},
+		{
+			name: "tab-separated fields",
+			lines: []string{
+				"4c195df3750b6fdb056bd98d18542d25\t4188\tnon-free/binary-amd64/Packages",
+				"8d5b8cd9009767eb059099f617762d8e \t 1645\t\tnon-free/binary-amd64/Packages.gz",
+			},
+			expected: []HashEntry{
+				{Hash: "4c195df3750b6fdb056bd98d18542d25", Size: 4188, Path: "non-free/binary-amd64/Packages"},
+				{Hash: "8d5b8cd9009767eb059099f617762d8e", Size: 1645, Path: "non-free/binary-amd64/Packages.gz"},
+			},
+		},
+		{
+			name: "path containing spaces",
+			lines: []string{
+				"4c195df3750b6fdb056bd98d18542d25 4188 main/i18n/Translation en",
+				"\t8d5b8cd9009767eb059099f617762d8e   1645   some dir/with  two spaces.gz  ",
+			},
+			expected: []HashEntry{
+				{Hash: "4c195df3750b6fdb056bd98d18542d25", Size: 4188, Path: "main/i18n/Translation en"},
+				{Hash: "8d5b8cd9009767eb059099f617762d8e", Size: 1645, Path: "some dir/with  two spaces.gz"},
+			},
+		},
 		{
 			name: "invalid format - missing fields",
 			lines: []string{
@@ -311,6 +336,85 @@ func TestFileInfoConsolidation(t *testing.T) {
 	t.Logf("Consolidated %d hash entries into %d FileInfo entries", totalHashEntries, len(files))
 }
 
+func TestFileInfoBestHash(t *testing.T) {
+	tests := []struct {
+		name string
+		fi   FileInfo
+		algo string
+		hash string
+	}{
+		{"all hashes", FileInfo{MD5: "m", SHA1: "s1", SHA256: "s256"}, "sha256", "s256"},
+		{"no SHA256", FileInfo{MD5: "m", SHA1: "s1"}, "sha1", "s1"},
+		{"MD5 only", FileInfo{MD5: "m"}, "md5", "m"},
+		{"no hashes", FileInfo{}, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			algo, hash := tt.fi.BestHash()
+			assert.Equal(t, tt.algo, algo)
+			assert.Equal(t, tt.hash, hash)
+		})
+	}
+}
+
+func TestFileInfoCompression(t *testing.T) {
+	tests := []struct {
+		path        string
+		fileType    string
+		compression string
+	}{
+		{"main/binary-amd64/Packages", "Packages", ""},
+		{"main/binary-amd64/Packages.gz", "Packages", ".gz"},
+		{"main/binary-amd64/Packages.bz2", "Packages", ".bz2"},
+		{"main/binary-amd64/Packages.xz", "Packages", ".xz"},
+		{"main/binary-amd64/Packages.zst", "Packages", ".zst"},
+		{"main/source/Sources.xz", "Sources", ".xz"},
+		{"Contents-amd64.bz2", "Contents", ".bz2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			info := parseFileInfo(HashEntry{Path: tt.path})
+			require.NotNil(t, info)
+			assert.Equal(t, tt.fileType, info.Type)
+			assert.Equal(t, tt.compression, info.Compression)
+			assert.Equal(t, tt.compression != "", info.Compressed)
+		})
+	}
+}
+
+func TestFileInfoContents(t *testing.T) {
+	tests := []struct {
+		path         string
+		fileType     string
+		component    string
+		architecture string
+		compression  string
+	}{
+		{"Contents-amd64", "Contents", "", "amd64", ""},
+		{"Contents-arm64.gz", "Contents", "", "arm64", ".gz"},
+		{"Contents-source.xz", "Contents", "", "source", ".xz"},
+		{"main/Contents-amd64", "Contents", "main", "amd64", ""},
+		{"main/Contents-amd64.gz", "Contents", "main", "amd64", ".gz"},
+		{"non-free/Contents-udeb-arm64.bz2", "Contents-udeb", "non-free", "arm64", ".bz2"},
+		{"Contents-udeb-amd64.gz", "Contents-udeb", "", "amd64", ".gz"},
+		{"stable/Contents-ppc64el.zst", "Contents", "stable", "ppc64el", ".zst"},
+		{"updates/main/Contents-amd64.gz", "Contents", "updates/main", "amd64", ".gz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			info := parseFileInfo(HashEntry{Path: tt.path})
+			require.NotNil(t, info)
+			assert.Equal(t, tt.fileType, info.Type)
+			assert.Equal(t, tt.component, info.Component)
+			assert.Equal(t, tt.architecture, info.Architecture)
+			assert.Equal(t, tt.compression, info.Compression)
+		})
+	}
+}
+
 func TestAllReleaseFiles(t *testing.T) {
 	// Test that all release files in testdata can be parsed
 	testdataDir := "testdata"
@@ -346,3 +450,159 @@ func TestAllReleaseFiles(t *testing.T) {
 		})
 	}
 }
+
+// parseReleaseFixture parses one of the gzipped Release files in testdata
+func parseReleaseFixture(t *testing.T, name string) *Release {
+	t.Helper()
+	releaseFile, err := os.Open(filepath.Join("testdata", name))
+	require.NoError(t, err)
+	defer releaseFile.Close()
+
+	gz, err := gzip.NewReader(releaseFile)
+	require.NoError(t, err)
+	defer gz.Close()
+
+	release, err := ParseRelease(gz)
+	require.NoError(t, err)
+	return release
+}
+
+// filePaths returns the sorted paths of a list of files
+func filePaths(files []FileInfo) []string {
+	var paths []string
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+func TestReleaseIndexAccessors(t *testing.T) {
+	docker := parseReleaseFixture(t, "docker-release.gz")
+	assert.Equal(t, []string{
+		"stable/binary-arm64/Packages",
+		"stable/binary-arm64/Packages.bz2",
+		"stable/binary-arm64/Packages.gz",
+	}, filePaths(docker.GetPackagesFiles("stable", "arm64")))
+	assert.Empty(t, docker.GetSourcesFiles("stable"))
+	assert.Empty(t, docker.GetTranslationFiles("stable", "en"))
+	// Docker's Contents files are under each component
+	assert.Len(t, docker.GetContentsFiles("amd64"), 9)
+
+	postgresql := parseReleaseFixture(t, "postgresql-release.gz")
+	assert.Equal(t, []string{
+		"main/source/Sources",
+		"main/source/Sources.bz2",
+		"main/source/Sources.gz",
+	}, filePaths(postgresql.GetSourcesFiles("main")))
+	assert.Empty(t, postgresql.GetSourcesFiles("contrib"))
+
+	brave := parseReleaseFixture(t, "brave-release.gz")
+	assert.Equal(t, []string{
+		"Contents-arm64",
+		"Contents-arm64.gz",
+		"main/Contents-arm64",
+		"main/Contents-arm64.gz",
+	}, filePaths(brave.GetContentsFiles("arm64")))
+	assert.Empty(t, brave.GetContentsFiles("source"))
+
+	release, err := ParseRelease(strings.NewReader(`Suite: stable
+Architectures: amd64
+Components: main
+Date: Mon, 09 Jun 2025 12:00:00 UTC
+SHA256:
+ e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855 0 main/i18n/Translation-en
+ e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855 0 main/i18n/Translation-en.bz2
+ e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855 0 main/i18n/Translation-de.bz2
+ e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855 0 contrib/i18n/Translation-en.bz2
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"main/i18n/Translation-en", "main/i18n/Translation-en.bz2"},
+		filePaths(release.GetTranslationFiles("main", "en")))
+	assert.Equal(t, []string{"main/i18n/Translation-de.bz2"}, filePaths(release.GetTranslationFiles("main", "de")))
+
+	// nested components, as in Debian's security archive and debian-installer, keep their full name
+	nested, err := ParseRelease(strings.NewReader(`Suite: stable
+Architectures: amd64
+Components: updates/main
+Date: Mon, 09 Jun 2025 12:00:00 UTC
+SHA256:
+ e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855 0 updates/main/binary-amd64/Packages.xz
+ e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855 0 updates/main/debian-installer/binary-amd64/Packages.xz
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"updates/main/binary-amd64/Packages.xz"}, filePaths(nested.GetPackagesFiles("updates/main", "amd64")))
+	assert.Equal(t, []string{"updates/main/debian-installer/binary-amd64/Packages.xz"},
+		filePaths(nested.GetPackagesFiles("updates/main/debian-installer", "amd64")))
+}
+
+func TestReleaseWrite_RoundTrip(t *testing.T) {
+	matches, err := filepath.Glob("testdata/*-release.gz")
+	require.NoError(t, err)
+	require.NotEmpty(t, matches)
+
+	for _, path := range matches {
+		name := filepath.Base(path)
+		t.Run(name, func(t *testing.T) {
+			release := parseReleaseFixture(t, name)
+
+			var buf bytes.Buffer
+			require.NoError(t, release.Write(&buf))
+			written, err := ParseRelease(&buf)
+			require.NoError(t, err)
+
+			assert.Equal(t, release.Fields(), written.Fields())
+			// the hash sections are reformatted, so only compare the parsed values
+			release.header, written.header = nil, nil
+			assert.Equal(t, release, written)
+		})
+	}
+}
+
+func TestReleaseWrite_Edited(t *testing.T) {
+	input := `Origin: Example
+Suite: stable
+Codename: bookworm
+Date: Sat, 27 Apr 2024 15:24:47 UTC
+Architectures: amd64 arm64
+Components: main
+NotAutomatic: no
+Description: an example archive
+SHA256:
+ fcb13e6a5ad1fbc5dd53fbe4bcb2e7b4f5b2ad48e7d5e2b8fe3a6d2f8e95d3c1             1234 main/binary-amd64/Packages
+ 0f9b8c4e6c5d1b0fa6e7d2c4b3a5e8f7d6c9b0a1e2f3d4c5b6a7e8f9d0c1b2a3             5678 main/binary-arm64/Packages
+`
+	release, err := ParseRelease(strings.NewReader(input))
+	require.NoError(t, err)
+
+	// drop arm64 and add an expiry
+	release.Architectures = []string{"amd64"}
+	release.SHA256 = release.SHA256[:1]
+	validUntil := time.Date(2024, 5, 4, 15, 24, 47, 0, time.UTC)
+	release.ValidUntil = &validUntil
+
+	var buf strings.Builder
+	require.NoError(t, release.Write(&buf))
+	// the new field goes where it belongs, after Date, rather than at the end
+	assert.Equal(t, `Origin: Example
+Suite: stable
+Codename: bookworm
+Date: Sat, 27 Apr 2024 15:24:47 UTC
+Valid-Until: Sat, 04 May 2024 15:24:47 UTC
+Architectures: amd64
+Components: main
+NotAutomatic: no
+Description: an example archive
+SHA256:
+ fcb13e6a5ad1fbc5dd53fbe4bcb2e7b4f5b2ad48e7d5e2b8fe3a6d2f8e95d3c1             1234 main/binary-amd64/Packages
+`, buf.String())
+
+	// fields that come before every field of the file go first
+	release, err = ParseRelease(strings.NewReader("Codename: bookworm\nDate: Sat, 27 Apr 2024 15:24:47 UTC\nArchitectures: amd64\nComponents: main\n"))
+	require.NoError(t, err)
+	release.Origin = "Example"
+	release.Version = "12.5"
+	buf.Reset()
+	require.NoError(t, release.Write(&buf))
+	assert.Equal(t, "Origin: Example\nVersion: 12.5\nCodename: bookworm\nDate: Sat, 27 Apr 2024 15:24:47 UTC\nArchitectures: amd64\nComponents: main\n", buf.String())
+}
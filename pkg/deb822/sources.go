@@ -0,0 +1,172 @@
+package deb822
+
+import (
+	"fmt"
+	"io"
+	"iter"
+	"slices"
+
+	"github.com/nicwaller/apt-look/pkg/rfc822"
+)
+
+// Source represents a single source package entry from an APT Sources file
+type Source struct {
+	// Mandatory fields
+	Package   string `json:"package"`
+	Directory string `json:"directory"`
+
+	// Highly recommended fields
+	Binary       []string `json:"binary,omitempty"`
+	Version      string   `json:"version,omitempty"`
+	Architecture string   `json:"architecture,omitempty"`
+	Format       string   `json:"format,omitempty"`
+
+	// Files that make up the source package, relative to Directory
+	Files           []HashEntry `json:"files,omitempty"` // MD5 checksums
+	ChecksumsSha1   []HashEntry `json:"checksums_sha1,omitempty"`
+	ChecksumsSha256 []HashEntry `json:"checksums_sha256,omitempty"`
+
+	// Control fields
+	Maintainer       string `json:"maintainer,omitempty"`
+	Uploaders        string `json:"uploaders,omitempty"`
+	Section          string `json:"section,omitempty"`
+	Priority         string `json:"priority,omitempty"`
+	Homepage         string `json:"homepage,omitempty"`
+	StandardsVersion string `json:"standards_version,omitempty"`
+	VcsBrowser       string `json:"vcs_browser,omitempty"`
+	VcsGit           string `json:"vcs_git,omitempty"`
+	Testsuite        string `json:"testsuite,omitempty"`
+
+	// Build dependency fields
+	BuildDepends      string `json:"build_depends,omitempty"`
+	BuildDependsIndep string `json:"build_depends_indep,omitempty"`
+	BuildDependsArch  string `json:"build_depends_arch,omitempty"`
+	BuildConflicts    string `json:"build_conflicts,omitempty"`
+
+	// Raw RFC822 header for access to non-standard fields
+	header rfc822.Header `json:"-"`
+}
+
+// ParseSources parses an APT Sources file and returns an iterator over Source entries
+func ParseSources(r io.Reader) iter.Seq2[*Source, error] {
+	return func(yield func(*Source, error) bool) {
+		for header, err := range ParseRecords(r) {
+			if err != nil {
+				yield(nil, fmt.Errorf("parsing sources file: %w", err))
+				return
+			}
+
+			src := &Source{header: header}
+			if err := src.parseFields(); err != nil {
+				yield(nil, fmt.Errorf("parsing source fields: %w", err))
+				return
+			}
+
+			if !yield(src, nil) {
+				return
+			}
+		}
+	}
+}
+
+// parseFields extracts and validates all fields from the RFC822 header
+func (s *Source) parseFields() error {
+	// Sources files use Package, while .dsc files use Source
+	s.Package = s.header.Get("Package")
+	if s.Package == "" {
+		s.Package = s.header.Get("Source")
+	}
+	if s.Package == "" {
+		return fmt.Errorf("source record must have Package field")
+	}
+
+	s.Directory = s.header.Get("Directory")
+	if s.Directory == "" {
+		return fmt.Errorf("source record %s must have Directory field", s.Package)
+	}
+
+	if binary := s.header.Get("Binary"); binary != "" {
+		s.Binary = parseDependencyList(binary)
+	}
+	s.Version = s.header.Get("Version")
+	s.Architecture = s.header.Get("Architecture")
+	s.Format = s.header.Get("Format")
+
+	var err error
+	if s.Files, err = parseHashEntries(s.header.GetLines("Files")); err != nil {
+		return fmt.Errorf("invalid Files field: %w", err)
+	}
+	if s.ChecksumsSha1, err = parseHashEntries(s.header.GetLines("Checksums-Sha1")); err != nil {
+		return fmt.Errorf("invalid Checksums-Sha1 field: %w", err)
+	}
+	if s.ChecksumsSha256, err = parseHashEntries(s.header.GetLines("Checksums-Sha256")); err != nil {
+		return fmt.Errorf("invalid Checksums-Sha256 field: %w", err)
+	}
+
+	s.Maintainer = s.header.Get("Maintainer")
+	s.Uploaders = s.header.Get("Uploaders")
+	s.Section = s.header.Get("Section")
+	s.Priority = s.header.Get("Priority")
+	s.Homepage = s.header.Get("Homepage")
+	s.StandardsVersion = s.header.Get("Standards-Version")
+	s.VcsBrowser = s.header.Get("Vcs-Browser")
+	s.VcsGit = s.header.Get("Vcs-Git")
+	s.Testsuite = s.header.Get("Testsuite")
+
+	s.BuildDepends = s.header.Get("Build-Depends")
+	s.BuildDependsIndep = s.header.Get("Build-Depends-Indep")
+	s.BuildDependsArch = s.header.Get("Build-Depends-Arch")
+	s.BuildConflicts = s.header.Get("Build-Conflicts")
+
+	return nil
+}
+
+// GetField returns the raw field value from the underlying RFC822 header
+func (s *Source) GetField(name string) string {
+	return s.header.Get(name)
+}
+
+// GetFieldLines returns the raw field value as separate lines, without unfolding
+func (s *Source) GetFieldLines(name string) []string {
+	return s.header.GetLines(name)
+}
+
+// HasField checks if a field exists in the underlying RFC822 header
+func (s *Source) HasField(name string) bool {
+	return s.header.Has(name)
+}
+
+// Fields returns all field names from the underlying RFC822 header
+func (s *Source) Fields() []string {
+	return s.header.Fields()
+}
+
+// SourceFile is one of the files that make up a source package, with each checksum listed for it
+type SourceFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	MD5    string `json:"md5,omitempty"`
+	SHA1   string `json:"sha1,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// SourceFiles returns the .dsc and the tarballs of the source package, relative to Directory,
+// combining the Files, Checksums-Sha1 and Checksums-Sha256 fields. Each field usually lists every
+// file, but any of them may be missing.
+func (s *Source) SourceFiles() []SourceFile {
+	var files []SourceFile
+	add := func(entries []HashEntry, set func(*SourceFile, string)) {
+		for _, entry := range entries {
+			i := slices.IndexFunc(files, func(f SourceFile) bool { return f.Name == entry.Path })
+			if i < 0 {
+				files = append(files, SourceFile{Name: entry.Path, Size: entry.Size})
+				i = len(files) - 1
+			}
+			set(&files[i], entry.Hash)
+		}
+	}
+	add(s.Files, func(f *SourceFile, hash string) { f.MD5 = hash })
+	add(s.ChecksumsSha1, func(f *SourceFile, hash string) { f.SHA1 = hash })
+	add(s.ChecksumsSha256, func(f *SourceFile, hash string) { f.SHA256 = hash })
+	return files
+}
@@ -0,0 +1,89 @@
+package deb822
+
+import (
+	"compress/gzip"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSources(t *testing.T) {
+	sourcesFile, err := os.Open("testdata/debian-sources.gz")
+	require.NoError(t, err)
+	defer sourcesFile.Close()
+
+	gz, err := gzip.NewReader(sourcesFile)
+	require.NoError(t, err)
+	defer gz.Close()
+
+	var sources []*Source
+	for src, err := range ParseSources(gz) {
+		require.NoError(t, err)
+		sources = append(sources, src)
+	}
+	require.Len(t, sources, 2)
+
+	hello := sources[0]
+	assert.Equal(t, "hello", hello.Package)
+	assert.Equal(t, []string{"hello"}, hello.Binary)
+	assert.Equal(t, "2.10-3", hello.Version)
+	assert.Equal(t, "any", hello.Architecture)
+	assert.Equal(t, "3.0 (quilt)", hello.Format)
+	assert.Equal(t, "pool/main/h/hello", hello.Directory)
+	assert.Equal(t, "devel", hello.Section)
+	assert.Equal(t, "https://salsa.debian.org/sanvila/hello.git", hello.VcsGit)
+	assert.Equal(t, "debhelper-compat (= 13)", hello.BuildDepends)
+	assert.Equal(t, "autopkgtest", hello.Testsuite)
+
+	require.Len(t, hello.Files, 3)
+	assert.Equal(t, HashEntry{Hash: "6d8a8c34dbf5e4d5f3c1b9a1cb2a0f7e", Size: 1329, Path: "hello_2.10-3.dsc"}, hello.Files[0])
+	require.Len(t, hello.ChecksumsSha256, 3)
+	assert.Equal(t, "hello_2.10.orig.tar.gz", hello.ChecksumsSha256[1].Path)
+	assert.Equal(t, int64(725946), hello.ChecksumsSha256[1].Size)
+	assert.Empty(t, hello.ChecksumsSha1)
+
+	files := hello.SourceFiles()
+	require.Len(t, files, 3)
+	assert.Equal(t, "hello_2.10-3.dsc", files[0].Name)
+	assert.Equal(t, "6d8a8c34dbf5e4d5f3c1b9a1cb2a0f7e", files[0].MD5)
+	assert.Equal(t, hello.ChecksumsSha256[0].Hash, files[0].SHA256)
+	assert.Equal(t, SourceFile{
+		Name:   "hello_2.10.orig.tar.gz",
+		Size:   725946,
+		MD5:    hello.Files[1].Hash,
+		SHA256: hello.ChecksumsSha256[1].Hash,
+	}, files[1])
+
+	// Fields without a dedicated struct member are still available
+	assert.True(t, hello.HasField("Package-List"))
+
+	utilLinux := sources[1]
+	assert.Equal(t, []string{"util-linux", "util-linux-extra", "fdisk", "mount", "bsdutils"}, utilLinux.Binary)
+	assert.Equal(t, "Chris Hofstaedtler <zeha@debian.org>", utilLinux.Uploaders)
+	assert.Equal(t, "any all", utilLinux.Architecture)
+}
+
+func TestParseSourcesInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{"missing package", "Version: 1.0\nDirectory: pool/main/x/x\n", "must have Package field"},
+		{"missing directory", "Package: x\nVersion: 1.0\n", "must have Directory field"},
+		{"bad checksum line", "Package: x\nDirectory: pool/main/x/x\nChecksums-Sha256:\n abc x_1.0.dsc\n", "invalid Checksums-Sha256 field"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var parseErr error
+			for _, err := range ParseSources(strings.NewReader(tt.input)) {
+				parseErr = err
+			}
+			assert.ErrorContains(t, parseErr, tt.wantErr)
+		})
+	}
+}
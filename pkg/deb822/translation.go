@@ -0,0 +1,92 @@
+package deb822
+
+import (
+	"fmt"
+	"io"
+	"iter"
+	"strings"
+
+	"github.com/nicwaller/apt-look/pkg/rfc822"
+)
+
+// Translation represents a single entry from an APT i18n Translation file,
+// which carries the long description of a package in one language
+type Translation struct {
+	// Mandatory fields
+	Package        string `json:"package"`
+	DescriptionMd5 string `json:"description_md5"`
+
+	// Language is taken from the Description-<lang> field name, e.g. "en" or "pt_BR"
+	Language    string `json:"language,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	// Raw RFC822 header for access to non-standard fields
+	header rfc822.Header `json:"-"`
+}
+
+// ParseTranslations parses an APT Translation file and returns an iterator over Translation entries
+func ParseTranslations(r io.Reader) iter.Seq2[*Translation, error] {
+	return func(yield func(*Translation, error) bool) {
+		for header, err := range ParseRecords(r) {
+			if err != nil {
+				yield(nil, fmt.Errorf("parsing translation file: %w", err))
+				return
+			}
+
+			tr := &Translation{header: header}
+			if err := tr.parseFields(); err != nil {
+				yield(nil, fmt.Errorf("parsing translation fields: %w", err))
+				return
+			}
+
+			if !yield(tr, nil) {
+				return
+			}
+		}
+	}
+}
+
+// parseFields extracts and validates all fields from the RFC822 header
+func (t *Translation) parseFields() error {
+	t.Package = t.header.Get("Package")
+	if t.Package == "" {
+		return fmt.Errorf("translation record must have Package field")
+	}
+
+	t.DescriptionMd5 = t.header.Get("Description-md5")
+	if t.DescriptionMd5 == "" {
+		return fmt.Errorf("translation record %s must have Description-md5 field", t.Package)
+	}
+
+	for _, field := range t.header.Fields() {
+		lang, ok := strings.CutPrefix(field, "Description-")
+		if !ok || strings.EqualFold(lang, "md5") {
+			continue
+		}
+		t.Language = lang
+		t.Description = t.header.Get(field)
+		break
+	}
+
+	return nil
+}
+
+// GetField returns the raw field value from the underlying RFC822 header
+func (t *Translation) GetField(name string) string {
+	return t.header.Get(name)
+}
+
+// GetFieldLines returns the raw field value as separate lines, without unfolding
+func (t *Translation) GetFieldLines(name string) []string {
+	return t.header.GetLines(name)
+}
+
+// HasField checks if a field exists in the underlying RFC822 header
+func (t *Translation) HasField(name string) bool {
+	return t.header.Has(name)
+}
+
+// Fields returns all field names from the underlying RFC822 header
+func (t *Translation) Fields() []string {
+	return t.header.Fields()
+}
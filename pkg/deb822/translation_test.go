@@ -0,0 +1,64 @@
+package deb822
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTranslations(t *testing.T) {
+	translations := `Package: hello
+Description-md5: 6aa7a5b2e11e8ec8b8ab5e5c8e4a3bf5
+Description-en: example package based on GNU hello
+ The GNU hello program produces a familiar, friendly greeting.
+ .
+ Seriously, though: this is an example of how to do a Debian package.
+
+Package: bash
+Description-md5: 3522aa7b4374048d6450e348a5bb45d9
+Description-de: GNU Bourne Again SHell
+ Bash ist ein sh-kompatibler Befehlsinterpreter.
+`
+
+	var entries []*Translation
+	for tr, err := range ParseTranslations(strings.NewReader(translations)) {
+		require.NoError(t, err)
+		entries = append(entries, tr)
+	}
+	require.Len(t, entries, 2)
+
+	hello := entries[0]
+	assert.Equal(t, "hello", hello.Package)
+	assert.Equal(t, "6aa7a5b2e11e8ec8b8ab5e5c8e4a3bf5", hello.DescriptionMd5)
+	assert.Equal(t, "en", hello.Language)
+	assert.Contains(t, hello.Description, "example package based on GNU hello")
+	assert.Contains(t, hello.Description, "familiar, friendly greeting")
+	assert.Len(t, hello.GetFieldLines("Description-en"), 4)
+
+	bash := entries[1]
+	assert.Equal(t, "de", bash.Language)
+	assert.Contains(t, bash.Description, "Befehlsinterpreter")
+}
+
+func TestParseTranslationsInvalid(t *testing.T) {
+	tests := []struct {
+		name         string
+		translations string
+		wantErr      string
+	}{
+		{name: "missing package", translations: "Description-md5: abc\nDescription-en: text\n", wantErr: "must have Package field"},
+		{name: "missing md5", translations: "Package: hello\nDescription-en: text\n", wantErr: "must have Description-md5 field"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lastErr error
+			for _, err := range ParseTranslations(strings.NewReader(tt.translations)) {
+				lastErr = err
+			}
+			assert.ErrorContains(t, lastErr, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package deb822
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a parsed Debian package version of the form [epoch:]upstream_version[-debian_revision], see
+// https://www.debian.org/doc/debian-policy/ch-controlfields.html#version
+type Version struct {
+	Epoch    int
+	Upstream string
+	Revision string
+}
+
+// ParseVersion parses and validates a Debian version string
+func ParseVersion(s string) (Version, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Version{}, fmt.Errorf("version string is empty")
+	}
+
+	var v Version
+	rest := s
+	if i := strings.IndexByte(rest, ':'); i >= 0 {
+		epoch, err := strconv.Atoi(rest[:i])
+		if err != nil || epoch < 0 {
+			return Version{}, fmt.Errorf("invalid epoch in version %q", s)
+		}
+		v.Epoch = epoch
+		rest = rest[i+1:]
+	}
+
+	// The revision is everything after the last hyphen; upstream versions may contain hyphens
+	if i := strings.LastIndexByte(rest, '-'); i >= 0 {
+		v.Revision = rest[i+1:]
+		rest = rest[:i]
+		if v.Revision == "" {
+			return Version{}, fmt.Errorf("empty revision in version %q", s)
+		}
+	}
+	v.Upstream = rest
+
+	if v.Upstream == "" {
+		return Version{}, fmt.Errorf("empty upstream version in %q", s)
+	}
+	if !isDigit(v.Upstream[0]) {
+		return Version{}, fmt.Errorf("upstream version in %q must start with a digit", s)
+	}
+	if i := strings.IndexFunc(v.Upstream, invalidVersionRune(".+~-:")); i >= 0 {
+		return Version{}, fmt.Errorf("invalid character %q in upstream version %q", v.Upstream[i], s)
+	}
+	if i := strings.IndexFunc(v.Revision, invalidVersionRune(".+~")); i >= 0 {
+		return Version{}, fmt.Errorf("invalid character %q in revision %q", v.Revision[i], s)
+	}
+
+	return v, nil
+}
+
+// invalidVersionRune returns a predicate matching characters other than alphanumerics and allowed
+func invalidVersionRune(allowed string) func(rune) bool {
+	return func(r rune) bool {
+		if r < 0x80 && (isDigit(byte(r)) || isAlpha(byte(r))) {
+			return false
+		}
+		return !strings.ContainsRune(allowed, r)
+	}
+}
+
+// Compare returns a negative number if v < other, zero if they are equal, and a positive number if v > other
+func (v Version) Compare(other Version) int {
+	if v.Epoch != other.Epoch {
+		if v.Epoch < other.Epoch {
+			return -1
+		}
+		return 1
+	}
+	if c := compareVersionPart(v.Upstream, other.Upstream); c != 0 {
+		return c
+	}
+	return compareVersionPart(v.Revision, other.Revision)
+}
+
+// String formats the version in its canonical form, omitting a zero epoch and empty revision
+func (v Version) String() string {
+	var sb strings.Builder
+	if v.Epoch != 0 {
+		sb.WriteString(strconv.Itoa(v.Epoch))
+		sb.WriteByte(':')
+	}
+	sb.WriteString(v.Upstream)
+	if v.Revision != "" {
+		sb.WriteByte('-')
+		sb.WriteString(v.Revision)
+	}
+	return sb.String()
+}
+
+// CompareVersions compares two Debian package version strings using dpkg ordering rules.
+// It returns a negative number if a < b, zero if a == b, and a positive number if a > b.
+// Malformed versions are compared on a best-effort basis rather than rejected,
+// because real-world Packages files occasionally contain them.
+func CompareVersions(a, b string) int {
+	return splitVersion(a).Compare(splitVersion(b))
+}
+
+// splitVersion breaks a version string into its parts without validation
+func splitVersion(s string) Version {
+	var v Version
+	rest := strings.TrimSpace(s)
+	if i := strings.IndexByte(rest, ':'); i >= 0 {
+		if e, err := strconv.Atoi(rest[:i]); err == nil {
+			v.Epoch = e
+			rest = rest[i+1:]
+		}
+	}
+	if i := strings.LastIndexByte(rest, '-'); i >= 0 {
+		v.Revision = rest[i+1:]
+		rest = rest[:i]
+	}
+	v.Upstream = rest
+	return v
+}
+
+// compareVersionPart implements the dpkg comparison for upstream versions and revisions.
+// Strings are compared as alternating runs of non-digits (compared lexically with
+// letters sorting before non-letters and '~' sorting before everything) and digits
+// (compared numerically).
+func compareVersionPart(a, b string) int {
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		// Compare the non-digit prefix
+		for (i < len(a) && !isDigit(a[i])) || (j < len(b) && !isDigit(b[j])) {
+			ac, bc := 0, 0
+			if i < len(a) {
+				ac = versionCharOrder(a[i])
+			}
+			if j < len(b) {
+				bc = versionCharOrder(b[j])
+			}
+			if ac != bc {
+				return ac - bc
+			}
+			i++
+			j++
+		}
+
+		// Skip leading zeros
+		for i < len(a) && a[i] == '0' {
+			i++
+		}
+		for j < len(b) && b[j] == '0' {
+			j++
+		}
+
+		// Compare the numeric part; a longer run of digits is larger
+		firstDiff := 0
+		for i < len(a) && isDigit(a[i]) && j < len(b) && isDigit(b[j]) {
+			if firstDiff == 0 {
+				firstDiff = int(a[i]) - int(b[j])
+			}
+			i++
+			j++
+		}
+		if i < len(a) && isDigit(a[i]) {
+			return 1
+		}
+		if j < len(b) && isDigit(b[j]) {
+			return -1
+		}
+		if firstDiff != 0 {
+			return firstDiff
+		}
+	}
+	return 0
+}
+
+// versionCharOrder returns the sort weight of a non-digit version character
+func versionCharOrder(c byte) int {
+	switch {
+	case isDigit(c):
+		return 0
+	case isAlpha(c):
+		return int(c)
+	case c == '~':
+		return -1
+	default:
+		return int(c) + 256
+	}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,156 @@
+package deb822
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Version
+	}{
+		{"1.0", Version{Upstream: "1.0"}},
+		{"1.0-1", Version{Upstream: "1.0", Revision: "1"}},
+		{"1:2.4.1-1ubuntu1", Version{Epoch: 1, Upstream: "2.4.1", Revision: "1ubuntu1"}},
+		{"2.30-0ubuntu2.1", Version{Upstream: "2.30", Revision: "0ubuntu2.1"}},
+		{"1.2-3-4", Version{Upstream: "1.2-3", Revision: "4"}},
+		{"1:1.2.60.564.gcc6305cb", Version{Epoch: 1, Upstream: "1.2.60.564.gcc6305cb"}},
+		{"2:1.0~rc1+dfsg", Version{Epoch: 2, Upstream: "1.0~rc1+dfsg"}},
+		{"1:2:3-1", Version{Epoch: 1, Upstream: "2:3", Revision: "1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			v, err := ParseVersion(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, v)
+			assert.Equal(t, tt.input, v.String())
+		})
+	}
+}
+
+func TestParseVersionInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"empty", ""},
+		{"whitespace only", "   "},
+		{"non-numeric epoch", "a:1.0"},
+		{"negative epoch", "-1:1.0"},
+		{"empty upstream", "1:-1"},
+		{"empty revision", "1.0-"},
+		{"upstream starts with letter", "v1.0"},
+		{"invalid character in upstream", "1.0_beta"},
+		{"invalid character in revision", "1.0-1:2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseVersion(tt.input)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     string
+		expected int
+	}{
+		// Equality
+		{"identical", "1.0", "1.0", 0},
+		{"zero epoch is implicit", "0:1.0-1", "1.0-1", 0},
+		{"leading zeros are ignored", "1.01", "1.1", 0},
+		{"missing revision equals empty", "1.0", "1.0-", 0},
+
+		// Epochs
+		{"epoch takes precedence", "1:2.4.1-1ubuntu1", "2.4.1-1ubuntu1", 1},
+		{"epoch beats larger upstream", "1:1.0", "9.9", 1},
+		{"epochs compare numerically", "10:1.0", "9:1.0", 1},
+
+		// Upstream version
+		{"numeric parts compared numerically", "2.4.10-1", "2.4.2-1", 1},
+		{"longer numeric run is larger", "1.100", "1.99", 1},
+		{"extra component is larger", "1.0.1", "1.0", 1},
+		{"plus sorts after end of string", "2.4.1+dfsg-1", "2.4.1-1", 1},
+		{"letters sort before non-letters", "1.0a", "1.0+", -1},
+		{"uppercase sorts before lowercase", "1.0A", "1.0a", -1},
+		{"alphanumeric after numeric", "1.0a", "1.0", 1},
+		{"purely numeric vs alphanumeric segment", "1.2", "1.a", -1},
+
+		// Tilde pre-releases
+		{"tilde sorts before release", "1.0~rc1", "1.0", -1},
+		{"tilde sorts before empty string", "1.0~", "1.0", -1},
+		{"double tilde sorts before single", "1.0~~", "1.0~", -1},
+		{"tilde pre-release ordering", "1.0~rc1", "1.0~rc2", -1},
+		{"tilde beta before rc", "1.0~beta1", "1.0~rc1", -1},
+		{"tilde with revision", "1.0~rc1-1", "1.0-1", -1},
+		{"tilde in revision", "1.0-1~bpo1", "1.0-1", -1},
+
+		// Debian revision
+		{"revision comparison", "2.4.1-1ubuntu2", "2.4.1-1ubuntu1", 1},
+		{"revision numeric", "1.0-10", "1.0-9", 1},
+		{"no revision before revision", "1.0", "1.0-1", -1},
+		{"hyphenated upstream", "1.2-3-4", "1.2-3-3", 1},
+
+		// Malformed versions are still ordered
+		{"malformed upstream", "v2", "v1", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, sign(CompareVersions(tt.a, tt.b)), "%s vs %s", tt.a, tt.b)
+			assert.Equal(t, -tt.expected, sign(CompareVersions(tt.b, tt.a)), "%s vs %s", tt.b, tt.a)
+		})
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	a, err := ParseVersion("1:1.21.4-1")
+	require.NoError(t, err)
+	b, err := ParseVersion("1.21.10-1")
+	require.NoError(t, err)
+
+	assert.Positive(t, a.Compare(b))
+	assert.Negative(t, b.Compare(a))
+	assert.Zero(t, a.Compare(a))
+}
+
+func TestCompareVersionsSorting(t *testing.T) {
+	versions := []string{
+		"1.21.5-1ubuntu1",
+		"1:1.21.4-1",
+		"1.21.5-1ubuntu2",
+		"1.21.10-1",
+		"1.21.5~rc1-1",
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return CompareVersions(versions[i], versions[j]) > 0
+	})
+
+	assert.Equal(t, []string{
+		"1:1.21.4-1",
+		"1.21.10-1",
+		"1.21.5-1ubuntu2",
+		"1.21.5-1ubuntu1",
+		"1.21.5~rc1-1",
+	}, versions)
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	default:
+		return 0
+	}
+}
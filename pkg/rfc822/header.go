@@ -60,6 +60,7 @@ func (h Header) Fields() []string {
 	return fields
 }
 
+// Write serializes the header with continuation lines indented by one space
 func (h Header) Write(writer io.Writer) (int, error) {
 	if len(h) == 0 {
 		return 0, nil
@@ -68,11 +69,15 @@ func (h Header) Write(writer io.Writer) (int, error) {
 	var sb strings.Builder
 	for _, field := range h {
 		sb.WriteString(field.Name)
-		sb.WriteString(": ")
+		sb.WriteString(":")
 
 		// Handle multi-line values
 		if len(field.Value) > 0 {
-			sb.WriteString(field.Value[0])
+			// fields like MD5Sum start their value on the next line
+			if field.Value[0] != "" {
+				sb.WriteString(" ")
+				sb.WriteString(field.Value[0])
+			}
 			sb.WriteString("\n")
 
 			// Add continuation lines with proper indentation